@@ -0,0 +1,37 @@
+// Command contentcheck validates the content directory the server loads,
+// printing every problem it finds and exiting non-zero on errors so content
+// changes can be gated before they are merged
+package main
+
+import (
+	"flag"
+	"fmt"
+	"golang-mmo-server/internal/game"
+	"os"
+)
+
+func main() {
+	dir := flag.String("content", "./content", "content directory to check")
+	strict := flag.Bool("strict", false, "fail on warnings as well as errors")
+	quiet := flag.Bool("quiet", false, "only print errors")
+	flag.Parse()
+
+	if info, err := os.Stat(*dir); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "contentcheck: %s is not a content directory\n", *dir)
+		os.Exit(2)
+	}
+
+	report := game.CheckContent(*dir)
+	for _, problem := range report.Problems {
+		if *quiet && problem.Severity != game.SeverityError {
+			continue
+		}
+		fmt.Println(problem)
+	}
+
+	errors, warnings := report.Errors(), report.Warnings()
+	fmt.Printf("%s: %d error(s), %d warning(s)\n", *dir, errors, warnings)
+	if errors > 0 || *strict && warnings > 0 {
+		os.Exit(1)
+	}
+}
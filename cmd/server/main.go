@@ -1,13 +1,20 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"golang-mmo-server/internal/auth"
 	"golang-mmo-server/internal/config"
+	"golang-mmo-server/internal/game"
 	"golang-mmo-server/internal/network"
 	"golang-mmo-server/internal/routes"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -24,32 +31,99 @@ const (
 )
 
 func main() {
-	printWelcomeBanner()
+	cfg, options, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		printError("❌ " + err.Error())
+		os.Exit(2)
+	}
+	if options.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	cfg := config.LoadConfig()
+	printWelcomeBanner()
 
+	if options.File != "" {
+		printInfo("🔧 Configuration read from " + options.File)
+	}
 	printInfo("🔧 Initializing services...")
 
-	authService, err := auth.NewAuthService("./data/users.db")
+	authService, err := auth.NewAuthService(cfg.UsersDatabase, cfg.SessionLifetime())
 	if err != nil {
 		printError("❌ Failed to initialize auth service: " + err.Error())
 		log.Fatal(err)
 	}
 
-	hub := network.NewHub()
+	content, err := game.LoadContent(cfg.ContentDir)
+	if err != nil {
+		printError("❌ Failed to load game content: " + err.Error())
+		log.Fatal(err)
+	}
+
+	gameDB, err := game.NewDatabase(cfg.GameDatabase)
+	if err != nil {
+		printError("❌ Failed to open game database: " + err.Error())
+		log.Fatal(err)
+	}
+
+	settings := game.DefaultSettings()
+	settings.TickInterval = cfg.TickInterval()
+	settings.AOIRadius = cfg.AOIRadius
+	settings.InteractionRange = cfg.InteractionRadius
+	settings.ScriptTickBudget = cfg.ScriptTickBudget()
+	zones, err := game.NewZoneManager(content, gameDB, settings)
+	if err != nil {
+		printError("❌ Failed to create zones: " + err.Error())
+		log.Fatal(err)
+	}
+
+	zones.MaxInstances = cfg.MaxInstances
+	zones.Clock.SetDayLength(time.Duration(cfg.DayLengthMinutes)*time.Minute, time.Now())
+
+	if err := zones.EnablePlugins(cfg.Plugins); err != nil {
+		printError("❌ Failed to enable plugins: " + err.Error())
+		log.Fatal(err)
+	}
+
+	hub := network.NewHub(zones, authService)
+	hub.MessagesPerSecond = cfg.MessagesPerSecond
+	hub.MessageBurst = cfg.MessageBurst
 
 	printSuccess("✅ Authentication service initialized with database")
+	for _, zone := range zones.Zones() {
+		printSuccess(fmt.Sprintf("✅ Zone %s loaded (%dx%d tiles, %d NPCs)", zone.Name, zone.Map.Width, zone.Map.Height, len(zone.NPCs)))
+	}
+	printSuccess(fmt.Sprintf("✅ %d instance templates loaded (max %d running)", len(content.Instances), zones.MaxInstances))
+	printSuccess(fmt.Sprintf("✅ %d quests loaded", len(content.Quests)))
+	printSuccess(fmt.Sprintf("✅ %d dialogues loaded", len(content.Dialogues)))
+	printSuccess(fmt.Sprintf("✅ %d shops loaded", len(content.Shops)))
+	printSuccess(fmt.Sprintf("✅ %d resource nodes and %d recipes loaded", len(content.Resources), len(content.Recipes)))
+	printSuccess(fmt.Sprintf("✅ %d abilities and %d status effects loaded", len(content.Abilities), len(content.Statuses)))
+	printSuccess(fmt.Sprintf("✅ %d scripts loaded (reloaded on change)", len(content.Scripts.Names())))
+	printSuccess(fmt.Sprintf("✅ World clock running (%v per day)", zones.Clock.DayLength()))
+	if zones.Auctions != nil {
+		printSuccess("✅ Auction house and mail opened")
+	}
+	if enabled := zones.Extensions.Plugins(); len(enabled) > 0 {
+		printSuccess(fmt.Sprintf("✅ Plugins enabled: %s", strings.Join(enabled, ", ")))
+	}
 	printSuccess("✅ Network hub created")
 
 	printInfo("🚀 Starting background services...")
 	go hub.Run()
-	hub.GetWorld().StartGameLoop()
+	zones.StartGameLoops()
+	go reloadContentOnSignal(zones)
 
 	printSuccess("✅ Network hub running")
-	printSuccess("✅ Game world loop started")
+	printSuccess("✅ Zone game loops started")
 
 	printInfo("🌐 Setting up routes...")
-	router := routes.NewRouter(authService, hub)
+	router := routes.NewRouter(authService, hub, cfg)
 	router.SetupRoutes()
 
 	printSuccess("✅ Routes configured")
@@ -64,6 +138,26 @@ func main() {
 	}
 }
 
+// reloadContentOnSignal reloads the game content every time the server
+// receives SIGHUP
+func reloadContentOnSignal(zones *game.ZoneManager) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		printInfo("🔄 Reloading content...")
+		diff, err := zones.ReloadContent()
+		if err != nil {
+			printError("❌ Content reload failed, keeping the current content: " + err.Error())
+			continue
+		}
+		printSuccess("✅ Content reloaded: " + diff.String())
+		for _, line := range diff.Lines() {
+			printInfo("   " + line)
+		}
+	}
+}
+
 // printWelcomeBanner displays the MMORPG server ASCII banner
 func printWelcomeBanner() {
 	banner := `
@@ -112,6 +206,10 @@ func printServerInfo(cfg *config.Config) {
 		{"POST", "/api/auth/logout", "User logout"},
 		{"GET", "/api/auth/verify", "Token verification"},
 		{"WS", "/ws", "WebSocket game connection"},
+		{"GET", "/api/game/status", "Server, zone and instance status"},
+		{"GET", "/api/game/leaderboards", "Statistic leaderboards by season"},
+		{"GET", "/api/plugins/*", "Routes added by enabled plugins"},
+		{"POST", "/api/admin/content/reload", "Reload content (admin token)"},
 		{"GET", "/api/game/world/state", "Get world state"},
 		{"POST", "/api/game/player/action", "Player actions"},
 	}
@@ -0,0 +1,7 @@
+package main
+
+// Plugins compiled into the server. Importing a plugin package registers
+// it; the plugins list of the config decides which ones are enabled
+import (
+	_ "golang-mmo-server/plugins/emotes"
+)
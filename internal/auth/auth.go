@@ -26,10 +26,13 @@ type Session struct {
 }
 
 type AuthService struct {
-	db *Database
+	db              *Database
+	sessionLifetime time.Duration
 }
 
-func NewAuthService(dbPath string) (*AuthService, error) {
+// NewAuthService opens the account database; logins stay valid for the
+// session lifetime
+func NewAuthService(dbPath string, sessionLifetime time.Duration) (*AuthService, error) {
 	db, err := NewDatabase(dbPath)
 	if err != nil {
 		return nil, err
@@ -43,7 +46,7 @@ func NewAuthService(dbPath string) (*AuthService, error) {
 		}
 	}()
 
-	return &AuthService{db: db}, nil
+	return &AuthService{db: db, sessionLifetime: sessionLifetime}, nil
 }
 
 func (as *AuthService) Register(username, email, password string) (*User, error) {
@@ -95,7 +98,7 @@ func (as *AuthService) Login(username, password string) (*Session, error) {
 		UserID:   user.ID,
 		Username: user.Username,
 		Created:  time.Now(),
-		Expires:  time.Now().Add(24 * time.Hour), // 24 hour sessions
+		Expires:  time.Now().Add(as.sessionLifetime),
 	}
 
 	if err := as.db.CreateSession(session); err != nil {
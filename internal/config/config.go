@@ -1,15 +1,185 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Config holds the server settings. Each one is taken from, in increasing
+// order of precedence, the defaults, the config file, an MMO_<KEY>
+// environment variable and a --<key> command-line flag, where the key is
+// the setting's JSON name and flags use dashes instead of underscores
 type Config struct {
-	Host        string `json:"host"`
-	Port        int    `json:"port"`
-	DatabaseURL string `json:"database_url"`
-	RedisURL    string `json:"redis_url"`
-	LogLevel    string `json:"log_level"`
+	Host string `json:"host" usage:"address to listen on"`
+	Port int    `json:"port" usage:"port to listen on"`
+
+	UsersDatabase string `json:"users_database" usage:"SQLite file accounts and sessions are kept in"`
+	GameDatabase  string `json:"game_database" usage:"SQLite file characters and the world are kept in"`
+	ContentDir    string `json:"content_dir" usage:"directory the game content is loaded from"`
+
+	TickMilliseconds         int     `json:"tick_ms" usage:"milliseconds between two updates of a zone"`
+	AOIRadius                float64 `json:"aoi_radius" usage:"how far away players see other players and NPCs"`
+	InteractionRadius        float64 `json:"interaction_radius" usage:"how close players must stand to NPCs to talk, trade and hand in quests"`
+	MaxInstances             int     `json:"max_instances" usage:"most dungeon instances running at once"`
+	DayLengthMinutes         int     `json:"day_length_minutes" usage:"real minutes a game day lasts"`
+	ScriptBudgetMilliseconds int     `json:"script_budget_ms" usage:"milliseconds a zone spends running scripts per tick; the rest wait for the next"`
+
+	SessionHours          int     `json:"session_hours" usage:"hours a login stays valid"`
+	MessagesPerSecond     float64 `json:"messages_per_second" usage:"messages a connection may send per second, 0 for no limit"`
+	MessageBurst          int     `json:"message_burst" usage:"messages a connection may send in a burst above that rate"`
+	AuthRequestsPerMinute int     `json:"auth_requests_per_minute" usage:"logins and registrations per client address per minute, 0 for no limit"`
+
+	Plugins    []string `json:"plugins" usage:"compiled-in plugins to enable, in order"`
+	AdminToken string   `json:"admin_token" usage:"token guarding the admin endpoints, which are off while it is empty"`
+}
+
+const (
+	// EnvPrefix starts the environment variables that override settings
+	EnvPrefix = "MMO_"
+	// DefaultFile is the config file read when none is named; unlike a
+	// named one it may be missing
+	DefaultFile = "config.json"
+)
+
+// Default returns the settings used when nothing overrides them
+func Default() *Config {
+	return &Config{
+		Host:                     "localhost",
+		Port:                     8080,
+		UsersDatabase:            "./data/users.db",
+		GameDatabase:             "./data/game.db",
+		ContentDir:               "./content",
+		TickMilliseconds:         100,
+		AOIRadius:                1000,
+		InteractionRadius:        96,
+		MaxInstances:             50,
+		DayLengthMinutes:         24,
+		ScriptBudgetMilliseconds: 20,
+		SessionHours:             24,
+		MessagesPerSecond:        200,
+		MessageBurst:             400,
+		AuthRequestsPerMinute:    20,
+		Plugins:                  []string{"emotes"},
+	}
+}
+
+// Options are the command-line flags that are not settings
+type Options struct {
+	// File is the config file the settings were read from, if any
+	File string
+	// PrintConfig asks for the settings to be printed instead of starting
+	PrintConfig bool
+}
+
+// Load builds the configuration from the defaults, the config file
+// (--config or MMO_CONFIG, config.json otherwise), the environment and the
+// command-line arguments, and validates the result
+func Load(args []string) (*Config, Options, error) {
+	var options Options
+	cfg := Default()
+	fields := cfg.fields()
+
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	flags.StringVar(&options.File, "config", os.Getenv(EnvPrefix+"CONFIG"), "config file, JSON or key: value lines (default "+DefaultFile+" if present)")
+	flags.BoolVar(&options.PrintConfig, "print-config", false, "print the resulting configuration and exit")
+	set := make(map[string]string)
+	for _, field := range fields {
+		key, usage := field.key, field.usage
+		if !field.value.IsZero() {
+			usage += fmt.Sprintf(" (default %v)", field.value.Interface())
+		}
+		flags.Func(strings.ReplaceAll(key, "_", "-"), usage, func(value string) error {
+			set[key] = value
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, options, err
+	}
+	if flags.NArg() > 0 {
+		return nil, options, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	file, required := options.File, true
+	if file == "" {
+		file, required = DefaultFile, false
+	}
+	data, err := os.ReadFile(file)
+	switch {
+	case err == nil:
+		if err := cfg.readFile(file, data); err != nil {
+			return nil, options, fmt.Errorf("%s: %w", file, err)
+		}
+		options.File = file
+	case !errors.Is(err, os.ErrNotExist) || required:
+		return nil, options, err
+	}
+
+	for _, field := range fields {
+		name := EnvPrefix + strings.ToUpper(field.key)
+		if value, exists := os.LookupEnv(name); exists {
+			if err := field.set(value); err != nil {
+				return nil, options, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+
+	for _, field := range fields {
+		if value, exists := set[field.key]; exists {
+			if err := field.set(value); err != nil {
+				return nil, options, fmt.Errorf("--%s: %w", strings.ReplaceAll(field.key, "_", "-"), err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, options, err
+	}
+	return cfg, options, nil
+}
+
+// Validate checks that every setting is usable, reporting all that are not
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port <= 65535, "port %d is not between 1 and 65535", c.Port)
+	check(c.UsersDatabase != "", "users_database is empty")
+	check(c.GameDatabase != "", "game_database is empty")
+	check(c.UsersDatabase == "" || c.UsersDatabase != c.GameDatabase, "users_database and game_database are the same file")
+	check(c.ContentDir != "", "content_dir is empty")
+	check(c.TickMilliseconds >= 10 && c.TickMilliseconds <= 1000, "tick_ms %d is not between 10 and 1000", c.TickMilliseconds)
+	check(c.AOIRadius > 0, "aoi_radius must be positive")
+	check(c.InteractionRadius > 0, "interaction_radius must be positive")
+	check(c.InteractionRadius <= c.AOIRadius, "interaction_radius %g is beyond aoi_radius %g", c.InteractionRadius, c.AOIRadius)
+	check(c.MaxInstances >= 0, "max_instances must not be negative")
+	check(c.DayLengthMinutes > 0, "day_length_minutes must be positive")
+	check(c.ScriptBudgetMilliseconds > 0 && c.ScriptBudgetMilliseconds < c.TickMilliseconds, "script_budget_ms %d is not between 1 and tick_ms %d", c.ScriptBudgetMilliseconds, c.TickMilliseconds)
+	check(c.SessionHours > 0, "session_hours must be positive")
+	check(c.MessagesPerSecond >= 0, "messages_per_second must not be negative")
+	check(c.MessagesPerSecond == 0 || c.MessageBurst >= 1, "message_burst must be at least 1 while messages are limited")
+	check(c.AuthRequestsPerMinute >= 0, "auth_requests_per_minute must not be negative")
+	for _, plugin := range c.Plugins {
+		check(plugin != "", "plugins has an empty name")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
 }
 
 // Address returns formatted host:port address
@@ -17,10 +187,159 @@ func (c *Config) Address() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
 
-// LoadConfig returns default configuration settings
-func LoadConfig() *Config {
-	return &Config{
-		Host: "localhost",
-		Port: 8080,
+// TickInterval returns how often zones update
+func (c *Config) TickInterval() time.Duration {
+	return time.Duration(c.TickMilliseconds) * time.Millisecond
+}
+
+// ScriptTickBudget returns how long zones spend running scripts per tick
+func (c *Config) ScriptTickBudget() time.Duration {
+	return time.Duration(c.ScriptBudgetMilliseconds) * time.Millisecond
+}
+
+// SessionLifetime returns how long a login stays valid
+func (c *Config) SessionLifetime() time.Duration {
+	return time.Duration(c.SessionHours) * time.Hour
+}
+
+// Print writes the settings as a JSON config file, hiding the admin token
+func (c *Config) Print(w io.Writer) error {
+	shown := *c
+	if shown.AdminToken != "" {
+		shown.AdminToken = "********"
+	}
+	data, err := json.MarshalIndent(&shown, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// readFile applies a config file: JSON when it starts with '{', otherwise
+// "key: value" lines where lists are comma separated or "- item" lines
+func (c *Config) readFile(name string, data []byte) error {
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") || filepath.Ext(name) == ".json" {
+		decoder := json.NewDecoder(strings.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(c)
+	}
+
+	fields := make(map[string]field)
+	for _, field := range c.fields() {
+		fields[field.key] = field
+	}
+
+	var list *field
+	var items []string
+	flush := func() error {
+		if list == nil {
+			return nil
+		}
+		err := list.set(strings.Join(items, ","))
+		if err != nil {
+			err = fmt.Errorf("%s: %w", list.key, err)
+		}
+		list, items = nil, nil
+		return err
+	}
+
+	for number, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if list != nil && strings.HasPrefix(line, "- ") {
+			items = append(items, unquote(strings.TrimSpace(line[2:])))
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		separator := strings.IndexAny(line, ":=")
+		if separator < 0 {
+			return fmt.Errorf("line %d: expected key: value", number+1)
+		}
+		key, value := strings.TrimSpace(line[:separator]), strings.TrimSpace(line[separator+1:])
+		field, exists := fields[key]
+		if !exists {
+			return fmt.Errorf("line %d: unknown setting %q", number+1, key)
+		}
+		if value == "" && field.value.Kind() == reflect.Slice {
+			list = &field
+			continue
+		}
+		if err := field.set(value); err != nil {
+			return fmt.Errorf("line %d: %s: %w", number+1, key, err)
+		}
+	}
+	return flush()
+}
+
+// field is one setting of a Config, found through its struct tags
+type field struct {
+	key   string
+	usage string
+	value reflect.Value
+}
+
+// fields lists the settings of the config in declaration order
+func (c *Config) fields() []field {
+	value := reflect.ValueOf(c).Elem()
+	var fields []field
+	for i := 0; i < value.NumField(); i++ {
+		structField := value.Type().Field(i)
+		fields = append(fields, field{
+			key:   strings.Split(structField.Tag.Get("json"), ",")[0],
+			usage: structField.Tag.Get("usage"),
+			value: value.Field(i),
+		})
+	}
+	return fields
+}
+
+// set parses a setting from its text form; lists are comma separated and
+// may be wrapped in brackets
+func (f field) set(text string) error {
+	text = unquote(strings.TrimSpace(text))
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(text)
+	case reflect.Int:
+		number, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", text)
+		}
+		f.value.SetInt(int64(number))
+	case reflect.Float64:
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", text)
+		}
+		f.value.SetFloat(number)
+	case reflect.Slice:
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "["), "]")
+		items := []string{}
+		for _, item := range strings.Split(text, ",") {
+			if item = unquote(strings.TrimSpace(item)); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.value.Type())
+	}
+	return nil
+}
+
+// unquote strips the quotes around a value, if it has them
+func unquote(text string) string {
+	if len(text) >= 2 && (text[0] == '"' && text[len(text)-1] == '"' || text[0] == '\'' && text[len(text)-1] == '\'') {
+		return text[1 : len(text)-1]
 	}
+	return text
 }
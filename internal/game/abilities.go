@@ -0,0 +1,668 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// GlobalCooldown is how long casting any ability keeps the others from
+	// being cast
+	GlobalCooldown = time.Second
+	// castMoveTolerance is how far a player may drift while casting before
+	// the cast counts as interrupted
+	castMoveTolerance = 1.0
+	// defaultMaxTargets is how many an area ability hits unless it says otherwise
+	defaultMaxTargets = 5
+)
+
+// AbilityTargeting says what an ability is aimed at
+type AbilityTargeting string
+
+const (
+	// TargetSelf abilities act on the caster
+	TargetSelf AbilityTargeting = "self"
+	// TargetUnit abilities act on the NPC or player picked as target
+	TargetUnit AbilityTargeting = "target"
+	// TargetGround abilities act on everything within a radius of a point
+	// picked on the ground
+	TargetGround AbilityTargeting = "ground"
+	// TargetArea abilities act on everything within a radius of the caster
+	TargetArea AbilityTargeting = "aoe"
+)
+
+// Ability effect types
+const (
+	EffectDamage = "damage"
+	EffectHeal   = "heal"
+	// EffectApply puts a status effect on the targets
+	EffectApply = "apply"
+	// EffectDispel removes debuffs of a dispel category from the targets
+	EffectDispel = "dispel"
+	// EffectResurrect offers a dead player to come back to life with Min
+	// percent of their health and mana
+	EffectResurrect = "resurrect"
+)
+
+var (
+	ErrUnknownAbility   = errors.New("unknown ability")
+	ErrAbilityNotKnown  = errors.New("you have not learned that ability yet")
+	ErrAbilityCooldown  = errors.New("that ability is not ready yet")
+	ErrAlreadyCasting   = errors.New("already casting")
+	ErrNotEnoughMana    = errors.New("not enough mana")
+	ErrNotEnoughStamina = errors.New("not enough stamina")
+	ErrInvalidTarget    = errors.New("invalid target")
+)
+
+// AbilityEffect is one thing an ability does to its targets, rolling an
+// amount between Min and Max
+type AbilityEffect struct {
+	Type string `json:"type"`
+	Min  int    `json:"min"`
+	Max  int    `json:"max"`
+	// Status and Stacks name the status effect an apply effect puts on
+	Status string `json:"status"`
+	Stacks int    `json:"stacks"`
+	// Dispel and Count are the category and number of debuffs a dispel
+	// effect removes
+	Dispel string `json:"dispel"`
+	Count  int    `json:"count"`
+	status *StatusEffectDefinition
+}
+
+// harmful reports whether the effect is meant for enemies
+func (e AbilityEffect) harmful() bool {
+	return e.Type == EffectDamage || (e.Type == EffectApply && e.status != nil && e.status.Debuff)
+}
+
+// AbilityDefinition describes an ability players can cast, as written in
+// abilities.json
+type AbilityDefinition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Level is the character level the ability is learned at
+	Level     int              `json:"level"`
+	Targeting AbilityTargeting `json:"targeting"`
+	// CastSeconds of 0 makes the ability instant
+	CastSeconds     float64 `json:"cast_seconds"`
+	CooldownSeconds float64 `json:"cooldown_seconds"`
+	Mana            int     `json:"mana"`
+	Stamina         int     `json:"stamina"`
+	// Range is how far away the target or ground point may be
+	Range float64 `json:"range"`
+	// Radius and MaxTargets shape ground and area abilities
+	Radius     float64         `json:"radius"`
+	MaxTargets int             `json:"max_targets"`
+	Effects    []AbilityEffect `json:"effects"`
+}
+
+// applyDefaults fills optional fields left out of the content file
+func (d *AbilityDefinition) applyDefaults() {
+	if d.Name == "" {
+		d.Name = d.ID
+	}
+	if d.Level <= 0 {
+		d.Level = 1
+	}
+	if d.Range <= 0 {
+		d.Range = AttackRange
+	}
+	if d.MaxTargets <= 0 {
+		d.MaxTargets = defaultMaxTargets
+	}
+	for i := range d.Effects {
+		if d.Effects[i].Max < d.Effects[i].Min {
+			d.Effects[i].Max = d.Effects[i].Min
+		}
+		if d.Effects[i].Stacks <= 0 {
+			d.Effects[i].Stacks = 1
+		}
+		if d.Effects[i].Count <= 0 {
+			d.Effects[i].Count = 1
+		}
+	}
+}
+
+// hostile reports whether the ability harms its targets; harmful
+// abilities hit NPCs and the players the PvP rules let the caster attack
+// and their healing, buffs and dispels go to the caster, the others act
+// on players
+func (d *AbilityDefinition) hostile() bool {
+	for _, effect := range d.Effects {
+		if effect.harmful() {
+			return true
+		}
+	}
+	return false
+}
+
+// resurrects reports whether the ability brings dead players back, so
+// it can only be aimed at them
+func (d *AbilityDefinition) resurrects() bool {
+	for _, effect := range d.Effects {
+		if effect.Type == EffectResurrect {
+			return true
+		}
+	}
+	return false
+}
+
+// Cooldowns tracks when a character can next cast each ability
+type Cooldowns struct {
+	global time.Time
+	ready  map[string]time.Time
+	mu     sync.Mutex
+}
+
+// NewCooldowns creates cooldowns with every ability ready
+func NewCooldowns() *Cooldowns {
+	return &Cooldowns{ready: make(map[string]time.Time)}
+}
+
+// Ready reports whether an ability is off both its own and the global cooldown
+func (c *Cooldowns) Ready(abilityID string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !now.Before(c.global) && !now.Before(c.ready[abilityID])
+}
+
+// StartGlobal puts every ability on the global cooldown
+func (c *Cooldowns) StartGlobal(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.global = now.Add(GlobalCooldown)
+}
+
+// Start puts one ability on its cooldown
+func (c *Cooldowns) Start(abilityID string, cooldown time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ready[abilityID] = now.Add(cooldown)
+}
+
+// casting is a player busy casting an ability
+type casting struct {
+	ability  *AbilityDefinition
+	targetID string
+	point    Position
+	position Position
+	finishAt time.Time
+}
+
+// CastAbility validates and begins a cast. Instant abilities take effect
+// at once; the others finish after their cast time unless the caster
+// moves or is hurt first. Costs and the ability's cooldown are only
+// charged when the cast finishes, the global cooldown when it begins
+func (w *World) CastAbility(playerID, abilityID, targetID string, point Position) error {
+	if w.Content() == nil {
+		return ErrUnknownAbility
+	}
+	ability, exists := w.Content().Abilities[abilityID]
+	if !exists {
+		return fmt.Errorf("%w %q", ErrUnknownAbility, abilityID)
+	}
+	now := time.Now()
+
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	if player.Progress.GetLevel() < ability.Level {
+		w.mu.Unlock()
+		return ErrAbilityNotKnown
+	}
+	if !player.Life.Alive() {
+		w.mu.Unlock()
+		return ErrDead
+	}
+	if player.Effects.Has(ControlStun) {
+		w.mu.Unlock()
+		return ErrStunned
+	}
+	if _, busy := w.casts[playerID]; busy {
+		w.mu.Unlock()
+		return ErrAlreadyCasting
+	}
+	if !player.Cooldowns.Ready(ability.ID, now) {
+		w.mu.Unlock()
+		return ErrAbilityCooldown
+	}
+	cast := &casting{ability: ability, targetID: targetID, point: point, position: player.GetPosition()}
+	if err := w.checkCast(player, cast); err != nil {
+		w.mu.Unlock()
+		return err
+	}
+	if err := checkAbilityCost(player, ability); err != nil {
+		w.mu.Unlock()
+		return err
+	}
+
+	player.Cooldowns.StartGlobal(now)
+	var messages []outboundMessage
+	if ability.CastSeconds <= 0 {
+		messages = w.finishCast(player, cast, now)
+	} else {
+		cast.finishAt = now.Add(time.Duration(ability.CastSeconds * float64(time.Second)))
+		w.casts[playerID] = cast
+		message := castMessage("cast_started", player, cast)
+		message["seconds"] = ability.CastSeconds
+		messages = []outboundMessage{{near: &cast.position, message: message}}
+	}
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	return nil
+}
+
+// checkCast checks that what a cast is aimed at is still there and in
+// range; the caller holds the world lock
+func (w *World) checkCast(player *Player, cast *casting) error {
+	ability := cast.ability
+	position := player.GetPosition()
+
+	switch ability.Targeting {
+	case TargetUnit:
+		if cast.targetID == "" && !ability.hostile() {
+			cast.targetID = player.ID
+		}
+		var target Position
+		if npc, exists := w.NPCs[cast.targetID]; exists {
+			if !ability.hostile() {
+				return ErrInvalidTarget
+			}
+			if npc.MaxHealth <= 0 {
+				return ErrNotAttackable
+			}
+			target = npc.Position
+		} else if other, exists := w.Players[cast.targetID]; exists {
+			if ability.hostile() {
+				if err := w.canAttackPlayer(player, other, time.Now()); err != nil {
+					return err
+				}
+			} else if other.Life.Alive() == ability.resurrects() {
+				// Resurrections are aimed at corpses, everything else at the living
+				return ErrInvalidTarget
+			}
+			target = other.GetPosition()
+			if !other.Life.Alive() {
+				var zone string
+				if zone, target = other.Life.Corpse(); zone != w.ID {
+					return ErrInvalidTarget
+				}
+			}
+		} else {
+			return ErrTargetNotFound
+		}
+		if distance(position, target) > ability.Range {
+			return ErrTargetTooFar
+		}
+	case TargetGround:
+		if distance(position, cast.point) > ability.Range {
+			return ErrTargetTooFar
+		}
+	}
+	return nil
+}
+
+// checkAbilityCost checks that a player can pay for an ability
+func checkAbilityCost(player *Player, ability *AbilityDefinition) error {
+	if mana, _ := player.Vitals.Mana(); mana < ability.Mana {
+		return ErrNotEnoughMana
+	}
+	if ability.Stamina > 0 && player.Stamina.Available() < float64(ability.Stamina) {
+		return ErrNotEnoughStamina
+	}
+	return nil
+}
+
+// updateCasting interrupts players who moved while casting and finishes
+// the casts that are due; the caller holds the world lock
+func (w *World) updateCasting(now time.Time) []outboundMessage {
+	var messages []outboundMessage
+
+	for playerID, cast := range w.casts {
+		player, exists := w.Players[playerID]
+		if !exists {
+			delete(w.casts, playerID)
+			continue
+		}
+		if distance(player.GetPosition(), cast.position) > castMoveTolerance {
+			messages = append(messages, w.interruptCast(playerID, "moved")...)
+			continue
+		}
+		if now.Before(cast.finishAt) {
+			continue
+		}
+		delete(w.casts, playerID)
+		messages = append(messages, w.finishCast(player, cast, now)...)
+	}
+
+	return messages
+}
+
+// interruptCast stops a player's cast, if any, without charging for it;
+// the caller holds the world lock
+func (w *World) interruptCast(playerID, reason string) []outboundMessage {
+	cast, exists := w.casts[playerID]
+	if !exists {
+		return nil
+	}
+	delete(w.casts, playerID)
+
+	return []outboundMessage{{near: &cast.position, message: map[string]interface{}{
+		"type":       "cast_interrupted",
+		"caster_id":  playerID,
+		"ability_id": cast.ability.ID,
+		"reason":     reason,
+	}}}
+}
+
+// finishCast charges for a cast and applies its effects, or interrupts
+// it when its target or the caster's resources are gone; the caller holds
+// the world lock
+func (w *World) finishCast(player *Player, cast *casting, now time.Time) []outboundMessage {
+	ability := cast.ability
+	err := w.checkCast(player, cast)
+	if err == nil {
+		err = checkAbilityCost(player, ability)
+	}
+	if err == nil && !player.Vitals.SpendMana(ability.Mana) {
+		err = ErrNotEnoughMana
+	}
+	if err == nil && ability.Stamina > 0 && !player.Stamina.Spend(float64(ability.Stamina)) {
+		err = ErrNotEnoughStamina
+	}
+	if err != nil {
+		return []outboundMessage{{near: &cast.position, message: map[string]interface{}{
+			"type":       "cast_interrupted",
+			"caster_id":  player.ID,
+			"ability_id": ability.ID,
+			"reason":     err.Error(),
+		}}}
+	}
+
+	cooldown := time.Duration(ability.CooldownSeconds * float64(time.Second))
+	player.Cooldowns.Start(ability.ID, cooldown, now)
+
+	messages := []outboundMessage{{near: &cast.position, message: castMessage("cast_finished", player, cast)}}
+	if cooldown > 0 {
+		messages = append(messages, outboundMessage{playerID: player.ID, message: map[string]interface{}{
+			"type":       "ability_cooldown",
+			"ability_id": ability.ID,
+			"seconds":    ability.CooldownSeconds,
+		}})
+	}
+	messages = append(messages, w.applyAbility(player, cast, now)...)
+
+	current, max, _ := player.Stamina.GetStamina()
+	return append(messages,
+		outboundMessage{playerID: player.ID, message: player.Vitals.Message()},
+		outboundMessage{playerID: player.ID, message: map[string]interface{}{
+			"type":        "stamina_update",
+			"stamina":     current,
+			"max_stamina": max,
+		}},
+	)
+}
+
+// applyAbility rolls each effect of a finished cast against its targets;
+// the caller holds the world lock
+func (w *World) applyAbility(player *Player, cast *casting, now time.Time) []outboundMessage {
+	ability := cast.ability
+	npcs, players := w.abilityTargets(player, cast, now)
+	var enemies []*Player
+	if ability.hostile() {
+		enemies, players = players, []*Player{player}
+		for _, enemy := range enemies {
+			w.flagAttacker(player, enemy, now)
+		}
+	}
+
+	var messages []outboundMessage
+	for _, effect := range ability.Effects {
+		switch effect.Type {
+		case EffectDamage:
+			for _, npc := range npcs {
+				if npc.Health <= 0 {
+					continue
+				}
+				damage := scaleDamage(w.rollEffect(effect), player.Stats(), ComputeStats(nil, npc.Effects))
+				npc.Health = maxInt(npc.Health-damage, 0)
+				position := npc.Position
+				messages = append(messages, outboundMessage{near: &position, message: map[string]interface{}{
+					"type":       "npc_damaged",
+					"id":         npc.ID,
+					"attacker":   player.ID,
+					"ability_id": ability.ID,
+					"damage":     damage,
+					"health":     npc.Health,
+					"max_health": npc.MaxHealth,
+				}})
+				if npc.Health == 0 {
+					messages = append(messages, w.killNPC(npc, player, now)...)
+				}
+			}
+			for _, enemy := range enemies {
+				damage := scaleDamage(w.rollEffect(effect), player.Stats(), enemy.Stats())
+				messages = append(messages, w.strikePlayer(player, enemy, damage)...)
+			}
+		case EffectHeal:
+			for _, target := range players {
+				healed := target.Vitals.Heal(w.rollEffect(effect))
+				health, maxHealth := target.Vitals.Health()
+				position := target.GetPosition()
+				messages = append(messages, outboundMessage{near: &position, message: map[string]interface{}{
+					"type":       "player_healed",
+					"id":         target.ID,
+					"healer_id":  player.ID,
+					"ability_id": ability.ID,
+					"amount":     healed,
+					"health":     health,
+					"max_health": maxHealth,
+				}})
+				// The caster is sent their vitals once the cast is paid for
+				if target != player {
+					messages = append(messages, outboundMessage{playerID: target.ID, message: target.Vitals.Message()})
+				}
+			}
+		case EffectApply:
+			if effect.harmful() {
+				for _, npc := range npcs {
+					if npc.Health > 0 && npc.Effects != nil {
+						messages = append(messages, w.applyStatusToNPC(npc, effect.status, effect.Stacks, player.ID, now)...)
+					}
+				}
+				for _, enemy := range enemies {
+					if enemy.Life.Alive() {
+						messages = append(messages, w.applyStatusToPlayer(enemy, effect.status, effect.Stacks, player.ID, now)...)
+					}
+				}
+				continue
+			}
+			for _, target := range players {
+				messages = append(messages, w.applyStatusToPlayer(target, effect.status, effect.Stacks, player.ID, now)...)
+			}
+		case EffectDispel:
+			for _, target := range players {
+				messages = append(messages, w.dispelPlayer(target, effect.Dispel, effect.Count)...)
+			}
+		case EffectResurrect:
+			for _, target := range players {
+				messages = append(messages, w.resurrect(player, target, ability, effect.Min, now)...)
+			}
+		}
+	}
+	return messages
+}
+
+// abilityTargets returns who a finished cast acts on: NPCs and the
+// players the caster may attack for harmful abilities and players for the
+// others, nearest first for area abilities. The caller holds the world lock
+func (w *World) abilityTargets(player *Player, cast *casting, now time.Time) ([]*Entity, []*Player) {
+	ability := cast.ability
+
+	var center Position
+	switch ability.Targeting {
+	case TargetSelf:
+		return nil, []*Player{player}
+	case TargetUnit:
+		if npc, exists := w.NPCs[cast.targetID]; exists {
+			return []*Entity{npc}, nil
+		}
+		if target, exists := w.Players[cast.targetID]; exists {
+			return nil, []*Player{target}
+		}
+		return nil, nil
+	case TargetGround:
+		center = cast.point
+	default:
+		center = player.GetPosition()
+	}
+
+	if ability.hostile() {
+		var npcs []*Entity
+		for _, npc := range w.NPCs {
+			if npc.MaxHealth > 0 && distance(center, npc.Position) <= ability.Radius {
+				npcs = append(npcs, npc)
+			}
+		}
+		var enemies []*Player
+		for _, other := range w.Players {
+			if distance(center, other.GetPosition()) <= ability.Radius && w.canAttackPlayer(player, other, now) == nil {
+				enemies = append(enemies, other)
+			}
+		}
+		sort.Slice(npcs, func(i, j int) bool {
+			return distance(center, npcs[i].Position) < distance(center, npcs[j].Position)
+		})
+		sort.Slice(enemies, func(i, j int) bool {
+			return distance(center, enemies[i].GetPosition()) < distance(center, enemies[j].GetPosition())
+		})
+		// Drop the farthest of either kind until the rest fit
+		for len(npcs)+len(enemies) > ability.MaxTargets {
+			if len(enemies) == 0 || (len(npcs) > 0 &&
+				distance(center, npcs[len(npcs)-1].Position) >= distance(center, enemies[len(enemies)-1].GetPosition())) {
+				npcs = npcs[:len(npcs)-1]
+			} else {
+				enemies = enemies[:len(enemies)-1]
+			}
+		}
+		return npcs, enemies
+	}
+
+	var players []*Player
+	for _, other := range w.Players {
+		if other.Life.Alive() && distance(center, other.GetPosition()) <= ability.Radius {
+			players = append(players, other)
+		}
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return distance(center, players[i].GetPosition()) < distance(center, players[j].GetPosition())
+	})
+	if len(players) > ability.MaxTargets {
+		players = players[:ability.MaxTargets]
+	}
+	return nil, players
+}
+
+// damagePlayer takes health from a player, interrupting any cast they are
+// in the middle of and killing them when it runs out; the caller holds
+// the world lock
+func (w *World) damagePlayer(player *Player, amount int, attackerID string) []outboundMessage {
+	if !player.Life.Alive() {
+		return nil
+	}
+	taken := player.Vitals.Damage(amount)
+	health, maxHealth := player.Vitals.Health()
+	position := player.GetPosition()
+
+	messages := []outboundMessage{
+		{near: &position, message: map[string]interface{}{
+			"type":       "player_damaged",
+			"id":         player.ID,
+			"attacker":   attackerID,
+			"damage":     taken,
+			"health":     health,
+			"max_health": maxHealth,
+		}},
+		{playerID: player.ID, message: player.Vitals.Message()},
+	}
+	if taken > 0 {
+		messages = append(messages, w.interruptCast(player.ID, "damaged")...)
+	}
+	if health == 0 {
+		messages = append(messages, w.killPlayer(player, attackerID)...)
+	}
+	return messages
+}
+
+// regenerateVitals brings back the mana of every player in the zone and
+// tells those whose mana changed; the caller holds the world lock
+func (w *World) regenerateVitals(delta float64) []outboundMessage {
+	var messages []outboundMessage
+	for _, player := range w.Players {
+		if player.Life.Alive() && player.Vitals.Regenerate(delta) {
+			messages = append(messages, outboundMessage{playerID: player.ID, message: player.Vitals.Message()})
+		}
+	}
+	return messages
+}
+
+// rollEffect rolls the amount of one effect; the caller holds the world lock
+func (w *World) rollEffect(effect AbilityEffect) int {
+	return effect.Min + w.rng.Intn(effect.Max-effect.Min+1)
+}
+
+func castMessage(kind string, player *Player, cast *casting) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       kind,
+		"caster_id":  player.ID,
+		"ability_id": cast.ability.ID,
+		"name":       cast.ability.Name,
+		"target_id":  cast.targetID,
+		"x":          cast.point.X,
+		"y":          cast.point.Y,
+	}
+}
+
+// AbilitiesMessage returns the abilities message listing every ability
+// by the level it is learned at
+func (c *Content) AbilitiesMessage() map[string]interface{} {
+	sorted := make([]*AbilityDefinition, 0, len(c.Abilities))
+	for _, ability := range c.Abilities {
+		sorted = append(sorted, ability)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Level != sorted[j].Level {
+			return sorted[i].Level < sorted[j].Level
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	abilities := make([]map[string]interface{}, 0, len(sorted))
+	for _, ability := range sorted {
+		abilities = append(abilities, map[string]interface{}{
+			"id":               ability.ID,
+			"name":             ability.Name,
+			"level":            ability.Level,
+			"targeting":        ability.Targeting,
+			"cast_seconds":     ability.CastSeconds,
+			"cooldown_seconds": ability.CooldownSeconds,
+			"mana":             ability.Mana,
+			"stamina":          ability.Stamina,
+			"range":            ability.Range,
+			"radius":           ability.Radius,
+			"hostile":          ability.hostile(),
+		})
+	}
+
+	return map[string]interface{}{
+		"type":      "abilities",
+		"abilities": abilities,
+	}
+}
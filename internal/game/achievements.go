@@ -0,0 +1,443 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrTitleNotEarned = errors.New("that title has not been earned")
+
+// Events achievement criteria can count, as written in achievements.json
+const (
+	CriterionKill           = "kill"
+	CriterionDeath          = "death"
+	CriterionQuestCompleted = "quest_completed"
+)
+
+// countedEvents are the events achievement criteria can count
+var countedEvents = map[string]bool{
+	CriterionKill:           true,
+	CriterionDeath:          true,
+	CriterionQuestCompleted: true,
+}
+
+// achievementEvents are the events the achievements subscribe to
+var achievementEvents = []string{
+	EventPlayerJoined,
+	EventEntityKilled,
+	EventPlayerDied,
+	EventQuestCompleted,
+	EventLevelUp,
+	EventStatisticChanged,
+}
+
+// AchievementCriterion is one goal of an achievement. Exactly one of
+// Event, Statistic and Level is set: counting Count events of a type,
+// only those about Target when it is given; waiting for an all-time
+// statistic to reach Count; or waiting for the character to reach Level
+type AchievementCriterion struct {
+	Event     string  `json:"event"`
+	Target    string  `json:"target"`
+	Statistic string  `json:"statistic"`
+	Level     int     `json:"level"`
+	Count     float64 `json:"count"`
+}
+
+// AchievementRewards is what a character receives for an achievement
+type AchievementRewards struct {
+	Title string            `json:"title"`
+	Items []QuestItemReward `json:"items"`
+}
+
+// AchievementDefinition describes an achievement as written in
+// achievements.json; it is earned once every criterion is met
+type AchievementDefinition struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Criteria    []AchievementCriterion `json:"criteria"`
+	Rewards     AchievementRewards     `json:"rewards"`
+}
+
+// applyDefaults fills optional fields left out of the content file
+func (a *AchievementDefinition) applyDefaults() {
+	if a.Name == "" {
+		a.Name = a.ID
+	}
+	for i := range a.Criteria {
+		if a.Criteria[i].Event != "" && a.Criteria[i].Count <= 0 {
+			a.Criteria[i].Count = 1
+		}
+	}
+}
+
+// goal returns how much progress meets a criterion
+func (c AchievementCriterion) goal() float64 {
+	if c.Level > 0 {
+		return float64(c.Level)
+	}
+	return c.Count
+}
+
+// achievementKey returns the key the achievements index files a
+// criterion under: the event, statistic or level change that moves it on
+func achievementKey(criterion AchievementCriterion) string {
+	switch {
+	case criterion.Event != "":
+		return "event:" + criterion.Event
+	case criterion.Statistic != "":
+		return "statistic:" + criterion.Statistic
+	default:
+		return "level"
+	}
+}
+
+// achievementSubject returns whose achievements an event may move on,
+// the index key of those achievements, and the criterion event it
+// counts as along with what it was about
+func achievementSubject(event Event) (player *Player, key, counted, target string) {
+	switch e := event.(type) {
+	case EntityKilled:
+		return e.Killer, "event:" + CriterionKill, CriterionKill, e.Kind
+	case PlayerDied:
+		return e.Player, "event:" + CriterionDeath, CriterionDeath, e.KillerID
+	case QuestCompleted:
+		return e.Player, "event:" + CriterionQuestCompleted, CriterionQuestCompleted, e.QuestID
+	case LevelUp:
+		return e.Player, "level", "", ""
+	case StatisticChanged:
+		return e.Player, "statistic:" + e.Statistic, "", ""
+	case PlayerJoined:
+		return e.Player, "", "", ""
+	}
+	return nil, "", "", ""
+}
+
+// Achievements are the achievements a character has earned, how far
+// they got with the criteria that count events, and the title they show
+type Achievements struct {
+	unlocked map[string]time.Time
+	counts   map[string][]float64
+	title    string
+	mu       sync.Mutex
+}
+
+// NewAchievements creates a character's achievements with none earned
+func NewAchievements() *Achievements {
+	return &Achievements{
+		unlocked: make(map[string]time.Time),
+		counts:   make(map[string][]float64),
+	}
+}
+
+// Unlocked reports whether an achievement has been earned
+func (a *Achievements) Unlocked(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, unlocked := a.unlocked[id]
+	return unlocked
+}
+
+// count returns how many events a criterion has counted
+func (a *Achievements) count(id string, criterion int) float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if counts := a.counts[id]; criterion < len(counts) {
+		return counts[criterion]
+	}
+	return 0
+}
+
+// setCount records how many events a criterion has counted
+func (a *Achievements) setCount(id string, criterion int, value float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	counts := a.counts[id]
+	for len(counts) <= criterion {
+		counts = append(counts, 0)
+	}
+	counts[criterion] = value
+	a.counts[id] = counts
+}
+
+// unlock marks an achievement earned, reporting false when it already was
+func (a *Achievements) unlock(id string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, unlocked := a.unlocked[id]; unlocked {
+		return false
+	}
+	a.unlocked[id] = now
+	delete(a.counts, id)
+	return true
+}
+
+// restore replaces the achievements with those saved with the character
+func (a *Achievements) restore(unlocked map[string]time.Time, counts map[string][]float64, title string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.unlocked = unlocked
+	a.counts = counts
+	a.title = title
+}
+
+// progressSnapshot returns a copy of the counted events and the title
+// for saving
+func (a *Achievements) progressSnapshot() (map[string][]float64, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	counts := make(map[string][]float64, len(a.counts))
+	for id, values := range a.counts {
+		counts[id] = append([]float64(nil), values...)
+	}
+	return counts, a.title
+}
+
+// Title returns the title the character shows, or "" for none
+func (a *Achievements) Title() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.title
+}
+
+// setTitle changes the title the character shows
+func (a *Achievements) setTitle(title string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.title = title
+}
+
+// Titles returns the titles the character's achievements have earned
+func (a *Achievements) Titles(definitions map[string]*AchievementDefinition) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	titles := []string{}
+	for id := range a.unlocked {
+		if definition, exists := definitions[id]; exists && definition.Rewards.Title != "" {
+			titles = append(titles, definition.Rewards.Title)
+		}
+	}
+	sort.Strings(titles)
+	return titles
+}
+
+// achievementProgress returns how far a character is with each of an
+// achievement's criteria
+func achievementProgress(player *Player, definition *AchievementDefinition) []float64 {
+	progress := make([]float64, len(definition.Criteria))
+	for i, criterion := range definition.Criteria {
+		switch {
+		case criterion.Event != "":
+			progress[i] = player.Achievements.count(definition.ID, i)
+		case criterion.Statistic != "":
+			progress[i] = player.Statistics.Lifetime(criterion.Statistic)
+		default:
+			progress[i] = float64(player.Progress.GetLevel())
+		}
+	}
+	return progress
+}
+
+// achievementMet reports whether every criterion of an achievement is met
+func achievementMet(definition *AchievementDefinition, progress []float64) bool {
+	for i, criterion := range definition.Criteria {
+		if progress[i] < criterion.goal() {
+			return false
+		}
+	}
+	return true
+}
+
+// trackAchievements moves a player's achievements on with an event from
+// the event bus, awarding those whose criteria are all met
+func (zm *ZoneManager) trackAchievements(event Event) {
+	player, key, counted, target := achievementSubject(event)
+	if player == nil {
+		return
+	}
+
+	candidates := zm.Content().achievementIndex[key]
+	if event.EventName() == EventPlayerJoined {
+		// Achievements added since the character last played may
+		// already be met by their statistics and level
+		candidates = zm.Content().achievementList
+	}
+
+	now := time.Now()
+	for _, definition := range candidates {
+		if player.Achievements.Unlocked(definition.ID) {
+			continue
+		}
+
+		moved := false
+		for i, criterion := range definition.Criteria {
+			if counted != "" && criterion.Event == counted && (criterion.Target == "" || criterion.Target == target) {
+				player.Achievements.setCount(definition.ID, i, player.Achievements.count(definition.ID, i)+1)
+				moved = true
+			}
+		}
+
+		progress := achievementProgress(player, definition)
+		if achievementMet(definition, progress) {
+			if player.Achievements.unlock(definition.ID, now) {
+				zm.awardAchievement(player, definition, now)
+			}
+		} else if moved {
+			zm.notifyCharacter(player.Name, map[string]interface{}{
+				"type":           "achievement_progress",
+				"achievement_id": definition.ID,
+				"progress":       progress,
+			})
+		}
+	}
+}
+
+// awardAchievement records an earned achievement, hands out its rewards
+// and tells the player, their party and the players around them
+func (zm *ZoneManager) awardAchievement(player *Player, definition *AchievementDefinition, now time.Time) {
+	if zm.persistent(player) {
+		if err := zm.database.UnlockAchievement(player.Name, definition.ID, now); err != nil {
+			log.Printf("Failed to save achievement %s of %s: %v", definition.ID, player.Name, err)
+		}
+	}
+
+	world, online := zm.PlayerZone(player.ID)
+	zm.giveAchievementItems(player, definition, online)
+
+	message := map[string]interface{}{
+		"type":           "achievement_unlocked",
+		"achievement_id": definition.ID,
+		"name":           definition.Name,
+		"description":    definition.Description,
+		"title":          definition.Rewards.Title,
+		"items":          definition.Rewards.Items,
+		"player_id":      player.ID,
+		"player_name":    player.Name,
+	}
+	if online {
+		world.announceAchievement(player, message)
+	}
+	zm.Events.Publish(AchievementUnlocked{Player: player, AchievementID: definition.ID})
+}
+
+// giveAchievementItems puts an achievement's reward items in the
+// player's bags, mailing them instead when they do not fit or the player
+// has already logged out
+func (zm *ZoneManager) giveAchievementItems(player *Player, definition *AchievementDefinition, online bool) {
+	var given []ItemStack
+	for _, reward := range definition.Rewards.Items {
+		given = append(given, ItemStack{ItemID: reward.Item, Quantity: reward.Quantity})
+	}
+	if len(given) == 0 {
+		return
+	}
+
+	if online {
+		err := player.Inventory.Exchange(nil, given, zm.Content().Items)
+		if err == nil {
+			zm.notifyCharacter(player.Name, player.Inventory.Message(zm.Content().Items))
+			return
+		}
+		if !errors.Is(err, ErrInventoryFull) {
+			log.Printf("Failed to give %s the rewards of achievement %s: %v", player.Name, definition.ID, err)
+			return
+		}
+	}
+	if zm.Post == nil {
+		log.Printf("Rewards of achievement %s for %s did not fit and there is no mail", definition.ID, player.Name)
+		return
+	}
+	reward := &Mail{
+		Recipient: player.Name,
+		Subject:   definition.Name,
+		Body:      "Your achievement reward did not fit in your bags.",
+		Items:     given,
+	}
+	if err := zm.Post.Send(reward); err != nil {
+		log.Printf("Failed to mail rewards of achievement %s to %s: %v", definition.ID, player.Name, err)
+	}
+}
+
+// announceAchievement sends an achievement unlock to the players around
+// a player and to everyone in their party, wherever they are
+func (w *World) announceAchievement(player *Player, message map[string]interface{}) {
+	if w.broadcaster == nil {
+		return
+	}
+
+	recipients := map[string]bool{player.ID: true}
+	w.mu.RLock()
+	for _, observerID := range w.observersOf(player.GetPosition(), "") {
+		recipients[observerID] = true
+	}
+	w.mu.RUnlock()
+	if party, exists := w.parties.PartyOf(player.ID); exists {
+		for _, memberID := range party.MemberIDs() {
+			recipients[memberID] = true
+		}
+	}
+
+	for playerID := range recipients {
+		w.broadcaster.SendToPlayer(playerID, message)
+	}
+}
+
+// AchievementsMessage returns the achievements message listing every
+// achievement with the player's progress and the titles they can show
+func (zm *ZoneManager) AchievementsMessage(player *Player) map[string]interface{} {
+	list := make([]map[string]interface{}, 0, len(zm.Content().achievementList))
+	for _, definition := range zm.Content().achievementList {
+		goals := make([]float64, len(definition.Criteria))
+		for i, criterion := range definition.Criteria {
+			goals[i] = criterion.goal()
+		}
+		entry := map[string]interface{}{
+			"id":          definition.ID,
+			"name":        definition.Name,
+			"description": definition.Description,
+			"goals":       goals,
+			"progress":    achievementProgress(player, definition),
+			"title":       definition.Rewards.Title,
+			"unlocked":    player.Achievements.Unlocked(definition.ID),
+		}
+		list = append(list, entry)
+	}
+	return map[string]interface{}{
+		"type":         "achievements",
+		"achievements": list,
+		"titles":       player.Achievements.Titles(zm.Content().Achievements),
+		"title":        player.Achievements.Title(),
+	}
+}
+
+// SetTitle changes the title a player shows to one of those they have
+// earned, or clears it, and shows it to the players around them
+func (zm *ZoneManager) SetTitle(playerID, title string) error {
+	player, world, exists := zm.FindPlayer(playerID)
+	if !exists {
+		return fmt.Errorf("player %s is not in a zone", playerID)
+	}
+	if title != "" {
+		earned := false
+		for _, candidate := range player.Achievements.Titles(zm.Content().Achievements) {
+			earned = earned || candidate == title
+		}
+		if !earned {
+			return ErrTitleNotEarned
+		}
+	}
+
+	player.Achievements.setTitle(title)
+	position := player.GetPosition()
+	world.deliver([]outboundMessage{{near: &position, message: map[string]interface{}{
+		"type":  "player_title",
+		"id":    player.ID,
+		"title": title,
+	}}})
+	return nil
+}
@@ -0,0 +1,134 @@
+package game
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultAOIRadius is how far away players see other players and NPCs
+// unless the server is configured otherwise
+const DefaultAOIRadius = 1000.0
+
+// distance returns the straight-line distance between two positions
+func distance(a, b Position) float64 {
+	dx := a.X - b.X
+	dy := a.Y - b.Y
+	return math.Sqrt(dx*dx + dy*dy)
+}
+
+// withinAOI reports whether two positions are close enough to see each
+// other in the zone's weather
+func (w *World) withinAOI(a, b Position) bool {
+	return distance(a, b) <= w.visionRadius()
+}
+
+// observersOf returns the players within the AOI of a position; the
+// caller holds the world lock
+func (w *World) observersOf(position Position, excludeID string) []string {
+	var observers []string
+	for playerID, player := range w.Players {
+		if playerID == excludeID {
+			continue
+		}
+		if w.withinAOI(position, player.GetPosition()) {
+			observers = append(observers, playerID)
+		}
+	}
+	return observers
+}
+
+// BroadcastNear sends a message to every player of the zone within the
+// AOI radius of a position
+func (w *World) BroadcastNear(position Position, message map[string]interface{}) {
+	w.deliver([]outboundMessage{{near: &position, message: message}})
+}
+
+// BroadcastZone sends a message to every player of the zone
+func (w *World) BroadcastZone(message map[string]interface{}) {
+	w.deliver([]outboundMessage{{message: message}})
+}
+
+// Chat sends what a player says to every player of the zone, unless it
+// is a chat command added by a plugin, which is run instead
+func (w *World) Chat(player *Player, text string) {
+	if w.extensions != nil {
+		if command, args, exists := w.extensions.command(text); exists {
+			if err := command(player, w, args); err != nil {
+				w.SendToPlayer(player.ID, map[string]interface{}{
+					"type":    "chat_command_failed",
+					"command": text,
+					"error":   err.Error(),
+				})
+			}
+			return
+		}
+	}
+	w.BroadcastZone(map[string]interface{}{
+		"type":    "chat_message",
+		"name":    player.Name,
+		"message": text,
+	})
+	w.publish(ChatSent{Player: player, Zone: w.ID, Text: text})
+}
+
+// SendToPlayer sends a message to one player of the zone
+func (w *World) SendToPlayer(playerID string, message map[string]interface{}) {
+	w.deliver([]outboundMessage{{playerID: playerID, message: message}})
+}
+
+// refreshInterest updates which players see each other after a player
+// joined or moved, producing appear and disappear messages for both
+// sides; observers are told about the player with appearType. Items
+// around the player are refreshed too. The caller holds the world lock
+func (w *World) refreshInterest(player *Player, appearType string) []outboundMessage {
+	var messages []outboundMessage
+
+	position := player.GetPosition()
+	seen := w.visible[player.ID]
+	if seen == nil {
+		seen = make(map[string]bool)
+		w.visible[player.ID] = seen
+	}
+
+	for otherID, other := range w.Players {
+		if otherID == player.ID {
+			continue
+		}
+
+		otherPosition := other.GetPosition()
+		inRange := w.withinAOI(position, otherPosition)
+
+		switch {
+		case inRange && !seen[otherID]:
+			seen[otherID] = true
+			w.visible[otherID][player.ID] = true
+			messages = append(messages,
+				outboundMessage{playerID: player.ID, message: playerAppearance("player_appeared", other, otherPosition)},
+				outboundMessage{playerID: otherID, message: playerAppearance(appearType, player, position)},
+			)
+		case !inRange && seen[otherID]:
+			delete(seen, otherID)
+			delete(w.visible[otherID], player.ID)
+			messages = append(messages,
+				outboundMessage{playerID: player.ID, message: map[string]interface{}{"type": "player_disappeared", "id": otherID}},
+				outboundMessage{playerID: otherID, message: map[string]interface{}{"type": "player_disappeared", "id": player.ID}},
+			)
+		}
+	}
+
+	messages = append(messages, w.refreshItemInterest(player)...)
+	return messages
+}
+
+func playerAppearance(messageType string, player *Player, position Position) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    messageType,
+		"id":      player.ID,
+		"name":    player.Name,
+		"x":       position.X,
+		"y":       position.Y,
+		"state":   player.Life.State(),
+		"flagged": player.PvP.Flagged(time.Now()),
+		"title":   player.Achievements.Title(),
+	}
+}
@@ -0,0 +1,500 @@
+package game
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AuctionDepositPercent of an item's value is kept from the seller
+	// for every 12 hours a listing runs, whether or not it sells
+	AuctionDepositPercent = 5
+	// AuctionCutPercent of the sale price is kept by the auction house
+	AuctionCutPercent = 5
+	// AuctionBidIncrementPercent is how much a bid must beat the last one by
+	AuctionBidIncrementPercent = 5
+	// AuctionPageSize is how many listings a search returns at once
+	AuctionPageSize = 10
+	// auctionExpiryInterval is how often ended listings are settled
+	auctionExpiryInterval = 30 * time.Second
+)
+
+// AuctionDurations are the hours a listing can run for
+var AuctionDurations = []int{12, 24, 48}
+
+// Auction listing states
+const (
+	AuctionActive    = "active"
+	AuctionSold      = "sold"
+	AuctionExpired   = "expired"
+	AuctionCancelled = "cancelled"
+)
+
+var (
+	ErrAuctionNotFound   = errors.New("that auction is no longer available")
+	ErrAuctionChanged    = errors.New("the auction changed, try again")
+	ErrAuctionDuration   = errors.New("auctions run for 12, 24 or 48 hours")
+	ErrAuctionPrice      = errors.New("the buyout must be positive and at least the starting bid")
+	ErrAuctionOwnListing = errors.New("you cannot bid on your own auction")
+	ErrAuctionNoBidding  = errors.New("that auction can only be bought out")
+	ErrAuctionBidTooLow  = errors.New("your bid is too low")
+	ErrAuctionHasBids    = errors.New("auctions with bids cannot be cancelled")
+	ErrNotYourAuction    = errors.New("that is not your auction")
+)
+
+// AuctionListing is an item put up for sale by a character. Item and the
+// highest bid are held by the auction house until it ends
+type AuctionListing struct {
+	ID     int64
+	Seller string
+	Item   ItemStack
+	// MinBid is the starting bid; 0 sells the listing by buyout only
+	MinBid  int
+	Buyout  int
+	Bid     int
+	Bidder  string
+	Deposit int
+	State   string
+	Created time.Time
+	Expires time.Time
+}
+
+// NextBid returns the lowest bid the listing accepts now
+func (l *AuctionListing) NextBid() int {
+	if l.Bid == 0 {
+		return l.MinBid
+	}
+	return l.Bid + maxInt(1, l.Bid*AuctionBidIncrementPercent/100)
+}
+
+// AuctionQuery filters a search of the active listings
+type AuctionQuery struct {
+	Text     string
+	Seller   string
+	MaxPrice int
+	Page     int
+}
+
+// AuctionDeposit returns the deposit for listing a stack for some hours
+func AuctionDeposit(definition *ItemDefinition, quantity, hours int) int {
+	return maxInt(1, definition.Value*quantity*AuctionDepositPercent*hours/(100*12))
+}
+
+// AuctionCut returns the auction house's share of a sale
+func AuctionCut(price int) int {
+	return price * AuctionCutPercent / 100
+}
+
+// AuctionHouse runs the player-to-player market shared by every zone.
+// Listings live in the database and every change to one is a single
+// transaction together with the currency and mail it moves
+type AuctionHouse struct {
+	database *Database
+	currency *CurrencyService
+	post     *PostOffice
+	items    func() map[string]*ItemDefinition
+	notify   func(name string, message map[string]interface{})
+	nextID   int64
+	mu       sync.Mutex
+}
+
+// NewAuctionHouse opens the auction house over the listings saved in
+// the database
+func NewAuctionHouse(database *Database, currency *CurrencyService, post *PostOffice, items func() map[string]*ItemDefinition) (*AuctionHouse, error) {
+	lastID, err := database.LastAuctionID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuctionHouse{
+		database: database,
+		currency: currency,
+		post:     post,
+		items:    items,
+		nextID:   lastID + 1,
+	}, nil
+}
+
+// SetNotifier sets how online characters are told about their auctions
+func (ah *AuctionHouse) SetNotifier(notify func(name string, message map[string]interface{})) {
+	ah.notify = notify
+}
+
+// Create lists part of an inventory slot. The stack leaves the
+// inventory and the deposit the wallet in the same transaction that
+// saves the listing
+func (ah *AuctionHouse) Create(player *Player, slot, quantity, minBid, buyout, hours int, now time.Time) (*AuctionListing, error) {
+	if !validAuctionDuration(hours) {
+		return nil, ErrAuctionDuration
+	}
+	if buyout <= 0 || minBid < 0 || minBid > buyout {
+		return nil, ErrAuctionPrice
+	}
+
+	slots := player.Inventory.Snapshot()
+	if slot < 0 || slot >= len(slots) || slots[slot] == nil {
+		return nil, ErrEmptySlot
+	}
+	definition, exists := ah.items()[slots[slot].ItemID]
+	if !exists {
+		return nil, ErrEmptySlot
+	}
+
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	stack, err := player.Inventory.TakeFromSlot(slot, quantity)
+	if err != nil {
+		return nil, err
+	}
+	listing := &AuctionListing{
+		ID:      ah.nextID,
+		Seller:  player.Name,
+		Item:    stack,
+		MinBid:  minBid,
+		Buyout:  buyout,
+		Deposit: AuctionDeposit(definition, stack.Quantity, hours),
+		State:   AuctionActive,
+		Created: now,
+		Expires: now.Add(time.Duration(hours) * time.Hour),
+	}
+
+	err = ah.currency.Transact(player, -listing.Deposit, ReasonAuctionDeposit, listing.reference(), func(tx *sql.Tx) error {
+		if err := insertAuction(tx, listing); err != nil {
+			return err
+		}
+		return saveInventory(tx, player.Name, player.Inventory)
+	})
+	if err != nil {
+		if undo := player.Inventory.Exchange(nil, []ItemStack{stack}, ah.items()); undo != nil {
+			log.Printf("Could not return %s to %s after a failed listing: %v", stack.ItemID, player.Name, undo)
+		}
+		return nil, err
+	}
+
+	ah.nextID++
+	return listing, nil
+}
+
+// Bid places a bid on a listing. The bid is taken from the wallet and
+// held until the auction ends, and the bid it beats is mailed back
+func (ah *AuctionHouse) Bid(player *Player, id int64, amount int, now time.Time) (*AuctionListing, error) {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	listing, err := ah.activeListing(id, now)
+	if err != nil {
+		return nil, err
+	}
+	if listing.Seller == player.Name {
+		return nil, ErrAuctionOwnListing
+	}
+	if listing.MinBid == 0 {
+		return nil, ErrAuctionNoBidding
+	}
+	if amount < listing.NextBid() {
+		return nil, fmt.Errorf("%w: at least %d", ErrAuctionBidTooLow, listing.NextBid())
+	}
+	if amount >= listing.Buyout {
+		return ah.buyout(player, listing, now)
+	}
+
+	outbid := ah.refund(listing, "Outbid", fmt.Sprintf("You were outbid on %s.", ah.describe(listing.Item)))
+	err = ah.currency.Transact(player, -amount, ReasonAuctionBid, listing.reference(), func(tx *sql.Tx) error {
+		if err := updateAuctionBid(tx, listing.ID, listing.Bid, amount, player.Name); err != nil {
+			return err
+		}
+		if outbid != nil {
+			return ah.post.deliver(tx, outbid)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if outbid != nil {
+		ah.post.Announce(outbid)
+		ah.tell(outbid.Recipient, "auction_outbid", listing)
+	}
+	listing.Bid = amount
+	listing.Bidder = player.Name
+	return listing, nil
+}
+
+// Buyout buys a listing outright for its buyout price
+func (ah *AuctionHouse) Buyout(player *Player, id int64, now time.Time) (*AuctionListing, error) {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	listing, err := ah.activeListing(id, now)
+	if err != nil {
+		return nil, err
+	}
+	if listing.Seller == player.Name {
+		return nil, ErrAuctionOwnListing
+	}
+	return ah.buyout(player, listing, now)
+}
+
+// buyout sells a listing to a player for its buyout; the caller holds the lock
+func (ah *AuctionHouse) buyout(player *Player, listing *AuctionListing, now time.Time) (*AuctionListing, error) {
+	outbid := ah.refund(listing, "Auction bought out", fmt.Sprintf("%s was bought out by another player.", ah.describe(listing.Item)))
+	won, proceeds := ah.settle(listing, player.Name, listing.Buyout)
+
+	err := ah.currency.Transact(player, -listing.Buyout, ReasonAuctionBuyout, listing.reference(), func(tx *sql.Tx) error {
+		if err := closeAuction(tx, listing.ID, listing.Bid, AuctionSold, player.Name, listing.Buyout, now); err != nil {
+			return err
+		}
+		for _, mail := range []*Mail{outbid, won, proceeds} {
+			if mail == nil {
+				continue
+			}
+			if err := ah.post.deliver(tx, mail); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	listing.State = AuctionSold
+	listing.Bid = listing.Buyout
+	listing.Bidder = player.Name
+	if outbid != nil {
+		ah.post.Announce(outbid)
+	}
+	ah.post.Announce(won)
+	ah.post.Announce(proceeds)
+	ah.tell(listing.Seller, "auction_sold", listing)
+	return listing, nil
+}
+
+// Cancel takes a listing without bids off the market and mails the
+// item back to the seller; the deposit is not returned
+func (ah *AuctionHouse) Cancel(player *Player, id int64, now time.Time) (*AuctionListing, error) {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	listing, err := ah.activeListing(id, now)
+	if err != nil {
+		return nil, err
+	}
+	if listing.Seller != player.Name {
+		return nil, ErrNotYourAuction
+	}
+	if listing.Bidder != "" {
+		return nil, ErrAuctionHasBids
+	}
+
+	returned := &Mail{
+		Recipient: listing.Seller,
+		Subject:   "Auction cancelled",
+		Body:      fmt.Sprintf("Your auction of %s was cancelled.", ah.describe(listing.Item)),
+		Items:     []ItemStack{listing.Item},
+	}
+	err = ah.database.Transact(func(tx *sql.Tx) error {
+		if err := closeAuction(tx, listing.ID, listing.Bid, AuctionCancelled, "", 0, now); err != nil {
+			return err
+		}
+		return ah.post.deliver(tx, returned)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ah.post.Announce(returned)
+	listing.State = AuctionCancelled
+	return listing, nil
+}
+
+// Expire settles the listings whose time ran out: those with a bid go
+// to the highest bidder, the rest are mailed back to their seller
+func (ah *AuctionHouse) Expire(now time.Time) {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	due, err := ah.database.DueAuctions(now)
+	if err != nil {
+		log.Printf("Failed to load ended auctions: %v", err)
+		return
+	}
+
+	for _, listing := range due {
+		var letters []*Mail
+		state := AuctionExpired
+		if listing.Bidder != "" {
+			state = AuctionSold
+			won, proceeds := ah.settle(listing, listing.Bidder, listing.Bid)
+			letters = append(letters, won, proceeds)
+		} else {
+			letters = append(letters, &Mail{
+				Recipient: listing.Seller,
+				Subject:   "Auction expired",
+				Body:      fmt.Sprintf("Your auction of %s ended without a buyer.", ah.describe(listing.Item)),
+				Items:     []ItemStack{listing.Item},
+			})
+		}
+
+		err := ah.database.Transact(func(tx *sql.Tx) error {
+			if err := closeAuction(tx, listing.ID, listing.Bid, state, listing.Bidder, listing.Bid, now); err != nil {
+				return err
+			}
+			for _, mail := range letters {
+				if err := ah.post.deliver(tx, mail); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to settle auction %d: %v", listing.ID, err)
+			continue
+		}
+
+		for _, mail := range letters {
+			ah.post.Announce(mail)
+		}
+		if state == AuctionSold {
+			ah.tell(listing.Seller, "auction_sold", listing)
+		} else {
+			ah.tell(listing.Seller, "auction_expired", listing)
+		}
+	}
+}
+
+// Search returns a page of the active listings matching a query and how
+// many pages there are
+func (ah *AuctionHouse) Search(query AuctionQuery, now time.Time) ([]*AuctionListing, int, error) {
+	var itemIDs []string
+	if text := strings.ToLower(strings.TrimSpace(query.Text)); text != "" {
+		for id, definition := range ah.items() {
+			if strings.Contains(strings.ToLower(definition.Name), text) || strings.Contains(id, text) {
+				itemIDs = append(itemIDs, id)
+			}
+		}
+		if len(itemIDs) == 0 {
+			return nil, 0, nil
+		}
+	}
+
+	page := maxInt(query.Page, 0)
+	listings, total, err := ah.database.SearchAuctions(itemIDs, query.Seller, query.MaxPrice, now, AuctionPageSize, page*AuctionPageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	return listings, (total + AuctionPageSize - 1) / AuctionPageSize, nil
+}
+
+// activeListing loads a listing that can still be bid on or bought
+func (ah *AuctionHouse) activeListing(id int64, now time.Time) (*AuctionListing, error) {
+	listing, err := ah.database.GetAuction(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrAuctionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if listing.State != AuctionActive || !now.Before(listing.Expires) {
+		return nil, ErrAuctionNotFound
+	}
+	return listing, nil
+}
+
+// refund returns the letter giving the current highest bidder their bid
+// back, or nil when nobody bid yet
+func (ah *AuctionHouse) refund(listing *AuctionListing, subject, body string) *Mail {
+	if listing.Bidder == "" {
+		return nil
+	}
+	return &Mail{
+		Recipient: listing.Bidder,
+		Subject:   subject,
+		Body:      body,
+		Currency:  listing.Bid,
+	}
+}
+
+// settle returns the letters of a sale: the item for the buyer and the
+// price less the auction house's cut for the seller
+func (ah *AuctionHouse) settle(listing *AuctionListing, buyer string, price int) (*Mail, *Mail) {
+	won := &Mail{
+		Recipient: buyer,
+		Subject:   "Auction won",
+		Body:      fmt.Sprintf("You won %s for %d.", ah.describe(listing.Item), price),
+		Items:     []ItemStack{listing.Item},
+	}
+	proceeds := &Mail{
+		Recipient: listing.Seller,
+		Subject:   "Auction successful",
+		Body:      fmt.Sprintf("%s sold for %d, less a %d cut.", ah.describe(listing.Item), price, AuctionCut(price)),
+		Currency:  price - AuctionCut(price),
+	}
+	return won, proceeds
+}
+
+// tell sends a character a message about one of their auctions
+func (ah *AuctionHouse) tell(name, messageType string, listing *AuctionListing) {
+	if ah.notify == nil {
+		return
+	}
+	ah.notify(name, map[string]interface{}{
+		"type": messageType,
+		"id":   listing.ID,
+		"name": ah.describe(listing.Item),
+		"bid":  listing.Bid,
+	})
+}
+
+// describe names a stack for letters and messages
+func (ah *AuctionHouse) describe(stack ItemStack) string {
+	name := stack.ItemID
+	if definition, exists := ah.items()[stack.ItemID]; exists {
+		name = definition.Name
+	}
+	if stack.Quantity > 1 {
+		return fmt.Sprintf("%s x%d", name, stack.Quantity)
+	}
+	return name
+}
+
+// Appearance describes a listing to a player
+func (ah *AuctionHouse) Appearance(listing *AuctionListing, viewer string, now time.Time) map[string]interface{} {
+	name := listing.Item.ItemID
+	if definition, exists := ah.items()[listing.Item.ItemID]; exists {
+		name = definition.Name
+	}
+	return map[string]interface{}{
+		"id":         listing.ID,
+		"item_id":    listing.Item.ItemID,
+		"name":       name,
+		"quantity":   listing.Item.Quantity,
+		"seller":     listing.Seller,
+		"bid":        listing.Bid,
+		"next_bid":   listing.NextBid(),
+		"buyout":     listing.Buyout,
+		"biddable":   listing.MinBid > 0,
+		"your_bid":   listing.Bidder != "" && listing.Bidder == viewer,
+		"expires_in": int(listing.Expires.Sub(now).Seconds()),
+	}
+}
+
+func (l *AuctionListing) reference() string {
+	return fmt.Sprintf("auction/%d", l.ID)
+}
+
+func validAuctionDuration(hours int) bool {
+	for _, duration := range AuctionDurations {
+		if hours == duration {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package game
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrNoAuctionOpen = errors.New("talk to an auctioneer first")
+
+// OpenAuction lets a player use the auction house through an auctioneer
+func (w *World) OpenAuction(player *Player, npc *Entity) error {
+	if w.auctions == nil {
+		return ErrNoDatabase
+	}
+	if player.Guest {
+		return ErrGuest
+	}
+
+	w.mu.Lock()
+	w.auctionVisits[player.ID] = npc.ID
+	w.mu.Unlock()
+
+	w.SendToPlayer(player.ID, map[string]interface{}{
+		"type":   "auction_opened",
+		"npc_id": npc.ID,
+	})
+	return nil
+}
+
+// CloseAuction forgets the auctioneer a player was using
+func (w *World) CloseAuction(playerID string) {
+	w.mu.Lock()
+	delete(w.auctionVisits, playerID)
+	w.mu.Unlock()
+}
+
+// SearchAuctions sends a player a page of the listings matching a query
+func (w *World) SearchAuctions(playerID string, query AuctionQuery) error {
+	player, err := w.auctionCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	listings, pages, err := w.auctions.Search(query, now)
+	if err != nil {
+		return err
+	}
+	results := make([]map[string]interface{}, 0, len(listings))
+	for _, listing := range listings {
+		results = append(results, w.auctions.Appearance(listing, player.Name, now))
+	}
+
+	w.SendToPlayer(playerID, map[string]interface{}{
+		"type":     "auction_results",
+		"listings": results,
+		"page":     maxInt(query.Page, 0),
+		"pages":    pages,
+	})
+	return nil
+}
+
+// ListAuction puts part of an inventory slot up for auction
+func (w *World) ListAuction(playerID string, slot, quantity, minBid, buyout, hours int) error {
+	player, err := w.auctionCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	listing, err := w.auctions.Create(player, slot, quantity, minBid, buyout, hours, time.Now())
+	if err != nil {
+		return err
+	}
+	w.sendAuctionResult(player, "listed", listing)
+	return nil
+}
+
+// BidAuction bids on a listing; bids reaching the buyout buy it outright
+func (w *World) BidAuction(playerID string, id int64, amount int) error {
+	player, err := w.auctionCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	listing, err := w.auctions.Bid(player, id, amount, time.Now())
+	if err != nil {
+		return err
+	}
+	action := "bid"
+	if listing.State == AuctionSold {
+		action = "bought"
+	}
+	w.sendAuctionResult(player, action, listing)
+	return nil
+}
+
+// BuyoutAuction buys a listing for its buyout price
+func (w *World) BuyoutAuction(playerID string, id int64) error {
+	player, err := w.auctionCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	listing, err := w.auctions.Buyout(player, id, time.Now())
+	if err != nil {
+		return err
+	}
+	w.sendAuctionResult(player, "bought", listing)
+	return nil
+}
+
+// CancelAuction takes one of a player's listings off the market
+func (w *World) CancelAuction(playerID string, id int64) error {
+	player, err := w.auctionCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	listing, err := w.auctions.Cancel(player, id, time.Now())
+	if err != nil {
+		return err
+	}
+	w.sendAuctionResult(player, "cancelled", listing)
+	return nil
+}
+
+// auctionCustomer returns a player using an auctioneer who is still
+// within talking range
+func (w *World) auctionCustomer(playerID string) (*Player, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	player, exists := w.Players[playerID]
+	if !exists {
+		return nil, errors.New("player not found")
+	}
+	npcID, exists := w.auctionVisits[playerID]
+	if !exists || w.auctions == nil {
+		return nil, ErrNoAuctionOpen
+	}
+	npc, exists := w.NPCs[npcID]
+	if !exists || distance(player.GetPosition(), npc.Position) > w.settings.InteractionRange {
+		delete(w.auctionVisits, playerID)
+		return nil, ErrNPCTooFar
+	}
+	return player, nil
+}
+
+// sendAuctionResult tells a player what came of their auction action
+// along with their inventory and wallet
+func (w *World) sendAuctionResult(player *Player, action string, listing *AuctionListing) {
+	w.SendToPlayer(player.ID, map[string]interface{}{
+		"type":   "auction_update",
+		"action": action,
+		"id":     listing.ID,
+		"name":   w.auctions.describe(listing.Item),
+		"price":  listing.Bid,
+	})
+	w.SendToPlayer(player.ID, player.Inventory.Message(w.Content().Items))
+	w.SendToPlayer(player.ID, player.Wallet.Message())
+	w.deliver(w.syncCollectObjectives(player))
+}
+
+// notifyCharacter sends a message to a character by name if they are online
+func (zm *ZoneManager) notifyCharacter(name string, message map[string]interface{}) {
+	playerID := zm.onlineCharacter(name)
+	zm.mu.RLock()
+	broadcaster := zm.broadcaster
+	zm.mu.RUnlock()
+
+	if broadcaster != nil && playerID != "" {
+		broadcaster.SendToPlayer(playerID, message)
+	}
+}
+
+// onlineCharacter returns the player ID of a character by name, or ""
+// when they are not in the game
+func (zm *ZoneManager) onlineCharacter(name string) string {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+	if player, online := zm.characters[name]; online {
+		return player.ID
+	}
+	return ""
+}
+
+// runAuctionExpiry periodically settles ended auctions until stopped
+func (zm *ZoneManager) runAuctionExpiry(stop chan struct{}) {
+	ticker := time.NewTicker(auctionExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			zm.Auctions.Expire(now)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package game
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDayLength is how long a game day lasts in real time
+	DefaultDayLength = 24 * time.Minute
+	// clockStartHour is the time of day the clock shows when the server starts
+	clockStartHour = 8.0
+	// clockSyncInterval is how often zones send their players the time of day
+	clockSyncInterval = time.Minute
+)
+
+// DayPhase is a part of the game day
+type DayPhase string
+
+const (
+	PhaseDawn  DayPhase = "dawn"
+	PhaseDay   DayPhase = "day"
+	PhaseDusk  DayPhase = "dusk"
+	PhaseNight DayPhase = "night"
+)
+
+// NPC activity periods, as written in npcs.json
+const (
+	ActiveAlways = ""
+	ActiveDay    = "day"
+	ActiveNight  = "night"
+)
+
+// WorldClock is the game's time of day, shared by every zone. It runs
+// from the server's start, a full day taking the configured day length
+type WorldClock struct {
+	dayLength time.Duration
+	epoch     time.Time
+	mu        sync.RWMutex
+}
+
+// NewWorldClock starts a clock showing the start hour at the given time
+func NewWorldClock(dayLength time.Duration, now time.Time) *WorldClock {
+	if dayLength <= 0 {
+		dayLength = DefaultDayLength
+	}
+	clock := &WorldClock{dayLength: dayLength}
+	clock.epoch = now.Add(-clock.realDuration(clockStartHour))
+	return clock
+}
+
+// realDuration returns how long some game hours take in real time; the
+// caller holds the lock or is setting the clock up
+func (c *WorldClock) realDuration(hours float64) time.Duration {
+	return time.Duration(float64(c.dayLength) * hours / 24)
+}
+
+// SetDayLength changes how long a game day lasts, keeping the current
+// time of day
+func (c *WorldClock) SetDayLength(dayLength time.Duration, now time.Time) {
+	if dayLength <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := float64(now.Sub(c.epoch)) / float64(c.dayLength)
+	c.dayLength = dayLength
+	c.epoch = now.Add(-time.Duration(elapsed * float64(dayLength)))
+}
+
+// DayLength returns how long a game day lasts in real time
+func (c *WorldClock) DayLength() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dayLength
+}
+
+// Now returns the game day, counted from 1, and the hour of that day,
+// from 0 up to 24
+func (c *WorldClock) Now(now time.Time) (int, float64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	elapsed := float64(now.Sub(c.epoch)) / float64(c.dayLength)
+	day := math.Floor(elapsed)
+	return int(day) + 1, (elapsed - day) * 24
+}
+
+// Phase returns the part of the day it is
+func (c *WorldClock) Phase(now time.Time) DayPhase {
+	_, hour := c.Now(now)
+	return phaseAt(hour)
+}
+
+// IsNight reports whether it is night
+func (c *WorldClock) IsNight(now time.Time) bool {
+	return c.Phase(now) == PhaseNight
+}
+
+// phaseAt returns the part of the day an hour falls in
+func phaseAt(hour float64) DayPhase {
+	switch {
+	case hour >= 5 && hour < 7:
+		return PhaseDawn
+	case hour >= 7 && hour < 19:
+		return PhaseDay
+	case hour >= 19 && hour < 21:
+		return PhaseDusk
+	default:
+		return PhaseNight
+	}
+}
+
+// Message returns the world_time message clients set their clock by
+func (c *WorldClock) Message(now time.Time) map[string]interface{} {
+	day, hour := c.Now(now)
+	return map[string]interface{}{
+		"type":               "world_time",
+		"day":                day,
+		"hour":               hour,
+		"phase":              phaseAt(hour),
+		"day_length_seconds": c.DayLength().Seconds(),
+	}
+}
+
+// activeAt reports whether an NPC is out in a part of the day
+func activeAt(definition *NPCDefinition, phase DayPhase) bool {
+	switch definition.Active {
+	case ActiveDay:
+		return phase != PhaseNight
+	case ActiveNight:
+		return phase == PhaseNight
+	default:
+		return true
+	}
+}
+
+// IsNight reports whether it is night in the zone; zones without a
+// clock are always in daylight
+func (w *World) IsNight() bool {
+	return w.Clock != nil && w.Clock.IsNight(time.Now())
+}
+
+// updateClock sends the time of day to the zone's players now and then
+// and whenever the part of the day changes, sending NPCs who are only
+// out by day or by night home or back out; the caller holds the world lock
+func (w *World) updateClock(now time.Time) []outboundMessage {
+	if w.Clock == nil {
+		return nil
+	}
+
+	phase := w.Clock.Phase(now)
+	changed := phase != w.phase
+	w.phase = phase
+
+	var messages []outboundMessage
+	if changed || now.Sub(w.lastClockSync) >= clockSyncInterval {
+		w.lastClockSync = now
+		messages = append(messages, outboundMessage{message: w.Clock.Message(now)})
+	}
+	if changed {
+		messages = append(messages, w.updateDormantNPCs(phase, now)...)
+	}
+	return messages
+}
+
+// updateDormantNPCs puts away the NPCs who are not out in a part of the
+// day and brings back those who are; the caller holds the world lock
+func (w *World) updateDormantNPCs(phase DayPhase, now time.Time) []outboundMessage {
+	var messages []outboundMessage
+
+	for id, npc := range w.NPCs {
+		if npc.AI == nil || activeAt(npc.AI.Definition, phase) {
+			continue
+		}
+		delete(w.NPCs, id)
+		if npc.Effects != nil {
+			npc.Effects.Clear()
+		}
+		if npc.AI.request != nil {
+			npc.AI.request.Cancel()
+			npc.AI.request = nil
+		}
+		npc.AI.path = nil
+		w.dormant[id] = npc
+
+		position := npc.Position
+		messages = append(messages, outboundMessage{near: &position, message: map[string]interface{}{
+			"type": "npc_despawned",
+			"id":   id,
+		}})
+	}
+
+	for id, npc := range w.dormant {
+		if !activeAt(npc.AI.Definition, phase) {
+			continue
+		}
+		delete(w.dormant, id)
+		messages = append(messages, w.returnNPC(npc, now)...)
+	}
+
+	return messages
+}
+
+// returnNPC puts an NPC back at its home with full health, or away until
+// its part of the day comes when it is not out now; the caller holds the
+// world lock
+func (w *World) returnNPC(npc *Entity, now time.Time) []outboundMessage {
+	if w.Clock != nil && !activeAt(npc.AI.Definition, w.Clock.Phase(now)) {
+		w.dormant[npc.ID] = npc
+		return nil
+	}
+
+	npc.Position = npc.AI.Home
+	npc.Health = npc.MaxHealth
+	npc.AI.waitUntil = now
+	w.NPCs[npc.ID] = npc
+
+	position := npc.Position
+	appearance := npcAppearance(npc)
+	appearance["type"] = "npc_spawned"
+	return []outboundMessage{{near: &position, message: appearance}}
+}
@@ -0,0 +1,187 @@
+package game
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// AttackRange is how close a player must stand to hit an NPC
+	AttackRange = 64.0
+	// AttackCooldown is the time between two attacks of a player
+	AttackCooldown  = time.Second
+	attackDamageMin = 8
+	attackDamageMax = 15
+)
+
+var (
+	ErrTargetNotFound = errors.New("target not found")
+	ErrNotAttackable  = errors.New("target cannot be attacked")
+	ErrTargetTooFar   = errors.New("target is too far away")
+	ErrAttackCooldown = errors.New("attack is not ready yet")
+)
+
+// npcRespawn is a killed NPC waiting to come back at its home
+type npcRespawn struct {
+	npc *Entity
+	at  time.Time
+}
+
+// AttackNPC makes a player hit an NPC, killing it and dropping its loot
+// when its health runs out
+func (w *World) AttackNPC(playerID, npcID string) error {
+	now := time.Now()
+
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	npc, exists := w.NPCs[npcID]
+	if !exists {
+		w.mu.Unlock()
+		return ErrTargetNotFound
+	}
+	if npc.MaxHealth <= 0 {
+		w.mu.Unlock()
+		return ErrNotAttackable
+	}
+	if distance(player.GetPosition(), npc.Position) > AttackRange {
+		w.mu.Unlock()
+		return ErrTargetTooFar
+	}
+	if !player.Life.Alive() {
+		w.mu.Unlock()
+		return ErrDead
+	}
+	if player.Effects.Has(ControlStun) {
+		w.mu.Unlock()
+		return ErrStunned
+	}
+	if now.Sub(w.lastAttack[playerID]) < AttackCooldown {
+		w.mu.Unlock()
+		return ErrAttackCooldown
+	}
+	w.lastAttack[playerID] = now
+
+	damage := attackDamageMin + w.rng.Intn(attackDamageMax-attackDamageMin+1)
+	damage = scaleDamage(damage, player.Stats(), ComputeStats(nil, npc.Effects))
+	npc.Health -= damage
+	if npc.Health < 0 {
+		npc.Health = 0
+	}
+
+	position := npc.Position
+	messages := []outboundMessage{{near: &position, message: map[string]interface{}{
+		"type":       "npc_damaged",
+		"id":         npc.ID,
+		"attacker":   player.ID,
+		"damage":     damage,
+		"health":     npc.Health,
+		"max_health": npc.MaxHealth,
+	}}}
+	if npc.Health == 0 {
+		messages = append(messages, w.killNPC(npc, player, now)...)
+	}
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	return nil
+}
+
+// killNPC removes a dead NPC until it respawns, credits the kill to the
+// killer and their party and drops its loot; the caller holds the world lock
+func (w *World) killNPC(npc *Entity, killer *Player, now time.Time) []outboundMessage {
+	delete(w.NPCs, npc.ID)
+	if npc.Effects != nil {
+		npc.Effects.Clear()
+	}
+
+	position := npc.Position
+	messages := []outboundMessage{{near: &position, message: map[string]interface{}{
+		"type":      "npc_died",
+		"id":        npc.ID,
+		"killer_id": killer.ID,
+	}}}
+	w.AddStatistic(killer, StatisticKills, 1)
+	killed := EntityKilled{Killer: killer, Zone: w.ID, VictimID: npc.ID, Kind: npc.Name}
+	if npc.AI != nil {
+		killed.Kind = npc.AI.Definition.ID
+	}
+	w.publish(killed)
+
+	if brain := npc.AI; brain != nil {
+		if brain.request != nil {
+			brain.request.Cancel()
+			brain.request = nil
+		}
+		brain.path = nil
+		if !brain.summoned {
+			w.respawns = append(w.respawns, &npcRespawn{
+				npc: npc,
+				at:  now.Add(time.Duration(brain.Definition.RespawnSeconds) * time.Second),
+			})
+		}
+		if brain.Definition.Script != "" {
+			w.queueScript(brain.Definition.Script, ScriptOnDeath, npcValue(npc), playerValue(killer))
+		}
+		credited := w.killCredit(npc, killer)
+		for playerID := range credited {
+			messages = append(messages, w.questEvent(w.Players[playerID], ObjectiveKill, brain.Definition.ID, 1)...)
+		}
+		messages = append(messages, w.dropNPCLoot(npc, killer, credited, now)...)
+	}
+
+	return messages
+}
+
+// respawnNPCs brings back killed NPCs whose respawn time has come, or
+// puts them away until their part of the day; the caller holds the
+// world lock
+func (w *World) respawnNPCs(now time.Time) []outboundMessage {
+	var messages []outboundMessage
+
+	waiting := w.respawns[:0]
+	for _, respawn := range w.respawns {
+		if now.Before(respawn.at) {
+			waiting = append(waiting, respawn)
+			continue
+		}
+
+		messages = append(messages, w.returnNPC(respawn.npc, now)...)
+	}
+	w.respawns = waiting
+
+	return messages
+}
+
+// killCredit returns the players sharing a kill, by ID with their
+// character names: the killer and the members of their party who are in
+// the zone and near the body. The caller holds the world lock
+func (w *World) killCredit(npc *Entity, killer *Player) map[string]string {
+	credited := map[string]string{killer.ID: killer.Name}
+	if w.parties == nil {
+		return credited
+	}
+	if group, inParty := w.parties.LootGroupOf(killer.ID); inParty {
+		for _, memberID := range group.MemberIDs {
+			member, inZone := w.Players[memberID]
+			if inZone && w.withinAOI(member.GetPosition(), npc.Position) {
+				credited[memberID] = member.Name
+			}
+		}
+	}
+	return credited
+}
+
+func npcAppearance(npc *Entity) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         npc.ID,
+		"name":       npc.Name,
+		"x":          npc.Position.X,
+		"y":          npc.Position.Y,
+		"health":     npc.Health,
+		"max_health": npc.MaxHealth,
+	}
+}
@@ -0,0 +1,721 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang-mmo-server/internal/loot"
+)
+
+// Content holds every data-driven definition the server loads at startup
+type Content struct {
+	// Dir is the directory the content was loaded from
+	Dir         string
+	Maps        map[string]*TileMap
+	NPCs        map[string]*NPCDefinition
+	Zones       map[string]*ZoneDefinition
+	DefaultZone string
+	Instances   map[string]*InstanceTemplate
+	Items       map[string]*ItemDefinition
+	LootTables  *loot.Registry
+	Quests      map[string]*QuestDefinition
+	Dialogues   map[string]*Dialogue
+	Shops       map[string]*ShopDefinition
+	Resources   map[string]*ResourceDefinition
+	Recipes     map[string]*RecipeDefinition
+	Abilities   map[string]*AbilityDefinition
+	Statuses    map[string]*StatusEffectDefinition
+	// Achievements are indexed by the event, statistic or level change
+	// that moves them on, and listed in file order
+	Achievements     map[string]*AchievementDefinition
+	achievementIndex map[string][]*AchievementDefinition
+	achievementList  []*AchievementDefinition
+	// Scripts are the scripts below content/scripts, reloaded as they change
+	Scripts *Scripts
+}
+
+// LoadContent reads all content files below the given directory
+func LoadContent(dir string) (*Content, error) {
+	content := &Content{
+		Dir:       dir,
+		Maps:      make(map[string]*TileMap),
+		NPCs:      make(map[string]*NPCDefinition),
+		Zones:     make(map[string]*ZoneDefinition),
+		Instances: make(map[string]*InstanceTemplate),
+		Items:     make(map[string]*ItemDefinition),
+		Quests:    make(map[string]*QuestDefinition),
+		Dialogues: make(map[string]*Dialogue),
+		Shops:     make(map[string]*ShopDefinition),
+		Resources: make(map[string]*ResourceDefinition),
+		Recipes:   make(map[string]*RecipeDefinition),
+		Abilities: make(map[string]*AbilityDefinition),
+		Statuses:  make(map[string]*StatusEffectDefinition),
+
+		Achievements:     make(map[string]*AchievementDefinition),
+		achievementIndex: make(map[string][]*AchievementDefinition),
+	}
+
+	var items []*ItemDefinition
+	if err := loadJSONFile(filepath.Join(dir, "items.json"), &items); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if _, exists := content.Items[item.ID]; exists {
+			return nil, fmt.Errorf("items.json: duplicate item id %q", item.ID)
+		}
+		item.applyDefaults()
+		content.Items[item.ID] = item
+	}
+
+	if err := content.loadMaps(filepath.Join(dir, "maps")); err != nil {
+		return nil, err
+	}
+
+	scripts, err := LoadScripts(filepath.Join(dir, "scripts"))
+	if err != nil {
+		return nil, err
+	}
+	content.Scripts = scripts
+
+	var npcs []*NPCDefinition
+	if err := loadJSONFile(filepath.Join(dir, "npcs.json"), &npcs); err != nil {
+		return nil, err
+	}
+	for _, npc := range npcs {
+		if _, exists := content.NPCs[npc.ID]; exists {
+			return nil, fmt.Errorf("npcs.json: duplicate npc id %q", npc.ID)
+		}
+		switch npc.Active {
+		case ActiveAlways, ActiveDay, ActiveNight:
+		default:
+			return nil, fmt.Errorf("npcs.json: npc %q has unknown active period %q", npc.ID, npc.Active)
+		}
+		if npc.Script != "" {
+			if err := content.checkScript(npc.Script); err != nil {
+				return nil, fmt.Errorf("npcs.json: npc %q: %w", npc.ID, err)
+			}
+		}
+		npc.applyDefaults()
+		content.NPCs[npc.ID] = npc
+	}
+
+	if err := content.loadLootTables(filepath.Join(dir, "loot_tables.json")); err != nil {
+		return nil, err
+	}
+
+	if err := content.loadZones(filepath.Join(dir, "zones.json")); err != nil {
+		return nil, err
+	}
+
+	if err := content.loadInstances(filepath.Join(dir, "instances.json")); err != nil {
+		return nil, err
+	}
+
+	if err := content.loadQuests(filepath.Join(dir, "quests.json")); err != nil {
+		return nil, err
+	}
+
+	if err := content.loadShops(filepath.Join(dir, "shops.json")); err != nil {
+		return nil, err
+	}
+
+	if err := content.loadDialogues(filepath.Join(dir, "dialogues.json")); err != nil {
+		return nil, err
+	}
+
+	if err := content.loadResources(filepath.Join(dir, "resources.json")); err != nil {
+		return nil, err
+	}
+
+	if err := content.loadRecipes(filepath.Join(dir, "recipes.json")); err != nil {
+		return nil, err
+	}
+
+	if err := content.loadStatusEffects(filepath.Join(dir, "status_effects.json")); err != nil {
+		return nil, err
+	}
+
+	if err := content.loadAbilities(filepath.Join(dir, "abilities.json")); err != nil {
+		return nil, err
+	}
+
+	if err := content.loadAchievements(filepath.Join(dir, "achievements.json")); err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// loadLootTables reads loot tables, checking that the items they drop
+// exist and that every NPC's loot table does
+func (c *Content) loadLootTables(path string) error {
+	var tables []*loot.Table
+	if err := loadJSONFile(path, &tables); err != nil {
+		return err
+	}
+
+	registry, err := loot.NewRegistry(tables)
+	if err != nil {
+		return fmt.Errorf("loot_tables.json: %w", err)
+	}
+	for _, itemID := range registry.Items() {
+		if _, exists := c.Items[itemID]; !exists {
+			return fmt.Errorf("loot_tables.json: unknown item %q", itemID)
+		}
+	}
+	for _, npc := range c.NPCs {
+		if _, exists := registry.Table(npc.LootTable); npc.LootTable != "" && !exists {
+			return fmt.Errorf("npcs.json: npc %q uses unknown loot table %q", npc.ID, npc.LootTable)
+		}
+	}
+
+	c.LootTables = registry
+	return nil
+}
+
+// loadZones reads zone definitions; without a zones file every map
+// becomes a zone of its own and "overworld" is where players start
+func (c *Content) loadZones(path string) error {
+	var zones []*ZoneDefinition
+	if err := loadJSONFile(path, &zones); err != nil {
+		return err
+	}
+
+	if len(zones) == 0 {
+		for key, tileMap := range c.Maps {
+			zones = append(zones, &ZoneDefinition{ID: key, Name: tileMap.Name, Map: key, Default: key == "overworld"})
+		}
+	}
+
+	for _, zone := range zones {
+		if _, exists := c.Zones[zone.ID]; exists {
+			return fmt.Errorf("zones.json: duplicate zone id %q", zone.ID)
+		}
+		tileMap, exists := c.Maps[zone.Map]
+		if !exists {
+			return fmt.Errorf("zones.json: zone %q uses unknown map %q", zone.ID, zone.Map)
+		}
+		if zone.Name == "" {
+			zone.Name = tileMap.Name
+		}
+		if zone.PvP == "" {
+			zone.PvP = PvPFlagged
+		}
+		if !validPvPRule(zone.PvP) {
+			return fmt.Errorf("zones.json: zone %q has unknown pvp rule %q", zone.ID, zone.PvP)
+		}
+		if err := checkPvPRegions(tileMap); err != nil {
+			return fmt.Errorf("zones.json: zone %q map %q: %w", zone.ID, zone.Map, err)
+		}
+		if zone.Weather != nil {
+			zone.Weather.applyDefaults()
+			if err := zone.Weather.validate(); err != nil {
+				return fmt.Errorf("zones.json: zone %q weather: %w", zone.ID, err)
+			}
+		}
+		if zone.Default {
+			if c.DefaultZone != "" {
+				return fmt.Errorf("zones.json: zones %q and %q are both marked default", c.DefaultZone, zone.ID)
+			}
+			c.DefaultZone = zone.ID
+		}
+		c.Zones[zone.ID] = zone
+	}
+
+	if len(c.Zones) > 0 && c.DefaultZone == "" {
+		return errors.New("zones.json: no default zone")
+	}
+	return nil
+}
+
+// loadInstances reads instance templates, checking their map and exit
+func (c *Content) loadInstances(path string) error {
+	var templates []*InstanceTemplate
+	if err := loadJSONFile(path, &templates); err != nil {
+		return err
+	}
+
+	for _, template := range templates {
+		if _, exists := c.Instances[template.ID]; exists {
+			return fmt.Errorf("instances.json: duplicate instance id %q", template.ID)
+		}
+		if strings.Contains(template.ID, "#") {
+			return fmt.Errorf("instances.json: instance id %q must not contain '#'", template.ID)
+		}
+		tileMap, exists := c.Maps[template.Map]
+		if !exists {
+			return fmt.Errorf("instances.json: instance %q uses unknown map %q", template.ID, template.Map)
+		}
+		if template.Name == "" {
+			template.Name = tileMap.Name
+		}
+		if template.ExitZone == "" {
+			template.ExitZone = c.DefaultZone
+		}
+		if _, exists := c.Zones[template.ExitZone]; !exists {
+			return fmt.Errorf("instances.json: instance %q exits to unknown zone %q", template.ID, template.ExitZone)
+		}
+		switch template.Reset {
+		case "", ResetNone, ResetDaily, ResetWeekly:
+		default:
+			return fmt.Errorf("instances.json: instance %q has unknown reset %q", template.ID, template.Reset)
+		}
+		template.applyDefaults()
+		if !validPvPRule(template.PvP) {
+			return fmt.Errorf("instances.json: instance %q has unknown pvp rule %q", template.ID, template.PvP)
+		}
+		if err := checkPvPRegions(tileMap); err != nil {
+			return fmt.Errorf("instances.json: instance %q map %q: %w", template.ID, template.Map, err)
+		}
+		c.Instances[template.ID] = template
+	}
+
+	return nil
+}
+
+// loadQuests reads quest definitions, checking that the NPCs, items,
+// regions and quests they refer to exist
+func (c *Content) loadQuests(path string) error {
+	var quests []*QuestDefinition
+	if err := loadJSONFile(path, &quests); err != nil {
+		return err
+	}
+
+	for _, quest := range quests {
+		if _, exists := c.Quests[quest.ID]; exists {
+			return fmt.Errorf("quests.json: duplicate quest id %q", quest.ID)
+		}
+		quest.applyDefaults()
+		c.Quests[quest.ID] = quest
+	}
+
+	for _, quest := range c.Quests {
+		for _, npcID := range []string{quest.Giver, quest.TurnIn} {
+			if _, exists := c.NPCs[npcID]; npcID != "" && !exists {
+				return fmt.Errorf("quests.json: quest %q uses unknown npc %q", quest.ID, npcID)
+			}
+		}
+		for _, prerequisite := range quest.Prerequisites {
+			if _, exists := c.Quests[prerequisite]; !exists {
+				return fmt.Errorf("quests.json: quest %q requires unknown quest %q", quest.ID, prerequisite)
+			}
+		}
+		if len(quest.Objectives) == 0 {
+			return fmt.Errorf("quests.json: quest %q has no objectives", quest.ID)
+		}
+		for _, objective := range quest.Objectives {
+			if err := c.checkObjective(objective); err != nil {
+				return fmt.Errorf("quests.json: quest %q: %w", quest.ID, err)
+			}
+		}
+		for _, reward := range quest.Rewards.Items {
+			if _, exists := c.Items[reward.Item]; !exists {
+				return fmt.Errorf("quests.json: quest %q rewards unknown item %q", quest.ID, reward.Item)
+			}
+		}
+		if quest.Script != "" {
+			if err := c.checkScript(quest.Script); err != nil {
+				return fmt.Errorf("quests.json: quest %q: %w", quest.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadAchievements reads achievements, checking their criteria can be
+// met and their rewards exist
+func (c *Content) loadAchievements(path string) error {
+	var achievements []*AchievementDefinition
+	if err := loadJSONFile(path, &achievements); err != nil {
+		return err
+	}
+
+	for _, achievement := range achievements {
+		if _, exists := c.Achievements[achievement.ID]; exists {
+			return fmt.Errorf("achievements.json: duplicate achievement id %q", achievement.ID)
+		}
+		achievement.applyDefaults()
+		if len(achievement.Criteria) == 0 {
+			return fmt.Errorf("achievements.json: achievement %q has no criteria", achievement.ID)
+		}
+		indexed := make(map[string]bool)
+		for _, criterion := range achievement.Criteria {
+			if err := c.checkCriterion(criterion); err != nil {
+				return fmt.Errorf("achievements.json: achievement %q: %w", achievement.ID, err)
+			}
+			if key := achievementKey(criterion); !indexed[key] {
+				indexed[key] = true
+				c.achievementIndex[key] = append(c.achievementIndex[key], achievement)
+			}
+		}
+		for _, reward := range achievement.Rewards.Items {
+			if _, exists := c.Items[reward.Item]; !exists {
+				return fmt.Errorf("achievements.json: achievement %q rewards unknown item %q", achievement.ID, reward.Item)
+			}
+			if reward.Quantity <= 0 {
+				return fmt.Errorf("achievements.json: achievement %q rewards no %q", achievement.ID, reward.Item)
+			}
+		}
+		c.Achievements[achievement.ID] = achievement
+		c.achievementList = append(c.achievementList, achievement)
+	}
+
+	return nil
+}
+
+// checkCriterion checks that an achievement criterion sets one goal that
+// can be met
+func (c *Content) checkCriterion(criterion AchievementCriterion) error {
+	goals := 0
+	for _, set := range []bool{criterion.Event != "", criterion.Statistic != "", criterion.Level > 0} {
+		if set {
+			goals++
+		}
+	}
+	if goals != 1 {
+		return errors.New("a criterion needs exactly one of event, statistic and level")
+	}
+
+	switch {
+	case criterion.Event != "":
+		if !countedEvents[criterion.Event] {
+			return fmt.Errorf("criterion counts unknown event %q", criterion.Event)
+		}
+		if criterion.Event == CriterionKill && criterion.Target != "" && criterion.Target != KillTargetPlayer {
+			if _, exists := c.NPCs[criterion.Target]; !exists {
+				return fmt.Errorf("criterion counts kills of unknown npc %q", criterion.Target)
+			}
+		}
+		if criterion.Event == CriterionQuestCompleted && criterion.Target != "" {
+			if _, exists := c.Quests[criterion.Target]; !exists {
+				return fmt.Errorf("criterion counts unknown quest %q", criterion.Target)
+			}
+		}
+	case criterion.Statistic != "":
+		if !knownStatistic(criterion.Statistic) {
+			return fmt.Errorf("criterion uses unknown statistic %q", criterion.Statistic)
+		}
+		if criterion.Count <= 0 {
+			return fmt.Errorf("criterion on %q needs a positive count", criterion.Statistic)
+		}
+	}
+	return nil
+}
+
+// loadShops reads vendor shops, checking the items they sell exist and
+// their prices and stock make sense
+func (c *Content) loadShops(path string) error {
+	var shops []*ShopDefinition
+	if err := loadJSONFile(path, &shops); err != nil {
+		return err
+	}
+
+	for _, shop := range shops {
+		if _, exists := c.Shops[shop.ID]; exists {
+			return fmt.Errorf("shops.json: duplicate shop id %q", shop.ID)
+		}
+		shop.applyDefaults()
+		sold := make(map[string]bool)
+		for _, item := range shop.Items {
+			if _, exists := c.Items[item.Item]; !exists {
+				return fmt.Errorf("shops.json: shop %q sells unknown item %q", shop.ID, item.Item)
+			}
+			if sold[item.Item] {
+				return fmt.Errorf("shops.json: shop %q lists item %q twice", shop.ID, item.Item)
+			}
+			sold[item.Item] = true
+			if item.Price <= 0 {
+				return fmt.Errorf("shops.json: shop %q has no price for item %q", shop.ID, item.Item)
+			}
+			if item.Stock < 0 || item.RestockSeconds < 0 {
+				return fmt.Errorf("shops.json: shop %q has negative stock for item %q", shop.ID, item.Item)
+			}
+		}
+		c.Shops[shop.ID] = shop
+	}
+	return nil
+}
+
+// loadDialogues reads NPC conversations, checking that everything they
+// refer to exists and that every NPC's dialogue does
+func (c *Content) loadDialogues(path string) error {
+	var dialogues []*Dialogue
+	if err := loadJSONFile(path, &dialogues); err != nil {
+		return err
+	}
+
+	for _, dialogue := range dialogues {
+		if _, exists := c.Dialogues[dialogue.ID]; exists {
+			return fmt.Errorf("dialogues.json: duplicate dialogue id %q", dialogue.ID)
+		}
+		if err := dialogue.validate(c); err != nil {
+			return fmt.Errorf("dialogues.json: dialogue %q: %w", dialogue.ID, err)
+		}
+		c.Dialogues[dialogue.ID] = dialogue
+	}
+
+	for _, npc := range c.NPCs {
+		if _, exists := c.Dialogues[npc.Dialogue]; npc.Dialogue != "" && !exists {
+			return fmt.Errorf("npcs.json: npc %q uses unknown dialogue %q", npc.ID, npc.Dialogue)
+		}
+	}
+	return nil
+}
+
+// loadResources reads resource node kinds, checking their loot tables and
+// that the resource spawns of every map use a known kind
+func (c *Content) loadResources(path string) error {
+	var resources []*ResourceDefinition
+	if err := loadJSONFile(path, &resources); err != nil {
+		return err
+	}
+
+	for _, resource := range resources {
+		if _, exists := c.Resources[resource.ID]; exists {
+			return fmt.Errorf("resources.json: duplicate resource id %q", resource.ID)
+		}
+		if resource.Profession == "" {
+			return fmt.Errorf("resources.json: resource %q has no profession", resource.ID)
+		}
+		if c.LootTables == nil {
+			return fmt.Errorf("resources.json: resource %q uses unknown loot table %q", resource.ID, resource.LootTable)
+		}
+		if _, exists := c.LootTables.Table(resource.LootTable); !exists {
+			return fmt.Errorf("resources.json: resource %q uses unknown loot table %q", resource.ID, resource.LootTable)
+		}
+		resource.applyDefaults()
+		c.Resources[resource.ID] = resource
+	}
+
+	for key, tileMap := range c.Maps {
+		for _, point := range tileMap.SpawnsOfType("resource") {
+			if _, exists := c.Resources[point.Properties["resource"]]; !exists {
+				return fmt.Errorf("map %q: resource spawn %q uses unknown resource %q", key, point.Name, point.Properties["resource"])
+			}
+		}
+	}
+	return nil
+}
+
+// loadAbilities reads ability definitions, checking their targeting and
+// effects make sense
+func (c *Content) loadAbilities(path string) error {
+	var abilities []*AbilityDefinition
+	if err := loadJSONFile(path, &abilities); err != nil {
+		return err
+	}
+
+	for _, ability := range abilities {
+		if _, exists := c.Abilities[ability.ID]; exists {
+			return fmt.Errorf("abilities.json: duplicate ability id %q", ability.ID)
+		}
+		switch ability.Targeting {
+		case TargetSelf, TargetUnit:
+		case TargetGround, TargetArea:
+			if ability.Radius <= 0 {
+				return fmt.Errorf("abilities.json: ability %q needs a radius", ability.ID)
+			}
+		default:
+			return fmt.Errorf("abilities.json: ability %q has unknown targeting %q", ability.ID, ability.Targeting)
+		}
+		if len(ability.Effects) == 0 {
+			return fmt.Errorf("abilities.json: ability %q has no effects", ability.ID)
+		}
+		for i := range ability.Effects {
+			effect := &ability.Effects[i]
+			switch effect.Type {
+			case EffectDamage, EffectHeal:
+				if effect.Min <= 0 {
+					return fmt.Errorf("abilities.json: ability %q has an effect without an amount", ability.ID)
+				}
+			case EffectApply:
+				status, exists := c.Statuses[effect.Status]
+				if !exists {
+					return fmt.Errorf("abilities.json: ability %q applies unknown status effect %q", ability.ID, effect.Status)
+				}
+				effect.status = status
+			case EffectDispel:
+				if effect.Dispel == "" {
+					return fmt.Errorf("abilities.json: ability %q has a dispel without a category", ability.ID)
+				}
+			case EffectResurrect:
+				if ability.Targeting != TargetUnit {
+					return fmt.Errorf("abilities.json: ability %q resurrects without a target", ability.ID)
+				}
+				if effect.Min <= 0 || effect.Min > 100 {
+					return fmt.Errorf("abilities.json: ability %q resurrects with %d%% health", ability.ID, effect.Min)
+				}
+			default:
+				return fmt.Errorf("abilities.json: ability %q has unknown effect %q", ability.ID, effect.Type)
+			}
+		}
+		if ability.Targeting == TargetSelf && ability.hostile() {
+			return fmt.Errorf("abilities.json: ability %q cannot damage its caster", ability.ID)
+		}
+		if ability.Mana < 0 || ability.Stamina < 0 || ability.CastSeconds < 0 || ability.CooldownSeconds < 0 {
+			return fmt.Errorf("abilities.json: ability %q has a negative cost or time", ability.ID)
+		}
+		ability.applyDefaults()
+		c.Abilities[ability.ID] = ability
+	}
+	return nil
+}
+
+// loadStatusEffects reads buffs and debuffs, checking their stats and
+// crowd-control states are known
+func (c *Content) loadStatusEffects(path string) error {
+	var statuses []*StatusEffectDefinition
+	if err := loadJSONFile(path, &statuses); err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if _, exists := c.Statuses[status.ID]; exists {
+			return fmt.Errorf("status_effects.json: duplicate status effect id %q", status.ID)
+		}
+		if status.DurationSeconds <= 0 {
+			return fmt.Errorf("status_effects.json: status effect %q needs a duration", status.ID)
+		}
+		if status.TickSeconds < 0 || status.TickDamage < 0 || status.TickHeal < 0 {
+			return fmt.Errorf("status_effects.json: status effect %q has a negative tick", status.ID)
+		}
+		if (status.TickDamage > 0 || status.TickHeal > 0) && status.TickSeconds == 0 {
+			return fmt.Errorf("status_effects.json: status effect %q ticks without tick_seconds", status.ID)
+		}
+		for stat := range status.Modifiers {
+			if !knownStats[stat] {
+				return fmt.Errorf("status_effects.json: status effect %q modifies unknown stat %q", status.ID, stat)
+			}
+		}
+		for _, control := range status.Control {
+			if control != ControlStun && control != ControlRoot {
+				return fmt.Errorf("status_effects.json: status effect %q has unknown control %q", status.ID, control)
+			}
+		}
+		status.applyDefaults()
+		c.Statuses[status.ID] = status
+	}
+	return nil
+}
+
+// loadRecipes reads crafting recipes, checking their items exist and that
+// some map has the station they are made at
+func (c *Content) loadRecipes(path string) error {
+	var recipes []*RecipeDefinition
+	if err := loadJSONFile(path, &recipes); err != nil {
+		return err
+	}
+
+	stations := make(map[string]bool)
+	for _, tileMap := range c.Maps {
+		for _, region := range tileMap.Regions {
+			if region.Type == "station" {
+				stations[region.Properties["station"]] = true
+			}
+		}
+	}
+
+	for _, recipe := range recipes {
+		if _, exists := c.Recipes[recipe.ID]; exists {
+			return fmt.Errorf("recipes.json: duplicate recipe id %q", recipe.ID)
+		}
+		if recipe.Profession == "" {
+			return fmt.Errorf("recipes.json: recipe %q has no profession", recipe.ID)
+		}
+		if len(recipe.Inputs) == 0 || len(recipe.Outputs) == 0 {
+			return fmt.Errorf("recipes.json: recipe %q needs inputs and outputs", recipe.ID)
+		}
+		for _, item := range append(append([]RecipeItem{}, recipe.Inputs...), recipe.Outputs...) {
+			if _, exists := c.Items[item.Item]; !exists {
+				return fmt.Errorf("recipes.json: recipe %q uses unknown item %q", recipe.ID, item.Item)
+			}
+		}
+		if recipe.Station != "" && !stations[recipe.Station] {
+			return fmt.Errorf("recipes.json: recipe %q needs station %q which no map has", recipe.ID, recipe.Station)
+		}
+		recipe.applyDefaults()
+		c.Recipes[recipe.ID] = recipe
+	}
+	return nil
+}
+
+// checkObjective checks that the target of a quest objective exists
+func (c *Content) checkObjective(objective QuestObjective) error {
+	switch objective.Type {
+	case ObjectiveKill, ObjectiveTalk:
+		if _, exists := c.NPCs[objective.Target]; !exists {
+			return fmt.Errorf("unknown npc %q", objective.Target)
+		}
+	case ObjectiveCollect:
+		if _, exists := c.Items[objective.Target]; !exists {
+			return fmt.Errorf("unknown item %q", objective.Target)
+		}
+	case ObjectiveReach:
+		var maps []*TileMap
+		switch {
+		case objective.Zone == "":
+			for _, tileMap := range c.Maps {
+				maps = append(maps, tileMap)
+			}
+		case c.Zones[objective.Zone] != nil:
+			maps = append(maps, c.Maps[c.Zones[objective.Zone].Map])
+		case c.Instances[objective.Zone] != nil:
+			maps = append(maps, c.Maps[c.Instances[objective.Zone].Map])
+		default:
+			return fmt.Errorf("unknown zone %q", objective.Zone)
+		}
+		for _, tileMap := range maps {
+			if _, exists := tileMap.Region(objective.Target); exists {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown region %q", objective.Target)
+	default:
+		return fmt.Errorf("unknown objective type %q", objective.Type)
+	}
+	return nil
+}
+
+// loadMaps loads every Tiled map in a directory, keyed by file name
+func (c *Content) loadMaps(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		tileMap, err := LoadTileMap(path)
+		if err != nil {
+			return err
+		}
+
+		key := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if tileMap.Name == "" {
+			tileMap.Name = key
+		}
+		c.Maps[key] = tileMap
+	}
+
+	return nil
+}
+
+// loadJSONFile decodes a content file, treating a missing file as empty
+func loadJSONFile(path string, target interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
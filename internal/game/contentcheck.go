@@ -0,0 +1,967 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang-mmo-server/internal/loot"
+)
+
+// Severity says whether a content problem breaks the game or only looks
+// like a mistake
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// ContentProblem is one thing CheckContent found wrong in a content file
+type ContentProblem struct {
+	File     string
+	Severity Severity
+	Message  string
+}
+
+// String formats the problem as "file: severity: message"
+func (p ContentProblem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.File, p.Severity, p.Message)
+}
+
+// ContentReport lists the problems CheckContent found, in the order found
+type ContentReport struct {
+	Problems []ContentProblem
+}
+
+func (r *ContentReport) errorf(file, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, ContentProblem{File: file, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ContentReport) warnf(file, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, ContentProblem{File: file, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+// Errors returns how many of the problems are errors
+func (r *ContentReport) Errors() int {
+	return r.count(SeverityError)
+}
+
+// Warnings returns how many of the problems are warnings
+func (r *ContentReport) Warnings() int {
+	return r.count(SeverityWarning)
+}
+
+func (r *ContentReport) count(severity Severity) int {
+	count := 0
+	for _, problem := range r.Problems {
+		if problem.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// CheckContent validates a content directory without starting a server.
+// Unlike LoadContent it keeps going after a problem: files are checked for
+// syntax, duplicate IDs and broken references first, and once those are
+// clean the content is loaded and checked for things that only show up in
+// play, such as spawns players cannot walk to and quests nobody can finish
+func CheckContent(dir string) *ContentReport {
+	report := &ContentReport{}
+
+	// References are only worth checking once every file could be read,
+	// otherwise everything the unreadable file defines shows up as unknown
+	sources := readContentSources(dir, report)
+	if sources.complete {
+		sources.checkReferences(report)
+	}
+	if report.Errors() > 0 {
+		return report
+	}
+
+	content, err := LoadContent(dir)
+	if err != nil {
+		file, message := dir, err.Error()
+		if prefix, rest, found := strings.Cut(message, ": "); found && strings.HasSuffix(prefix, ".json") {
+			file, message = prefix, rest
+		}
+		report.errorf(file, "%s", message)
+		return report
+	}
+
+	check := &contentCheck{content: content, report: report}
+	check.run()
+	return report
+}
+
+// contentSources are the definition files as written, before LoadContent
+// fills in defaults and stops at the first problem
+type contentSources struct {
+	items        []*ItemDefinition
+	npcs         []*NPCDefinition
+	lootTables   []*loot.Table
+	zones        []*ZoneDefinition
+	instances    []*InstanceTemplate
+	quests       []*QuestDefinition
+	shops        []*ShopDefinition
+	dialogues    []*Dialogue
+	resources    []*ResourceDefinition
+	recipes      []*RecipeDefinition
+	abilities    []*AbilityDefinition
+	statuses     []*StatusEffectDefinition
+	achievements []*AchievementDefinition
+	maps         map[string]*TileMap
+	// complete is false when a file could not be read or decoded
+	complete bool
+}
+
+// readContentSources decodes every content file, reporting syntax errors,
+// entries without an ID and IDs used twice in a file
+func readContentSources(dir string, report *ContentReport) *contentSources {
+	sources := &contentSources{maps: make(map[string]*TileMap), complete: true}
+
+	files := []struct {
+		name   string
+		target interface{}
+	}{
+		{"items.json", &sources.items},
+		{"npcs.json", &sources.npcs},
+		{"loot_tables.json", &sources.lootTables},
+		{"zones.json", &sources.zones},
+		{"instances.json", &sources.instances},
+		{"quests.json", &sources.quests},
+		{"shops.json", &sources.shops},
+		{"dialogues.json", &sources.dialogues},
+		{"resources.json", &sources.resources},
+		{"recipes.json", &sources.recipes},
+		{"abilities.json", &sources.abilities},
+		{"status_effects.json", &sources.statuses},
+		{"achievements.json", &sources.achievements},
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, file.name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			report.errorf(file.name, "%v", err)
+			sources.complete = false
+			continue
+		}
+
+		var entries []struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(data, &entries); err != nil {
+			report.errorf(file.name, "%s", describeJSONError(data, err))
+			sources.complete = false
+			continue
+		}
+		seen := make(map[string]bool)
+		for i, entry := range entries {
+			switch {
+			case entry.ID == "":
+				report.errorf(file.name, "entry %d has no id", i)
+			case seen[entry.ID]:
+				report.errorf(file.name, "duplicate id %q", entry.ID)
+			}
+			seen[entry.ID] = true
+		}
+
+		if err := json.Unmarshal(data, file.target); err != nil {
+			report.errorf(file.name, "%s", describeJSONError(data, err))
+			sources.complete = false
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "maps", "*.json"))
+	if err != nil {
+		report.errorf("maps", "%v", err)
+		sources.complete = false
+	}
+	for _, path := range paths {
+		name := mapFile(strings.TrimSuffix(filepath.Base(path), ".json"))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			report.errorf(name, "%v", err)
+			sources.complete = false
+			continue
+		}
+		tileMap, err := ParseTileMap(data)
+		if err != nil {
+			report.errorf(name, "%s", describeJSONError(data, err))
+			sources.complete = false
+			continue
+		}
+		sources.maps[strings.TrimSuffix(filepath.Base(path), ".json")] = tileMap
+	}
+
+	return sources
+}
+
+// describeJSONError adds the line a decoding error happened on
+func describeJSONError(data []byte, err error) string {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err.Error()
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return fmt.Sprintf("line %d: %v", bytes.Count(data[:offset], []byte("\n"))+1, err)
+}
+
+// mapFile names a map's file the way problems are reported
+func mapFile(key string) string {
+	return "maps/" + key + ".json"
+}
+
+// checkReferences reports every ID a definition or map names that no
+// definition has
+func (s *contentSources) checkReferences(report *ContentReport) {
+	items := make(map[string]bool)
+	for _, item := range s.items {
+		items[item.ID] = true
+	}
+	npcs := make(map[string]bool)
+	for _, npc := range s.npcs {
+		npcs[npc.ID] = true
+	}
+	tables := make(map[string]bool)
+	for _, table := range s.lootTables {
+		tables[table.ID] = true
+	}
+	quests := make(map[string]bool)
+	for _, quest := range s.quests {
+		quests[quest.ID] = true
+	}
+	shops := make(map[string]bool)
+	for _, shop := range s.shops {
+		shops[shop.ID] = true
+	}
+	dialogues := make(map[string]bool)
+	for _, dialogue := range s.dialogues {
+		dialogues[dialogue.ID] = true
+	}
+	resources := make(map[string]bool)
+	for _, resource := range s.resources {
+		resources[resource.ID] = true
+	}
+
+	// Without a zones file every map is a zone of its own
+	zoneMaps := make(map[string]string)
+	for _, zone := range s.zones {
+		zoneMaps[zone.ID] = zone.Map
+	}
+	if len(s.zones) == 0 {
+		for key := range s.maps {
+			zoneMaps[key] = key
+		}
+	}
+	instanceMaps := make(map[string]string)
+	for _, template := range s.instances {
+		instanceMaps[template.ID] = template.Map
+	}
+
+	// spawnExists reports whether the map of a zone or instance has a spawn
+	// point; unknown maps are reported on their own
+	spawnExists := func(mapKey, spawn string) bool {
+		tileMap, exists := s.maps[mapKey]
+		if !exists || spawn == "" {
+			return true
+		}
+		_, exists = tileMap.Spawn(spawn)
+		return exists
+	}
+
+	for _, npc := range s.npcs {
+		if npc.LootTable != "" && !tables[npc.LootTable] {
+			report.errorf("npcs.json", "npc %q uses unknown loot table %q", npc.ID, npc.LootTable)
+		}
+		if npc.Dialogue != "" && !dialogues[npc.Dialogue] {
+			report.errorf("npcs.json", "npc %q uses unknown dialogue %q", npc.ID, npc.Dialogue)
+		}
+	}
+
+	for _, table := range s.lootTables {
+		if table.NothingWeight < 0 {
+			report.errorf("loot_tables.json", "loot table %q has a negative nothing_weight of %d", table.ID, table.NothingWeight)
+		}
+		total, weighted := table.NothingWeight, false
+		for i, entry := range table.Entries {
+			if entry.Item != "" && !items[entry.Item] {
+				report.errorf("loot_tables.json", "loot table %q entry %d drops unknown item %q", table.ID, i, entry.Item)
+			}
+			if entry.Table != "" && !tables[entry.Table] {
+				report.errorf("loot_tables.json", "loot table %q entry %d nests unknown loot table %q", table.ID, i, entry.Table)
+			}
+			if entry.Weight < 0 {
+				report.errorf("loot_tables.json", "loot table %q entry %d has a negative weight of %d", table.ID, i, entry.Weight)
+			}
+			if !entry.Guaranteed {
+				total += entry.Weight
+				weighted = true
+			}
+		}
+		if weighted && total <= 0 {
+			report.errorf("loot_tables.json", "loot table %q has a total weight of %d, so nothing can be rolled", table.ID, total)
+		}
+	}
+
+	for _, zone := range s.zones {
+		if _, exists := s.maps[zone.Map]; !exists {
+			report.errorf("zones.json", "zone %q uses unknown map %q", zone.ID, zone.Map)
+		}
+	}
+
+	for _, template := range s.instances {
+		if _, exists := s.maps[template.Map]; !exists {
+			report.errorf("instances.json", "instance %q uses unknown map %q", template.ID, template.Map)
+		}
+		if template.ExitZone == "" {
+			continue
+		}
+		mapKey, exists := zoneMaps[template.ExitZone]
+		if !exists {
+			report.errorf("instances.json", "instance %q exits to unknown zone %q", template.ID, template.ExitZone)
+		} else if !spawnExists(mapKey, template.ExitSpawn) {
+			report.errorf("instances.json", "instance %q exits to unknown spawn %q of zone %q", template.ID, template.ExitSpawn, template.ExitZone)
+		}
+	}
+
+	for _, quest := range s.quests {
+		for _, npcID := range []string{quest.Giver, quest.TurnIn} {
+			if npcID != "" && !npcs[npcID] {
+				report.errorf("quests.json", "quest %q uses unknown npc %q", quest.ID, npcID)
+			}
+		}
+		for _, prerequisite := range quest.Prerequisites {
+			if !quests[prerequisite] {
+				report.errorf("quests.json", "quest %q requires unknown quest %q", quest.ID, prerequisite)
+			}
+		}
+		if len(quest.Objectives) == 0 {
+			report.errorf("quests.json", "quest %q has no objectives", quest.ID)
+		}
+		for _, objective := range quest.Objectives {
+			switch objective.Type {
+			case ObjectiveKill, ObjectiveTalk:
+				if !npcs[objective.Target] {
+					report.errorf("quests.json", "quest %q objective uses unknown npc %q", quest.ID, objective.Target)
+				}
+			case ObjectiveCollect:
+				if !items[objective.Target] {
+					report.errorf("quests.json", "quest %q objective uses unknown item %q", quest.ID, objective.Target)
+				}
+			case ObjectiveReach:
+				mapKeys := make([]string, 0, len(s.maps))
+				switch {
+				case objective.Zone == "":
+					for key := range s.maps {
+						mapKeys = append(mapKeys, key)
+					}
+				case zoneMaps[objective.Zone] != "":
+					mapKeys = append(mapKeys, zoneMaps[objective.Zone])
+				case instanceMaps[objective.Zone] != "":
+					mapKeys = append(mapKeys, instanceMaps[objective.Zone])
+				default:
+					report.errorf("quests.json", "quest %q objective uses unknown zone %q", quest.ID, objective.Zone)
+					continue
+				}
+				found := false
+				for _, key := range mapKeys {
+					if tileMap, exists := s.maps[key]; exists {
+						if _, exists := tileMap.Region(objective.Target); exists {
+							found = true
+						}
+					}
+				}
+				if !found {
+					report.errorf("quests.json", "quest %q objective uses unknown region %q", quest.ID, objective.Target)
+				}
+			default:
+				report.errorf("quests.json", "quest %q has unknown objective type %q", quest.ID, objective.Type)
+			}
+		}
+		for _, reward := range quest.Rewards.Items {
+			if !items[reward.Item] {
+				report.errorf("quests.json", "quest %q rewards unknown item %q", quest.ID, reward.Item)
+			}
+		}
+	}
+
+	for _, shop := range s.shops {
+		for _, item := range shop.Items {
+			if !items[item.Item] {
+				report.errorf("shops.json", "shop %q sells unknown item %q", shop.ID, item.Item)
+			}
+		}
+	}
+
+	for _, dialogue := range s.dialogues {
+		checkConditions := func(where string, conditions []DialogueCondition) {
+			for _, condition := range conditions {
+				if condition.Type == ConditionQuest && !quests[condition.Quest] {
+					report.errorf("dialogues.json", "dialogue %q %s checks unknown quest %q", dialogue.ID, where, condition.Quest)
+				}
+				if condition.Type == ConditionItem && !items[condition.Item] {
+					report.errorf("dialogues.json", "dialogue %q %s checks unknown item %q", dialogue.ID, where, condition.Item)
+				}
+			}
+		}
+
+		for _, entry := range dialogue.Start {
+			if _, exists := dialogue.Nodes[entry.Node]; !exists {
+				report.errorf("dialogues.json", "dialogue %q starts at unknown node %q", dialogue.ID, entry.Node)
+			}
+			checkConditions("start", entry.Conditions)
+		}
+		for _, nodeID := range sortedNodeIDs(dialogue) {
+			where := fmt.Sprintf("node %q", nodeID)
+			for _, option := range dialogue.Nodes[nodeID].Options {
+				if _, exists := dialogue.Nodes[option.Next]; option.Next != "" && !exists {
+					report.errorf("dialogues.json", "dialogue %q %s leads to unknown node %q", dialogue.ID, where, option.Next)
+				}
+				checkConditions(where, option.Conditions)
+				for _, action := range option.Actions {
+					switch action.Type {
+					case ActionGiveQuest, ActionTurnInQuest:
+						if !quests[action.Quest] {
+							report.errorf("dialogues.json", "dialogue %q %s uses unknown quest %q", dialogue.ID, where, action.Quest)
+						}
+					case ActionOpenShop:
+						if !shops[action.Shop] {
+							report.errorf("dialogues.json", "dialogue %q %s opens unknown shop %q", dialogue.ID, where, action.Shop)
+						}
+					case ActionTeleport:
+						mapKey, exists := zoneMaps[action.Zone]
+						if !exists {
+							report.errorf("dialogues.json", "dialogue %q %s teleports to unknown zone %q", dialogue.ID, where, action.Zone)
+						} else if !spawnExists(mapKey, action.Spawn) {
+							report.errorf("dialogues.json", "dialogue %q %s teleports to unknown spawn %q of zone %q", dialogue.ID, where, action.Spawn, action.Zone)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for _, resource := range s.resources {
+		if !tables[resource.LootTable] {
+			report.errorf("resources.json", "resource %q uses unknown loot table %q", resource.ID, resource.LootTable)
+		}
+	}
+
+	for _, recipe := range s.recipes {
+		for _, item := range append(append([]RecipeItem{}, recipe.Inputs...), recipe.Outputs...) {
+			if !items[item.Item] {
+				report.errorf("recipes.json", "recipe %q uses unknown item %q", recipe.ID, item.Item)
+			}
+		}
+	}
+
+	for _, achievement := range s.achievements {
+		for _, reward := range achievement.Rewards.Items {
+			if !items[reward.Item] {
+				report.errorf("achievements.json", "achievement %q rewards unknown item %q", achievement.ID, reward.Item)
+			}
+		}
+	}
+
+	for _, key := range sortedMapKeys(s.maps) {
+		tileMap := s.maps[key]
+		for _, point := range tileMap.Spawns {
+			switch point.Type {
+			case "npc":
+				if !npcs[point.Properties["npc"]] {
+					report.errorf(mapFile(key), "npc spawn %q uses unknown npc %q", point.Name, point.Properties["npc"])
+				}
+				for _, name := range strings.Split(point.Properties["patrol"], ",") {
+					if name = strings.TrimSpace(name); name == "" {
+						continue
+					}
+					if _, exists := tileMap.Spawn(name); !exists {
+						report.errorf(mapFile(key), "npc spawn %q patrols to unknown waypoint %q", point.Name, name)
+					}
+				}
+			case "item":
+				if !items[point.Properties["item"]] {
+					report.errorf(mapFile(key), "item spawn %q uses unknown item %q", point.Name, point.Properties["item"])
+				}
+			case "resource":
+				if !resources[point.Properties["resource"]] {
+					report.errorf(mapFile(key), "resource spawn %q uses unknown resource %q", point.Name, point.Properties["resource"])
+				}
+			}
+		}
+		for _, region := range tileMap.Regions {
+			if region.Type != "portal" {
+				continue
+			}
+			if templateID := region.Properties["target_instance"]; templateID != "" {
+				if _, exists := instanceMaps[templateID]; !exists {
+					report.errorf(mapFile(key), "portal %q leads to unknown instance %q", region.Name, templateID)
+				}
+				continue
+			}
+			zoneID := region.Properties["target_zone"]
+			mapKey, exists := zoneMaps[zoneID]
+			if !exists {
+				report.errorf(mapFile(key), "portal %q leads to unknown zone %q", region.Name, zoneID)
+			} else if !spawnExists(mapKey, region.Properties["target_spawn"]) {
+				report.errorf(mapFile(key), "portal %q leads to unknown spawn %q of zone %q", region.Name, region.Properties["target_spawn"], zoneID)
+			}
+		}
+	}
+}
+
+// scriptSpawnPattern and scriptGivePattern find the NPCs and items scripts
+// name as literals when spawning NPCs and handing out items
+var (
+	scriptSpawnPattern = regexp.MustCompile(`\bspawn\(\s*"([^"]+)"`)
+	scriptGivePattern  = regexp.MustCompile(`\bgive_item\([^,()]*,\s*"([^"]+)"`)
+)
+
+// contentCheck looks at loaded content the way players will meet it: what
+// can be walked to, which NPCs are out in the world and where items come
+// from
+type contentCheck struct {
+	content *Content
+	report  *ContentReport
+	// reachable marks the tiles of each map used by a zone or instance
+	// that players can walk to from a player spawn
+	reachable map[string][]bool
+	// placed holds the NPCs spawned on those maps or by scripts
+	placed map[string]bool
+	// obtainable holds the items players have some way of getting
+	obtainable map[string]bool
+}
+
+// run makes every check, in a stable order
+func (c *contentCheck) run() {
+	c.reachable = make(map[string][]bool)
+	c.placed = make(map[string]bool)
+	c.obtainable = make(map[string]bool)
+
+	used := make(map[string]bool)
+	for _, zone := range c.content.Zones {
+		used[zone.Map] = true
+	}
+	for _, template := range c.content.Instances {
+		used[template.Map] = true
+	}
+	for _, key := range sortedMapKeys(c.content.Maps) {
+		if !used[key] {
+			c.report.warnf(mapFile(key), "map is not used by any zone or instance")
+			continue
+		}
+		c.checkMap(key, c.content.Maps[key])
+	}
+
+	c.findScriptLiterals()
+	c.findItemSources(used)
+	c.checkQuests()
+	c.checkUnused()
+}
+
+// checkMap walks a map from its player spawns and reports spawns and
+// regions that sit on blocked tiles or cannot be walked to
+func (c *contentCheck) checkMap(key string, tileMap *TileMap) {
+	file := mapFile(key)
+	reachable := make([]bool, tileMap.Width*tileMap.Height)
+	c.reachable[key] = reachable
+
+	var queue [][2]int
+	for _, point := range tileMap.SpawnsOfType("spawn") {
+		x, y := tileMap.TileAt(point.Position)
+		if tileMap.Walkable(x, y) && !reachable[y*tileMap.Width+x] {
+			reachable[y*tileMap.Width+x] = true
+			queue = append(queue, [2]int{x, y})
+		}
+	}
+	if _, ok := tileMap.PlayerSpawn(); !ok {
+		c.report.errorf(file, "map has no player spawn")
+	}
+	for len(queue) > 0 {
+		tile := queue[0]
+		queue = queue[1:]
+		for _, step := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			x, y := tile[0]+step[0], tile[1]+step[1]
+			if tileMap.Walkable(x, y) && !reachable[y*tileMap.Width+x] {
+				reachable[y*tileMap.Width+x] = true
+				queue = append(queue, [2]int{x, y})
+			}
+		}
+	}
+
+	for _, point := range tileMap.Spawns {
+		x, y := tileMap.TileAt(point.Position)
+		where := fmt.Sprintf("%s spawn %q at (%.0f, %.0f)", point.Type, point.Name, point.Position.X, point.Position.Y)
+
+		// NPCs, items and resources only need to be in range of somewhere
+		// players can stand; trees and veins may even stand on solid tiles
+		reach := 0.0
+		switch point.Type {
+		case "npc":
+			npc, exists := c.content.NPCs[point.Properties["npc"]]
+			if !exists {
+				continue
+			}
+			c.placed[npc.ID] = true
+			reach = AttackRange
+			if npc.Health <= 0 {
+				reach = DefaultInteractionRange
+			}
+		case "item":
+			reach = ItemPickupRange
+		case "resource":
+			if !c.withinReach(key, point.Position, GatherRange) {
+				c.report.errorf(file, "%s is out of gathering range of any reachable tile", where)
+			}
+			continue
+		}
+
+		switch {
+		case tileMap.IsTileBlocked(x, y):
+			c.report.errorf(file, "%s is on a blocked tile", where)
+		case point.Type == "waypoint":
+		case reach > 0 && !c.withinReach(key, point.Position, reach):
+			c.report.errorf(file, "%s is out of reach of any reachable tile", where)
+		case reach == 0 && !reachable[y*tileMap.Width+x]:
+			c.report.errorf(file, "%s cannot be reached from a player spawn", where)
+		}
+	}
+
+	for _, region := range tileMap.Regions {
+		if (region.Type == "portal" || region.Type == "station") && !c.regionReachable(key, region.Bounds) {
+			c.report.errorf(file, "%s %q cannot be reached from a player spawn", region.Type, region.Name)
+		}
+	}
+}
+
+// withinReach reports whether a reachable tile of a map lies within
+// reach of a position
+func (c *contentCheck) withinReach(key string, position Position, reach float64) bool {
+	tileMap := c.content.Maps[key]
+	fromX, fromY := tileMap.TileAt(Position{X: position.X - reach, Y: position.Y - reach})
+	toX, toY := tileMap.TileAt(Position{X: position.X + reach, Y: position.Y + reach})
+	for y := maxInt(fromY, 0); y <= minInt(toY, tileMap.Height-1); y++ {
+		for x := maxInt(fromX, 0); x <= minInt(toX, tileMap.Width-1); x++ {
+			if !c.reachable[key][y*tileMap.Width+x] {
+				continue
+			}
+			// Measure to the point of the tile closest to the position
+			closest := Position{
+				X: math.Max(float64(x*tileMap.TileWidth), math.Min(position.X, float64((x+1)*tileMap.TileWidth))),
+				Y: math.Max(float64(y*tileMap.TileHeight), math.Min(position.Y, float64((y+1)*tileMap.TileHeight))),
+			}
+			if distance(closest, position) <= reach {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// regionReachable reports whether any tile overlapping a region is reachable
+func (c *contentCheck) regionReachable(key string, bounds Rect) bool {
+	tileMap := c.content.Maps[key]
+	fromX, fromY := tileMap.TileAt(Position{X: bounds.X, Y: bounds.Y})
+	toX := int(math.Ceil((bounds.X+bounds.Width)/float64(tileMap.TileWidth))) - 1
+	toY := int(math.Ceil((bounds.Y+bounds.Height)/float64(tileMap.TileHeight))) - 1
+	for y := maxInt(fromY, 0); y <= minInt(toY, tileMap.Height-1); y++ {
+		for x := maxInt(fromX, 0); x <= minInt(toX, tileMap.Width-1); x++ {
+			if c.reachable[key][y*tileMap.Width+x] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findScriptLiterals counts NPCs scripts spawn as placed and items they
+// give out as obtainable
+func (c *contentCheck) findScriptLiterals() {
+	if c.content.Scripts == nil {
+		return
+	}
+	files, err := c.content.Scripts.files()
+	if err != nil {
+		c.report.errorf("scripts", "%v", err)
+		return
+	}
+	for _, file := range files {
+		source, err := os.ReadFile(file.path)
+		if err != nil {
+			c.report.errorf("scripts", "%v", err)
+			continue
+		}
+		for _, match := range scriptSpawnPattern.FindAllSubmatch(source, -1) {
+			c.placed[string(match[1])] = true
+		}
+		for _, match := range scriptGivePattern.FindAllSubmatch(source, -1) {
+			c.obtainable[string(match[1])] = true
+		}
+	}
+}
+
+// findItemSources marks every item players can get: found on the maps in
+// use, dropped by NPCs out in the world, gathered, bought, crafted or
+// handed out as a reward
+func (c *contentCheck) findItemSources(used map[string]bool) {
+	for key, tileMap := range c.content.Maps {
+		if !used[key] {
+			continue
+		}
+		for _, point := range tileMap.SpawnsOfType("item") {
+			c.obtainable[point.Properties["item"]] = true
+		}
+		for _, point := range tileMap.SpawnsOfType("resource") {
+			if resource, exists := c.content.Resources[point.Properties["resource"]]; exists {
+				c.markLoot(resource.LootTable, map[string]bool{})
+			}
+		}
+	}
+	for npcID := range c.placed {
+		if npc, exists := c.content.NPCs[npcID]; exists && npc.LootTable != "" && npc.Health > 0 {
+			c.markLoot(npc.LootTable, map[string]bool{})
+		}
+	}
+	for _, shop := range c.content.Shops {
+		for _, item := range shop.Items {
+			c.obtainable[item.Item] = true
+		}
+	}
+	for _, recipe := range c.content.Recipes {
+		for _, item := range recipe.Outputs {
+			c.obtainable[item.Item] = true
+		}
+	}
+	for _, quest := range c.content.Quests {
+		for _, reward := range quest.Rewards.Items {
+			c.obtainable[reward.Item] = true
+		}
+	}
+	for _, achievement := range c.content.Achievements {
+		for _, reward := range achievement.Rewards.Items {
+			c.obtainable[reward.Item] = true
+		}
+	}
+}
+
+// markLoot marks the items a loot table and the tables below it can drop
+func (c *contentCheck) markLoot(tableID string, seen map[string]bool) {
+	table, exists := c.content.LootTables.Table(tableID)
+	if !exists || seen[tableID] {
+		return
+	}
+	seen[tableID] = true
+	for _, entry := range table.Entries {
+		if entry.Weight == 0 && !entry.Guaranteed {
+			continue
+		}
+		if entry.Item != "" {
+			c.obtainable[entry.Item] = true
+		} else {
+			c.markLoot(entry.Table, seen)
+		}
+	}
+}
+
+// checkQuests reports quests players cannot pick up or finish
+func (c *contentCheck) checkQuests() {
+	ids := make([]string, 0, len(c.content.Quests))
+	for id := range c.content.Quests {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		quest := c.content.Quests[id]
+		if quest.MinLevel > MaxLevel {
+			c.report.errorf("quests.json", "quest %q needs level %d but characters stop at %d", id, quest.MinLevel, MaxLevel)
+		}
+		if quest.Giver != "" && !c.placed[quest.Giver] {
+			c.report.errorf("quests.json", "quest %q is given by npc %q which is never spawned", id, quest.Giver)
+		}
+		if quest.TurnIn != "" && quest.TurnIn != quest.Giver && !c.placed[quest.TurnIn] {
+			c.report.errorf("quests.json", "quest %q is handed in to npc %q which is never spawned", id, quest.TurnIn)
+		}
+		if cycle := c.prerequisiteCycle(id, nil); cycle != nil {
+			c.report.errorf("quests.json", "quest %q requires itself: %s", id, strings.Join(cycle, " -> "))
+		}
+
+		for _, objective := range quest.Objectives {
+			switch objective.Type {
+			case ObjectiveKill:
+				npc := c.content.NPCs[objective.Target]
+				if !c.placed[npc.ID] {
+					c.report.errorf("quests.json", "quest %q needs npc %q killed but it is never spawned", id, npc.ID)
+				} else if npc.Health <= 0 {
+					c.report.errorf("quests.json", "quest %q needs npc %q killed but it cannot be attacked", id, npc.ID)
+				}
+			case ObjectiveTalk:
+				if !c.placed[objective.Target] {
+					c.report.errorf("quests.json", "quest %q needs npc %q talked to but it is never spawned", id, objective.Target)
+				}
+			case ObjectiveCollect:
+				item := c.content.Items[objective.Target]
+				if !c.obtainable[item.ID] {
+					c.report.errorf("quests.json", "quest %q needs item %q collected but nothing drops, sells or gives it", id, item.ID)
+				}
+				if objective.Count > item.MaxStack*InventorySize {
+					c.report.errorf("quests.json", "quest %q needs %d of item %q but bags only hold %d", id, objective.Count, item.ID, item.MaxStack*InventorySize)
+				}
+			case ObjectiveReach:
+				if !c.reachableRegion(objective) {
+					c.report.errorf("quests.json", "quest %q needs region %q reached but no player can walk into it", id, objective.Target)
+				}
+			}
+		}
+	}
+}
+
+// prerequisiteCycle returns the chain of prerequisites leading from a
+// quest back to itself, if there is one
+func (c *contentCheck) prerequisiteCycle(id string, path []string) []string {
+	for i, visited := range path {
+		if visited == id {
+			if i == 0 {
+				return append(path, id)
+			}
+			// A cycle further down is reported for the quests on it
+			return nil
+		}
+	}
+	path = append(path, id)
+	for _, prerequisite := range c.content.Quests[id].Prerequisites {
+		if cycle := c.prerequisiteCycle(prerequisite, path); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// reachableRegion reports whether players can walk into the region of a
+// reach objective
+func (c *contentCheck) reachableRegion(objective QuestObjective) bool {
+	var keys []string
+	switch {
+	case objective.Zone == "":
+		keys = sortedMapKeys(c.content.Maps)
+	case c.content.Zones[objective.Zone] != nil:
+		keys = []string{c.content.Zones[objective.Zone].Map}
+	default:
+		keys = []string{c.content.Instances[objective.Zone].Map}
+	}
+	for _, key := range keys {
+		if c.reachable[key] == nil {
+			continue
+		}
+		if region, exists := c.content.Maps[key].Region(objective.Target); exists && c.regionReachable(key, region.Bounds) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnused warns about definitions nothing uses and dialogue nodes no
+// conversation can get to
+func (c *contentCheck) checkUnused() {
+	ids := make([]string, 0, len(c.content.NPCs))
+	for id := range c.content.NPCs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !c.placed[id] {
+			c.report.warnf("npcs.json", "npc %q is never spawned", id)
+		}
+	}
+
+	usedTables := make(map[string]bool)
+	for _, npc := range c.content.NPCs {
+		usedTables[npc.LootTable] = true
+	}
+	for _, resource := range c.content.Resources {
+		usedTables[resource.LootTable] = true
+	}
+	for _, id := range c.content.LootTables.IDs() {
+		table, _ := c.content.LootTables.Table(id)
+		for _, entry := range table.Entries {
+			usedTables[entry.Table] = true
+		}
+	}
+	for _, id := range c.content.LootTables.IDs() {
+		if !usedTables[id] {
+			c.report.warnf("loot_tables.json", "loot table %q is not used by any npc, resource or loot table", id)
+		}
+	}
+
+	ids = ids[:0]
+	for id := range c.content.Dialogues {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		dialogue := c.content.Dialogues[id]
+		seen := make(map[string]bool)
+		var queue []string
+		for _, entry := range dialogue.Start {
+			queue = append(queue, entry.Node)
+		}
+		for len(queue) > 0 {
+			nodeID := queue[0]
+			queue = queue[1:]
+			if seen[nodeID] {
+				continue
+			}
+			seen[nodeID] = true
+			for _, option := range dialogue.Nodes[nodeID].Options {
+				if option.Next != "" {
+					queue = append(queue, option.Next)
+				}
+			}
+		}
+		for _, nodeID := range sortedNodeIDs(dialogue) {
+			if !seen[nodeID] {
+				c.report.warnf("dialogues.json", "dialogue %q node %q cannot be reached", id, nodeID)
+			}
+		}
+	}
+}
+
+// sortedMapKeys returns the keys of a set of maps in order
+func sortedMapKeys(maps map[string]*TileMap) []string {
+	keys := make([]string, 0, len(maps))
+	for key := range maps {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedNodeIDs returns the node IDs of a dialogue in order
+func sortedNodeIDs(dialogue *Dialogue) []string {
+	ids := make([]string, 0, len(dialogue.Nodes))
+	for id := range dialogue.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
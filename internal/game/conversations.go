@@ -0,0 +1,189 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// conversation is a player's ongoing dialogue with an NPC; options maps
+// the answers shown to the player to the node's options
+type conversation struct {
+	npcID    string
+	dialogue *Dialogue
+	node     string
+	options  []int
+}
+
+// dialogueOf returns the dialogue an NPC speaks, if any
+func (w *World) dialogueOf(npc *Entity) (*Dialogue, bool) {
+	if w.Content() == nil || npc.AI == nil || npc.AI.Definition.Dialogue == "" {
+		return nil, false
+	}
+	dialogue, exists := w.Content().Dialogues[npc.AI.Definition.Dialogue]
+	return dialogue, exists
+}
+
+// startConversation opens an NPC's dialogue at the first entry the
+// player qualifies for; the caller holds the world lock
+func (w *World) startConversation(player *Player, npc *Entity, dialogue *Dialogue) ([]outboundMessage, error) {
+	node, ok := dialogue.entry(player, w.Content())
+	if !ok {
+		return nil, ErrNoDialogue
+	}
+
+	talk := &conversation{npcID: npc.ID, dialogue: dialogue}
+	w.conversations[player.ID] = talk
+	return []outboundMessage{w.showDialogueNode(player, npc, talk, node)}, nil
+}
+
+// showDialogueNode moves a conversation to a node and builds the message
+// presenting it with the answers the player qualifies for
+func (w *World) showDialogueNode(player *Player, npc *Entity, talk *conversation, nodeID string) outboundMessage {
+	node := talk.dialogue.Nodes[nodeID]
+	talk.node = nodeID
+	talk.options = talk.options[:0]
+
+	options := make([]map[string]interface{}, 0, len(node.Options))
+	for i, option := range node.Options {
+		if !conditionsMet(option.Conditions, player, w.Content()) {
+			continue
+		}
+		options = append(options, map[string]interface{}{
+			"index": len(talk.options),
+			"text":  option.Text,
+		})
+		talk.options = append(talk.options, i)
+	}
+
+	return outboundMessage{playerID: player.ID, message: map[string]interface{}{
+		"type":    "dialogue",
+		"npc_id":  npc.ID,
+		"name":    npc.Name,
+		"text":    node.Text,
+		"options": options,
+	}}
+}
+
+// ChooseDialogueOption answers the NPC a player is talking to: the
+// option's actions run in order and the conversation moves on to the
+// option's next node, or ends when it has none
+func (w *World) ChooseDialogueOption(playerID string, index int) error {
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	talk, exists := w.conversations[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return ErrNoConversation
+	}
+	npc, exists := w.NPCs[talk.npcID]
+	if !exists || distance(player.GetPosition(), npc.Position) > w.settings.InteractionRange {
+		messages := w.endConversation(playerID)
+		w.mu.Unlock()
+		w.deliver(messages)
+		return ErrNPCTooFar
+	}
+	if index < 0 || index >= len(talk.options) {
+		w.mu.Unlock()
+		return ErrUnknownOption
+	}
+	option := talk.dialogue.Nodes[talk.node].Options[talk.options[index]]
+	w.mu.Unlock()
+
+	if !conditionsMet(option.Conditions, player, w.Content()) {
+		return ErrConditionsNotMet
+	}
+
+	var teleport *DialogueAction
+	for i, action := range option.Actions {
+		if action.Type == ActionTeleport {
+			teleport = &option.Actions[i]
+			continue
+		}
+		if err := w.runDialogueAction(player, npc, action); err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	var messages []outboundMessage
+	if option.Next != "" && teleport == nil {
+		messages = append(messages, w.showDialogueNode(player, npc, talk, option.Next))
+	} else {
+		messages = w.endConversation(playerID)
+	}
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	if teleport != nil && w.onTeleport != nil {
+		w.onTeleport(playerID, teleport.Zone, teleport.Spawn)
+	}
+	return nil
+}
+
+// runDialogueAction carries out one action of a chosen option; quests
+// given or taken in dialogue skip the giver checks since the NPC speaking
+// decides
+func (w *World) runDialogueAction(player *Player, npc *Entity, action DialogueAction) error {
+	switch action.Type {
+	case ActionGiveQuest:
+		quest, err := w.quest(action.Quest)
+		if err != nil {
+			return err
+		}
+		return w.acceptQuest(player, quest)
+	case ActionTurnInQuest:
+		quest, err := w.quest(action.Quest)
+		if err != nil {
+			return err
+		}
+		return w.turnInQuest(player, quest)
+	case ActionOpenShop:
+		return w.OpenShop(player, npc, action.Shop)
+	case ActionOpenAuction:
+		return w.OpenAuction(player, npc)
+	case ActionSetFlag:
+		if action.Clear {
+			player.Flags.Clear(action.Flag)
+		} else {
+			player.Flags.Set(action.Flag)
+		}
+	case ActionScript:
+		w.mu.RLock()
+		npcArg := npcValue(npc)
+		w.mu.RUnlock()
+		w.runScript(action.Script, action.Function, playerValue(player), npcArg)
+	default:
+		log.Printf("Dialogue of %s has unknown action %q", npc.ID, action.Type)
+		return fmt.Errorf("unknown dialogue action %q", action.Type)
+	}
+	return nil
+}
+
+// EndConversation closes the dialogue a player has open
+func (w *World) EndConversation(playerID string) {
+	w.mu.Lock()
+	messages := w.endConversation(playerID)
+	w.mu.Unlock()
+
+	w.deliver(messages)
+}
+
+// endConversation drops a player's conversation and tells their client;
+// the caller holds the world lock
+func (w *World) endConversation(playerID string) []outboundMessage {
+	talk, exists := w.conversations[playerID]
+	if !exists {
+		return nil
+	}
+	delete(w.conversations, playerID)
+
+	return []outboundMessage{{playerID: playerID, message: map[string]interface{}{
+		"type":   "dialogue_closed",
+		"npc_id": talk.npcID,
+	}}}
+}
@@ -0,0 +1,139 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnknownRecipe = errors.New("unknown recipe")
+	ErrNoStation     = errors.New("you need to be at the right crafting station")
+)
+
+// RecipeItem is a stack a recipe uses up or makes
+type RecipeItem struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+// RecipeDefinition describes something a profession can make, as
+// written in recipes.json
+type RecipeDefinition struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Profession string `json:"profession"`
+	// Skill is the profession level needed to craft the recipe
+	Skill int `json:"skill"`
+	// Station names the station regions the recipe is crafted in; without
+	// one it can be crafted anywhere
+	Station    string       `json:"station"`
+	Inputs     []RecipeItem `json:"inputs"`
+	Outputs    []RecipeItem `json:"outputs"`
+	Experience int          `json:"experience"`
+}
+
+// applyDefaults fills optional fields left out of the content file
+func (d *RecipeDefinition) applyDefaults() {
+	if d.Name == "" {
+		d.Name = d.ID
+	}
+	if d.Skill <= 0 {
+		d.Skill = 1
+	}
+	if d.Experience <= 0 {
+		d.Experience = 10
+	}
+	for _, items := range [][]RecipeItem{d.Inputs, d.Outputs} {
+		for i := range items {
+			if items[i].Quantity <= 0 {
+				items[i].Quantity = 1
+			}
+		}
+	}
+}
+
+// stacks returns recipe items as inventory stacks
+func recipeStacks(items []RecipeItem) []ItemStack {
+	stacks := make([]ItemStack, 0, len(items))
+	for _, item := range items {
+		stacks = append(stacks, ItemStack{ItemID: item.Item, Quantity: item.Quantity})
+	}
+	return stacks
+}
+
+// Craft makes a recipe: the inputs are taken and the outputs given in
+// one inventory change, so nothing is used up when the outputs do not fit
+func (w *World) Craft(playerID, recipeID string) error {
+	if w.Content() == nil {
+		return ErrUnknownRecipe
+	}
+	recipe, exists := w.Content().Recipes[recipeID]
+	if !exists {
+		return fmt.Errorf("%w %q", ErrUnknownRecipe, recipeID)
+	}
+	player, exists := w.GetPlayer(playerID)
+	if !exists {
+		return errors.New("player not found")
+	}
+	if !player.Life.Alive() {
+		return ErrDead
+	}
+	if player.Professions.Level(recipe.Profession) < recipe.Skill {
+		return fmt.Errorf("%w: %s %d needed", ErrSkillTooLow, recipe.Profession, recipe.Skill)
+	}
+	if recipe.Station != "" && !w.atStation(player.GetPosition(), recipe.Station) {
+		return ErrNoStation
+	}
+
+	if err := player.Inventory.Exchange(recipeStacks(recipe.Inputs), recipeStacks(recipe.Outputs), w.Content().Items); err != nil {
+		return err
+	}
+
+	messages := []outboundMessage{
+		{playerID: playerID, message: map[string]interface{}{
+			"type":      "craft_complete",
+			"recipe_id": recipe.ID,
+			"name":      recipe.Name,
+		}},
+		{playerID: playerID, message: player.Inventory.Message(w.Content().Items)},
+	}
+	messages = append(messages, w.professionProgress(player, recipe.Profession, recipe.Experience, recipe.Skill)...)
+	w.deliver(append(messages, w.syncCollectObjectives(player)...))
+	return nil
+}
+
+// atStation reports whether a position lies in a station region of the
+// given kind
+func (w *World) atStation(position Position, station string) bool {
+	if w.Map == nil {
+		return false
+	}
+	for _, region := range w.Map.RegionsAt(position) {
+		if region.Type == "station" && region.Properties["station"] == station {
+			return true
+		}
+	}
+	return false
+}
+
+// RecipesMessage returns the recipes message listing everything that can
+// be crafted
+func (c *Content) RecipesMessage() map[string]interface{} {
+	recipes := make([]map[string]interface{}, 0, len(c.Recipes))
+	for _, recipe := range c.Recipes {
+		recipes = append(recipes, map[string]interface{}{
+			"id":         recipe.ID,
+			"name":       recipe.Name,
+			"profession": recipe.Profession,
+			"skill":      recipe.Skill,
+			"station":    recipe.Station,
+			"inputs":     recipe.Inputs,
+			"outputs":    recipe.Outputs,
+		})
+	}
+
+	return map[string]interface{}{
+		"type":    "recipes",
+		"recipes": recipes,
+	}
+}
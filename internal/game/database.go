@@ -0,0 +1,1162 @@
+package game
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Database persists character state between sessions
+type Database struct {
+	db *sql.DB
+}
+
+// CharacterRecord is the persisted state of a character
+type CharacterRecord struct {
+	Name     string
+	Zone     string
+	Position Position
+	Updated  time.Time
+}
+
+// InstanceLockout binds a character to one copy of an instance until
+// the instance resets
+type InstanceLockout struct {
+	Name       string
+	Template   string
+	InstanceID string
+	Expires    time.Time
+}
+
+// NewDatabase opens the game database, creating tables as needed
+func NewDatabase(dbPath string) (*Database, error) {
+	// Create data directory if it doesn't exist
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+
+	database := &Database{db: db}
+	if err := database.createTables(); err != nil {
+		return nil, err
+	}
+
+	return database, nil
+}
+
+func (d *Database) createTables() error {
+	characterTable := `
+	CREATE TABLE IF NOT EXISTS characters (
+		name TEXT PRIMARY KEY,
+		zone TEXT NOT NULL,
+		x REAL NOT NULL,
+		y REAL NOT NULL,
+		updated_at DATETIME NOT NULL
+	);`
+
+	lockoutTable := `
+	CREATE TABLE IF NOT EXISTS instance_lockouts (
+		name TEXT NOT NULL,
+		template TEXT NOT NULL,
+		instance_id TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		PRIMARY KEY (name, template)
+	);`
+
+	if _, err := d.db.Exec(characterTable); err != nil {
+		return err
+	}
+
+	itemTable := `
+	CREATE TABLE IF NOT EXISTS character_items (
+		name TEXT NOT NULL,
+		slot INTEGER NOT NULL,
+		item_id TEXT NOT NULL,
+		quantity INTEGER NOT NULL,
+		PRIMARY KEY (name, slot)
+	);`
+
+	if _, err := d.db.Exec(lockoutTable); err != nil {
+		return err
+	}
+
+	if _, err := d.db.Exec(itemTable); err != nil {
+		return err
+	}
+
+	progressTable := `
+	CREATE TABLE IF NOT EXISTS character_progress (
+		name TEXT PRIMARY KEY,
+		level INTEGER NOT NULL,
+		experience INTEGER NOT NULL,
+		currency INTEGER NOT NULL
+	);`
+
+	questTable := `
+	CREATE TABLE IF NOT EXISTS character_quests (
+		name TEXT NOT NULL,
+		quest_id TEXT NOT NULL,
+		state TEXT NOT NULL,
+		progress TEXT NOT NULL,
+		accepted_at DATETIME NOT NULL,
+		completed_at DATETIME,
+		PRIMARY KEY (name, quest_id)
+	);`
+
+	if _, err := d.db.Exec(progressTable); err != nil {
+		return err
+	}
+
+	if _, err := d.db.Exec(questTable); err != nil {
+		return err
+	}
+
+	flagTable := `
+	CREATE TABLE IF NOT EXISTS character_flags (
+		name TEXT NOT NULL,
+		flag TEXT NOT NULL,
+		PRIMARY KEY (name, flag)
+	);`
+
+	if _, err := d.db.Exec(flagTable); err != nil {
+		return err
+	}
+
+	professionTable := `
+	CREATE TABLE IF NOT EXISTS character_professions (
+		name TEXT NOT NULL,
+		profession TEXT NOT NULL,
+		level INTEGER NOT NULL,
+		experience INTEGER NOT NULL,
+		PRIMARY KEY (name, profession)
+	);`
+
+	if _, err := d.db.Exec(professionTable); err != nil {
+		return err
+	}
+
+	bindTable := `
+	CREATE TABLE IF NOT EXISTS character_binds (
+		name TEXT PRIMARY KEY,
+		zone TEXT NOT NULL,
+		point TEXT NOT NULL,
+		x REAL NOT NULL,
+		y REAL NOT NULL
+	);`
+
+	if _, err := d.db.Exec(bindTable); err != nil {
+		return err
+	}
+
+	effectTable := `
+	CREATE TABLE IF NOT EXISTS character_effects (
+		name TEXT NOT NULL,
+		effect_id TEXT NOT NULL,
+		stacks INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		remaining_seconds REAL NOT NULL,
+		PRIMARY KEY (name, effect_id)
+	);`
+
+	if _, err := d.db.Exec(effectTable); err != nil {
+		return err
+	}
+
+	walletTable := `
+	CREATE TABLE IF NOT EXISTS character_wallets (
+		name TEXT PRIMARY KEY,
+		balance INTEGER NOT NULL
+	);`
+
+	// The ledger is only ever appended to; every change of a wallet's
+	// balance has a row here
+	ledgerTable := `
+	CREATE TABLE IF NOT EXISTS currency_ledger (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		delta INTEGER NOT NULL,
+		balance INTEGER NOT NULL,
+		reason TEXT NOT NULL,
+		reference TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);`
+
+	if _, err := d.db.Exec(walletTable); err != nil {
+		return err
+	}
+
+	if _, err := d.db.Exec(ledgerTable); err != nil {
+		return err
+	}
+
+	if _, err := d.db.Exec(`CREATE INDEX IF NOT EXISTS idx_currency_ledger_name ON currency_ledger (name, id)`); err != nil {
+		return err
+	}
+
+	// Mail holds its item and currency attachments until they are taken;
+	// cod is what the recipient pays the sender to take them
+	mailTable := `
+	CREATE TABLE IF NOT EXISTS mail (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		recipient TEXT NOT NULL,
+		sender TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		body TEXT NOT NULL,
+		items TEXT NOT NULL,
+		currency INTEGER NOT NULL,
+		cod INTEGER NOT NULL DEFAULT 0,
+		read INTEGER NOT NULL DEFAULT 0,
+		returned INTEGER NOT NULL DEFAULT 0,
+		sent_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);`
+
+	if _, err := d.db.Exec(mailTable); err != nil {
+		return err
+	}
+
+	if _, err := d.db.Exec(`CREATE INDEX IF NOT EXISTS idx_mail_recipient ON mail (recipient, id)`); err != nil {
+		return err
+	}
+
+	if _, err := d.db.Exec(`CREATE INDEX IF NOT EXISTS idx_mail_expires ON mail (expires_at)`); err != nil {
+		return err
+	}
+
+	// A listing holds the item and the highest bid in escrow while it is
+	// active; both leave it by mail once it is sold, expired or cancelled
+	auctionTable := `
+	CREATE TABLE IF NOT EXISTS auctions (
+		id INTEGER PRIMARY KEY,
+		seller TEXT NOT NULL,
+		item_id TEXT NOT NULL,
+		quantity INTEGER NOT NULL,
+		min_bid INTEGER NOT NULL,
+		buyout INTEGER NOT NULL,
+		bid INTEGER NOT NULL,
+		bidder TEXT NOT NULL,
+		deposit INTEGER NOT NULL,
+		state TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		closed_at DATETIME
+	);`
+
+	if _, err := d.db.Exec(auctionTable); err != nil {
+		return err
+	}
+
+	if _, err := d.db.Exec(`CREATE INDEX IF NOT EXISTS idx_auctions_state ON auctions (state, expires_at)`); err != nil {
+		return err
+	}
+
+	// Statistics are kept per season so the seasonal leaderboards can
+	// start over while the all-time totals keep counting
+	statisticsTable := `
+	CREATE TABLE IF NOT EXISTS character_statistics (
+		name TEXT NOT NULL,
+		season TEXT NOT NULL,
+		stat TEXT NOT NULL,
+		value REAL NOT NULL,
+		PRIMARY KEY (name, season, stat)
+	);`
+
+	if _, err := d.db.Exec(statisticsTable); err != nil {
+		return err
+	}
+
+	if _, err := d.db.Exec(`CREATE INDEX IF NOT EXISTS idx_statistics_leaderboard ON character_statistics (stat, season, value)`); err != nil {
+		return err
+	}
+
+	achievementTable := `
+	CREATE TABLE IF NOT EXISTS character_achievements (
+		name TEXT NOT NULL,
+		achievement_id TEXT NOT NULL,
+		unlocked_at DATETIME NOT NULL,
+		PRIMARY KEY (name, achievement_id)
+	);`
+
+	if _, err := d.db.Exec(achievementTable); err != nil {
+		return err
+	}
+
+	// Only criteria that count events keep progress of their own; the
+	// others are measured from statistics and levels
+	achievementProgressTable := `
+	CREATE TABLE IF NOT EXISTS character_achievement_progress (
+		name TEXT NOT NULL,
+		achievement_id TEXT NOT NULL,
+		criterion INTEGER NOT NULL,
+		count REAL NOT NULL,
+		PRIMARY KEY (name, achievement_id, criterion)
+	);`
+
+	if _, err := d.db.Exec(achievementProgressTable); err != nil {
+		return err
+	}
+
+	titleTable := `
+	CREATE TABLE IF NOT EXISTS character_titles (
+		name TEXT PRIMARY KEY,
+		title TEXT NOT NULL
+	);`
+
+	if _, err := d.db.Exec(titleTable); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Transact runs fn in a transaction, committing only when it succeeds
+func (d *Database) Transact(fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetCharacter loads a character, returning sql.ErrNoRows for new characters
+func (d *Database) GetCharacter(name string) (*CharacterRecord, error) {
+	query := `SELECT name, zone, x, y, updated_at FROM characters WHERE name = ?`
+	row := d.db.QueryRow(query, name)
+
+	record := &CharacterRecord{}
+	err := row.Scan(&record.Name, &record.Zone, &record.Position.X, &record.Position.Y, &record.Updated)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// SaveCharacterLocation stores the zone and position a character is in
+func (d *Database) SaveCharacterLocation(name, zone string, position Position) error {
+	query := `
+	INSERT INTO characters (name, zone, x, y, updated_at) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(name) DO UPDATE SET zone = excluded.zone, x = excluded.x, y = excluded.y, updated_at = excluded.updated_at`
+	_, err := d.db.Exec(query, name, zone, position.X, position.Y, time.Now())
+	return err
+}
+
+// LoadInventory fills an inventory with the items saved for a character
+func (d *Database) LoadInventory(name string, inventory *Inventory) error {
+	rows, err := d.db.Query(`SELECT slot, item_id, quantity FROM character_items WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slot int
+		stack := &ItemStack{}
+		if err := rows.Scan(&slot, &stack.ItemID, &stack.Quantity); err != nil {
+			return err
+		}
+		inventory.SetSlot(slot, stack)
+	}
+
+	return rows.Err()
+}
+
+// SaveInventory replaces the items saved for a character
+func (d *Database) SaveInventory(name string, inventory *Inventory) error {
+	return d.Transact(func(tx *sql.Tx) error {
+		return saveInventory(tx, name, inventory)
+	})
+}
+
+// saveInventory replaces the items saved for a character as part of a
+// larger transaction
+func saveInventory(tx *sql.Tx, name string, inventory *Inventory) error {
+	if _, err := tx.Exec(`DELETE FROM character_items WHERE name = ?`, name); err != nil {
+		return err
+	}
+
+	for slot, stack := range inventory.Snapshot() {
+		if stack == nil {
+			continue
+		}
+		query := `INSERT INTO character_items (name, slot, item_id, quantity) VALUES (?, ?, ?, ?)`
+		if _, err := tx.Exec(query, name, slot, stack.ItemID, stack.Quantity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadProgress fills in the level and experience saved for a character,
+// leaving new characters at level 1
+func (d *Database) LoadProgress(name string, progress *Progress) error {
+	var level, experience int
+	row := d.db.QueryRow(`SELECT level, experience FROM character_progress WHERE name = ?`, name)
+	err := row.Scan(&level, &experience)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	progress.Set(level, experience)
+	return nil
+}
+
+// SaveProgress stores a character's level and experience; the currency
+// column predates wallets and is left alone
+func (d *Database) SaveProgress(name string, progress *Progress) error {
+	level, experience := progress.Snapshot()
+	query := `
+	INSERT INTO character_progress (name, level, experience, currency) VALUES (?, ?, ?, 0)
+	ON CONFLICT(name) DO UPDATE SET level = excluded.level, experience = excluded.experience`
+	_, err := d.db.Exec(query, name, level, experience)
+	return err
+}
+
+// LoadWallet returns a character's currency balance. Characters saved
+// before wallets existed open theirs with the currency of their progress,
+// recorded in the ledger as the opening balance
+func (d *Database) LoadWallet(name string, now time.Time) (int, error) {
+	var balance int
+	err := d.db.QueryRow(`SELECT balance FROM character_wallets WHERE name = ?`, name).Scan(&balance)
+	if err != sql.ErrNoRows {
+		return balance, err
+	}
+
+	err = d.db.QueryRow(`SELECT currency FROM character_progress WHERE name = ?`, name).Scan(&balance)
+	if err == sql.ErrNoRows || (err == nil && balance <= 0) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := d.RecordCurrency(CurrencyEntry{Name: name, Delta: balance, Reason: ReasonOpeningBalance, Time: now}); err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+// RecordCurrency changes a character's balance and appends the change to
+// the ledger, both or neither
+func (d *Database) RecordCurrency(entry CurrencyEntry) error {
+	return d.Transact(func(tx *sql.Tx) error {
+		_, err := recordCurrency(tx, entry)
+		return err
+	})
+}
+
+// recordCurrency changes a character's balance by the entry's delta as
+// part of a larger transaction and appends the change to the ledger with
+// the balance it left, which it returns. The balance is changed in place
+// so that writes from elsewhere are never overwritten, and it fails with
+// ErrInsufficientFunds rather than going below zero
+func recordCurrency(tx *sql.Tx, entry CurrencyEntry) (int, error) {
+	query := `UPDATE character_wallets SET balance = balance + ? WHERE name = ? AND balance + ? >= 0`
+	result, err := tx.Exec(query, entry.Delta, entry.Name, entry.Delta)
+	if err != nil {
+		return 0, err
+	}
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if changed == 0 {
+		// Credits always apply to an existing wallet, so nothing changed
+		// either because the debit is too big or there is no wallet yet
+		if entry.Delta < 0 {
+			return 0, ErrInsufficientFunds
+		}
+		if _, err := tx.Exec(`INSERT INTO character_wallets (name, balance) VALUES (?, ?)`, entry.Name, entry.Delta); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.QueryRow(`SELECT balance FROM character_wallets WHERE name = ?`, entry.Name).Scan(&entry.Balance); err != nil {
+		return 0, err
+	}
+
+	query = `INSERT INTO currency_ledger (name, delta, balance, reason, reference, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := tx.Exec(query, entry.Name, entry.Delta, entry.Balance, entry.Reason, entry.Reference, entry.Time.UTC()); err != nil {
+		return 0, err
+	}
+	return entry.Balance, nil
+}
+
+// LoadQuestLog fills a quest log with the quests saved for a character
+func (d *Database) LoadQuestLog(name string, log *QuestLog, quests map[string]*QuestDefinition) error {
+	rows, err := d.db.Query(`SELECT quest_id, state, progress, accepted_at, completed_at FROM character_quests WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var active []QuestProgress
+	completed := make(map[string]time.Time)
+	for rows.Next() {
+		var state, counts string
+		var completedAt sql.NullTime
+		progress := QuestProgress{}
+		if err := rows.Scan(&progress.QuestID, &state, &counts, &progress.Accepted, &completedAt); err != nil {
+			return err
+		}
+
+		if state == "completed" {
+			completed[progress.QuestID] = completedAt.Time
+			continue
+		}
+		if err := json.Unmarshal([]byte(counts), &progress.Counts); err != nil {
+			return err
+		}
+		active = append(active, progress)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	log.Restore(quests, active, completed)
+	return nil
+}
+
+// SaveQuestLog replaces the quests saved for a character
+func (d *Database) SaveQuestLog(name string, log *QuestLog) error {
+	active, completed := log.Snapshot()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM character_quests WHERE name = ?`, name); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO character_quests (name, quest_id, state, progress, accepted_at, completed_at) VALUES (?, ?, ?, ?, ?, ?)`
+	for _, progress := range active {
+		counts, err := json.Marshal(progress.Counts)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, name, progress.QuestID, "active", string(counts), progress.Accepted.UTC(), nil); err != nil {
+			return err
+		}
+	}
+	for questID, at := range completed {
+		if _, err := tx.Exec(query, name, questID, "completed", "[]", at.UTC(), at.UTC()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// LoadFlags sets the flags saved for a character
+func (d *Database) LoadFlags(name string, flags *CharacterFlags) error {
+	rows, err := d.db.Query(`SELECT flag FROM character_flags WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var flag string
+		if err := rows.Scan(&flag); err != nil {
+			return err
+		}
+		flags.Set(flag)
+	}
+
+	return rows.Err()
+}
+
+// SaveFlags replaces the flags saved for a character
+func (d *Database) SaveFlags(name string, flags *CharacterFlags) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM character_flags WHERE name = ?`, name); err != nil {
+		return err
+	}
+
+	for _, flag := range flags.List() {
+		if _, err := tx.Exec(`INSERT INTO character_flags (name, flag) VALUES (?, ?)`, name, flag); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// LoadProfessions restores the profession skills saved for a character
+func (d *Database) LoadProfessions(name string, professions *Professions) error {
+	rows, err := d.db.Query(`SELECT profession, level, experience FROM character_professions WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var skills []ProfessionSkill
+	for rows.Next() {
+		var skill ProfessionSkill
+		if err := rows.Scan(&skill.Profession, &skill.Level, &skill.Experience); err != nil {
+			return err
+		}
+		skills = append(skills, skill)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	professions.Restore(skills)
+	return nil
+}
+
+// SaveProfessions stores a character's profession skills
+func (d *Database) SaveProfessions(name string, professions *Professions) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO character_professions (name, profession, level, experience)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(name, profession) DO UPDATE SET level = excluded.level, experience = excluded.experience`
+
+	for _, skill := range professions.Snapshot() {
+		if _, err := tx.Exec(query, name, skill.Profession, skill.Level, skill.Experience); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetBind returns the bind point of a character, or sql.ErrNoRows when
+// they never bound anywhere
+func (d *Database) GetBind(name string) (*BindPoint, error) {
+	row := d.db.QueryRow(`SELECT zone, point, x, y FROM character_binds WHERE name = ?`, name)
+
+	bind := &BindPoint{}
+	if err := row.Scan(&bind.Zone, &bind.Name, &bind.Position.X, &bind.Position.Y); err != nil {
+		return nil, err
+	}
+	return bind, nil
+}
+
+// SaveBind stores the bind point of a character
+func (d *Database) SaveBind(name string, bind BindPoint) error {
+	query := `
+	INSERT INTO character_binds (name, zone, point, x, y)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(name) DO UPDATE SET zone = excluded.zone, point = excluded.point, x = excluded.x, y = excluded.y`
+
+	_, err := d.db.Exec(query, name, bind.Zone, bind.Name, bind.Position.X, bind.Position.Y)
+	return err
+}
+
+// LoadStatusEffects returns the status effects saved with a character
+func (d *Database) LoadStatusEffects(name string) ([]SavedStatus, error) {
+	rows, err := d.db.Query(`SELECT effect_id, stacks, source, remaining_seconds FROM character_effects WHERE name = ?`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var saved []SavedStatus
+	for rows.Next() {
+		var status SavedStatus
+		var seconds float64
+		if err := rows.Scan(&status.EffectID, &status.Stacks, &status.SourceID, &seconds); err != nil {
+			return nil, err
+		}
+		status.Remaining = time.Duration(seconds * float64(time.Second))
+		saved = append(saved, status)
+	}
+	return saved, rows.Err()
+}
+
+// SaveStatusEffects replaces the status effects saved with a character
+func (d *Database) SaveStatusEffects(name string, statuses []SavedStatus) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM character_effects WHERE name = ?`, name); err != nil {
+		return err
+	}
+	query := `INSERT INTO character_effects (name, effect_id, stacks, source, remaining_seconds) VALUES (?, ?, ?, ?, ?)`
+	for _, status := range statuses {
+		if _, err := tx.Exec(query, name, status.EffectID, status.Stacks, status.SourceID, status.Remaining.Seconds()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetLockout returns a character's unexpired lockout to an instance
+// template, or sql.ErrNoRows when they are free to enter a new copy
+func (d *Database) GetLockout(name, template string, now time.Time) (*InstanceLockout, error) {
+	query := `SELECT name, template, instance_id, expires_at FROM instance_lockouts WHERE name = ? AND template = ? AND expires_at > ?`
+	row := d.db.QueryRow(query, name, template, now.UTC())
+
+	lockout := &InstanceLockout{}
+	err := row.Scan(&lockout.Name, &lockout.Template, &lockout.InstanceID, &lockout.Expires)
+	if err != nil {
+		return nil, err
+	}
+
+	return lockout, nil
+}
+
+// SaveLockout binds a character to an instance until the given time
+func (d *Database) SaveLockout(name, template, instanceID string, expires time.Time) error {
+	query := `
+	INSERT INTO instance_lockouts (name, template, instance_id, expires_at) VALUES (?, ?, ?, ?)
+	ON CONFLICT(name, template) DO UPDATE SET instance_id = excluded.instance_id, expires_at = excluded.expires_at`
+	_, err := d.db.Exec(query, name, template, instanceID, expires.UTC())
+	return err
+}
+
+// insertMail writes a letter as part of a larger transaction and returns its ID
+func insertMail(tx *sql.Tx, mail *Mail) (int64, error) {
+	items, err := json.Marshal(mail.Items)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+	INSERT INTO mail (recipient, sender, subject, body, items, currency, cod, read, returned, sent_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, mail.Recipient, mail.Sender, mail.Subject, mail.Body, string(items), mail.Currency,
+		mail.COD, mail.Read, mail.Returned, mail.Sent.UTC(), mail.Expires.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// deleteMail removes a letter from a mailbox as part of a larger
+// transaction, failing when it is no longer there
+func deleteMail(tx *sql.Tx, id int64, recipient string) error {
+	result, err := tx.Exec(`DELETE FROM mail WHERE id = ? AND recipient = ?`, id, recipient)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows != 1 {
+		return ErrMailNotFound
+	}
+	return nil
+}
+
+// returnMail sends a letter back to its sender as part of a larger
+// transaction. It comes back unread, free of any COD and with a new
+// retention time, and cannot be returned again
+func returnMail(tx *sql.Tx, id int64, recipient string, sent, expires time.Time) error {
+	query := `
+	UPDATE mail SET recipient = sender, sender = recipient, cod = 0, read = 0, returned = 1, sent_at = ?, expires_at = ?
+	WHERE id = ? AND recipient = ? AND returned = 0`
+	result, err := tx.Exec(query, sent.UTC(), expires.UTC(), id, recipient)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows != 1 {
+		return ErrMailNotFound
+	}
+	return nil
+}
+
+const mailColumns = `id, recipient, sender, subject, body, items, currency, cod, read, returned, sent_at, expires_at`
+
+func scanMail(row interface{ Scan(...interface{}) error }) (*Mail, error) {
+	mail := &Mail{}
+	var items string
+	err := row.Scan(&mail.ID, &mail.Recipient, &mail.Sender, &mail.Subject, &mail.Body, &items, &mail.Currency,
+		&mail.COD, &mail.Read, &mail.Returned, &mail.Sent, &mail.Expires)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(items), &mail.Items); err != nil {
+		return nil, err
+	}
+	return mail, nil
+}
+
+func (d *Database) queryMail(query string, args ...interface{}) ([]*Mail, error) {
+	rows, err := d.db.Query(`SELECT `+mailColumns+` FROM mail `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var letters []*Mail
+	for rows.Next() {
+		mail, err := scanMail(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, mail)
+	}
+	return letters, rows.Err()
+}
+
+// GetMail loads a letter, returning sql.ErrNoRows when it is gone
+func (d *Database) GetMail(id int64) (*Mail, error) {
+	return scanMail(d.db.QueryRow(`SELECT `+mailColumns+` FROM mail WHERE id = ?`, id))
+}
+
+// LoadMail returns a character's mailbox, oldest letter first
+func (d *Database) LoadMail(recipient string) ([]*Mail, error) {
+	return d.queryMail(`WHERE recipient = ? ORDER BY id`, recipient)
+}
+
+// DueMail returns the letters whose retention time has run out
+func (d *Database) DueMail(now time.Time) ([]*Mail, error) {
+	return d.queryMail(`WHERE expires_at <= ? ORDER BY id`, now.UTC())
+}
+
+// CountMail returns how many letters a character has and how many of
+// them are unread
+func (d *Database) CountMail(recipient string) (total, unread int, err error) {
+	query := `SELECT COUNT(*), COALESCE(SUM(CASE WHEN read = 0 THEN 1 ELSE 0 END), 0) FROM mail WHERE recipient = ?`
+	err = d.db.QueryRow(query, recipient).Scan(&total, &unread)
+	return total, unread, err
+}
+
+// MarkMailRead marks every letter in a character's mailbox as read
+func (d *Database) MarkMailRead(recipient string) error {
+	_, err := d.db.Exec(`UPDATE mail SET read = 1 WHERE recipient = ? AND read = 0`, recipient)
+	return err
+}
+
+// LastAuctionID returns the highest auction ID handed out so far
+func (d *Database) LastAuctionID() (int64, error) {
+	var id int64
+	err := d.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM auctions`).Scan(&id)
+	return id, err
+}
+
+// insertAuction saves a new listing as part of a larger transaction
+func insertAuction(tx *sql.Tx, listing *AuctionListing) error {
+	query := `
+	INSERT INTO auctions (id, seller, item_id, quantity, min_bid, buyout, bid, bidder, deposit, state, created_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := tx.Exec(query, listing.ID, listing.Seller, listing.Item.ItemID, listing.Item.Quantity, listing.MinBid, listing.Buyout,
+		listing.Bid, listing.Bidder, listing.Deposit, listing.State, listing.Created.UTC(), listing.Expires.UTC())
+	return err
+}
+
+// updateAuctionBid raises the bid of an active listing as part of a
+// larger transaction, failing when the listing changed since it was read
+func updateAuctionBid(tx *sql.Tx, id int64, previous, bid int, bidder string) error {
+	query := `UPDATE auctions SET bid = ?, bidder = ? WHERE id = ? AND state = ? AND bid = ?`
+	return expectOneRow(tx.Exec(query, bid, bidder, id, AuctionActive, previous))
+}
+
+// closeAuction ends an active listing as part of a larger transaction,
+// failing when the listing changed since it was read
+func closeAuction(tx *sql.Tx, id int64, previous int, state, buyer string, price int, now time.Time) error {
+	query := `UPDATE auctions SET state = ?, bidder = ?, bid = ?, closed_at = ? WHERE id = ? AND state = ? AND bid = ?`
+	return expectOneRow(tx.Exec(query, state, buyer, price, now.UTC(), id, AuctionActive, previous))
+}
+
+func expectOneRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows != 1 {
+		return ErrAuctionChanged
+	}
+	return nil
+}
+
+const auctionColumns = `id, seller, item_id, quantity, min_bid, buyout, bid, bidder, deposit, state, created_at, expires_at`
+
+func scanAuction(row interface{ Scan(...interface{}) error }) (*AuctionListing, error) {
+	listing := &AuctionListing{}
+	err := row.Scan(&listing.ID, &listing.Seller, &listing.Item.ItemID, &listing.Item.Quantity, &listing.MinBid, &listing.Buyout,
+		&listing.Bid, &listing.Bidder, &listing.Deposit, &listing.State, &listing.Created, &listing.Expires)
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+func (d *Database) queryAuctions(query string, args ...interface{}) ([]*AuctionListing, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var listings []*AuctionListing
+	for rows.Next() {
+		listing, err := scanAuction(rows)
+		if err != nil {
+			return nil, err
+		}
+		listings = append(listings, listing)
+	}
+	return listings, rows.Err()
+}
+
+// GetAuction loads a listing, returning sql.ErrNoRows for unknown ones
+func (d *Database) GetAuction(id int64) (*AuctionListing, error) {
+	return scanAuction(d.db.QueryRow(`SELECT `+auctionColumns+` FROM auctions WHERE id = ?`, id))
+}
+
+// DueAuctions returns the active listings whose time ran out
+func (d *Database) DueAuctions(now time.Time) ([]*AuctionListing, error) {
+	return d.queryAuctions(`SELECT `+auctionColumns+` FROM auctions WHERE state = ? AND expires_at <= ? ORDER BY expires_at`, AuctionActive, now.UTC())
+}
+
+// SearchAuctions returns a page of the running listings, cheapest buyout
+// first, and how many match in all; empty filters match everything
+func (d *Database) SearchAuctions(itemIDs []string, seller string, maxPrice int, now time.Time, limit, offset int) ([]*AuctionListing, int, error) {
+	where := []string{`state = ?`, `expires_at > ?`}
+	args := []interface{}{AuctionActive, now.UTC()}
+	if len(itemIDs) > 0 {
+		where = append(where, `item_id IN (?`+strings.Repeat(`, ?`, len(itemIDs)-1)+`)`)
+		for _, id := range itemIDs {
+			args = append(args, id)
+		}
+	}
+	if seller != "" {
+		where = append(where, `seller = ?`)
+		args = append(args, seller)
+	}
+	if maxPrice > 0 {
+		where = append(where, `buyout <= ?`)
+		args = append(args, maxPrice)
+	}
+	filter := ` FROM auctions WHERE ` + strings.Join(where, ` AND `)
+
+	var total int
+	if err := d.db.QueryRow(`SELECT COUNT(*)`+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	listings, err := d.queryAuctions(`SELECT `+auctionColumns+filter+` ORDER BY buyout, id LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return listings, total, nil
+}
+
+// LoadStatistics returns a character's saved statistics by season
+func (d *Database) LoadStatistics(name string) (map[string]map[string]float64, error) {
+	rows, err := d.db.Query(`SELECT season, stat, value FROM character_statistics WHERE name = ?`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	saved := make(map[string]map[string]float64)
+	for rows.Next() {
+		var season, stat string
+		var value float64
+		if err := rows.Scan(&season, &stat, &value); err != nil {
+			return nil, err
+		}
+		if saved[season] == nil {
+			saved[season] = make(map[string]float64)
+		}
+		saved[season][stat] = value
+	}
+	return saved, rows.Err()
+}
+
+// AddStatistics adds changes to a character's statistics for a season
+func (d *Database) AddStatistics(name, season string, changes map[string]float64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO character_statistics (name, season, stat, value)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(name, season, stat) DO UPDATE SET value = value + excluded.value`
+	for stat, value := range changes {
+		if _, err := tx.Exec(query, name, season, stat, value); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Leaderboard returns a page of the characters with the highest total of
+// a statistic in a season, or summed over every season for SeasonAllTime,
+// and how many characters have one in all
+func (d *Database) Leaderboard(stat, season string, limit, offset int) ([]LeaderboardEntry, int, error) {
+	where := `WHERE stat = ? AND value > 0`
+	args := []interface{}{stat}
+	if season != SeasonAllTime {
+		where += ` AND season = ?`
+		args = append(args, season)
+	}
+
+	var total int
+	if err := d.db.QueryRow(`SELECT COUNT(DISTINCT name) FROM character_statistics `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT name, SUM(value) AS total FROM character_statistics ` + where + ` GROUP BY name ORDER BY total DESC, name LIMIT ? OFFSET ?`
+	rows, err := d.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []LeaderboardEntry{}
+	for rows.Next() {
+		var entry LeaderboardEntry
+		if err := rows.Scan(&entry.Name, &entry.Value); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
+
+// LoadAchievements restores the achievements, progress and title saved
+// for a character
+func (d *Database) LoadAchievements(name string, achievements *Achievements) error {
+	unlocked := make(map[string]time.Time)
+	rows, err := d.db.Query(`SELECT achievement_id, unlocked_at FROM character_achievements WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return err
+		}
+		unlocked[id] = at
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	counts := make(map[string][]float64)
+	progress, err := d.db.Query(`SELECT achievement_id, criterion, count FROM character_achievement_progress WHERE name = ? ORDER BY achievement_id, criterion`, name)
+	if err != nil {
+		return err
+	}
+	defer progress.Close()
+	for progress.Next() {
+		var id string
+		var criterion int
+		var count float64
+		if err := progress.Scan(&id, &criterion, &count); err != nil {
+			return err
+		}
+		values := counts[id]
+		for len(values) <= criterion {
+			values = append(values, 0)
+		}
+		values[criterion] = count
+		counts[id] = values
+	}
+	if err := progress.Err(); err != nil {
+		return err
+	}
+
+	var title string
+	err = d.db.QueryRow(`SELECT title FROM character_titles WHERE name = ?`, name).Scan(&title)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	achievements.restore(unlocked, counts, title)
+	return nil
+}
+
+// UnlockAchievement records an achievement a character has earned
+func (d *Database) UnlockAchievement(name, achievementID string, at time.Time) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO character_achievements (name, achievement_id, unlocked_at) VALUES (?, ?, ?)`, name, achievementID, at.UTC()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM character_achievement_progress WHERE name = ? AND achievement_id = ?`, name, achievementID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SaveAchievements replaces the achievement progress and title saved for
+// a character
+func (d *Database) SaveAchievements(name string, achievements *Achievements) error {
+	counts, title := achievements.progressSnapshot()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM character_achievement_progress WHERE name = ?`, name); err != nil {
+		return err
+	}
+	for id, values := range counts {
+		for criterion, count := range values {
+			if count == 0 {
+				continue
+			}
+			query := `INSERT INTO character_achievement_progress (name, achievement_id, criterion, count) VALUES (?, ?, ?, ?)`
+			if _, err := tx.Exec(query, name, id, criterion, count); err != nil {
+				return err
+			}
+		}
+	}
+
+	query := `
+	INSERT INTO character_titles (name, title)
+	VALUES (?, ?)
+	ON CONFLICT(name) DO UPDATE SET title = excluded.title`
+	if _, err := tx.Exec(query, name, title); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *Database) Close() error {
+	return d.db.Close()
+}
@@ -0,0 +1,480 @@
+package game
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// corpseReviveRange is how close a ghost must come to their corpse to
+	// return to life
+	corpseReviveRange = 96.0
+	// bindRange is how close a player must stand to a bind point to bind there
+	bindRange = 64.0
+	// respawnVitalsPercent is the health and mana players come back with
+	// after releasing or reaching their corpse
+	respawnVitalsPercent = 50
+	// resurrectOfferTimeout is how long a resurrection stays on offer
+	resurrectOfferTimeout = time.Minute
+)
+
+// LifeState is whether a character is alive, dead or a ghost
+type LifeState string
+
+const (
+	Alive LifeState = "alive"
+	// Dead characters lie where they fell until they release their spirit
+	// or accept a resurrection
+	Dead LifeState = "dead"
+	// Ghost characters released their spirit in a zone with corpse runs
+	// and walk back to their corpse to return to life
+	Ghost LifeState = "ghost"
+)
+
+var (
+	ErrDead           = errors.New("you are dead")
+	ErrNotDead        = errors.New("you are not dead")
+	ErrNotGhost       = errors.New("you have no corpse to return to")
+	ErrCorpseTooFar   = errors.New("your corpse is too far away")
+	ErrNoResurrection = errors.New("no resurrection is on offer")
+	ErrNoBindPoint    = errors.New("there is no bind point nearby")
+)
+
+// DeathRules are what dying costs in a zone, as written in zones.json and
+// instances.json
+type DeathRules struct {
+	// CorpseRun releases players as ghosts at the graveyard, who have to
+	// walk back to their corpse; otherwise they come back to life there
+	CorpseRun bool `json:"corpse_run"`
+	// ExperiencePenaltyPercent is the share of the experience needed for
+	// the next level lost on release, never taking a level away
+	ExperiencePenaltyPercent int `json:"experience_penalty_percent"`
+}
+
+// BindPoint is where a character comes back when the zone they died in
+// has no graveyard
+type BindPoint struct {
+	Zone     string
+	Name     string
+	Position Position
+}
+
+// resurrectOffer is a resurrection a player cast on a dead one, waiting
+// for them to accept it
+type resurrectOffer struct {
+	zone     string
+	position Position
+	percent  int
+	expires  time.Time
+}
+
+// Life tracks whether a character is alive, where their corpse lies and
+// where they are bound
+type Life struct {
+	state      LifeState
+	corpse     Position
+	corpseZone string
+	bind       *BindPoint
+	offer      *resurrectOffer
+	mu         sync.Mutex
+}
+
+// NewLife creates the life of a living character without a bind point
+func NewLife() *Life {
+	return &Life{state: Alive}
+}
+
+// State returns whether the character is alive, dead or a ghost
+func (l *Life) State() LifeState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+// Alive reports whether the character is alive
+func (l *Life) Alive() bool {
+	return l.State() == Alive
+}
+
+// Corpse returns the zone and position the character died at
+func (l *Life) Corpse() (string, Position) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.corpseZone, l.corpse
+}
+
+// Bind returns the character's bind point, if any
+func (l *Life) Bind() (BindPoint, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.bind == nil {
+		return BindPoint{}, false
+	}
+	return *l.bind, true
+}
+
+// SetBind binds the character to a point
+func (l *Life) SetBind(bind BindPoint) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bind = &bind
+}
+
+// die leaves a corpse where the character fell
+func (l *Life) die(zone string, position Position) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.state = Dead
+	l.corpseZone = zone
+	l.corpse = position
+	l.offer = nil
+}
+
+// release turns a dead character into a ghost, or back to life
+func (l *Life) release(ghost bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.state = Alive
+	if ghost {
+		l.state = Ghost
+	}
+	l.offer = nil
+}
+
+// revive brings the character back to life
+func (l *Life) revive() {
+	l.release(false)
+}
+
+// offerResurrection records a resurrection for the character to accept
+func (l *Life) offerResurrection(offer resurrectOffer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.offer = &offer
+}
+
+// takeOffer returns and clears the resurrection on offer, unless it ran out
+func (l *Life) takeOffer(now time.Time) (resurrectOffer, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	offer := l.offer
+	l.offer = nil
+	if offer == nil || now.After(offer.expires) {
+		return resurrectOffer{}, false
+	}
+	return *offer, true
+}
+
+// Message returns the death_state message describing the character's life
+func (l *Life) Message() map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	message := map[string]interface{}{
+		"type":  "death_state",
+		"state": l.state,
+	}
+	if l.state != Alive {
+		message["corpse_zone"] = l.corpseZone
+		message["corpse_x"] = l.corpse.X
+		message["corpse_y"] = l.corpse.Y
+	}
+	return message
+}
+
+// LoseExperience takes a share of the experience needed for the next
+// level, without going below the start of the current level, and returns
+// how much was lost
+func (p *Progress) LoseExperience(percent int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if percent <= 0 || p.Level >= MaxLevel {
+		return 0
+	}
+	lost := minInt(ExperienceToLevel(p.Level)*percent/100, p.Experience)
+	p.Experience -= lost
+	return lost
+}
+
+// killPlayer leaves a player's corpse where they fell and stops whatever
+// they were doing; the caller holds the world lock
+func (w *World) killPlayer(player *Player, killerID string) []outboundMessage {
+	position := player.GetPosition()
+	player.Life.die(w.ID, position)
+	w.AddStatistic(player, StatisticDeaths, 1)
+	w.publish(PlayerDied{Player: player, Zone: w.ID, KillerID: killerID})
+	if killer, exists := w.Players[killerID]; exists && killerID != player.ID {
+		w.AddStatistic(killer, StatisticKills, 1)
+		w.publish(EntityKilled{Killer: killer, Zone: w.ID, VictimID: player.ID, Kind: KillTargetPlayer})
+	}
+	player.Effects.Clear()
+	w.clearPlayerPath(player.ID)
+	delete(w.gathers, player.ID)
+	delete(w.conversations, player.ID)
+
+	messages := w.interruptCast(player.ID, "died")
+	messages = append(messages, w.forfeitDuel(player.ID, DuelDied)...)
+	messages = append(messages,
+		outboundMessage{near: &position, message: map[string]interface{}{
+			"type":      "player_died",
+			"id":        player.ID,
+			"killer_id": killerID,
+			"x":         position.X,
+			"y":         position.Y,
+		}},
+		outboundMessage{playerID: player.ID, message: player.Life.Message()},
+		outboundMessage{playerID: player.ID, message: player.Effects.Message(player.ID, time.Now())},
+	)
+	return append(messages, refreshStats(player)...)
+}
+
+// revivePlayer brings a player back to life at a position in this zone
+// with a share of their health and mana; the caller holds the world lock
+func (w *World) revivePlayer(player *Player, position Position, percent int) []outboundMessage {
+	player.Life.revive()
+	player.Vitals.Revive(percent)
+	player.SetPosition(position)
+	return w.placeRevived(player, "player_revived")
+}
+
+// placeRevived tells a player and those around them about their new life
+// or ghost; the caller holds the world lock
+func (w *World) placeRevived(player *Player, event string) []outboundMessage {
+	position := player.GetPosition()
+	messages := w.refreshInterest(player, "player_appeared")
+	return append(messages,
+		outboundMessage{near: &position, message: map[string]interface{}{
+			"type":  event,
+			"id":    player.ID,
+			"x":     position.X,
+			"y":     position.Y,
+			"state": player.Life.State(),
+		}},
+		outboundMessage{playerID: player.ID, message: map[string]interface{}{
+			"type": "position_correction",
+			"x":    position.X,
+			"y":    position.Y,
+		}},
+		outboundMessage{playerID: player.ID, message: player.Life.Message()},
+		outboundMessage{playerID: player.ID, message: player.Vitals.Message()},
+		outboundMessage{playerID: player.ID, message: player.StatsMessage()},
+		outboundMessage{playerID: player.ID, message: w.pvpStatus(player, time.Now())},
+	)
+}
+
+// ReviveAtCorpse brings a ghost back to life once they reach their corpse
+func (w *World) ReviveAtCorpse(playerID string) error {
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	if player.Life.State() != Ghost {
+		w.mu.Unlock()
+		return ErrNotGhost
+	}
+	zone, corpse := player.Life.Corpse()
+	if zone != w.ID {
+		w.mu.Unlock()
+		return ErrNotGhost
+	}
+	if distance(player.GetPosition(), corpse) > corpseReviveRange {
+		w.mu.Unlock()
+		return ErrCorpseTooFar
+	}
+
+	messages := w.revivePlayer(player, corpse, respawnVitalsPercent)
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	return nil
+}
+
+// AcceptResurrection brings a dead player or ghost back to life where the
+// resurrection was cast
+func (w *World) AcceptResurrection(playerID string) error {
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	if player.Life.Alive() {
+		w.mu.Unlock()
+		return ErrNotDead
+	}
+	offer, ok := player.Life.takeOffer(time.Now())
+	if !ok || offer.zone != w.ID {
+		w.mu.Unlock()
+		return ErrNoResurrection
+	}
+
+	messages := w.revivePlayer(player, offer.position, offer.percent)
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	return nil
+}
+
+// resurrect offers a dead player a resurrection at the caster's feet; the
+// caller holds the world lock
+func (w *World) resurrect(caster, target *Player, ability *AbilityDefinition, percent int, now time.Time) []outboundMessage {
+	if target.Life.Alive() {
+		return nil
+	}
+	target.Life.offerResurrection(resurrectOffer{
+		zone:     w.ID,
+		position: caster.GetPosition(),
+		percent:  percent,
+		expires:  now.Add(resurrectOfferTimeout),
+	})
+
+	return []outboundMessage{{playerID: target.ID, message: map[string]interface{}{
+		"type":        "resurrect_offer",
+		"caster_id":   caster.ID,
+		"caster_name": caster.Name,
+		"ability_id":  ability.ID,
+		"percent":     percent,
+		"seconds":     resurrectOfferTimeout.Seconds(),
+	}}}
+}
+
+// BindAt binds a player to the bind point they stand at
+func (w *World) BindAt(playerID string) error {
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	if !player.Life.Alive() {
+		w.mu.Unlock()
+		return ErrDead
+	}
+	if w.Map == nil {
+		w.mu.Unlock()
+		return ErrNoBindPoint
+	}
+	position := player.GetPosition()
+	var bind *SpawnPoint
+	for _, point := range w.Map.SpawnsOfType("bind") {
+		if distance(position, point.Position) <= bindRange {
+			point := point
+			bind = &point
+			break
+		}
+	}
+	if bind == nil {
+		w.mu.Unlock()
+		return ErrNoBindPoint
+	}
+
+	player.Life.SetBind(BindPoint{Zone: w.ID, Name: bind.Name, Position: bind.Position})
+	w.mu.Unlock()
+
+	w.deliver([]outboundMessage{{playerID: playerID, message: map[string]interface{}{
+		"type": "bind_set",
+		"zone": w.ID,
+		"name": bind.Name,
+	}}})
+	return nil
+}
+
+// nearestGraveyard returns the graveyard of the zone closest to a position
+func (w *World) nearestGraveyard(position Position) (Position, bool) {
+	if w.Map == nil {
+		return Position{}, false
+	}
+	best, found := Position{}, false
+	bestDistance := math.MaxFloat64
+	for _, graveyard := range w.Map.SpawnsOfType("graveyard") {
+		if d := distance(position, graveyard.Position); d < bestDistance {
+			best, bestDistance, found = graveyard.Position, d, true
+		}
+	}
+	return best, found
+}
+
+// ReleaseSpirit sends a dead player to the graveyard nearest their corpse,
+// as a ghost in zones with corpse runs; zones without a graveyard send
+// them to their bind point, an instance's exit or the default spawn
+func (zm *ZoneManager) ReleaseSpirit(playerID string) error {
+	player, world, exists := zm.FindPlayer(playerID)
+	if !exists {
+		return errors.New("player not found")
+	}
+	if player.Life.State() != Dead {
+		return ErrNotDead
+	}
+
+	target, position := zm.respawnPoint(player, world)
+	ghost := world.Death.CorpseRun && target == world
+	player.Life.release(ghost)
+	if !ghost {
+		player.Vitals.Revive(respawnVitalsPercent)
+	}
+	zm.applyDeathPenalty(player, world)
+
+	if target != world {
+		return zm.transferTo(playerID, target, position)
+	}
+
+	world.mu.Lock()
+	player.SetPosition(position)
+	event := "player_revived"
+	if ghost {
+		event = "player_released"
+	}
+	messages := world.placeRevived(player, event)
+	world.mu.Unlock()
+
+	world.deliver(messages)
+	return nil
+}
+
+// respawnPoint picks where a player who died in a zone comes back
+func (zm *ZoneManager) respawnPoint(player *Player, world *World) (*World, Position) {
+	_, corpse := player.Life.Corpse()
+	if graveyard, ok := world.nearestGraveyard(corpse); ok {
+		return world, graveyard
+	}
+	if bind, ok := player.Life.Bind(); ok {
+		if target, exists := zm.Zone(bind.Zone); exists {
+			return target, bind.Position
+		}
+	}
+	if templateID, isInstance := instanceTemplateID(world.ID); isInstance {
+		if template, exists := zm.Content().Instances[templateID]; exists {
+			return zm.instanceExit(template)
+		}
+	}
+	target := zm.DefaultZone()
+	return target, target.SpawnPosition(Position{})
+}
+
+// applyDeathPenalty takes the experience a zone charges for dying
+func (zm *ZoneManager) applyDeathPenalty(player *Player, world *World) {
+	lost := player.Progress.LoseExperience(world.Death.ExperiencePenaltyPercent)
+	if lost == 0 {
+		return
+	}
+
+	zm.mu.RLock()
+	broadcaster := zm.broadcaster
+	zm.mu.RUnlock()
+	if broadcaster != nil {
+		broadcaster.SendToPlayer(player.ID, player.Progress.Message())
+		broadcaster.SendToPlayer(player.ID, map[string]interface{}{
+			"type":       "death_penalty",
+			"experience": lost,
+		})
+	}
+}
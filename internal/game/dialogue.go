@@ -0,0 +1,268 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNoDialogue       = errors.New("that npc has nothing to say")
+	ErrNoConversation   = errors.New("not in a conversation")
+	ErrUnknownOption    = errors.New("unknown dialogue option")
+	ErrConditionsNotMet = errors.New("that option is not available")
+)
+
+// ConditionType is what a dialogue condition checks about the player
+type ConditionType string
+
+const (
+	// ConditionLevel requires at least Value levels
+	ConditionLevel ConditionType = "level"
+	// ConditionQuest requires Quest to be in State
+	ConditionQuest ConditionType = "quest"
+	// ConditionItem requires at least Value of Item in the inventory
+	ConditionItem ConditionType = "item"
+	// ConditionFlag requires Flag to be set on the character
+	ConditionFlag ConditionType = "flag"
+)
+
+// Quest states a quest condition can ask for: a quest is locked until
+// its level and prerequisites are met, then available to accept, active
+// while in the quest log, complete once its objectives are met and
+// completed after it was handed in
+const (
+	QuestStateLocked    = "locked"
+	QuestStateAvailable = "available"
+	QuestStateActive    = "active"
+	QuestStateComplete  = "complete"
+	QuestStateCompleted = "completed"
+)
+
+// DialogueCondition is a check an option or entry needs to pass; Not
+// turns the check around
+type DialogueCondition struct {
+	Type  ConditionType `json:"type"`
+	Value int           `json:"value"`
+	Quest string        `json:"quest"`
+	State string        `json:"state"`
+	Item  string        `json:"item"`
+	Flag  string        `json:"flag"`
+	Not   bool          `json:"not"`
+}
+
+// Met reports whether the player passes the condition
+func (c DialogueCondition) Met(player *Player, content *Content) bool {
+	met := false
+	switch c.Type {
+	case ConditionLevel:
+		met = player.Progress.GetLevel() >= c.Value
+	case ConditionQuest:
+		met = questState(player, content.Quests[c.Quest]) == c.State
+	case ConditionItem:
+		met = player.Inventory.Count(c.Item) >= maxInt(c.Value, 1)
+	case ConditionFlag:
+		met = player.Flags.Has(c.Flag)
+	}
+	return met != c.Not
+}
+
+// questState names where a player stands with a quest
+func questState(player *Player, quest *QuestDefinition) string {
+	if quest == nil {
+		return ""
+	}
+	if player.Quests.Completed(quest.ID) {
+		return QuestStateCompleted
+	}
+	if progress, active := player.Quests.Active(quest.ID); active {
+		if progress.Complete(quest) {
+			return QuestStateComplete
+		}
+		return QuestStateActive
+	}
+	if player.Quests.CanAccept(quest, player.Progress.GetLevel()) == nil {
+		return QuestStateAvailable
+	}
+	return QuestStateLocked
+}
+
+// conditionsMet reports whether the player passes every condition
+func conditionsMet(conditions []DialogueCondition, player *Player, content *Content) bool {
+	for _, condition := range conditions {
+		if !condition.Met(player, content) {
+			return false
+		}
+	}
+	return true
+}
+
+// ActionType is what choosing a dialogue option does
+type ActionType string
+
+const (
+	// ActionGiveQuest adds Quest to the player's quest log
+	ActionGiveQuest ActionType = "give_quest"
+	// ActionTurnInQuest hands Quest in
+	ActionTurnInQuest ActionType = "turn_in_quest"
+	// ActionOpenShop opens the Shop window
+	ActionOpenShop ActionType = "open_shop"
+	// ActionOpenAuction opens the auction house
+	ActionOpenAuction ActionType = "open_auction"
+	// ActionTeleport moves the player to Spawn of Zone
+	ActionTeleport ActionType = "teleport"
+	// ActionSetFlag sets Flag on the character, or clears it with Clear
+	ActionSetFlag ActionType = "set_flag"
+	// ActionScript calls Function of Script with the player and the NPC
+	ActionScript ActionType = "script"
+)
+
+// DialogueAction is something that happens when an option is chosen
+type DialogueAction struct {
+	Type  ActionType `json:"type"`
+	Quest string     `json:"quest"`
+	Shop  string     `json:"shop"`
+	Zone  string     `json:"zone"`
+	Spawn string     `json:"spawn"`
+	Flag  string     `json:"flag"`
+	Clear bool       `json:"clear"`
+	// Script and Function name the script function a script action calls
+	Script   string `json:"script"`
+	Function string `json:"function"`
+}
+
+// DialogueOption is an answer the player can pick; without Next the
+// conversation ends after its actions
+type DialogueOption struct {
+	Text       string              `json:"text"`
+	Next       string              `json:"next"`
+	Conditions []DialogueCondition `json:"conditions"`
+	Actions    []DialogueAction    `json:"actions"`
+}
+
+// DialogueNode is one thing an NPC says along with the possible answers
+type DialogueNode struct {
+	Text    string           `json:"text"`
+	Options []DialogueOption `json:"options"`
+}
+
+// DialogueEntry is a node a conversation may start at
+type DialogueEntry struct {
+	Node       string              `json:"node"`
+	Conditions []DialogueCondition `json:"conditions"`
+}
+
+// Dialogue is a branching conversation as written in dialogues.json
+type Dialogue struct {
+	ID string `json:"id"`
+	// Start lists the nodes a conversation can open with; the first one
+	// whose conditions the player passes is used
+	Start []DialogueEntry          `json:"start"`
+	Nodes map[string]*DialogueNode `json:"nodes"`
+}
+
+// entry returns the node a conversation with the player opens with
+func (d *Dialogue) entry(player *Player, content *Content) (string, bool) {
+	for _, entry := range d.Start {
+		if conditionsMet(entry.Conditions, player, content) {
+			return entry.Node, true
+		}
+	}
+	return "", false
+}
+
+// validate checks that every node, quest, item, zone and flag a
+// dialogue refers to exists
+func (d *Dialogue) validate(content *Content) error {
+	if len(d.Start) == 0 {
+		return errors.New("no start nodes")
+	}
+	for _, entry := range d.Start {
+		if _, exists := d.Nodes[entry.Node]; !exists {
+			return fmt.Errorf("starts at unknown node %q", entry.Node)
+		}
+		if err := validateConditions(entry.Conditions, content); err != nil {
+			return err
+		}
+	}
+
+	for nodeID, node := range d.Nodes {
+		for _, option := range node.Options {
+			if _, exists := d.Nodes[option.Next]; option.Next != "" && !exists {
+				return fmt.Errorf("node %q leads to unknown node %q", nodeID, option.Next)
+			}
+			if err := validateConditions(option.Conditions, content); err != nil {
+				return fmt.Errorf("node %q: %w", nodeID, err)
+			}
+			for _, action := range option.Actions {
+				if err := validateAction(action, content); err != nil {
+					return fmt.Errorf("node %q: %w", nodeID, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateConditions(conditions []DialogueCondition, content *Content) error {
+	for _, condition := range conditions {
+		switch condition.Type {
+		case ConditionLevel:
+		case ConditionQuest:
+			if _, exists := content.Quests[condition.Quest]; !exists {
+				return fmt.Errorf("condition on unknown quest %q", condition.Quest)
+			}
+			switch condition.State {
+			case QuestStateLocked, QuestStateAvailable, QuestStateActive, QuestStateComplete, QuestStateCompleted:
+			default:
+				return fmt.Errorf("unknown quest state %q", condition.State)
+			}
+		case ConditionItem:
+			if _, exists := content.Items[condition.Item]; !exists {
+				return fmt.Errorf("condition on unknown item %q", condition.Item)
+			}
+		case ConditionFlag:
+			if condition.Flag == "" {
+				return errors.New("flag condition without a flag")
+			}
+		default:
+			return fmt.Errorf("unknown condition type %q", condition.Type)
+		}
+	}
+	return nil
+}
+
+func validateAction(action DialogueAction, content *Content) error {
+	switch action.Type {
+	case ActionGiveQuest, ActionTurnInQuest:
+		if _, exists := content.Quests[action.Quest]; !exists {
+			return fmt.Errorf("action on unknown quest %q", action.Quest)
+		}
+	case ActionOpenShop:
+		if _, exists := content.Shops[action.Shop]; !exists {
+			return fmt.Errorf("opens unknown shop %q", action.Shop)
+		}
+	case ActionOpenAuction:
+	case ActionTeleport:
+		zone, exists := content.Zones[action.Zone]
+		if !exists {
+			return fmt.Errorf("teleport to unknown zone %q", action.Zone)
+		}
+		if _, exists := content.Maps[zone.Map].Spawn(action.Spawn); action.Spawn != "" && !exists {
+			return fmt.Errorf("teleport to unknown spawn %q of zone %q", action.Spawn, action.Zone)
+		}
+	case ActionSetFlag:
+		if action.Flag == "" {
+			return errors.New("set_flag action without a flag")
+		}
+	case ActionScript:
+		if err := content.checkScript(action.Script); err != nil {
+			return err
+		}
+		if !content.Scripts.Has(action.Script, action.Function) {
+			return fmt.Errorf("script %q has no function %q", action.Script, action.Function)
+		}
+	default:
+		return fmt.Errorf("unknown action type %q", action.Type)
+	}
+	return nil
+}
@@ -5,13 +5,20 @@ type EntityType int
 const (
 	NPC EntityType = iota
 	Item
+	Resource
 )
 
 type Entity struct {
-	ID       string
-	Type     EntityType
-	Name     string
-	Position Position
+	ID        string
+	Type      EntityType
+	Name      string
+	Position  Position
+	AI        *NPCBrain
+	Drop      *ItemDrop
+	Node      *ResourceNode
+	Health    int
+	MaxHealth int
+	Effects   *StatusEffects
 }
 
 type Position struct {
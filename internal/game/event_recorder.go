@@ -0,0 +1,133 @@
+package game
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// TestingT is the part of testing.TB an EventRecorder reports through,
+// so the game package does not import testing
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// EventRecorder records the events published on a bus so tests can
+// assert on what a piece of the game emitted. It listens synchronously,
+// so an event is recorded by the time Publish returns
+type EventRecorder struct {
+	subscription *Subscription
+	events       []Event
+	recorded     chan struct{}
+	mu           sync.Mutex
+}
+
+// NewEventRecorder starts recording the events named, or every event
+// when no names are given
+func NewEventRecorder(bus *EventBus, names ...string) *EventRecorder {
+	recorder := &EventRecorder{recorded: make(chan struct{}, 1)}
+	recorder.subscription = bus.SubscribeSync(recorder.record, names...)
+	return recorder
+}
+
+// record keeps an event and wakes anyone waiting for one
+func (r *EventRecorder) record(event Event) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+
+	select {
+	case r.recorded <- struct{}{}:
+	default:
+	}
+}
+
+// Stop stops recording
+func (r *EventRecorder) Stop() {
+	r.subscription.Unsubscribe()
+}
+
+// Events returns every event recorded so far, oldest first
+func (r *EventRecorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// Named returns the recorded events with a name, oldest first
+func (r *EventRecorder) Named(name string) []Event {
+	var named []Event
+	for _, event := range r.Events() {
+		if event.EventName() == name {
+			named = append(named, event)
+		}
+	}
+	return named
+}
+
+// Reset forgets the events recorded so far
+func (r *EventRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+// WaitFor waits until an event with a name has been recorded, for events
+// published by asynchronous subscribers, reporting false on timeout
+func (r *EventRecorder) WaitFor(name string, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		if len(r.Named(name)) > 0 {
+			return true
+		}
+		select {
+		case <-r.recorded:
+		case <-deadline.C:
+			return len(r.Named(name)) > 0
+		}
+	}
+}
+
+// AssertEmitted checks that the wanted events were recorded in the order
+// given, other events in between allowed
+func (r *EventRecorder) AssertEmitted(t TestingT, want ...Event) bool {
+	t.Helper()
+
+	events := r.Events()
+	next := 0
+	for _, event := range events {
+		if next < len(want) && reflect.DeepEqual(event, want[next]) {
+			next++
+		}
+	}
+	if next < len(want) {
+		t.Errorf("event %s %+v was not emitted; got %s", want[next].EventName(), want[next], eventNames(events))
+		return false
+	}
+	return true
+}
+
+// AssertNotEmitted checks that no event with any of the names was recorded
+func (r *EventRecorder) AssertNotEmitted(t TestingT, names ...string) bool {
+	t.Helper()
+
+	for _, name := range names {
+		if named := r.Named(name); len(named) > 0 {
+			t.Errorf("event %s was emitted %d times, want none", name, len(named))
+			return false
+		}
+	}
+	return true
+}
+
+// eventNames lists the names of some events for failure messages
+func eventNames(events []Event) []string {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = event.EventName()
+	}
+	return names
+}
@@ -0,0 +1,352 @@
+package game
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// Names of the events published on the event bus
+const (
+	EventPlayerJoined         = "player_joined"
+	EventPlayerLeft           = "player_left"
+	EventPlayerMoved          = "player_moved"
+	EventChatSent             = "chat_sent"
+	EventInteractionCompleted = "interaction_completed"
+	EventEntityKilled         = "entity_killed"
+	EventPlayerDied           = "player_died"
+	EventQuestCompleted       = "quest_completed"
+	EventLevelUp              = "level_up"
+	EventStatisticChanged     = "statistic_changed"
+	EventAchievementUnlocked  = "achievement_unlocked"
+)
+
+// KillTargetPlayer is the kind of entity killed when the victim is a player
+const KillTargetPlayer = "player"
+
+// DefaultEventQueueSize is how many events an asynchronous subscriber
+// can fall behind by when it does not ask for another size
+const DefaultEventQueueSize = 1024
+
+// Event is something that happened in the game, published on the event
+// bus so other systems can react to it without the code that made it
+// happen knowing about them
+type Event interface {
+	EventName() string
+}
+
+// PlayerJoined is a character logging in
+type PlayerJoined struct {
+	Player *Player
+	Zone   string
+}
+
+// PlayerLeft is a character logging out
+type PlayerLeft struct {
+	Player *Player
+	Zone   string
+}
+
+// PlayerMoved is a player moving, whether by their own steps or along a
+// clicked path
+type PlayerMoved struct {
+	Player    *Player
+	Zone      string
+	From      Position
+	To        Position
+	Sprinting bool
+}
+
+// ChatSent is a player talking to their zone
+type ChatSent struct {
+	Player *Player
+	Zone   string
+	Text   string
+}
+
+// InteractionCompleted is a player interaction that went through
+type InteractionCompleted struct {
+	From *Player
+	To   *Player
+	Type InteractionType
+}
+
+// EntityKilled is a player killing an NPC or another player. Kind is
+// the NPC definition killed, or KillTargetPlayer
+type EntityKilled struct {
+	Killer   *Player
+	Zone     string
+	VictimID string
+	Kind     string
+}
+
+// PlayerDied is a player dying to an NPC, another player or themselves
+type PlayerDied struct {
+	Player   *Player
+	Zone     string
+	KillerID string
+}
+
+// QuestCompleted is a quest turned in
+type QuestCompleted struct {
+	Player  *Player
+	QuestID string
+}
+
+// LevelUp is a character gaining one or more levels
+type LevelUp struct {
+	Player *Player
+	Level  int
+}
+
+// StatisticChanged is one of a character's statistics growing; Total is
+// its new all-time total
+type StatisticChanged struct {
+	Player    *Player
+	Statistic string
+	Total     float64
+}
+
+// AchievementUnlocked is a character earning an achievement
+type AchievementUnlocked struct {
+	Player        *Player
+	AchievementID string
+}
+
+func (PlayerJoined) EventName() string         { return EventPlayerJoined }
+func (PlayerLeft) EventName() string           { return EventPlayerLeft }
+func (PlayerMoved) EventName() string          { return EventPlayerMoved }
+func (ChatSent) EventName() string             { return EventChatSent }
+func (InteractionCompleted) EventName() string { return EventInteractionCompleted }
+func (EntityKilled) EventName() string         { return EventEntityKilled }
+func (PlayerDied) EventName() string           { return EventPlayerDied }
+func (QuestCompleted) EventName() string       { return EventQuestCompleted }
+func (LevelUp) EventName() string              { return EventLevelUp }
+func (StatisticChanged) EventName() string     { return EventStatisticChanged }
+func (AchievementUnlocked) EventName() string  { return EventAchievementUnlocked }
+
+// Overflow is what an asynchronous subscriber's queue does with an event
+// when it is full
+type Overflow int
+
+const (
+	// OverflowDrop drops the new event
+	OverflowDrop Overflow = iota
+	// OverflowDropOldest drops the oldest queued event to make room
+	OverflowDropOldest
+	// OverflowBlock makes the publisher wait for room. Zones publish from
+	// their tick, so a subscriber using it must keep up and must not wait
+	// for a zone itself
+	OverflowBlock
+)
+
+// AsyncOptions configure an asynchronous subscriber
+type AsyncOptions struct {
+	QueueSize int
+	Overflow  Overflow
+}
+
+// Subscription is a subscriber's place on the event bus
+type Subscription struct {
+	bus      *EventBus
+	names    map[string]bool
+	handle   func(Event)
+	queue    chan Event
+	overflow Overflow
+	dropped  uint64
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// wants reports whether the subscriber listens to an event
+func (s *Subscription) wants(event Event) bool {
+	return len(s.names) == 0 || s.names[event.EventName()]
+}
+
+// Dropped returns how many events an asynchronous subscriber missed
+// because its queue was full
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe stops the subscriber getting events; an asynchronous
+// subscriber drops what is still queued
+func (s *Subscription) Unsubscribe() {
+	s.stopOnce.Do(func() {
+		s.bus.remove(s)
+		close(s.done)
+	})
+}
+
+// call runs the subscriber's handler, keeping a panicking subscriber
+// from taking its publisher down with it
+func (s *Subscription) call(event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Event subscriber panicked on %s: %v", event.EventName(), r)
+		}
+	}()
+	s.handle(event)
+}
+
+// enqueue hands an event to an asynchronous subscriber as its overflow
+// policy allows
+func (s *Subscription) enqueue(event Event) {
+	switch s.overflow {
+	case OverflowBlock:
+		select {
+		case s.queue <- event:
+		case <-s.done:
+		}
+		return
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.queue <- event:
+				return
+			default:
+			}
+			select {
+			case <-s.queue:
+				s.countDropped(event)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.queue <- event:
+		default:
+			s.countDropped(event)
+		}
+	}
+}
+
+// countDropped counts a dropped event, logging the first and then every
+// thousandth so a stuck subscriber does not flood the log
+func (s *Subscription) countDropped(event Event) {
+	if dropped := atomic.AddUint64(&s.dropped, 1); dropped%1000 == 1 {
+		log.Printf("Event subscriber falling behind, %d events dropped (last %s)", dropped, event.EventName())
+	}
+}
+
+// run delivers an asynchronous subscriber's queued events in order
+func (s *Subscription) run() {
+	for {
+		select {
+		case event := <-s.queue:
+			s.call(event)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// EventBus hands published events to its subscribers. Synchronous
+// subscribers run on the publisher's goroutine before Publish returns,
+// inside the zone tick for events the tick publishes, while the zone may
+// be locked: they must be quick and must not call back into the zone.
+// Asynchronous subscribers get events in order on a goroutine of their
+// own through a bounded queue, and may take any lock
+type EventBus struct {
+	subscribers []*Subscription
+	mu          sync.RWMutex
+}
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// SubscribeSync calls handle with every event named, or every event when
+// no names are given, on the publisher's goroutine
+func (b *EventBus) SubscribeSync(handle func(Event), names ...string) *Subscription {
+	subscription := b.newSubscription(handle, names)
+	b.add(subscription)
+	return subscription
+}
+
+// SubscribeAsync calls handle with every event named, or every event
+// when no names are given, on a goroutine of the subscriber's own
+func (b *EventBus) SubscribeAsync(handle func(Event), options AsyncOptions, names ...string) *Subscription {
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultEventQueueSize
+	}
+	subscription := b.newSubscription(handle, names)
+	subscription.queue = make(chan Event, options.QueueSize)
+	subscription.overflow = options.Overflow
+	b.add(subscription)
+	go subscription.run()
+	return subscription
+}
+
+// newSubscription creates a subscription to some events on the bus
+func (b *EventBus) newSubscription(handle func(Event), names []string) *Subscription {
+	subscription := &Subscription{
+		bus:    b,
+		handle: handle,
+		done:   make(chan struct{}),
+	}
+	if len(names) > 0 {
+		subscription.names = make(map[string]bool, len(names))
+		for _, name := range names {
+			subscription.names[name] = true
+		}
+	}
+	return subscription
+}
+
+// add puts a subscription on the bus
+func (b *EventBus) add(subscription *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, subscription)
+}
+
+// remove takes a subscription off the bus
+func (b *EventBus) remove(subscription *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, candidate := range b.subscribers {
+		if candidate == subscription {
+			b.subscribers = append(b.subscribers[:i:i], b.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Publish hands an event to every subscriber listening to it
+func (b *EventBus) Publish(event Event) {
+	// Subscribers may publish in turn, so they are not called with the
+	// bus locked
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, subscription := range subscribers {
+		if !subscription.wants(event) {
+			continue
+		}
+		if subscription.queue == nil {
+			subscription.call(event)
+		} else {
+			subscription.enqueue(event)
+		}
+	}
+}
+
+// publish puts an event on the zone's event bus, if it has one
+func (w *World) publish(event Event) {
+	if w.events != nil {
+		w.events.Publish(event)
+	}
+}
+
+// AddStatistic adds to one of a player's statistics and publishes its
+// new total
+func (w *World) AddStatistic(player *Player, stat string, amount float64) {
+	if amount <= 0 {
+		return
+	}
+	player.Statistics.Add(stat, amount)
+	w.publish(StatisticChanged{Player: player, Statistic: stat, Total: player.Statistics.Lifetime(stat)})
+}
@@ -0,0 +1,226 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+// eventTimeout bounds how long a test waits for asynchronous delivery
+const eventTimeout = 2 * time.Second
+
+func chat(text string) ChatSent {
+	return ChatSent{Zone: "overworld", Text: text}
+}
+
+func TestSyncSubscribersGetEventsBeforePublishReturns(t *testing.T) {
+	bus := NewEventBus()
+	all := NewEventRecorder(bus)
+	chats := NewEventRecorder(bus, EventChatSent)
+
+	bus.Publish(PlayerJoined{Zone: "overworld"})
+	bus.Publish(chat("hello"))
+	bus.Publish(PlayerLeft{Zone: "overworld"})
+
+	all.AssertEmitted(t, PlayerJoined{Zone: "overworld"}, chat("hello"), PlayerLeft{Zone: "overworld"})
+	chats.AssertEmitted(t, chat("hello"))
+	chats.AssertNotEmitted(t, EventPlayerJoined, EventPlayerLeft)
+}
+
+func TestAsyncSubscribersGetEventsInOrder(t *testing.T) {
+	bus, relay := NewEventBus(), NewEventBus()
+	recorder := NewEventRecorder(relay)
+	bus.SubscribeAsync(relay.Publish, AsyncOptions{}, EventChatSent)
+
+	bus.Publish(chat("one"))
+	bus.Publish(PlayerJoined{Zone: "overworld"})
+	bus.Publish(chat("two"))
+	bus.Publish(PlayerLeft{Zone: "overworld"})
+
+	deadline := time.Now().Add(eventTimeout)
+	for len(recorder.Events()) < 2 && time.Now().Before(deadline) {
+		recorder.WaitFor(EventChatSent, 10*time.Millisecond)
+	}
+	recorder.AssertEmitted(t, chat("one"), chat("two"))
+	recorder.AssertNotEmitted(t, EventPlayerJoined, EventPlayerLeft)
+}
+
+// blockedSubscriber is an asynchronous subscriber with a queue of two
+// whose handler holds the first event until released, so the queue fills
+type blockedSubscriber struct {
+	subscription *Subscription
+	recorder     *EventRecorder
+	started      chan struct{}
+	release      chan struct{}
+}
+
+func newBlockedSubscriber(bus *EventBus, overflow Overflow) *blockedSubscriber {
+	relay := NewEventBus()
+	subscriber := &blockedSubscriber{
+		recorder: NewEventRecorder(relay),
+		started:  make(chan struct{}, 1),
+		release:  make(chan struct{}),
+	}
+	subscriber.subscription = bus.SubscribeAsync(func(event Event) {
+		select {
+		case subscriber.started <- struct{}{}:
+			<-subscriber.release
+		default:
+		}
+		relay.Publish(event)
+	}, AsyncOptions{QueueSize: 2, Overflow: overflow})
+	return subscriber
+}
+
+// publishUntilFull publishes the first event, waits for the handler to
+// hold it and then publishes the rest
+func (s *blockedSubscriber) publishUntilFull(t *testing.T, bus *EventBus, texts ...string) {
+	t.Helper()
+	bus.Publish(chat(texts[0]))
+	select {
+	case <-s.started:
+	case <-time.After(eventTimeout):
+		t.Fatal("subscriber never got the first event")
+	}
+	for _, text := range texts[1:] {
+		bus.Publish(chat(text))
+	}
+}
+
+// received waits for the subscriber to pass on count events and returns
+// their texts
+func (s *blockedSubscriber) received(t *testing.T, count int) []string {
+	t.Helper()
+	deadline := time.Now().Add(eventTimeout)
+	for len(s.recorder.Events()) < count && time.Now().Before(deadline) {
+		s.recorder.WaitFor(EventChatSent, 10*time.Millisecond)
+	}
+	var texts []string
+	for _, event := range s.recorder.Events() {
+		texts = append(texts, event.(ChatSent).Text)
+	}
+	return texts
+}
+
+func TestAsyncOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow Overflow
+		want     []string
+		dropped  uint64
+	}{
+		{"drop newest", OverflowDrop, []string{"1", "2", "3"}, 1},
+		{"drop oldest", OverflowDropOldest, []string{"1", "3", "4"}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bus := NewEventBus()
+			subscriber := newBlockedSubscriber(bus, test.overflow)
+			defer subscriber.subscription.Unsubscribe()
+
+			// The handler holds 1, so 2 and 3 fill the queue and 4 overflows
+			subscriber.publishUntilFull(t, bus, "1", "2", "3", "4")
+			if dropped := subscriber.subscription.Dropped(); dropped != test.dropped {
+				t.Errorf("dropped %d events, want %d", dropped, test.dropped)
+			}
+
+			close(subscriber.release)
+			got := subscriber.received(t, len(test.want))
+			if len(got) != len(test.want) {
+				t.Fatalf("received %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("received %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAsyncOverflowBlockWaitsForRoom(t *testing.T) {
+	bus := NewEventBus()
+	subscriber := newBlockedSubscriber(bus, OverflowBlock)
+	defer subscriber.subscription.Unsubscribe()
+
+	subscriber.publishUntilFull(t, bus, "1", "2", "3")
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(chat("4"))
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("publishing to a full queue returned before there was room")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(subscriber.release)
+	select {
+	case <-published:
+	case <-time.After(eventTimeout):
+		t.Fatal("publisher stayed blocked after the queue drained")
+	}
+	if got := subscriber.received(t, 4); len(got) != 4 {
+		t.Fatalf("received %v, want all 4 events", got)
+	}
+	if dropped := subscriber.subscription.Dropped(); dropped != 0 {
+		t.Errorf("dropped %d events, want none", dropped)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	bus := NewEventBus()
+	recorder := NewEventRecorder(bus)
+	stopped := NewEventRecorder(bus)
+
+	bus.Publish(chat("before"))
+	stopped.Stop()
+	stopped.Stop()
+	bus.Publish(chat("after"))
+
+	recorder.AssertEmitted(t, chat("before"), chat("after"))
+	if events := stopped.Events(); len(events) != 1 {
+		t.Fatalf("stopped recorder got %d events, want 1", len(events))
+	}
+}
+
+func TestAsyncUnsubscribeReleasesBlockedPublisher(t *testing.T) {
+	bus := NewEventBus()
+	subscriber := newBlockedSubscriber(bus, OverflowBlock)
+	subscriber.publishUntilFull(t, bus, "1", "2", "3")
+
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(chat("4"))
+		close(published)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	subscriber.subscription.Unsubscribe()
+
+	select {
+	case <-published:
+	case <-time.After(eventTimeout):
+		t.Fatal("publisher stayed blocked on an unsubscribed subscriber")
+	}
+	close(subscriber.release)
+
+	bus.Publish(chat("5"))
+	time.Sleep(20 * time.Millisecond)
+	for _, event := range subscriber.recorder.Events() {
+		if event.(ChatSent).Text == "5" {
+			t.Fatal("unsubscribed subscriber got an event published afterwards")
+		}
+	}
+}
+
+func TestPanickingSubscriberDoesNotStopOthers(t *testing.T) {
+	bus := NewEventBus()
+	bus.SubscribeSync(func(Event) { panic("broken subscriber") })
+	recorder := NewEventRecorder(bus)
+
+	bus.Publish(chat("still delivered"))
+
+	recorder.AssertEmitted(t, chat("still delivered"))
+}
@@ -0,0 +1,52 @@
+package game
+
+import (
+	"sort"
+	"sync"
+)
+
+// CharacterFlags are named markers content sets on a character, such as
+// having met an NPC, for dialogue to check later
+type CharacterFlags struct {
+	flags map[string]bool
+	mu    sync.Mutex
+}
+
+// NewCharacterFlags creates a character without flags
+func NewCharacterFlags() *CharacterFlags {
+	return &CharacterFlags{flags: make(map[string]bool)}
+}
+
+// Has reports whether a flag is set
+func (f *CharacterFlags) Has(flag string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.flags[flag]
+}
+
+// Set sets a flag
+func (f *CharacterFlags) Set(flag string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flags[flag] = true
+}
+
+// Clear removes a flag
+func (f *CharacterFlags) Clear(flag string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.flags, flag)
+}
+
+// List returns the set flags in name order
+func (f *CharacterFlags) List() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	flags := make([]string, 0, len(f.flags))
+	for flag := range f.flags {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+	return flags
+}
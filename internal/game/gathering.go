@@ -0,0 +1,278 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// GatherRange is how close a player must stand to a resource node
+	GatherRange = 64.0
+	// gatherMoveTolerance is how far a player may drift while gathering
+	// before the action counts as interrupted
+	gatherMoveTolerance = 1.0
+)
+
+var (
+	ErrResourceNotFound = errors.New("resource not found")
+	ErrResourceTooFar   = errors.New("resource is too far away")
+	ErrResourceDepleted = errors.New("there is nothing left to gather here")
+	ErrSkillTooLow      = errors.New("your skill is too low")
+	ErrAlreadyGathering = errors.New("already gathering")
+)
+
+// ResourceDefinition describes a kind of resource node, such as a tree
+// or an ore vein, as written in resources.json
+type ResourceDefinition struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Profession string `json:"profession"`
+	// Skill is the profession level needed to gather the node
+	Skill         int     `json:"skill"`
+	GatherSeconds float64 `json:"gather_seconds"`
+	// LootTable is rolled at the gatherer's skill, so entries with a
+	// min_level only come up for practised gatherers
+	LootTable      string `json:"loot_table"`
+	Experience     int    `json:"experience"`
+	RespawnSeconds int    `json:"respawn_seconds"`
+}
+
+// applyDefaults fills optional fields left out of the content file
+func (d *ResourceDefinition) applyDefaults() {
+	if d.Name == "" {
+		d.Name = d.ID
+	}
+	if d.Skill <= 0 {
+		d.Skill = 1
+	}
+	if d.GatherSeconds <= 0 {
+		d.GatherSeconds = 3
+	}
+	if d.Experience <= 0 {
+		d.Experience = 10
+	}
+	if d.RespawnSeconds <= 0 {
+		d.RespawnSeconds = 60
+	}
+}
+
+// ResourceNode is a resource placed in the world; it is depleted once
+// gathered until RespawnAt
+type ResourceNode struct {
+	Definition *ResourceDefinition
+	RespawnAt  time.Time
+}
+
+// Depleted reports whether the node was gathered and has not come back
+func (n *ResourceNode) Depleted() bool {
+	return !n.RespawnAt.IsZero()
+}
+
+// gathering is a player busy harvesting a node
+type gathering struct {
+	nodeID   string
+	position Position
+	finishAt time.Time
+}
+
+// spawnResources places a node at every resource spawn point of the map
+func (w *World) spawnResources() {
+	if w.Map == nil || w.Content() == nil {
+		return
+	}
+
+	for i, point := range w.Map.SpawnsOfType("resource") {
+		definition, exists := w.Content().Resources[point.Properties["resource"]]
+		if !exists {
+			log.Printf("Resource spawn %q uses unknown resource %q", point.Name, point.Properties["resource"])
+			continue
+		}
+
+		name := point.Name
+		if name == "" {
+			name = definition.ID
+		}
+		id := fmt.Sprintf("resource_%s_%d", strings.ReplaceAll(strings.ToLower(name), " ", "_"), i)
+		entity := NewEntity(id, Resource, definition.Name, point.Position)
+		entity.Node = &ResourceNode{Definition: definition}
+		w.Resources[entity.ID] = entity
+	}
+}
+
+// StartGathering begins harvesting a resource node; the player has to
+// stand still until it finishes
+func (w *World) StartGathering(playerID, nodeID string) error {
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	entity, exists := w.Resources[nodeID]
+	if !exists {
+		w.mu.Unlock()
+		return ErrResourceNotFound
+	}
+	if _, busy := w.gathers[playerID]; busy {
+		w.mu.Unlock()
+		return ErrAlreadyGathering
+	}
+	position := player.GetPosition()
+	if distance(position, entity.Position) > GatherRange {
+		w.mu.Unlock()
+		return ErrResourceTooFar
+	}
+	definition := entity.Node.Definition
+	if entity.Node.Depleted() {
+		w.mu.Unlock()
+		return ErrResourceDepleted
+	}
+	if player.Professions.Level(definition.Profession) < definition.Skill {
+		w.mu.Unlock()
+		return fmt.Errorf("%w: %s %d needed", ErrSkillTooLow, definition.Profession, definition.Skill)
+	}
+
+	duration := time.Duration(definition.GatherSeconds * float64(time.Second))
+	w.gathers[playerID] = &gathering{nodeID: nodeID, position: position, finishAt: time.Now().Add(duration)}
+	w.mu.Unlock()
+
+	w.SendToPlayer(playerID, map[string]interface{}{
+		"type":      "gather_started",
+		"target_id": nodeID,
+		"name":      definition.Name,
+		"seconds":   definition.GatherSeconds,
+	})
+	return nil
+}
+
+// updateGathering interrupts players who moved while gathering, finishes
+// the gathering that is due and brings depleted nodes back; the caller
+// holds the world lock
+func (w *World) updateGathering(now time.Time) []outboundMessage {
+	var messages []outboundMessage
+
+	for playerID, gather := range w.gathers {
+		player, exists := w.Players[playerID]
+		if !exists {
+			delete(w.gathers, playerID)
+			continue
+		}
+		if distance(player.GetPosition(), gather.position) > gatherMoveTolerance {
+			delete(w.gathers, playerID)
+			messages = append(messages, outboundMessage{playerID: playerID, message: map[string]interface{}{
+				"type":      "gather_interrupted",
+				"target_id": gather.nodeID,
+			}})
+			continue
+		}
+		if now.Before(gather.finishAt) {
+			continue
+		}
+		delete(w.gathers, playerID)
+		messages = append(messages, w.finishGathering(player, gather.nodeID, now)...)
+	}
+
+	for _, entity := range w.Resources {
+		if entity.Node.Depleted() && !now.Before(entity.Node.RespawnAt) {
+			entity.Node.RespawnAt = time.Time{}
+			messages = append(messages, outboundMessage{message: map[string]interface{}{
+				"type": "resource_respawned",
+				"id":   entity.ID,
+			}})
+		}
+	}
+
+	return messages
+}
+
+// finishGathering hands a player what they harvested from a node: the
+// yield goes into the inventory, or onto the ground for them when it does
+// not fit, and the node is depleted. The caller holds the world lock
+func (w *World) finishGathering(player *Player, nodeID string, now time.Time) []outboundMessage {
+	entity, exists := w.Resources[nodeID]
+	if !exists || entity.Node.Depleted() {
+		return []outboundMessage{{playerID: player.ID, message: map[string]interface{}{
+			"type":      "gather_failed",
+			"target_id": nodeID,
+			"error":     ErrResourceDepleted.Error(),
+		}}}
+	}
+	definition := entity.Node.Definition
+
+	var yield []ItemStack
+	if w.loot != nil {
+		drops, err := w.loot.Roll(definition.LootTable, player.Professions.Level(definition.Profession))
+		if err != nil {
+			log.Printf("Failed to roll yield of %s: %v", nodeID, err)
+		}
+		for _, drop := range drops {
+			yield = append(yield, ItemStack{ItemID: drop.Item, Quantity: drop.Quantity})
+		}
+	}
+
+	var messages []outboundMessage
+	if err := player.Inventory.Exchange(nil, yield, w.Content().Items); err != nil {
+		for _, stack := range yield {
+			_, placed := w.placeItem(w.newDrop(stack.ItemID, stack.Quantity, []string{player.Name}, now), player.GetPosition())
+			messages = append(messages, placed...)
+		}
+	}
+
+	entity.Node.RespawnAt = now.Add(time.Duration(definition.RespawnSeconds) * time.Second)
+	messages = append(messages, outboundMessage{message: map[string]interface{}{
+		"type": "resource_depleted",
+		"id":   entity.ID,
+	}})
+
+	items := make([]map[string]interface{}, 0, len(yield))
+	for _, stack := range yield {
+		items = append(items, map[string]interface{}{
+			"item_id":  stack.ItemID,
+			"name":     w.Content().Items[stack.ItemID].Name,
+			"quantity": stack.Quantity,
+		})
+	}
+	messages = append(messages,
+		outboundMessage{playerID: player.ID, message: map[string]interface{}{
+			"type":      "gather_complete",
+			"target_id": nodeID,
+			"name":      definition.Name,
+			"items":     items,
+		}},
+		outboundMessage{playerID: player.ID, message: player.Inventory.Message(w.Content().Items)},
+	)
+	messages = append(messages, w.professionProgress(player, definition.Profession, definition.Experience, definition.Skill)...)
+	return append(messages, w.syncCollectObjectives(player)...)
+}
+
+// professionProgress grants profession experience for a task and builds
+// the messages telling the player about it
+func (w *World) professionProgress(player *Player, profession string, experience, requirement int) []outboundMessage {
+	levels := player.Professions.Gain(profession, experience, requirement)
+	messages := []outboundMessage{{playerID: player.ID, message: player.Professions.Message()}}
+	if levels > 0 {
+		messages = append(messages, outboundMessage{playerID: player.ID, message: map[string]interface{}{
+			"type":       "profession_level_up",
+			"profession": profession,
+			"level":      player.Professions.Level(profession),
+		}})
+	}
+	return messages
+}
+
+func resourceAppearance(entity *Entity) map[string]interface{} {
+	definition := entity.Node.Definition
+	return map[string]interface{}{
+		"id":          entity.ID,
+		"resource_id": definition.ID,
+		"name":        entity.Name,
+		"profession":  definition.Profession,
+		"skill":       definition.Skill,
+		"x":           entity.Position.X,
+		"y":           entity.Position.Y,
+		"depleted":    entity.Node.Depleted(),
+	}
+}
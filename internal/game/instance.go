@@ -0,0 +1,353 @@
+package game
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxInstances caps how many instances run at the same time
+	DefaultMaxInstances = 50
+	// instanceMaintenanceInterval is how often idle and expired
+	// instances are looked for
+	instanceMaintenanceInterval = 10 * time.Second
+)
+
+// InstanceReset says when a character's lockout to an instance ends
+type InstanceReset string
+
+const (
+	ResetNone   InstanceReset = "none"
+	ResetDaily  InstanceReset = "daily"
+	ResetWeekly InstanceReset = "weekly"
+)
+
+var (
+	ErrUnknownInstance = errors.New("unknown instance")
+	ErrInstanceCap     = errors.New("too many instances are running, try again later")
+	ErrInstanceFull    = errors.New("instance is full")
+	ErrInstanceLocked  = errors.New("you are saved to another instance of this dungeon")
+)
+
+// InstanceTemplate describes a dungeon as written in instances.json; every
+// party entering it gets a private copy of its map
+type InstanceTemplate struct {
+	ID              string        `json:"id"`
+	Name            string        `json:"name"`
+	Map             string        `json:"map"`
+	MaxPlayers      int           `json:"max_players"`
+	LifetimeMinutes int           `json:"lifetime_minutes"`
+	EmptyMinutes    int           `json:"empty_minutes"`
+	Reset           InstanceReset `json:"reset"`
+	ExitZone        string        `json:"exit_zone"`
+	ExitSpawn       string        `json:"exit_spawn"`
+	Death           DeathRules    `json:"death"`
+	// PvP is the rule outside of regions with a rule of their own
+	PvP PvPRule `json:"pvp"`
+}
+
+// applyDefaults fills in optional template fields
+func (t *InstanceTemplate) applyDefaults() {
+	if t.MaxPlayers <= 0 {
+		t.MaxPlayers = MaxPartySize
+	}
+	if t.LifetimeMinutes <= 0 {
+		t.LifetimeMinutes = 120
+	}
+	if t.EmptyMinutes <= 0 {
+		t.EmptyMinutes = 10
+	}
+	if t.Reset == "" {
+		t.Reset = ResetDaily
+	}
+	if t.PvP == "" {
+		t.PvP = PvPDuel
+	}
+}
+
+// LockoutExpiry returns when a lockout taken at the given time ends:
+// midnight UTC for daily resets and Monday midnight UTC for weekly ones
+func (t *InstanceTemplate) LockoutExpiry(from time.Time) time.Time {
+	from = from.UTC()
+	midnight := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+
+	switch t.Reset {
+	case ResetDaily:
+		return midnight
+	case ResetWeekly:
+		for midnight.Weekday() != time.Monday {
+			midnight = midnight.AddDate(0, 0, 1)
+		}
+		return midnight
+	default:
+		return time.Time{}
+	}
+}
+
+// Instance is a running private copy of an instance template
+type Instance struct {
+	World      *World
+	Template   *InstanceTemplate
+	Owner      string
+	Created    time.Time
+	Expires    time.Time
+	emptySince time.Time
+	closing    bool
+}
+
+// instanceOwner returns who an instance entered by a player belongs to:
+// their party, or the character alone when they are not in one
+func (zm *ZoneManager) instanceOwner(player *Player) string {
+	if party, inParty := zm.Parties.PartyOf(player.ID); inParty {
+		return party.ID
+	}
+	return "player:" + player.Name
+}
+
+// instanceTemplateID returns the template an instance ID was made from
+func instanceTemplateID(instanceID string) (string, bool) {
+	templateID, _, found := strings.Cut(instanceID, "#")
+	return templateID, found
+}
+
+// EnterInstance sends a player into their party's copy of an instance,
+// creating it when the party has none yet
+func (zm *ZoneManager) EnterInstance(playerID, templateID string) error {
+	template, exists := zm.Content().Instances[templateID]
+	if !exists {
+		return fmt.Errorf("%w %q", ErrUnknownInstance, templateID)
+	}
+	player, _, exists := zm.FindPlayer(playerID)
+	if !exists {
+		return errors.New("player is not in a zone")
+	}
+
+	now := time.Now()
+	var lockout *InstanceLockout
+	if zm.persistent(player) && template.Reset != ResetNone {
+		saved, err := zm.database.GetLockout(player.Name, template.ID, now)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		lockout = saved
+	}
+
+	owner := zm.instanceOwner(player)
+	key := owner + "|" + template.ID
+
+	zm.mu.Lock()
+	instance, exists := zm.ownerInstances[key]
+	if exists && instance.closing {
+		exists = false
+	}
+	if lockout != nil && (!exists || instance.World.ID != lockout.InstanceID) {
+		zm.mu.Unlock()
+		return fmt.Errorf("%w until %s", ErrInstanceLocked, lockout.Expires.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	if !exists {
+		if len(zm.instances) >= zm.MaxInstances {
+			zm.mu.Unlock()
+			return ErrInstanceCap
+		}
+		instance = zm.createInstance(template, owner, now)
+		zm.ownerInstances[key] = instance
+	}
+	if instance.World.PlayerCount()+zm.inboundTransfers(instance.World) >= template.MaxPlayers {
+		zm.mu.Unlock()
+		return ErrInstanceFull
+	}
+	zm.mu.Unlock()
+
+	if lockout == nil && zm.persistent(player) && template.Reset != ResetNone {
+		if err := zm.database.SaveLockout(player.Name, template.ID, instance.World.ID, template.LockoutExpiry(now)); err != nil {
+			log.Printf("Failed to save lockout of %s to %s: %v", player.Name, instance.World.ID, err)
+		}
+	}
+
+	return zm.transferTo(playerID, instance.World, instance.World.SpawnPosition(Position{}))
+}
+
+// createInstance starts a new copy of a template; the caller holds the
+// zone manager lock
+func (zm *ZoneManager) createInstance(template *InstanceTemplate, owner string, now time.Time) *Instance {
+	world := NewWorld(zm.newInstanceID(template), zm.Content().Maps[template.Map], zm.Content(), zm.settings)
+	world.Name = template.Name
+	world.Death = template.Death
+	world.PvP = template.PvP
+	zm.wireWorld(world)
+	world.StartGameLoop()
+
+	instance := &Instance{
+		World:    world,
+		Template: template,
+		Owner:    owner,
+		Created:  now,
+		Expires:  now.Add(time.Duration(template.LifetimeMinutes) * time.Minute),
+	}
+	zm.instances[world.ID] = instance
+
+	log.Printf("Instance %s created for %s", world.ID, owner)
+	return instance
+}
+
+// newInstanceID returns an ID for a new copy of a template. Characters and
+// lockouts are saved with the ID, so it must not repeat after a restart
+// either; the caller holds the zone manager lock
+func (zm *ZoneManager) newInstanceID(template *InstanceTemplate) string {
+	suffix := make([]byte, 8)
+	for {
+		if _, err := rand.Read(suffix); err != nil {
+			panic(fmt.Sprintf("reading random instance id: %v", err))
+		}
+		id := fmt.Sprintf("%s#%x", template.ID, suffix)
+		if _, exists := zm.instances[id]; !exists {
+			return id
+		}
+	}
+}
+
+// rejoinInstance reports whether a logging-in character may go back into
+// the running instance they were saved in: only its owner and characters
+// whose lockout names it may, so an instance cannot take in strangers
+func (zm *ZoneManager) rejoinInstance(player *Player, instance *Instance) bool {
+	if instance.Owner == zm.instanceOwner(player) {
+		return true
+	}
+	if !zm.persistent(player) {
+		return false
+	}
+	lockout, err := zm.database.GetLockout(player.Name, instance.Template.ID, time.Now())
+	return err == nil && lockout.InstanceID == instance.World.ID
+}
+
+// inboundTransfers counts players on their way into a zone; the caller
+// holds the zone manager lock
+func (zm *ZoneManager) inboundTransfers(world *World) int {
+	count := 0
+	for _, transfer := range zm.transfers {
+		if transfer.target == world {
+			count++
+		}
+	}
+	return count
+}
+
+// instanceExit returns where players leaving an instance made from the
+// template end up
+func (zm *ZoneManager) instanceExit(template *InstanceTemplate) (*World, Position) {
+	world, exists := zm.Zone(template.ExitZone)
+	if !exists {
+		world = zm.DefaultZone()
+	}
+
+	position := world.SpawnPosition(Position{})
+	if template.ExitSpawn != "" && world.Map != nil {
+		if spawn, ok := world.Map.Spawn(template.ExitSpawn); ok {
+			position = spawn.Position
+		}
+	}
+	return world, position
+}
+
+// InstanceCounts returns how many instances of each template are running
+func (zm *ZoneManager) InstanceCounts() map[string]int {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, instance := range zm.instances {
+		counts[instance.Template.ID]++
+	}
+	return counts
+}
+
+// InstanceCount returns the number of running instances
+func (zm *ZoneManager) InstanceCount() int {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+	return len(zm.instances)
+}
+
+// maintainInstances closes instances that outlived their template's
+// lifetime and tears down those left empty for too long
+func (zm *ZoneManager) maintainInstances(now time.Time) {
+	var expired, idle []*Instance
+
+	zm.mu.Lock()
+	for _, instance := range zm.instances {
+		if zm.inboundTransfers(instance.World) > 0 {
+			instance.emptySince = time.Time{}
+			continue
+		}
+		if now.After(instance.Expires) {
+			instance.closing = true
+			expired = append(expired, instance)
+			continue
+		}
+		if instance.World.PlayerCount() > 0 {
+			instance.emptySince = time.Time{}
+			continue
+		}
+		if instance.emptySince.IsZero() {
+			instance.emptySince = now
+			continue
+		}
+		if now.Sub(instance.emptySince) >= time.Duration(instance.Template.EmptyMinutes)*time.Minute {
+			instance.closing = true
+			idle = append(idle, instance)
+		}
+	}
+	zm.mu.Unlock()
+
+	for _, instance := range expired {
+		exit, position := zm.instanceExit(instance.Template)
+		for _, playerID := range instance.World.PlayerIDs() {
+			instance.World.SendToPlayer(playerID, map[string]interface{}{
+				"type":      "instance_closed",
+				"zone_name": instance.World.Name,
+			})
+			if err := zm.transferTo(playerID, exit, position); err != nil {
+				log.Printf("Failed to move %s out of %s: %v", playerID, instance.World.ID, err)
+			}
+		}
+		zm.destroyInstance(instance)
+	}
+
+	for _, instance := range idle {
+		zm.destroyInstance(instance)
+	}
+}
+
+// destroyInstance stops an instance and forgets it
+func (zm *ZoneManager) destroyInstance(instance *Instance) {
+	zm.mu.Lock()
+	delete(zm.instances, instance.World.ID)
+	key := instance.Owner + "|" + instance.Template.ID
+	if zm.ownerInstances[key] == instance {
+		delete(zm.ownerInstances, key)
+	}
+	zm.mu.Unlock()
+
+	instance.World.StopGameLoop()
+	log.Printf("Instance %s torn down", instance.World.ID)
+}
+
+// runInstanceMaintenance periodically maintains instances until stopped
+func (zm *ZoneManager) runInstanceMaintenance(stop chan struct{}) {
+	ticker := time.NewTicker(instanceMaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			zm.maintainInstances(now)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package game
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestZones loads the repository's content into a zone manager backed
+// by a database of its own
+func newTestZones(t *testing.T) *ZoneManager {
+	t.Helper()
+	content, err := LoadContent(filepath.Join("..", "..", "content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := NewDatabase(filepath.Join(t.TempDir(), "game.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zones, err := NewZoneManager(content, database, DefaultSettings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zones
+}
+
+// startInstance creates a running copy of the sunken crypt for an owner
+func startInstance(t *testing.T, zones *ZoneManager, owner string) *Instance {
+	t.Helper()
+	template := zones.Content().Instances["sunken_crypt"]
+	zones.mu.Lock()
+	instance := zones.createInstance(template, owner, time.Now())
+	zones.mu.Unlock()
+	t.Cleanup(instance.World.StopGameLoop)
+	return instance
+}
+
+func TestInstanceIDsAreUnique(t *testing.T) {
+	zones := newTestZones(t)
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		id := startInstance(t, zones, "player:alice").World.ID
+		if !strings.HasPrefix(id, "sunken_crypt#") || seen[id] {
+			t.Fatalf("instance id %q is malformed or repeated", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestJoinPlayerOnlyRejoinsOwnInstance(t *testing.T) {
+	zones := newTestZones(t)
+	instance := startInstance(t, zones, "player:alice")
+	exit, _ := zones.instanceExit(instance.Template)
+
+	tests := []struct {
+		name    string
+		lockout bool
+		want    *World
+	}{
+		{"alice", false, instance.World},
+		{"bob", false, exit},
+		{"carol", true, instance.World},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := zones.database.SaveCharacterLocation(test.name, instance.World.ID, Position{X: 100, Y: 100}); err != nil {
+				t.Fatal(err)
+			}
+			if test.lockout {
+				if err := zones.database.SaveLockout(test.name, instance.Template.ID, instance.World.ID, time.Now().Add(time.Hour)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			player := NewPlayer("id-"+test.name, test.name)
+			world, err := zones.JoinPlayer(player, Position{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer zones.LeavePlayer(player)
+			if world != test.want {
+				t.Fatalf("%s joined %s, want %s", test.name, world.ID, test.want.ID)
+			}
+		})
+	}
+}
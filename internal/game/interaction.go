@@ -11,9 +11,11 @@ const (
 	ViewStats   InteractionType = "view_stats"
 	Trade       InteractionType = "trade"
 	Challenge   InteractionType = "challenge"
+	Attack      InteractionType = "attack"
 	SendMessage InteractionType = "send_message"
 	AddFriend   InteractionType = "add_friend"
 	Block       InteractionType = "block"
+	PartyInvite InteractionType = "party_invite"
 )
 
 type InteractionRequest struct {
@@ -79,15 +81,19 @@ func (pi *PlayerInteracter) GetNearbyPlayers(playerID string) []*Player {
 
 func (pi *PlayerInteracter) GetAvailableInteractions(fromPlayerID, toPlayerID string) []InteractionOption {
 	// Check if both players exist
-	_, fromExists := pi.world.GetPlayer(fromPlayerID)
-	_, toExists := pi.world.GetPlayer(toPlayerID)
+	fromPlayer, fromExists := pi.world.GetPlayer(fromPlayerID)
+	toPlayer, toExists := pi.world.GetPlayer(toPlayerID)
 
 	if !fromExists || !toExists {
 		return []InteractionOption{}
 	}
 
-	// Basic interactions available to all players
-	return []InteractionOption{
+	// Fighting depends on the PvP rules where both players stand
+	canChallenge := pi.world.CanChallenge(fromPlayerID, toPlayerID) == nil
+	canAttack := pi.world.CanAttackPlayer(fromPlayerID, toPlayerID) == nil
+
+	// Basic interactions available to all players, then those plugins add
+	options := []InteractionOption{
 		{
 			Type:    string(ViewStats),
 			Label:   "View Stats",
@@ -104,6 +110,18 @@ func (pi *PlayerInteracter) GetAvailableInteractions(fromPlayerID, toPlayerID st
 			Type:    string(Challenge),
 			Label:   "Challenge to Duel",
 			Icon:    "⚔️",
+			Enabled: canChallenge,
+		},
+		{
+			Type:    string(Attack),
+			Label:   "Attack",
+			Icon:    "🗡️",
+			Enabled: canAttack,
+		},
+		{
+			Type:    string(PartyInvite),
+			Label:   "Invite to Party",
+			Icon:    "🛡️",
 			Enabled: true,
 		},
 		{
@@ -125,6 +143,10 @@ func (pi *PlayerInteracter) GetAvailableInteractions(fromPlayerID, toPlayerID st
 			Enabled: true,
 		},
 	}
+	if pi.world.extensions != nil {
+		options = append(options, pi.world.extensions.interactionOptions(fromPlayer, toPlayer)...)
+	}
+	return options
 }
 
 func (pi *PlayerInteracter) ProcessInteraction(request *InteractionRequest) *InteractionResult {
@@ -152,6 +174,15 @@ func (pi *PlayerInteracter) ProcessInteraction(request *InteractionRequest) *Int
 		}
 	}
 
+	result := pi.dispatch(request, fromPlayer, toPlayer)
+	if result.Success {
+		pi.world.publish(InteractionCompleted{From: fromPlayer, To: toPlayer, Type: request.Type})
+	}
+	return result
+}
+
+// dispatch hands an interaction to the handler of its type
+func (pi *PlayerInteracter) dispatch(request *InteractionRequest, fromPlayer, toPlayer *Player) *InteractionResult {
 	switch request.Type {
 	case ViewStats:
 		return pi.handleViewStats(fromPlayer, toPlayer)
@@ -159,13 +190,22 @@ func (pi *PlayerInteracter) ProcessInteraction(request *InteractionRequest) *Int
 		return pi.handleTrade(fromPlayer, toPlayer)
 	case Challenge:
 		return pi.handleChallenge(fromPlayer, toPlayer)
+	case Attack:
+		return pi.handleAttack(fromPlayer, toPlayer)
 	case SendMessage:
 		return pi.handleSendMessage(fromPlayer, toPlayer, request.Data)
+	case PartyInvite:
+		return pi.handlePartyInvite(fromPlayer, toPlayer)
 	case AddFriend:
 		return pi.handleAddFriend(fromPlayer, toPlayer)
 	case Block:
 		return pi.handleBlock(fromPlayer, toPlayer)
 	default:
+		if pi.world.extensions != nil {
+			if interaction, exists := pi.world.extensions.interaction(request.Type); exists {
+				return pi.handlePluginInteraction(interaction, fromPlayer, toPlayer, request.Data)
+			}
+		}
 		return &InteractionResult{
 			Success: false,
 			Message: "Unknown interaction type",
@@ -174,13 +214,29 @@ func (pi *PlayerInteracter) ProcessInteraction(request *InteractionRequest) *Int
 	}
 }
 
+// handlePluginInteraction runs an interaction added by a plugin
+func (pi *PlayerInteracter) handlePluginInteraction(interaction PluginInteraction, fromPlayer, toPlayer *Player, data interface{}) *InteractionResult {
+	if interaction.Enabled != nil && !interaction.Enabled(fromPlayer, toPlayer) {
+		return &InteractionResult{
+			Success: false,
+			Message: interaction.Label + " is not available",
+			Error:   "Interaction not available",
+		}
+	}
+	result := interaction.Handle(pi.world, fromPlayer, toPlayer, data)
+	if result == nil {
+		result = &InteractionResult{Success: true}
+	}
+	return result
+}
+
 func (pi *PlayerInteracter) handleViewStats(fromPlayer, toPlayer *Player) *InteractionResult {
 	current, max, canSprint := toPlayer.GetStaminaInfo()
 
 	stats := map[string]interface{}{
 		"player_name": toPlayer.Name,
 		"player_id":   toPlayer.ID,
-		"level":       1, // TODO: Add level system
+		"level":       toPlayer.Progress.GetLevel(),
 		"position": map[string]float64{
 			"x": toPlayer.Position.X,
 			"y": toPlayer.Position.Y,
@@ -224,6 +280,14 @@ func (pi *PlayerInteracter) handleTrade(fromPlayer, toPlayer *Player) *Interacti
 }
 
 func (pi *PlayerInteracter) handleChallenge(fromPlayer, toPlayer *Player) *InteractionResult {
+	if err := pi.world.ChallengeToDuel(fromPlayer.ID, toPlayer.ID); err != nil {
+		return &InteractionResult{
+			Success: false,
+			Message: err.Error(),
+			Error:   err.Error(),
+		}
+	}
+
 	return &InteractionResult{
 		Success: true,
 		Message: "Duel challenge sent",
@@ -236,6 +300,25 @@ func (pi *PlayerInteracter) handleChallenge(fromPlayer, toPlayer *Player) *Inter
 	}
 }
 
+func (pi *PlayerInteracter) handleAttack(fromPlayer, toPlayer *Player) *InteractionResult {
+	if err := pi.world.AttackPlayer(fromPlayer.ID, toPlayer.ID); err != nil {
+		return &InteractionResult{
+			Success: false,
+			Message: err.Error(),
+			Error:   err.Error(),
+		}
+	}
+
+	return &InteractionResult{
+		Success: true,
+		Message: "Attacking " + toPlayer.Name,
+		Action:  "attack_player",
+		Data: map[string]interface{}{
+			"target_id": toPlayer.ID,
+		},
+	}
+}
+
 func (pi *PlayerInteracter) handleSendMessage(fromPlayer, toPlayer *Player, data interface{}) *InteractionResult {
 	return &InteractionResult{
 		Success: true,
@@ -249,6 +332,34 @@ func (pi *PlayerInteracter) handleSendMessage(fromPlayer, toPlayer *Player, data
 	}
 }
 
+func (pi *PlayerInteracter) handlePartyInvite(fromPlayer, toPlayer *Player) *InteractionResult {
+	if pi.world.parties == nil {
+		return &InteractionResult{
+			Success: false,
+			Message: "Parties are not available here",
+			Error:   "No party manager",
+		}
+	}
+
+	if err := pi.world.parties.Invite(fromPlayer, toPlayer); err != nil {
+		return &InteractionResult{
+			Success: false,
+			Message: err.Error(),
+			Error:   err.Error(),
+		}
+	}
+
+	return &InteractionResult{
+		Success: true,
+		Message: "Party invite sent!",
+		Action:  "send_party_invite",
+		Data: map[string]interface{}{
+			"from": fromPlayer.Name,
+			"to":   toPlayer.Name,
+		},
+	}
+}
+
 func (pi *PlayerInteracter) handleAddFriend(fromPlayer, toPlayer *Player) *InteractionResult {
 	return &InteractionResult{
 		Success: true,
@@ -1,3 +1,289 @@
 package game
 
-// TODO implement inventory management
+import (
+	"errors"
+	"sync"
+)
+
+// InventorySize is how many slots a character's bags hold
+const InventorySize = 20
+
+var (
+	ErrUnknownItem    = errors.New("unknown item")
+	ErrInventoryFull  = errors.New("inventory is full")
+	ErrNotEnoughItems = errors.New("not enough items")
+	ErrEmptySlot      = errors.New("inventory slot is empty")
+)
+
+// ItemDefinition describes an item as written in items.json
+type ItemDefinition struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MaxStack    int    `json:"max_stack"`
+	// Value is what vendors pay for one; items without a value cannot be sold
+	Value int `json:"value"`
+}
+
+// applyDefaults fills in optional definition fields
+func (d *ItemDefinition) applyDefaults() {
+	if d.MaxStack <= 0 {
+		d.MaxStack = 1
+	}
+}
+
+// ItemStack is a quantity of one item held in an inventory slot
+type ItemStack struct {
+	ItemID   string
+	Quantity int
+}
+
+// Inventory is a fixed number of slots each holding one stack of items
+type Inventory struct {
+	Slots []*ItemStack
+	mu    sync.Mutex
+}
+
+// NewInventory creates an empty inventory with the given number of slots
+func NewInventory(size int) *Inventory {
+	return &Inventory{
+		Slots: make([]*ItemStack, size),
+	}
+}
+
+// CanAdd reports whether a quantity of an item fits in the inventory
+func (inv *Inventory) CanAdd(definition *ItemDefinition, quantity int) bool {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return slotRoom(inv.Slots, definition) >= quantity
+}
+
+// slotRoom returns how many of an item still fit in a set of slots
+func slotRoom(slots []*ItemStack, definition *ItemDefinition) int {
+	room := 0
+	for _, stack := range slots {
+		switch {
+		case stack == nil:
+			room += definition.MaxStack
+		case stack.ItemID == definition.ID:
+			room += definition.MaxStack - stack.Quantity
+		}
+	}
+	return room
+}
+
+// Add puts a quantity of an item in the inventory, topping up existing
+// stacks before using empty slots; nothing is added when it does not all fit
+func (inv *Inventory) Add(definition *ItemDefinition, quantity int) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return addToSlots(inv.Slots, definition, quantity)
+}
+
+// Remove takes a quantity of an item out of the inventory, emptying the
+// last stacks first; nothing is removed when there are not enough
+func (inv *Inventory) Remove(itemID string, quantity int) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return removeFromSlots(inv.Slots, itemID, quantity)
+}
+
+// Exchange removes and then adds several stacks of items as one change:
+// either all of it happens or, when something is missing or does not
+// fit, none of it
+func (inv *Inventory) Exchange(remove, add []ItemStack, items map[string]*ItemDefinition) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	slots := make([]*ItemStack, len(inv.Slots))
+	for i, stack := range inv.Slots {
+		if stack != nil {
+			copied := *stack
+			slots[i] = &copied
+		}
+	}
+
+	for _, stack := range remove {
+		if err := removeFromSlots(slots, stack.ItemID, stack.Quantity); err != nil {
+			return err
+		}
+	}
+	for _, stack := range add {
+		definition, exists := items[stack.ItemID]
+		if !exists {
+			return ErrUnknownItem
+		}
+		if err := addToSlots(slots, definition, stack.Quantity); err != nil {
+			return err
+		}
+	}
+
+	inv.Slots = slots
+	return nil
+}
+
+// addToSlots puts items into a set of slots, changing nothing when they
+// do not all fit
+func addToSlots(slots []*ItemStack, definition *ItemDefinition, quantity int) error {
+	if slotRoom(slots, definition) < quantity {
+		return ErrInventoryFull
+	}
+
+	for _, stack := range slots {
+		if quantity == 0 {
+			return nil
+		}
+		if stack != nil && stack.ItemID == definition.ID && stack.Quantity < definition.MaxStack {
+			added := minInt(quantity, definition.MaxStack-stack.Quantity)
+			stack.Quantity += added
+			quantity -= added
+		}
+	}
+
+	for i, stack := range slots {
+		if quantity == 0 {
+			return nil
+		}
+		if stack == nil {
+			added := minInt(quantity, definition.MaxStack)
+			slots[i] = &ItemStack{ItemID: definition.ID, Quantity: added}
+			quantity -= added
+		}
+	}
+
+	return nil
+}
+
+// removeFromSlots takes items out of a set of slots, changing nothing
+// when there are not enough
+func removeFromSlots(slots []*ItemStack, itemID string, quantity int) error {
+	if slotCount(slots, itemID) < quantity {
+		return ErrNotEnoughItems
+	}
+
+	for i := len(slots) - 1; i >= 0 && quantity > 0; i-- {
+		stack := slots[i]
+		if stack == nil || stack.ItemID != itemID {
+			continue
+		}
+		removed := minInt(quantity, stack.Quantity)
+		stack.Quantity -= removed
+		quantity -= removed
+		if stack.Quantity == 0 {
+			slots[i] = nil
+		}
+	}
+
+	return nil
+}
+
+// TakeFromSlot removes up to a quantity of items from one slot and
+// returns what was taken
+func (inv *Inventory) TakeFromSlot(slot, quantity int) (ItemStack, error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	if slot < 0 || slot >= len(inv.Slots) || inv.Slots[slot] == nil {
+		return ItemStack{}, ErrEmptySlot
+	}
+
+	stack := inv.Slots[slot]
+	if quantity <= 0 || quantity > stack.Quantity {
+		quantity = stack.Quantity
+	}
+	stack.Quantity -= quantity
+	if stack.Quantity == 0 {
+		inv.Slots[slot] = nil
+	}
+
+	return ItemStack{ItemID: stack.ItemID, Quantity: quantity}, nil
+}
+
+// ReturnToSlot puts back a stack taken from a slot with TakeFromSlot
+// when what it was taken for fell through; the slot only holds that item
+// or nothing, since the inventory was locked in between by the same player
+func (inv *Inventory) ReturnToSlot(slot int, stack ItemStack) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	if slot < 0 || slot >= len(inv.Slots) {
+		return
+	}
+	if current := inv.Slots[slot]; current != nil && current.ItemID == stack.ItemID {
+		current.Quantity += stack.Quantity
+		return
+	}
+	if inv.Slots[slot] == nil {
+		inv.Slots[slot] = &stack
+	}
+}
+
+// SetSlot places a stack in a slot, replacing whatever was there
+func (inv *Inventory) SetSlot(slot int, stack *ItemStack) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	if slot >= 0 && slot < len(inv.Slots) {
+		inv.Slots[slot] = stack
+	}
+}
+
+// Count returns how many of an item the inventory holds
+func (inv *Inventory) Count(itemID string) int {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return slotCount(inv.Slots, itemID)
+}
+
+// slotCount returns how many of an item a set of slots holds
+func slotCount(slots []*ItemStack, itemID string) int {
+	total := 0
+	for _, stack := range slots {
+		if stack != nil && stack.ItemID == itemID {
+			total += stack.Quantity
+		}
+	}
+	return total
+}
+
+// Snapshot returns a copy of the inventory's slots, nil for empty ones
+func (inv *Inventory) Snapshot() []*ItemStack {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	slots := make([]*ItemStack, len(inv.Slots))
+	for i, stack := range inv.Slots {
+		if stack != nil {
+			copied := *stack
+			slots[i] = &copied
+		}
+	}
+	return slots
+}
+
+// Message returns the inventory_update message describing the inventory
+func (inv *Inventory) Message(items map[string]*ItemDefinition) map[string]interface{} {
+	slots := make([]map[string]interface{}, 0)
+	for i, stack := range inv.Snapshot() {
+		if stack == nil {
+			continue
+		}
+		name, value := stack.ItemID, 0
+		if definition, exists := items[stack.ItemID]; exists {
+			name, value = definition.Name, definition.Value
+		}
+		slots = append(slots, map[string]interface{}{
+			"slot":     i,
+			"item_id":  stack.ItemID,
+			"name":     name,
+			"quantity": stack.Quantity,
+			"value":    value,
+		})
+	}
+
+	return map[string]interface{}{
+		"type":  "inventory_update",
+		"size":  len(inv.Slots),
+		"slots": slots,
+	}
+}
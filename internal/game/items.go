@@ -0,0 +1,307 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	// ItemPickupRange is how close a player must stand to pick up an item
+	ItemPickupRange = 64.0
+	// ItemOwnershipDuration is how long only the owners of a drop may loot it
+	ItemOwnershipDuration = 60 * time.Second
+	// ItemDespawnDuration is how long dropped items stay on the ground
+	ItemDespawnDuration = 3 * time.Minute
+	// defaultItemRespawn is how long a map item spawn stays empty
+	defaultItemRespawn = 60 * time.Second
+)
+
+var (
+	ErrItemNotFound = errors.New("item not found")
+	ErrItemTooFar   = errors.New("item is too far away")
+	ErrItemNotYours = errors.New("item belongs to someone else")
+)
+
+// ItemDrop is a stack of items lying on the ground
+type ItemDrop struct {
+	ItemID     string
+	Quantity   int
+	Owners     []string
+	OwnedUntil time.Time
+	DespawnAt  time.Time
+	spawn      *itemSpawn
+}
+
+// CanLoot reports whether a character may pick the drop up; drops
+// without owners, or whose ownership ran out, are free for all
+func (d *ItemDrop) CanLoot(name string, now time.Time) bool {
+	if len(d.Owners) == 0 || now.After(d.OwnedUntil) {
+		return true
+	}
+	for _, owner := range d.Owners {
+		if owner == name {
+			return true
+		}
+	}
+	return false
+}
+
+// itemSpawn is a map spawn point that keeps an item on the ground,
+// putting it back a while after it is picked up
+type itemSpawn struct {
+	position  Position
+	itemID    string
+	quantity  int
+	respawn   time.Duration
+	respawnAt time.Time
+}
+
+// spawnItems places the items of the map's item spawn points
+func (w *World) spawnItems() {
+	if w.Map == nil || w.Content() == nil {
+		return
+	}
+
+	for _, point := range w.Map.SpawnsOfType("item") {
+		itemID := point.Properties["item"]
+		if _, exists := w.Content().Items[itemID]; !exists {
+			log.Printf("Item spawn %q uses unknown item %q", point.Name, itemID)
+			continue
+		}
+
+		spawn := &itemSpawn{
+			position: point.Position,
+			itemID:   itemID,
+			quantity: 1,
+			respawn:  defaultItemRespawn,
+		}
+		if quantity, err := strconv.Atoi(point.Properties["quantity"]); err == nil && quantity > 0 {
+			spawn.quantity = quantity
+		}
+		if seconds, err := strconv.Atoi(point.Properties["respawn_seconds"]); err == nil && seconds > 0 {
+			spawn.respawn = time.Duration(seconds) * time.Second
+		}
+
+		w.itemSpawns = append(w.itemSpawns, spawn)
+		w.placeItem(&ItemDrop{ItemID: spawn.itemID, Quantity: spawn.quantity, spawn: spawn}, spawn.position)
+	}
+}
+
+// DropItem puts items on the ground; while ownership lasts only the
+// named characters may pick them up
+func (w *World) DropItem(itemID string, quantity int, position Position, owners []string) (*Entity, error) {
+	if w.Content() == nil {
+		return nil, ErrUnknownItem
+	}
+	if _, exists := w.Content().Items[itemID]; !exists {
+		return nil, fmt.Errorf("%w %q", ErrUnknownItem, itemID)
+	}
+
+	w.mu.Lock()
+	entity, messages := w.placeItem(w.newDrop(itemID, quantity, owners, time.Now()), position)
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	return entity, nil
+}
+
+// newDrop describes items about to be dropped, reserved for their owners
+// for a while and despawning after ItemDespawnDuration
+func (w *World) newDrop(itemID string, quantity int, owners []string, now time.Time) *ItemDrop {
+	drop := &ItemDrop{
+		ItemID:    itemID,
+		Quantity:  quantity,
+		DespawnAt: now.Add(ItemDespawnDuration),
+	}
+	if len(owners) > 0 {
+		drop.Owners = owners
+		drop.OwnedUntil = now.Add(ItemOwnershipDuration)
+	}
+	return drop
+}
+
+// placeItem adds an item entity and shows it to nearby players; the
+// caller holds the world lock
+func (w *World) placeItem(drop *ItemDrop, position Position) (*Entity, []outboundMessage) {
+	w.nextItemID++
+	name := drop.ItemID
+	if definition, exists := w.Content().Items[drop.ItemID]; exists {
+		name = definition.Name
+	}
+
+	entity := NewEntity(fmt.Sprintf("item_%d", w.nextItemID), Item, name, position)
+	entity.Drop = drop
+	w.Items[entity.ID] = entity
+
+	var messages []outboundMessage
+	for _, playerID := range w.observersOf(position, "") {
+		w.visibleItems[playerID][entity.ID] = true
+		messages = append(messages, outboundMessage{playerID: playerID, message: itemAppearance(entity)})
+	}
+	return entity, messages
+}
+
+// removeItem takes an item entity off the ground, telling the players who
+// could see it; the caller holds the world lock
+func (w *World) removeItem(entityID string) []outboundMessage {
+	entity, exists := w.Items[entityID]
+	if !exists {
+		return nil
+	}
+	delete(w.Items, entityID)
+
+	if spawn := entity.Drop.spawn; spawn != nil {
+		spawn.respawnAt = time.Now().Add(spawn.respawn)
+	}
+
+	var messages []outboundMessage
+	for playerID, seen := range w.visibleItems {
+		if seen[entityID] {
+			delete(seen, entityID)
+			messages = append(messages, outboundMessage{playerID: playerID, message: map[string]interface{}{
+				"type": "item_disappeared",
+				"id":   entityID,
+			}})
+		}
+	}
+	return messages
+}
+
+// PickupItem moves an item from the ground into a player's inventory
+func (w *World) PickupItem(playerID, entityID string) error {
+	now := time.Now()
+
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	entity, exists := w.Items[entityID]
+	if !exists {
+		w.mu.Unlock()
+		return ErrItemNotFound
+	}
+	if distance(player.GetPosition(), entity.Position) > ItemPickupRange {
+		w.mu.Unlock()
+		return ErrItemTooFar
+	}
+	if !entity.Drop.CanLoot(player.Name, now) {
+		w.mu.Unlock()
+		return ErrItemNotYours
+	}
+	definition, exists := w.Content().Items[entity.Drop.ItemID]
+	if !exists {
+		w.mu.Unlock()
+		return ErrUnknownItem
+	}
+	if err := player.Inventory.Add(definition, entity.Drop.Quantity); err != nil {
+		w.mu.Unlock()
+		return err
+	}
+
+	messages := w.removeItem(entityID)
+	messages = append(messages, outboundMessage{playerID: playerID, message: player.Inventory.Message(w.Content().Items)})
+	messages = append(messages, w.syncCollectObjectives(player)...)
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	return nil
+}
+
+// DropFromInventory takes items out of a player's inventory slot and
+// leaves them on the ground at the player's feet for anyone to pick up
+func (w *World) DropFromInventory(playerID string, slot, quantity int) error {
+	player, exists := w.GetPlayer(playerID)
+	if !exists {
+		return errors.New("player not found")
+	}
+	if !player.Life.Alive() {
+		return ErrDead
+	}
+
+	stack, err := player.Inventory.TakeFromSlot(slot, quantity)
+	if err != nil {
+		return err
+	}
+
+	// Items whose definition a content reload removed cannot go on the
+	// ground, so they stay where they were
+	if _, err := w.DropItem(stack.ItemID, stack.Quantity, player.GetPosition(), nil); err != nil {
+		player.Inventory.ReturnToSlot(slot, stack)
+		return err
+	}
+
+	messages := []outboundMessage{{playerID: playerID, message: player.Inventory.Message(w.Content().Items)}}
+	w.deliver(append(messages, w.syncCollectObjectives(player)...))
+	return nil
+}
+
+// updateItems despawns expired drops and refills empty item spawns; the
+// caller holds the world lock
+func (w *World) updateItems(now time.Time) []outboundMessage {
+	var messages []outboundMessage
+
+	for entityID, entity := range w.Items {
+		if !entity.Drop.DespawnAt.IsZero() && now.After(entity.Drop.DespawnAt) {
+			messages = append(messages, w.removeItem(entityID)...)
+		}
+	}
+
+	for _, spawn := range w.itemSpawns {
+		if spawn.respawnAt.IsZero() || now.Before(spawn.respawnAt) {
+			continue
+		}
+		spawn.respawnAt = time.Time{}
+		_, placed := w.placeItem(&ItemDrop{ItemID: spawn.itemID, Quantity: spawn.quantity, spawn: spawn}, spawn.position)
+		messages = append(messages, placed...)
+	}
+
+	return messages
+}
+
+// refreshItemInterest shows a player the items that came within their
+// area of interest and hides those that left it; the caller holds the
+// world lock
+func (w *World) refreshItemInterest(player *Player) []outboundMessage {
+	var messages []outboundMessage
+
+	position := player.GetPosition()
+	seen := w.visibleItems[player.ID]
+	if seen == nil {
+		seen = make(map[string]bool)
+		w.visibleItems[player.ID] = seen
+	}
+
+	for entityID, entity := range w.Items {
+		inRange := w.withinAOI(position, entity.Position)
+		switch {
+		case inRange && !seen[entityID]:
+			seen[entityID] = true
+			messages = append(messages, outboundMessage{playerID: player.ID, message: itemAppearance(entity)})
+		case !inRange && seen[entityID]:
+			delete(seen, entityID)
+			messages = append(messages, outboundMessage{playerID: player.ID, message: map[string]interface{}{
+				"type": "item_disappeared",
+				"id":   entityID,
+			}})
+		}
+	}
+
+	return messages
+}
+
+func itemAppearance(entity *Entity) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "item_appeared",
+		"id":       entity.ID,
+		"item_id":  entity.Drop.ItemID,
+		"name":     entity.Name,
+		"quantity": entity.Drop.Quantity,
+		"x":        entity.Position.X,
+		"y":        entity.Position.Y,
+	}
+}
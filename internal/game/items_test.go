@@ -0,0 +1,49 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDropFromInventory(t *testing.T) {
+	tests := []struct {
+		name string
+		item string
+		dead bool
+		err  error
+		// left is the quantity still in the slot afterwards
+		left int
+	}{
+		{"drops the stack", "apple", false, nil, 0},
+		{"keeps items without a definition", "removed_item", false, ErrUnknownItem, 3},
+		{"refuses the dead", "apple", true, ErrDead, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zones := newTestZones(t)
+			player := NewPlayer("id-alice", "alice")
+			world, err := zones.JoinPlayer(player, Position{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer zones.LeavePlayer(player)
+
+			player.Inventory.SetSlot(0, &ItemStack{ItemID: test.item, Quantity: 3})
+			if test.dead {
+				player.Life.die(world.ID, player.GetPosition())
+			}
+
+			if err := world.DropFromInventory(player.ID, 0, 3); !errors.Is(err, test.err) {
+				t.Fatalf("DropFromInventory = %v, want %v", err, test.err)
+			}
+			left := 0
+			if stack := player.Inventory.Snapshot()[0]; stack != nil {
+				left = stack.Quantity
+			}
+			if left != test.left {
+				t.Fatalf("%d left in the slot, want %d", left, test.left)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"golang-mmo-server/internal/loot"
+)
+
+const (
+	// NeedGreedThreshold is the lowest rarity parties roll need or greed on;
+	// anything below is free for all party members
+	NeedGreedThreshold = loot.Uncommon
+	// lootRollDuration is how long party members have to make their choice
+	lootRollDuration = 30 * time.Second
+	// lootScatterRadius spreads the drops of one kill around the body
+	lootScatterRadius = 20.0
+)
+
+// Need, greed and pass are the choices of a need/greed roll
+const (
+	RollNeed  = "need"
+	RollGreed = "greed"
+	RollPass  = "pass"
+)
+
+var (
+	ErrUnknownRoll = errors.New("unknown loot roll")
+	ErrBadChoice   = errors.New("choice must be need, greed or pass")
+)
+
+// lootRoll is a drop party members are rolling need or greed on
+type lootRoll struct {
+	id       string
+	drop     loot.Drop
+	position Position
+	eligible map[string]string
+	choices  map[string]string
+	expires  time.Time
+}
+
+// dropNPCLoot rolls a killed NPC's loot table and puts the drops on the
+// ground, shared out among the eligible players according to the
+// killer's party loot mode; the caller holds the world lock
+func (w *World) dropNPCLoot(npc *Entity, killer *Player, eligible map[string]string, now time.Time) []outboundMessage {
+	definition := npc.AI.Definition
+	if definition.LootTable == "" || w.loot == nil {
+		return nil
+	}
+
+	drops, err := w.loot.Roll(definition.LootTable, definition.Level)
+	if err != nil {
+		log.Printf("Failed to roll loot of %s: %v", npc.ID, err)
+		return nil
+	}
+
+	group, inParty := LootGroup{}, false
+	if w.parties != nil {
+		group, inParty = w.parties.LootGroupOf(killer.ID)
+	}
+
+	var messages []outboundMessage
+	for i, drop := range drops {
+		angle := 2 * math.Pi * float64(i) / float64(len(drops))
+		position := Position{
+			X: npc.Position.X + math.Cos(angle)*lootScatterRadius,
+			Y: npc.Position.Y + math.Sin(angle)*lootScatterRadius,
+		}
+		if len(drops) == 1 || (w.Map != nil && w.Map.IsBlocked(position)) {
+			position = npc.Position
+		}
+
+		owners := []string{killer.Name}
+		if inParty {
+			switch {
+			case group.Mode == LootRoundRobin:
+				ids := make(map[string]bool, len(eligible))
+				for memberID := range eligible {
+					ids[memberID] = true
+				}
+				if looterID, ok := w.parties.NextLooter(group.PartyID, ids); ok {
+					owners = []string{eligible[looterID]}
+				}
+			case group.Mode == LootNeedGreed && drop.Rarity.AtLeast(NeedGreedThreshold) && len(eligible) > 1:
+				messages = append(messages, w.startLootRoll(drop, position, eligible, now)...)
+				continue
+			default:
+				owners = owners[:0]
+				for _, name := range eligible {
+					owners = append(owners, name)
+				}
+			}
+		}
+
+		_, placed := w.placeItem(w.newDrop(drop.Item, drop.Quantity, owners, now), position)
+		messages = append(messages, placed...)
+	}
+
+	return messages
+}
+
+// startLootRoll asks party members to roll on a drop; the caller holds
+// the world lock
+func (w *World) startLootRoll(drop loot.Drop, position Position, eligible map[string]string, now time.Time) []outboundMessage {
+	w.nextRollID++
+	roll := &lootRoll{
+		id:       fmt.Sprintf("roll_%d", w.nextRollID),
+		drop:     drop,
+		position: position,
+		eligible: eligible,
+		choices:  make(map[string]string),
+		expires:  now.Add(lootRollDuration),
+	}
+	w.lootRolls[roll.id] = roll
+
+	name := drop.Item
+	if definition, exists := w.Content().Items[drop.Item]; exists {
+		name = definition.Name
+	}
+
+	var messages []outboundMessage
+	for playerID := range eligible {
+		messages = append(messages, outboundMessage{playerID: playerID, message: map[string]interface{}{
+			"type":       "loot_roll",
+			"roll_id":    roll.id,
+			"item_id":    drop.Item,
+			"name":       name,
+			"quantity":   drop.Quantity,
+			"rarity":     drop.Rarity,
+			"expires_in": lootRollDuration.Seconds(),
+		}})
+	}
+	return messages
+}
+
+// LootRollChoice records a party member's need, greed or pass on a roll,
+// settling the roll once everyone has chosen
+func (w *World) LootRollChoice(playerID, rollID, choice string) error {
+	switch choice {
+	case RollNeed, RollGreed, RollPass:
+	default:
+		return ErrBadChoice
+	}
+
+	w.mu.Lock()
+	roll, exists := w.lootRolls[rollID]
+	if !exists {
+		w.mu.Unlock()
+		return ErrUnknownRoll
+	}
+	if _, eligible := roll.eligible[playerID]; !eligible {
+		w.mu.Unlock()
+		return ErrUnknownRoll
+	}
+	roll.choices[playerID] = choice
+
+	var messages []outboundMessage
+	if len(roll.choices) == len(roll.eligible) {
+		messages = w.settleLootRoll(roll, time.Now())
+	}
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	return nil
+}
+
+// updateLootRolls settles rolls whose time ran out, counting missing
+// choices as passes; the caller holds the world lock
+func (w *World) updateLootRolls(now time.Time) []outboundMessage {
+	var messages []outboundMessage
+	for _, roll := range w.lootRolls {
+		if now.After(roll.expires) {
+			messages = append(messages, w.settleLootRoll(roll, now)...)
+		}
+	}
+	return messages
+}
+
+// settleLootRoll picks the winner of a roll, need beating greed, and
+// drops the item for them; when everyone passed the item is free for
+// all. The caller holds the world lock
+func (w *World) settleLootRoll(roll *lootRoll, now time.Time) []outboundMessage {
+	delete(w.lootRolls, roll.id)
+
+	results := make([]map[string]interface{}, 0, len(roll.choices))
+	winnerID, winnerChoice, winnerRoll := "", "", 0
+	for _, choice := range []string{RollNeed, RollGreed} {
+		for playerID, made := range roll.choices {
+			if made != choice {
+				continue
+			}
+			value := w.loot.RollPercent()
+			results = append(results, map[string]interface{}{
+				"name":   roll.eligible[playerID],
+				"choice": choice,
+				"roll":   value,
+			})
+			if winnerChoice == "" || (winnerChoice == choice && value > winnerRoll) {
+				winnerID, winnerChoice, winnerRoll = playerID, choice, value
+			}
+		}
+		if winnerID != "" {
+			break
+		}
+	}
+
+	var owners []string
+	winner := ""
+	if winnerID != "" {
+		winner = roll.eligible[winnerID]
+		owners = []string{winner}
+	}
+
+	var messages []outboundMessage
+	for playerID := range roll.eligible {
+		messages = append(messages, outboundMessage{playerID: playerID, message: map[string]interface{}{
+			"type":    "loot_roll_result",
+			"roll_id": roll.id,
+			"item_id": roll.drop.Item,
+			"winner":  winner,
+			"results": results,
+		}})
+	}
+
+	_, placed := w.placeItem(w.newDrop(roll.drop.Item, roll.drop.Quantity, owners, now), roll.position)
+	return append(messages, placed...)
+}
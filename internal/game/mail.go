@@ -0,0 +1,539 @@
+package game
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// SystemSender is the sender of mail the server sends itself
+const SystemSender = "Postmaster"
+
+const (
+	// MailRetention is how long a letter waits in a mailbox. Player
+	// letters still holding attachments then go back to their sender;
+	// anything else is deleted
+	MailRetention = 30 * 24 * time.Hour
+	// MailMaxAttachments is how many item stacks a letter can hold
+	MailMaxAttachments = 6
+	// MailboxSize is how many letters a mailbox takes from other players;
+	// letters from the server are always delivered
+	MailboxSize = 50
+	// mailExpiryInterval is how often letters past their retention are handled
+	mailExpiryInterval = time.Minute
+	// maxMailSubject and maxMailBody bound the text of player letters
+	maxMailSubject = 64
+	maxMailBody    = 500
+)
+
+var (
+	ErrMailNotFound       = errors.New("mail not found")
+	ErrMailRecipient      = errors.New("there is no character by that name")
+	ErrMailToSelf         = errors.New("you cannot mail yourself")
+	ErrMailboxFull        = errors.New("their mailbox is full")
+	ErrMailAttachments    = errors.New("a letter holds up to 6 item stacks")
+	ErrMailCOD            = errors.New("cash on delivery needs items attached and no coins")
+	ErrMailNotReturnable  = errors.New("that letter cannot be returned")
+	ErrMailHasAttachments = errors.New("take or return the attachments first")
+)
+
+// Mail is a letter waiting in a character's mailbox, holding its item
+// and currency attachments until they are taken
+type Mail struct {
+	ID        int64
+	Recipient string
+	Sender    string
+	Subject   string
+	Body      string
+	Items     []ItemStack
+	Currency  int
+	// COD is what the recipient pays the sender to take the items
+	COD      int
+	Read     bool
+	Returned bool
+	Sent     time.Time
+	Expires  time.Time
+}
+
+// hasAttachments reports whether a letter still holds items or currency
+func (m *Mail) hasAttachments() bool {
+	return len(m.Items) > 0 || m.Currency > 0
+}
+
+// returnable reports whether a letter can go back to its sender
+func (m *Mail) returnable() bool {
+	return m.Sender != SystemSender && !m.Returned
+}
+
+// MailAttachment picks part of an inventory slot to attach to a letter
+type MailAttachment struct {
+	Slot     int
+	Quantity int
+}
+
+// PostOffice delivers mail to characters whether or not they are online
+// and hands out its attachments
+type PostOffice struct {
+	database *Database
+	currency *CurrencyService
+	items    func() map[string]*ItemDefinition
+	notify   func(name string, message map[string]interface{})
+	known    func(name string) bool
+}
+
+// NewPostOffice creates the mail service on top of the game database
+func NewPostOffice(database *Database, currency *CurrencyService, items func() map[string]*ItemDefinition) *PostOffice {
+	return &PostOffice{database: database, currency: currency, items: items}
+}
+
+// SetNotifier sets how online characters are told about new mail
+func (p *PostOffice) SetNotifier(notify func(name string, message map[string]interface{})) {
+	p.notify = notify
+}
+
+// SetDirectory sets how the recipients of player letters are checked
+func (p *PostOffice) SetDirectory(known func(name string) bool) {
+	p.known = known
+}
+
+// Send delivers a letter on its own
+func (p *PostOffice) Send(mail *Mail) error {
+	if err := p.database.Transact(func(tx *sql.Tx) error {
+		return p.deliver(tx, mail)
+	}); err != nil {
+		return err
+	}
+	p.Announce(mail)
+	return nil
+}
+
+// deliver writes a letter as part of a larger transaction; the
+// recipient is told with Announce once it commits
+func (p *PostOffice) deliver(tx *sql.Tx, mail *Mail) error {
+	if mail.Sent.IsZero() {
+		mail.Sent = time.Now()
+	}
+	if mail.Expires.IsZero() {
+		mail.Expires = mail.Sent.Add(MailRetention)
+	}
+	if mail.Sender == "" {
+		mail.Sender = SystemSender
+	}
+	id, err := insertMail(tx, mail)
+	if err != nil {
+		return fmt.Errorf("mailing %s: %w", mail.Recipient, err)
+	}
+	mail.ID = id
+	return nil
+}
+
+// Announce tells the recipient of delivered mail about it if they are online
+func (p *PostOffice) Announce(mail *Mail) {
+	if p.notify == nil {
+		return
+	}
+	_, unread, err := p.database.CountMail(mail.Recipient)
+	if err != nil {
+		log.Printf("Failed to count mail of %s: %v", mail.Recipient, err)
+	}
+	p.notify(mail.Recipient, map[string]interface{}{
+		"type":    "mail_received",
+		"id":      mail.ID,
+		"sender":  mail.Sender,
+		"subject": mail.Subject,
+		"unread":  unread,
+	})
+}
+
+// Post sends a letter from a player to another character. Attached
+// stacks leave the inventory and attached coins the wallet in the same
+// transaction that delivers it
+func (p *PostOffice) Post(sender *Player, recipient, subject, body string, attachments []MailAttachment, currency, cod int, now time.Time) (*Mail, error) {
+	recipient = strings.TrimSpace(recipient)
+	switch {
+	case recipient == "" || recipient == SystemSender:
+		return nil, ErrMailRecipient
+	case recipient == sender.Name:
+		return nil, ErrMailToSelf
+	case len(attachments) > MailMaxAttachments:
+		return nil, ErrMailAttachments
+	case currency < 0 || cod < 0 || (cod > 0 && (currency > 0 || len(attachments) == 0)):
+		return nil, ErrMailCOD
+	}
+	if p.known != nil && !p.known(recipient) {
+		return nil, ErrMailRecipient
+	}
+	if total, _, err := p.database.CountMail(recipient); err != nil {
+		return nil, err
+	} else if total >= MailboxSize {
+		return nil, ErrMailboxFull
+	}
+
+	subject = truncateText(strings.TrimSpace(subject), maxMailSubject)
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	mail := &Mail{
+		Recipient: recipient,
+		Sender:    sender.Name,
+		Subject:   subject,
+		Body:      truncateText(strings.TrimSpace(body), maxMailBody),
+		Currency:  currency,
+		COD:       cod,
+		Sent:      now,
+	}
+
+	for _, attachment := range attachments {
+		stack, err := sender.Inventory.TakeFromSlot(attachment.Slot, attachment.Quantity)
+		if err != nil {
+			p.restore(sender, mail.Items)
+			return nil, err
+		}
+		mail.Items = append(mail.Items, stack)
+	}
+
+	err := p.currency.Transact(sender, -currency, ReasonMail, "mail/to/"+recipient, func(tx *sql.Tx) error {
+		if err := p.deliver(tx, mail); err != nil {
+			return err
+		}
+		return saveInventory(tx, sender.Name, sender.Inventory)
+	})
+	if err != nil {
+		p.restore(sender, mail.Items)
+		return nil, err
+	}
+
+	p.Announce(mail)
+	return mail, nil
+}
+
+// Take moves a letter's attachments into the character's inventory and
+// wallet and removes it from the mailbox, all or nothing. Taking a COD
+// letter pays its sender by mail in the same transaction
+func (p *PostOffice) Take(player *Player, id int64) (*Mail, error) {
+	mail, err := p.mailOf(player, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var payment *Mail
+	if mail.COD > 0 {
+		payment = &Mail{
+			Recipient: mail.Sender,
+			Subject:   "COD payment: " + mail.Subject,
+			Body:      fmt.Sprintf("%s paid for the items you sent.", player.Name),
+			Currency:  mail.COD,
+		}
+	}
+
+	if err := player.Inventory.Exchange(nil, mail.Items, p.items()); err != nil {
+		return nil, err
+	}
+	err = p.currency.Transact(player, mail.Currency-mail.COD, ReasonMail, fmt.Sprintf("mail/%d", mail.ID), func(tx *sql.Tx) error {
+		if err := deleteMail(tx, mail.ID, player.Name); err != nil {
+			return err
+		}
+		if payment != nil {
+			if err := p.deliver(tx, payment); err != nil {
+				return err
+			}
+		}
+		return saveInventory(tx, player.Name, player.Inventory)
+	})
+	if err != nil {
+		if undo := player.Inventory.Exchange(mail.Items, nil, p.items()); undo != nil {
+			log.Printf("Could not undo taking mail %d of %s: %v", mail.ID, player.Name, undo)
+		}
+		return nil, err
+	}
+
+	if payment != nil {
+		p.Announce(payment)
+	}
+	return mail, nil
+}
+
+// Return sends a letter back to the character who sent it, attachments
+// and all
+func (p *PostOffice) Return(player *Player, id int64, now time.Time) (*Mail, error) {
+	mail, err := p.mailOf(player, id)
+	if err != nil {
+		return nil, err
+	}
+	if !mail.returnable() {
+		return nil, ErrMailNotReturnable
+	}
+
+	if err := p.returnToSender(mail, now); err != nil {
+		return nil, err
+	}
+	return mail, nil
+}
+
+// Delete throws away a letter that holds nothing
+func (p *PostOffice) Delete(player *Player, id int64) error {
+	mail, err := p.mailOf(player, id)
+	if err != nil {
+		return err
+	}
+	if mail.hasAttachments() {
+		return ErrMailHasAttachments
+	}
+
+	return p.database.Transact(func(tx *sql.Tx) error {
+		return deleteMail(tx, mail.ID, player.Name)
+	})
+}
+
+// Expire handles the letters whose retention time has run out: player
+// letters with attachments go back to their sender once, everything
+// else is deleted along with what it holds
+func (p *PostOffice) Expire(now time.Time) {
+	due, err := p.database.DueMail(now)
+	if err != nil {
+		log.Printf("Failed to load expired mail: %v", err)
+		return
+	}
+
+	for _, mail := range due {
+		if mail.returnable() && mail.hasAttachments() {
+			err = p.returnToSender(mail, now)
+		} else {
+			err = p.database.Transact(func(tx *sql.Tx) error {
+				return deleteMail(tx, mail.ID, mail.Recipient)
+			})
+		}
+		if err != nil && err != ErrMailNotFound {
+			log.Printf("Failed to expire mail %d of %s: %v", mail.ID, mail.Recipient, err)
+		}
+	}
+}
+
+// SummaryMessage returns the mail_summary message counting a character's
+// letters
+func (p *PostOffice) SummaryMessage(name string) (map[string]interface{}, error) {
+	total, unread, err := p.database.CountMail(name)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"type":   "mail_summary",
+		"total":  total,
+		"unread": unread,
+	}, nil
+}
+
+// returnToSender turns a letter around and tells its sender
+func (p *PostOffice) returnToSender(mail *Mail, now time.Time) error {
+	if err := p.database.Transact(func(tx *sql.Tx) error {
+		return returnMail(tx, mail.ID, mail.Recipient, now, now.Add(MailRetention))
+	}); err != nil {
+		return err
+	}
+
+	mail.Recipient, mail.Sender = mail.Sender, mail.Recipient
+	mail.COD = 0
+	mail.Returned = true
+	p.Announce(mail)
+	return nil
+}
+
+// mailOf loads a letter from a player's own mailbox
+func (p *PostOffice) mailOf(player *Player, id int64) (*Mail, error) {
+	mail, err := p.database.GetMail(id)
+	if err == sql.ErrNoRows || (err == nil && mail.Recipient != player.Name) {
+		return nil, ErrMailNotFound
+	}
+	return mail, err
+}
+
+// restore puts attachments of a letter that was not sent back into the
+// sender's inventory
+func (p *PostOffice) restore(sender *Player, stacks []ItemStack) {
+	if undo := sender.Inventory.Exchange(nil, stacks, p.items()); undo != nil {
+		log.Printf("Could not return mail attachments to %s: %v", sender.Name, undo)
+	}
+}
+
+// truncateText cuts text down to at most max characters
+func truncateText(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max])
+}
+
+// InboxMessage returns the mail_list message describing a character's mailbox
+func (p *PostOffice) InboxMessage(name string) (map[string]interface{}, error) {
+	inbox, err := p.database.LoadMail(name)
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]map[string]interface{}, 0, len(inbox))
+	for _, mail := range inbox {
+		items := make([]map[string]interface{}, 0, len(mail.Items))
+		for _, stack := range mail.Items {
+			itemName := stack.ItemID
+			if definition, exists := p.items()[stack.ItemID]; exists {
+				itemName = definition.Name
+			}
+			items = append(items, map[string]interface{}{
+				"item_id":  stack.ItemID,
+				"name":     itemName,
+				"quantity": stack.Quantity,
+			})
+		}
+		letters = append(letters, map[string]interface{}{
+			"id":       mail.ID,
+			"sender":   mail.Sender,
+			"subject":  mail.Subject,
+			"body":     mail.Body,
+			"items":    items,
+			"currency": mail.Currency,
+			"cod":      mail.COD,
+			"read":     mail.Read,
+			"returned": mail.Returned,
+			"sent":     mail.Sent.Unix(),
+			"expires":  mail.Expires.Unix(),
+		})
+	}
+
+	return map[string]interface{}{
+		"type": "mail_list",
+		"mail": letters,
+	}, nil
+}
+
+// postCustomer returns a player who may use the mail; guests have no
+// mailbox
+func (w *World) postCustomer(playerID string) (*Player, error) {
+	player, exists := w.GetPlayer(playerID)
+	if !exists {
+		return nil, errors.New("player not found")
+	}
+	if w.post == nil {
+		return nil, ErrNoDatabase
+	}
+	if player.Guest {
+		return nil, ErrGuest
+	}
+	return player, nil
+}
+
+// ListMail sends a player their mailbox
+func (w *World) ListMail(playerID string) error {
+	player, err := w.postCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	message, err := w.post.InboxMessage(player.Name)
+	if err != nil {
+		return err
+	}
+	w.SendToPlayer(playerID, message)
+	if err := w.post.database.MarkMailRead(player.Name); err != nil {
+		log.Printf("Failed to mark mail of %s read: %v", player.Name, err)
+	}
+	return nil
+}
+
+// SendMail posts a letter from a player to another character
+func (w *World) SendMail(playerID, recipient, subject, body string, attachments []MailAttachment, currency, cod int) error {
+	player, err := w.postCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	mail, err := w.post.Post(player, recipient, subject, body, attachments, currency, cod, time.Now())
+	if err != nil {
+		return err
+	}
+
+	w.SendToPlayer(playerID, map[string]interface{}{
+		"type":      "mail_sent",
+		"id":        mail.ID,
+		"recipient": mail.Recipient,
+		"subject":   mail.Subject,
+	})
+	w.SendToPlayer(playerID, player.Inventory.Message(w.Content().Items))
+	w.SendToPlayer(playerID, player.Wallet.Message())
+	w.deliver(w.syncCollectObjectives(player))
+	return nil
+}
+
+// ReturnMail sends a letter in a player's mailbox back to its sender
+func (w *World) ReturnMail(playerID string, id int64) error {
+	player, err := w.postCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.post.Return(player, id, time.Now()); err != nil {
+		return err
+	}
+	return w.ListMail(playerID)
+}
+
+// DeleteMail throws away an empty letter in a player's mailbox
+func (w *World) DeleteMail(playerID string, id int64) error {
+	player, err := w.postCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	if err := w.post.Delete(player, id); err != nil {
+		return err
+	}
+	return w.ListMail(playerID)
+}
+
+// TakeMail takes the attachments of a letter in a player's mailbox
+func (w *World) TakeMail(playerID string, id int64) error {
+	player, err := w.postCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.post.Take(player, id); err != nil {
+		return err
+	}
+
+	w.SendToPlayer(playerID, player.Inventory.Message(w.Content().Items))
+	w.SendToPlayer(playerID, player.Wallet.Message())
+	w.deliver(w.syncCollectObjectives(player))
+	return w.ListMail(playerID)
+}
+
+// characterKnown reports whether a character is online or has been
+// saved; guests cannot receive mail
+func (zm *ZoneManager) characterKnown(name string) bool {
+	zm.mu.RLock()
+	player, online := zm.characters[name]
+	zm.mu.RUnlock()
+	if online {
+		return !player.Guest
+	}
+	_, err := zm.database.GetCharacter(name)
+	return err == nil
+}
+
+// runMailExpiry periodically handles letters past their retention until stopped
+func (zm *ZoneManager) runMailExpiry(stop chan struct{}) {
+	ticker := time.NewTicker(mailExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			zm.Post.Expire(now)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package game
+
+import (
+	"errors"
+
+	"golang-mmo-server/internal/pathfinding"
+)
+
+// PlayerWalkSpeed is how fast server-driven movement walks a player, in
+// world units per second; it matches the client's keyboard walking speed
+const PlayerWalkSpeed = 160.0
+
+var (
+	ErrNoNavigation       = errors.New("this world has no navigation map")
+	ErrDestinationBlocked = errors.New("destination is blocked")
+)
+
+// playerPath is the click-to-move route a player is following
+type playerPath struct {
+	destination Position
+	waypoints   []Position
+	request     *pathfinding.Request
+}
+
+// StartClickMove searches a path to the destination and, once found,
+// walks the player along it at PlayerWalkSpeed
+func (w *World) StartClickMove(playerID string, destination Position) error {
+	if w.Map == nil || w.Navigator == nil {
+		return ErrNoNavigation
+	}
+	if w.Map.IsBlocked(destination) {
+		return ErrDestinationBlocked
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	player, exists := w.Players[playerID]
+	if !exists {
+		return errors.New("player not found")
+	}
+	if player.Life.State() == Dead {
+		return ErrDead
+	}
+
+	w.clearPlayerPath(playerID)
+
+	route := &playerPath{destination: destination}
+	w.playerPaths[playerID] = route
+
+	start := pathPoint(w.Map, player.GetPosition())
+	goal := pathPoint(w.Map, destination)
+	route.request = w.Navigator.Request(start, goal, func(points []pathfinding.Point, err error) {
+		w.mu.Lock()
+		current, active := w.playerPaths[playerID]
+		if !active || current != route {
+			w.mu.Unlock()
+			return
+		}
+		route.request = nil
+
+		var message map[string]interface{}
+		if err != nil {
+			delete(w.playerPaths, playerID)
+			message = map[string]interface{}{
+				"type":  "move_to_failed",
+				"error": err.Error(),
+			}
+		} else {
+			route.waypoints = pathPositions(w.Map, points, destination)
+			waypoints := make([]map[string]float64, 0, len(route.waypoints))
+			for _, waypoint := range route.waypoints {
+				waypoints = append(waypoints, map[string]float64{"x": waypoint.X, "y": waypoint.Y})
+			}
+			message = map[string]interface{}{
+				"type":      "move_path",
+				"waypoints": waypoints,
+			}
+		}
+		w.mu.Unlock()
+
+		w.deliver([]outboundMessage{{playerID: playerID, message: message}})
+	})
+
+	return nil
+}
+
+// CancelClickMove stops any server-driven movement of the player
+func (w *World) CancelClickMove(playerID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.clearPlayerPath(playerID)
+}
+
+// clearPlayerPath drops a player's route; the caller holds the world lock
+func (w *World) clearPlayerPath(playerID string) {
+	if route, exists := w.playerPaths[playerID]; exists {
+		if route.request != nil {
+			route.request.Cancel()
+		}
+		delete(w.playerPaths, playerID)
+	}
+}
+
+// updatePlayerPaths walks players along their routes, returning the
+// portals players stepped into; the caller holds the world lock
+func (w *World) updatePlayerPaths(delta float64) ([]outboundMessage, map[string]*Region) {
+	var messages []outboundMessage
+	portals := make(map[string]*Region)
+
+	for playerID, route := range w.playerPaths {
+		if route.request != nil {
+			continue
+		}
+
+		player, exists := w.Players[playerID]
+		if !exists {
+			delete(w.playerPaths, playerID)
+			continue
+		}
+
+		// Rooted and stunned players keep their route until they can move again
+		speed := player.MoveSpeedFactor()
+		if speed == 0 {
+			continue
+		}
+
+		from := player.GetPosition()
+		position, remaining, moved := followPath(from, route.waypoints, PlayerWalkSpeed*speed*delta)
+		route.waypoints = remaining
+		if moved {
+			player.SetPosition(position)
+			w.AddStatistic(player, StatisticDistanceWalked, distance(from, position))
+			w.publish(PlayerMoved{Player: player, Zone: w.ID, From: from, To: position})
+			messages = append(messages, w.refreshInterest(player, "player_appeared")...)
+			messages = append(messages, outboundMessage{near: &position, message: map[string]interface{}{
+				"type":      "player_moved",
+				"id":        player.ID,
+				"x":         position.X,
+				"y":         position.Y,
+				"sprinting": false,
+			}})
+			messages = append(messages, w.reachEvents(player, from, position)...)
+			messages = append(messages, w.regionEvents(player, from, position)...)
+
+			if portal := w.portalEntered(from, position); portal != nil && player.Life.Alive() {
+				portals[playerID] = portal
+				delete(w.playerPaths, playerID)
+				continue
+			}
+		}
+
+		if len(remaining) == 0 {
+			delete(w.playerPaths, playerID)
+			messages = append(messages, outboundMessage{playerID: playerID, message: map[string]interface{}{
+				"type": "move_to_complete",
+				"x":    position.X,
+				"y":    position.Y,
+			}})
+		}
+	}
+
+	return messages, portals
+}
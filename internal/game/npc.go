@@ -0,0 +1,257 @@
+package game
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-mmo-server/internal/pathfinding"
+)
+
+type NPCBehavior string
+
+const (
+	BehaviorIdle   NPCBehavior = "idle"
+	BehaviorWander NPCBehavior = "wander"
+	BehaviorPatrol NPCBehavior = "patrol"
+)
+
+// NPCDefinition describes a kind of NPC as written in npcs.json
+type NPCDefinition struct {
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	Behavior     NPCBehavior `json:"behavior"`
+	Speed        float64     `json:"speed"`
+	WanderRadius float64     `json:"wander_radius"`
+	PauseSeconds float64     `json:"pause_seconds"`
+	// Level gates the loot the NPC can drop
+	Level int `json:"level"`
+	// Health of 0 makes the NPC impossible to attack
+	Health         int    `json:"health"`
+	LootTable      string `json:"loot_table"`
+	RespawnSeconds int    `json:"respawn_seconds"`
+	// Dialogue names the conversation in dialogues.json the NPC opens when
+	// talked to
+	Dialogue string `json:"dialogue"`
+	// Active of "day" or "night" keeps the NPC away the rest of the time
+	Active string `json:"active"`
+	// Script names the script in content/scripts whose on_think runs
+	// every second and whose on_death runs when the NPC is killed
+	Script string `json:"script"`
+}
+
+// applyDefaults fills optional fields left out of the content file
+func (d *NPCDefinition) applyDefaults() {
+	if d.Name == "" {
+		d.Name = d.ID
+	}
+	if d.Behavior == "" {
+		d.Behavior = BehaviorIdle
+	}
+	if d.Speed <= 0 {
+		d.Speed = 60
+	}
+	if d.WanderRadius <= 0 {
+		d.WanderRadius = 128
+	}
+	if d.PauseSeconds <= 0 {
+		d.PauseSeconds = 3
+	}
+	if d.Level <= 0 {
+		d.Level = 1
+	}
+	if d.RespawnSeconds <= 0 {
+		d.RespawnSeconds = 30
+	}
+}
+
+// NPCBrain holds the movement state of one NPC
+type NPCBrain struct {
+	Definition   *NPCDefinition
+	Home         Position
+	Waypoints    []Position
+	nextWaypoint int
+	path         []Position
+	request      *pathfinding.Request
+	waitUntil    time.Time
+	nextThink    time.Time
+	// summoned NPCs were spawned by a script and do not respawn
+	summoned bool
+}
+
+// spawnNPCs places an NPC at every npc spawn point of the map
+func (w *World) spawnNPCs() {
+	if w.Map == nil || w.Content() == nil {
+		return
+	}
+
+	for i, spawn := range w.Map.SpawnsOfType("npc") {
+		definition, ok := w.Content().NPCs[spawn.Properties["npc"]]
+		if !ok {
+			continue
+		}
+
+		brain := &NPCBrain{
+			Definition: definition,
+			Home:       spawn.Position,
+		}
+		for _, name := range strings.Split(spawn.Properties["patrol"], ",") {
+			if waypoint, ok := w.Map.Spawn(strings.TrimSpace(name)); ok {
+				brain.Waypoints = append(brain.Waypoints, waypoint.Position)
+			}
+		}
+
+		id := spawn.Name
+		if id == "" {
+			id = definition.ID
+		}
+		npc := NewEntity(npcEntityID(id, i), NPC, definition.Name, spawn.Position)
+		npc.AI = brain
+		npc.Health = definition.Health
+		npc.MaxHealth = definition.Health
+		npc.Effects = NewStatusEffects()
+		w.NPCs[npc.ID] = npc
+	}
+}
+
+func npcEntityID(name string, index int) string {
+	return "npc_" + strings.ReplaceAll(strings.ToLower(name), " ", "_") + "_" + strconv.Itoa(index)
+}
+
+// updateNPCs advances NPC behaviors; the caller holds the world lock
+func (w *World) updateNPCs(delta float64, now time.Time) []outboundMessage {
+	var messages []outboundMessage
+
+	for _, npc := range w.NPCs {
+		brain := npc.AI
+		if brain == nil {
+			continue
+		}
+		// Rooted and stunned NPCs hold still and slowed ones crawl
+		speed := npcSpeedFactor(npc)
+		if speed == 0 {
+			continue
+		}
+
+		if len(brain.path) > 0 {
+			var moved bool
+			npc.Position, brain.path, moved = followPath(npc.Position, brain.path, brain.Definition.Speed*speed*delta)
+			if moved {
+				position := npc.Position
+				messages = append(messages, outboundMessage{near: &position, message: map[string]interface{}{
+					"type": "npc_moved",
+					"id":   npc.ID,
+					"x":    npc.Position.X,
+					"y":    npc.Position.Y,
+				}})
+			}
+			if len(brain.path) == 0 {
+				brain.waitUntil = now.Add(time.Duration(brain.Definition.PauseSeconds * float64(time.Second)))
+			}
+			continue
+		}
+
+		if brain.request != nil || now.Before(brain.waitUntil) {
+			continue
+		}
+
+		if destination, ok := w.nextNPCDestination(brain); ok {
+			w.requestNPCPath(npc, destination)
+		} else {
+			brain.waitUntil = now.Add(time.Duration(brain.Definition.PauseSeconds * float64(time.Second)))
+		}
+	}
+
+	return messages
+}
+
+// nextNPCDestination picks where an NPC should walk next
+func (w *World) nextNPCDestination(brain *NPCBrain) (Position, bool) {
+	switch brain.Definition.Behavior {
+	case BehaviorWander:
+		angle := w.rng.Float64() * 2 * math.Pi
+		distance := w.rng.Float64() * brain.Definition.WanderRadius
+		destination := Position{
+			X: brain.Home.X + math.Cos(angle)*distance,
+			Y: brain.Home.Y + math.Sin(angle)*distance,
+		}
+		return destination, !w.Map.IsBlocked(destination)
+	case BehaviorPatrol:
+		if len(brain.Waypoints) == 0 {
+			return Position{}, false
+		}
+		destination := brain.Waypoints[brain.nextWaypoint]
+		brain.nextWaypoint = (brain.nextWaypoint + 1) % len(brain.Waypoints)
+		return destination, true
+	}
+	return Position{}, false
+}
+
+// requestNPCPath queues a path search for an NPC; the caller holds the world lock
+func (w *World) requestNPCPath(npc *Entity, destination Position) {
+	brain := npc.AI
+	start := pathPoint(w.Map, npc.Position)
+	goal := pathPoint(w.Map, destination)
+
+	brain.request = w.Navigator.Request(start, goal, func(points []pathfinding.Point, err error) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		brain.request = nil
+		if err != nil {
+			brain.waitUntil = time.Now().Add(time.Duration(brain.Definition.PauseSeconds * float64(time.Second)))
+			return
+		}
+		brain.path = pathPositions(w.Map, points, destination)
+	})
+}
+
+// followPath moves a position along waypoints by up to distance units
+func followPath(position Position, path []Position, distance float64) (Position, []Position, bool) {
+	moved := false
+	for distance > 0 && len(path) > 0 {
+		target := path[0]
+		dx := target.X - position.X
+		dy := target.Y - position.Y
+		remaining := math.Sqrt(dx*dx + dy*dy)
+
+		if remaining <= distance {
+			position.X, position.Y = target.X, target.Y
+			path = path[1:]
+			distance -= remaining
+			moved = true
+			continue
+		}
+
+		position.X += dx / remaining * distance
+		position.Y += dy / remaining * distance
+		moved = true
+		break
+	}
+	return position, path, moved
+}
+
+// pathPoint converts a world position to a pathfinding cell
+func pathPoint(tileMap *TileMap, position Position) pathfinding.Point {
+	x, y := tileMap.TileAt(position)
+	return pathfinding.Point{X: x, Y: y}
+}
+
+// pathPositions converts a cell path to world waypoints, skipping the
+// starting cell and ending exactly on the requested destination
+func pathPositions(tileMap *TileMap, points []pathfinding.Point, destination Position) []Position {
+	if len(points) == 0 {
+		return nil
+	}
+
+	positions := make([]Position, 0, len(points))
+	for _, point := range points[1:] {
+		positions = append(positions, tileMap.TileCenter(point.X, point.Y))
+	}
+	if len(positions) == 0 {
+		return []Position{destination}
+	}
+	positions[len(positions)-1] = destination
+	return positions
+}
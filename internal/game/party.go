@@ -0,0 +1,334 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MaxPartySize is how many players a party can hold
+const MaxPartySize = 5
+
+var (
+	ErrAlreadyInParty = errors.New("player is already in a party")
+	ErrPartyFull      = errors.New("party is full")
+	ErrNotPartyLeader = errors.New("only the party leader can do that")
+	ErrNoInvite       = errors.New("no pending party invite")
+	ErrNotInParty     = errors.New("player is not in a party")
+	ErrUnknownLoot    = errors.New("unknown loot mode")
+)
+
+// LootMode is how a party shares the loot of its kills
+type LootMode string
+
+const (
+	// LootFreeForAll lets any party member pick up any drop
+	LootFreeForAll LootMode = "free_for_all"
+	// LootRoundRobin gives each drop to the next member in turn
+	LootRoundRobin LootMode = "round_robin"
+	// LootNeedGreed has members roll need, greed or pass on good drops
+	LootNeedGreed LootMode = "need_greed"
+)
+
+// Party is a group of players adventuring together
+type Party struct {
+	ID         string
+	Leader     string
+	Members    []*Player
+	LootMode   LootMode
+	robinIndex int
+}
+
+// HasMember reports whether a player belongs to the party
+func (p *Party) HasMember(playerID string) bool {
+	for _, member := range p.Members {
+		if member.ID == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+// MemberIDs returns the IDs of the party's members
+func (p *Party) MemberIDs() []string {
+	ids := make([]string, 0, len(p.Members))
+	for _, member := range p.Members {
+		ids = append(ids, member.ID)
+	}
+	return ids
+}
+
+// partyInvite is an invitation waiting for the invited player's answer
+type partyInvite struct {
+	from *Player
+	to   *Player
+}
+
+// PartyManager keeps track of parties and pending invitations
+type PartyManager struct {
+	parties     map[string]*Party
+	playerParty map[string]*Party
+	invites     map[string]*partyInvite
+	broadcaster Broadcaster
+	nextID      int
+	mu          sync.Mutex
+}
+
+// NewPartyManager creates an empty party manager
+func NewPartyManager() *PartyManager {
+	return &PartyManager{
+		parties:     make(map[string]*Party),
+		playerParty: make(map[string]*Party),
+		invites:     make(map[string]*partyInvite),
+	}
+}
+
+// SetBroadcaster sets where party messages are delivered
+func (pm *PartyManager) SetBroadcaster(broadcaster Broadcaster) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.broadcaster = broadcaster
+}
+
+// PartyOf returns the party a player belongs to
+func (pm *PartyManager) PartyOf(playerID string) (*Party, bool) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	party, exists := pm.playerParty[playerID]
+	return party, exists
+}
+
+// Count returns the number of parties
+func (pm *PartyManager) Count() int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return len(pm.parties)
+}
+
+// Invite asks a player to join the inviter's party; players without a
+// party form a new one when the invite is accepted
+func (pm *PartyManager) Invite(from, to *Player) error {
+	pm.mu.Lock()
+	if _, inParty := pm.playerParty[to.ID]; inParty {
+		pm.mu.Unlock()
+		return ErrAlreadyInParty
+	}
+	if party, inParty := pm.playerParty[from.ID]; inParty {
+		if party.Leader != from.ID {
+			pm.mu.Unlock()
+			return ErrNotPartyLeader
+		}
+		if len(party.Members) >= MaxPartySize {
+			pm.mu.Unlock()
+			return ErrPartyFull
+		}
+	}
+	pm.invites[to.ID] = &partyInvite{from: from, to: to}
+	broadcaster := pm.broadcaster
+	pm.mu.Unlock()
+
+	if broadcaster != nil {
+		broadcaster.SendToPlayer(to.ID, map[string]interface{}{
+			"type":      "party_invite",
+			"from_id":   from.ID,
+			"from_name": from.Name,
+		})
+	}
+	return nil
+}
+
+// Accept adds a player to the party they were invited to
+func (pm *PartyManager) Accept(playerID string) (*Party, error) {
+	pm.mu.Lock()
+	invite, exists := pm.invites[playerID]
+	if !exists {
+		pm.mu.Unlock()
+		return nil, ErrNoInvite
+	}
+	delete(pm.invites, playerID)
+
+	if _, inParty := pm.playerParty[playerID]; inParty {
+		pm.mu.Unlock()
+		return nil, ErrAlreadyInParty
+	}
+
+	party, exists := pm.playerParty[invite.from.ID]
+	if !exists {
+		pm.nextID++
+		party = &Party{
+			ID:       fmt.Sprintf("party_%d", pm.nextID),
+			Leader:   invite.from.ID,
+			Members:  []*Player{invite.from},
+			LootMode: LootFreeForAll,
+		}
+		pm.parties[party.ID] = party
+		pm.playerParty[invite.from.ID] = party
+	}
+	if len(party.Members) >= MaxPartySize {
+		pm.mu.Unlock()
+		return nil, ErrPartyFull
+	}
+
+	party.Members = append(party.Members, invite.to)
+	pm.playerParty[playerID] = party
+	messages := pm.partyUpdate(party)
+	broadcaster := pm.broadcaster
+	pm.mu.Unlock()
+
+	pm.send(broadcaster, messages)
+	return party, nil
+}
+
+// Decline drops the invite a player received
+func (pm *PartyManager) Decline(playerID string) {
+	pm.mu.Lock()
+	invite, exists := pm.invites[playerID]
+	delete(pm.invites, playerID)
+	broadcaster := pm.broadcaster
+	pm.mu.Unlock()
+
+	if exists && broadcaster != nil {
+		broadcaster.SendToPlayer(invite.from.ID, map[string]interface{}{
+			"type": "party_declined",
+			"name": invite.to.Name,
+		})
+	}
+}
+
+// Leave removes a player from their party, passing leadership on and
+// disbanding parties that are down to one member
+func (pm *PartyManager) Leave(playerID string) {
+	pm.mu.Lock()
+	delete(pm.invites, playerID)
+	party, exists := pm.playerParty[playerID]
+	if !exists {
+		pm.mu.Unlock()
+		return
+	}
+
+	delete(pm.playerParty, playerID)
+	for i, member := range party.Members {
+		if member.ID == playerID {
+			party.Members = append(party.Members[:i], party.Members[i+1:]...)
+			break
+		}
+	}
+
+	messages := []outboundMessage{{playerID: playerID, message: map[string]interface{}{"type": "party_left"}}}
+	if len(party.Members) <= 1 {
+		for _, member := range party.Members {
+			delete(pm.playerParty, member.ID)
+			messages = append(messages, outboundMessage{playerID: member.ID, message: map[string]interface{}{"type": "party_left"}})
+		}
+		delete(pm.parties, party.ID)
+	} else {
+		if party.Leader == playerID {
+			party.Leader = party.Members[0].ID
+		}
+		messages = append(messages, pm.partyUpdate(party)...)
+	}
+	broadcaster := pm.broadcaster
+	pm.mu.Unlock()
+
+	pm.send(broadcaster, messages)
+}
+
+// SetLootMode changes how the leader's party shares loot
+func (pm *PartyManager) SetLootMode(playerID string, mode LootMode) error {
+	switch mode {
+	case LootFreeForAll, LootRoundRobin, LootNeedGreed:
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownLoot, mode)
+	}
+
+	pm.mu.Lock()
+	party, exists := pm.playerParty[playerID]
+	if !exists {
+		pm.mu.Unlock()
+		return ErrNotInParty
+	}
+	if party.Leader != playerID {
+		pm.mu.Unlock()
+		return ErrNotPartyLeader
+	}
+	party.LootMode = mode
+	messages := pm.partyUpdate(party)
+	broadcaster := pm.broadcaster
+	pm.mu.Unlock()
+
+	pm.send(broadcaster, messages)
+	return nil
+}
+
+// LootGroup is a snapshot of a party as needed to share out loot
+type LootGroup struct {
+	PartyID   string
+	Mode      LootMode
+	MemberIDs []string
+}
+
+// LootGroupOf returns the loot settings of a player's party
+func (pm *PartyManager) LootGroupOf(playerID string) (LootGroup, bool) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	party, exists := pm.playerParty[playerID]
+	if !exists {
+		return LootGroup{}, false
+	}
+	return LootGroup{PartyID: party.ID, Mode: party.LootMode, MemberIDs: party.MemberIDs()}, true
+}
+
+// NextLooter returns whose turn it is to receive a round robin drop among
+// the eligible members of a party
+func (pm *PartyManager) NextLooter(partyID string, eligible map[string]bool) (string, bool) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	party, exists := pm.parties[partyID]
+	if !exists || len(party.Members) == 0 {
+		return "", false
+	}
+
+	for i := 0; i < len(party.Members); i++ {
+		member := party.Members[(party.robinIndex+i)%len(party.Members)]
+		if eligible[member.ID] {
+			party.robinIndex = (party.robinIndex + i + 1) % len(party.Members)
+			return member.ID, true
+		}
+	}
+	return "", false
+}
+
+// partyUpdate builds the roster message for every member; the caller
+// holds the party lock
+func (pm *PartyManager) partyUpdate(party *Party) []outboundMessage {
+	members := make([]map[string]interface{}, 0, len(party.Members))
+	for _, member := range party.Members {
+		members = append(members, map[string]interface{}{
+			"id":   member.ID,
+			"name": member.Name,
+		})
+	}
+
+	messages := make([]outboundMessage, 0, len(party.Members))
+	for _, member := range party.Members {
+		messages = append(messages, outboundMessage{playerID: member.ID, message: map[string]interface{}{
+			"type":      "party_update",
+			"party_id":  party.ID,
+			"leader":    party.Leader,
+			"members":   members,
+			"loot_mode": party.LootMode,
+		}})
+	}
+	return messages
+}
+
+func (pm *PartyManager) send(broadcaster Broadcaster, messages []outboundMessage) {
+	if broadcaster == nil {
+		return
+	}
+	for _, outbound := range messages {
+		broadcaster.SendToPlayer(outbound.playerID, outbound.message)
+	}
+}
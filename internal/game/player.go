@@ -30,7 +30,34 @@ func NewPlayerStamina() *PlayerStamina {
 func (ps *PlayerStamina) Update(isRunning bool) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
+	ps.update(isRunning)
+}
+
+// Spend takes stamina for an action if there is enough of it
+func (ps *PlayerStamina) Spend(amount float64) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.update(ps.IsRunning)
+	if ps.Current < amount {
+		return false
+	}
+	ps.Current -= amount
+	return true
+}
+
+// Available returns the stamina there is right now
+func (ps *PlayerStamina) Available() float64 {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
 
+	ps.update(ps.IsRunning)
+	return ps.Current
+}
+
+// update applies what happened to stamina since the last update; the
+// caller holds the lock
+func (ps *PlayerStamina) update(isRunning bool) {
 	now := time.Now()
 	deltaTime := now.Sub(ps.LastUpdate).Seconds()
 	ps.LastUpdate = now
@@ -75,12 +102,28 @@ func (ps *PlayerStamina) GetStamina() (current, max float64, canSprint bool) {
 }
 
 type Player struct {
-	ID       string
-	Name     string
-	Position Position
-	Stamina  *PlayerStamina
-	Conn     interface{}
-	mu       sync.Mutex
+	ID           string
+	Name         string
+	Position     Position
+	Stamina      *PlayerStamina
+	Inventory    *Inventory
+	Progress     *Progress
+	Wallet       *Wallet
+	Quests       *QuestLog
+	Flags        *CharacterFlags
+	Professions  *Professions
+	Vitals       *Vitals
+	Cooldowns    *Cooldowns
+	Effects      *StatusEffects
+	Life         *Life
+	PvP          *PvPFlag
+	Statistics   *Statistics
+	Achievements *Achievements
+	// Guest is set for players who joined without logging in; nothing
+	// of theirs is loaded or saved
+	Guest bool
+	Conn  interface{}
+	mu    sync.Mutex
 }
 
 // NewPlayer creates a new player with specified ID and name
@@ -93,7 +136,20 @@ func NewPlayer(id, name string) *Player {
 			Y: 0,
 			Z: 0,
 		},
-		Stamina: NewPlayerStamina(),
+		Stamina:      NewPlayerStamina(),
+		Inventory:    NewInventory(InventorySize),
+		Progress:     NewProgress(),
+		Wallet:       NewWallet(),
+		Quests:       NewQuestLog(),
+		Flags:        NewCharacterFlags(),
+		Professions:  NewProfessions(),
+		Vitals:       NewVitals(),
+		Cooldowns:    NewCooldowns(),
+		Effects:      NewStatusEffects(),
+		Life:         NewLife(),
+		PvP:          NewPvPFlag(),
+		Statistics:   NewStatistics(),
+		Achievements: NewAchievements(),
 	}
 }
 
@@ -106,6 +162,20 @@ func (p *Player) Move(x, y, z float64) {
 	p.Position.Z += z
 }
 
+// GetPosition returns the player's current position
+func (p *Player) GetPosition() Position {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Position
+}
+
+// SetPosition places the player at an absolute position
+func (p *Player) SetPosition(position Position) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Position = position
+}
+
 // UpdateSprint processes sprint status and stamina
 func (p *Player) UpdateSprint(isSprinting bool) {
 	if p.Stamina != nil {
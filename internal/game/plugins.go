@@ -0,0 +1,347 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownPlugin     = errors.New("unknown plugin")
+	ErrExtensionConflict = errors.New("already registered")
+)
+
+// builtinInteractions are the interaction types plugins cannot replace
+var builtinInteractions = map[InteractionType]bool{
+	ViewStats:   true,
+	Trade:       true,
+	Challenge:   true,
+	Attack:      true,
+	SendMessage: true,
+	AddFriend:   true,
+	Block:       true,
+	PartyInvite: true,
+}
+
+// Plugin is a game extension compiled into the server. A plugin package
+// registers its plugin from an init function with RegisterPlugin; the
+// plugins list of the server config decides which ones are switched on
+type Plugin interface {
+	// Name is what the config calls the plugin
+	Name() string
+	// Setup adds the plugin's extensions to the game through the API
+	Setup(api *PluginAPI) error
+}
+
+// MessageHandler handles a websocket message type added by a plugin. An
+// error is sent back to the player as a "<type>_failed" message
+type MessageHandler func(player *Player, world *World, data map[string]interface{}) error
+
+// ChatCommand runs a chat command added by a plugin, such as /roll, with
+// the words typed after it. An error is sent back to the player
+type ChatCommand func(player *Player, world *World, args []string) error
+
+// TickSystem runs on every tick of every zone and instance, after the
+// zone's own update and with the zone unlocked; delta is in seconds
+type TickSystem func(world *World, delta float64)
+
+// PluginInteraction is an interaction between players added by a plugin
+type PluginInteraction struct {
+	Type  InteractionType
+	Label string
+	Icon  string
+	// Enabled reports whether one player may interact with another this
+	// way at the moment; nil always allows it
+	Enabled func(from, to *Player) bool
+	Handle  func(world *World, from, to *Player, data interface{}) *InteractionResult
+}
+
+// PluginRoute is an HTTP route added by a plugin
+type PluginRoute struct {
+	Pattern string
+	Handler http.HandlerFunc
+}
+
+// registeredPlugins are the plugins compiled into the server by name
+var registeredPlugins = struct {
+	plugins map[string]Plugin
+	mu      sync.Mutex
+}{plugins: make(map[string]Plugin)}
+
+// RegisterPlugin makes a compiled-in plugin available to the config. It
+// is meant for init functions and panics on a duplicate name
+func RegisterPlugin(plugin Plugin) {
+	registeredPlugins.mu.Lock()
+	defer registeredPlugins.mu.Unlock()
+
+	if _, exists := registeredPlugins.plugins[plugin.Name()]; exists {
+		panic(fmt.Sprintf("plugin %q registered twice", plugin.Name()))
+	}
+	registeredPlugins.plugins[plugin.Name()] = plugin
+}
+
+// RegisteredPlugins returns the names of the compiled-in plugins
+func RegisteredPlugins() []string {
+	registeredPlugins.mu.Lock()
+	defer registeredPlugins.mu.Unlock()
+
+	names := make([]string, 0, len(registeredPlugins.plugins))
+	for name := range registeredPlugins.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EnablePlugins sets up the named plugins, in order, before the game
+// loops start
+func (zm *ZoneManager) EnablePlugins(names []string) error {
+	for _, name := range names {
+		registeredPlugins.mu.Lock()
+		plugin, exists := registeredPlugins.plugins[name]
+		registeredPlugins.mu.Unlock()
+		if !exists {
+			return fmt.Errorf("%w %q (compiled in: %s)", ErrUnknownPlugin, name, strings.Join(RegisteredPlugins(), ", "))
+		}
+		if err := plugin.Setup(&PluginAPI{name: name, zones: zm}); err != nil {
+			return fmt.Errorf("setting up plugin %q: %w", name, err)
+		}
+		zm.Extensions.enabled(name)
+	}
+	return nil
+}
+
+// PluginAPI is what a plugin's Setup extends the game through
+type PluginAPI struct {
+	name  string
+	zones *ZoneManager
+}
+
+// Name returns the name of the plugin being set up
+func (api *PluginAPI) Name() string {
+	return api.name
+}
+
+// Zones returns the zone manager, for reaching zones, players and the
+// game's services
+func (api *PluginAPI) Zones() *ZoneManager {
+	return api.zones
+}
+
+// Events returns the game's event bus
+func (api *PluginAPI) Events() *EventBus {
+	return api.zones.Events
+}
+
+// HandleMessage handles a new websocket message type. Messages the
+// server handles itself never reach plugins
+func (api *PluginAPI) HandleMessage(messageType string, handler MessageHandler) error {
+	return api.zones.Extensions.addMessage(messageType, handler)
+}
+
+// AddInteraction adds an interaction between players, offered in the
+// interaction menu after the built-in ones
+func (api *PluginAPI) AddInteraction(interaction PluginInteraction) error {
+	if builtinInteractions[interaction.Type] {
+		return fmt.Errorf("interaction %q is built in", interaction.Type)
+	}
+	if interaction.Handle == nil {
+		return fmt.Errorf("interaction %q has no handler", interaction.Type)
+	}
+	return api.zones.Extensions.addInteraction(interaction)
+}
+
+// AddTickSystem runs a system on every zone tick
+func (api *PluginAPI) AddTickSystem(system TickSystem) {
+	api.zones.Extensions.addTickSystem(system)
+}
+
+// AddChatCommand adds a chat command, typed as /name in chat
+func (api *PluginAPI) AddChatCommand(name string, command ChatCommand) error {
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("invalid chat command name %q", name)
+	}
+	return api.zones.Extensions.addCommand(name, command)
+}
+
+// HandleHTTP adds an HTTP route, served below /api/plugins/<name>/
+func (api *PluginAPI) HandleHTTP(path string, handler http.HandlerFunc) error {
+	pattern := "/api/plugins/" + api.name + "/" + strings.TrimPrefix(path, "/")
+	return api.zones.Extensions.addRoute(PluginRoute{Pattern: pattern, Handler: handler})
+}
+
+// Extensions hold what the enabled plugins added to the game
+type Extensions struct {
+	plugins      []string
+	messages     map[string]MessageHandler
+	interactions []PluginInteraction
+	ticks        []TickSystem
+	commands     map[string]ChatCommand
+	routes       []PluginRoute
+	mu           sync.RWMutex
+}
+
+// NewExtensions creates an empty set of extensions
+func NewExtensions() *Extensions {
+	return &Extensions{
+		messages: make(map[string]MessageHandler),
+		commands: make(map[string]ChatCommand),
+	}
+}
+
+// enabled records a plugin as set up
+func (e *Extensions) enabled(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.plugins = append(e.plugins, name)
+}
+
+// Plugins returns the names of the enabled plugins
+func (e *Extensions) Plugins() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]string(nil), e.plugins...)
+}
+
+func (e *Extensions) addMessage(messageType string, handler MessageHandler) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, exists := e.messages[messageType]; exists {
+		return fmt.Errorf("message type %q %w", messageType, ErrExtensionConflict)
+	}
+	e.messages[messageType] = handler
+	return nil
+}
+
+func (e *Extensions) addInteraction(interaction PluginInteraction) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, existing := range e.interactions {
+		if existing.Type == interaction.Type {
+			return fmt.Errorf("interaction %q %w", interaction.Type, ErrExtensionConflict)
+		}
+	}
+	e.interactions = append(e.interactions, interaction)
+	return nil
+}
+
+func (e *Extensions) addTickSystem(system TickSystem) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ticks = append(e.ticks, system)
+}
+
+func (e *Extensions) addCommand(name string, command ChatCommand) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, exists := e.commands[name]; exists {
+		return fmt.Errorf("chat command /%s %w", name, ErrExtensionConflict)
+	}
+	e.commands[name] = command
+	return nil
+}
+
+func (e *Extensions) addRoute(route PluginRoute) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, existing := range e.routes {
+		if existing.Pattern == route.Pattern {
+			return fmt.Errorf("route %s %w", route.Pattern, ErrExtensionConflict)
+		}
+	}
+	e.routes = append(e.routes, route)
+	return nil
+}
+
+// Routes returns the HTTP routes plugins added
+func (e *Extensions) Routes() []PluginRoute {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]PluginRoute(nil), e.routes...)
+}
+
+// HandleMessage passes a websocket message the server does not know to
+// the plugin handling its type, reporting false when none does
+func (e *Extensions) HandleMessage(messageType string, player *Player, world *World, data map[string]interface{}) (bool, error) {
+	e.mu.RLock()
+	handler, exists := e.messages[messageType]
+	e.mu.RUnlock()
+	if !exists {
+		return false, nil
+	}
+	return true, handler(player, world, data)
+}
+
+// interactionOptions returns the menu options of the plugin interactions
+// between two players
+func (e *Extensions) interactionOptions(from, to *Player) []InteractionOption {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	options := make([]InteractionOption, 0, len(e.interactions))
+	for _, interaction := range e.interactions {
+		options = append(options, InteractionOption{
+			Type:    string(interaction.Type),
+			Label:   interaction.Label,
+			Icon:    interaction.Icon,
+			Enabled: interaction.Enabled == nil || interaction.Enabled(from, to),
+		})
+	}
+	return options
+}
+
+// interaction returns the plugin interaction of a type, if any
+func (e *Extensions) interaction(interactionType InteractionType) (PluginInteraction, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, interaction := range e.interactions {
+		if interaction.Type == interactionType {
+			return interaction, true
+		}
+	}
+	return PluginInteraction{}, false
+}
+
+// command returns the chat command typed in a chat message, if the
+// message is one
+func (e *Extensions) command(text string) (ChatCommand, []string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return nil, nil, false
+	}
+	words := strings.Fields(text[1:])
+	if len(words) == 0 {
+		return nil, nil, false
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	command, exists := e.commands[strings.ToLower(words[0])]
+	return command, words[1:], exists
+}
+
+// tick runs every tick system on a zone
+func (e *Extensions) tick(world *World, delta float64) {
+	e.mu.RLock()
+	systems := e.ticks
+	e.mu.RUnlock()
+
+	for _, system := range systems {
+		runTickSystem(system, world, delta)
+	}
+}
+
+// runTickSystem runs a tick system, keeping a panicking one from
+// stopping the zone's loop
+func runTickSystem(system TickSystem, world *World, delta float64) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Tick system panicked in zone %s: %v", world.ID, r)
+		}
+	}()
+	system(world, delta)
+}
@@ -0,0 +1,126 @@
+package game
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	// MaxProfessionLevel is the highest skill a profession can reach
+	MaxProfessionLevel = 50
+	// ProfessionTrivialGap is how far a character's skill may outgrow a
+	// task's requirement before the task stops teaching them anything
+	ProfessionTrivialGap = 10
+)
+
+// ExperienceToSkill returns the experience a profession needs to advance
+// from a skill level to the next
+func ExperienceToSkill(level int) int {
+	return 20 * level
+}
+
+// ProfessionSkill is how far a character got in one profession
+type ProfessionSkill struct {
+	Profession string
+	Level      int
+	Experience int
+}
+
+// Professions are a character's gathering and crafting skills; a
+// profession starts at level 1 the first time it is used
+type Professions struct {
+	skills map[string]*ProfessionSkill
+	mu     sync.Mutex
+}
+
+// NewProfessions creates a character without profession skills
+func NewProfessions() *Professions {
+	return &Professions{skills: make(map[string]*ProfessionSkill)}
+}
+
+// Level returns the character's skill in a profession
+func (p *Professions) Level(profession string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if skill, exists := p.skills[profession]; exists {
+		return skill.Level
+	}
+	return 1
+}
+
+// Gain grants profession experience for a task with the given skill
+// requirement and returns how many levels were gained; tasks the
+// character has outgrown by ProfessionTrivialGap grant nothing
+func (p *Professions) Gain(profession string, amount, requirement int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	skill, exists := p.skills[profession]
+	if !exists {
+		skill = &ProfessionSkill{Profession: profession, Level: 1}
+		p.skills[profession] = skill
+	}
+	if skill.Level >= MaxProfessionLevel || skill.Level >= requirement+ProfessionTrivialGap {
+		return 0
+	}
+
+	gained := 0
+	skill.Experience += amount
+	for skill.Level < MaxProfessionLevel && skill.Experience >= ExperienceToSkill(skill.Level) {
+		skill.Experience -= ExperienceToSkill(skill.Level)
+		skill.Level++
+		gained++
+	}
+	if skill.Level >= MaxProfessionLevel {
+		skill.Experience = 0
+	}
+	return gained
+}
+
+// Restore replaces the skills with saved ones
+func (p *Professions) Restore(skills []ProfessionSkill) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.skills = make(map[string]*ProfessionSkill, len(skills))
+	for _, skill := range skills {
+		restored := skill
+		restored.Level = minInt(maxInt(restored.Level, 1), MaxProfessionLevel)
+		p.skills[skill.Profession] = &restored
+	}
+}
+
+// Snapshot returns copies of the skills in profession order
+func (p *Professions) Snapshot() []ProfessionSkill {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	skills := make([]ProfessionSkill, 0, len(p.skills))
+	for _, skill := range p.skills {
+		skills = append(skills, *skill)
+	}
+	sort.Slice(skills, func(i, j int) bool {
+		return skills[i].Profession < skills[j].Profession
+	})
+	return skills
+}
+
+// Message returns the professions_update message describing the skills
+func (p *Professions) Message() map[string]interface{} {
+	skills := p.Snapshot()
+	entries := make([]map[string]interface{}, 0, len(skills))
+	for _, skill := range skills {
+		entries = append(entries, map[string]interface{}{
+			"profession":          skill.Profession,
+			"level":               skill.Level,
+			"experience":          skill.Experience,
+			"experience_to_level": ExperienceToSkill(skill.Level),
+		})
+	}
+
+	return map[string]interface{}{
+		"type":        "professions_update",
+		"professions": entries,
+	}
+}
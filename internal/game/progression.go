@@ -0,0 +1,85 @@
+package game
+
+import "sync"
+
+// MaxLevel is the highest level a character can reach
+const MaxLevel = 20
+
+// ExperienceToLevel returns the experience needed to advance from a level
+// to the next
+func ExperienceToLevel(level int) int {
+	return 100 * level
+}
+
+// Progress is a character's level and experience
+type Progress struct {
+	Level      int
+	Experience int
+	mu         sync.Mutex
+}
+
+// NewProgress creates the progress of a new level 1 character
+func NewProgress() *Progress {
+	return &Progress{Level: 1}
+}
+
+// Set replaces the progress with saved values
+func (p *Progress) Set(level, experience int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if level < 1 {
+		level = 1
+	}
+	p.Level = level
+	p.Experience = experience
+}
+
+// Snapshot returns the current level and experience
+func (p *Progress) Snapshot() (level, experience int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Level, p.Experience
+}
+
+// GetLevel returns the character's level
+func (p *Progress) GetLevel() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Level
+}
+
+// AddExperience grants experience, levelling up as often as it allows,
+// and returns how many levels were gained; experience stops adding up
+// at MaxLevel
+func (p *Progress) AddExperience(amount int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Level >= MaxLevel {
+		return 0
+	}
+
+	gained := 0
+	p.Experience += amount
+	for p.Level < MaxLevel && p.Experience >= ExperienceToLevel(p.Level) {
+		p.Experience -= ExperienceToLevel(p.Level)
+		p.Level++
+		gained++
+	}
+	if p.Level >= MaxLevel {
+		p.Experience = 0
+	}
+	return gained
+}
+
+// Message returns the progress_update message describing the progress
+func (p *Progress) Message() map[string]interface{} {
+	level, experience := p.Snapshot()
+	return map[string]interface{}{
+		"type":                "progress_update",
+		"level":               level,
+		"experience":          experience,
+		"experience_to_level": ExperienceToLevel(level),
+	}
+}
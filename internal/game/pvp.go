@@ -0,0 +1,625 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// pvpFlagDuration is how long attacking another player keeps the
+	// attacker flagged for PvP
+	pvpFlagDuration = time.Minute
+	// duelChallengeTimeout is how long a duel challenge waits for an answer
+	duelChallengeTimeout = 30 * time.Second
+	// duelRange is how far from where a duel began its fighters may stray
+	// before the one who wandered off forfeits
+	duelRange = 480.0
+)
+
+// PvPRule is what kind of fighting between players an area allows
+type PvPRule string
+
+const (
+	// PvPSanctuary areas allow no fighting between players at all
+	PvPSanctuary PvPRule = "sanctuary"
+	// PvPDuel areas only allow fighting an accepted duel opponent
+	PvPDuel PvPRule = "duel"
+	// PvPFlagged areas allow attacking players flagged for PvP, either
+	// by choice or because they attacked someone recently
+	PvPFlagged PvPRule = "flagged"
+	// PvPFreeForAll areas allow attacking anyone
+	PvPFreeForAll PvPRule = "ffa"
+)
+
+// pvpStrictness orders the rules from the most to the least permissive;
+// where areas overlap the strictest one applies
+var pvpStrictness = map[PvPRule]int{
+	PvPFreeForAll: 0,
+	PvPFlagged:    1,
+	PvPDuel:       2,
+	PvPSanctuary:  3,
+}
+
+// Ways a duel can end
+const (
+	DuelDefeated = "defeated"
+	DuelFled     = "fled"
+	DuelLeft     = "left"
+	DuelDied     = "died"
+)
+
+var (
+	ErrSanctuary       = errors.New("no fighting is allowed in a sanctuary")
+	ErrDuelOnly        = errors.New("only duel opponents may fight here")
+	ErrNotFlagged      = errors.New("that player is not flagged for PvP")
+	ErrAlreadyDueling  = errors.New("already in a duel")
+	ErrNoDuelChallenge = errors.New("no duel challenge is pending")
+)
+
+// validPvPRule reports whether a content file names a known rule
+func validPvPRule(rule PvPRule) bool {
+	_, known := pvpStrictness[rule]
+	return known
+}
+
+// checkPvPRegions checks the pvp property of every region of a map
+func checkPvPRegions(tileMap *TileMap) error {
+	for _, region := range tileMap.Regions {
+		if rule, set := region.Properties["pvp"]; set && !validPvPRule(PvPRule(rule)) {
+			return fmt.Errorf("region %q has unknown pvp rule %q", region.Name, rule)
+		}
+	}
+	return nil
+}
+
+// PvPFlag tracks whether a player chose to be open to attacks from other
+// players and how long their last attack keeps them open regardless
+type PvPFlag struct {
+	enabled   bool
+	until     time.Time
+	announced bool
+	mu        sync.Mutex
+}
+
+// NewPvPFlag creates the flag of a player who has not opted in
+func NewPvPFlag() *PvPFlag {
+	return &PvPFlag{}
+}
+
+// Enabled reports whether the player opted in to PvP
+func (f *PvPFlag) Enabled() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enabled
+}
+
+// SetEnabled opts the player in to or out of PvP; a recent attack keeps
+// them flagged until its timer runs out
+func (f *PvPFlag) SetEnabled(enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.enabled = enabled
+}
+
+// Flagged reports whether other players may attack the player where the
+// flag rule applies
+func (f *PvPFlag) Flagged(now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enabled || now.Before(f.until)
+}
+
+// Remaining returns how long the player's last attack keeps them flagged
+func (f *PvPFlag) Remaining(now time.Time) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now.After(f.until) {
+		return 0
+	}
+	return f.until.Sub(now)
+}
+
+// engage restarts the flag timer after the player attacked someone
+func (f *PvPFlag) engage(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.until = now.Add(pvpFlagDuration)
+}
+
+// changed reports whether the player became flagged or unflagged since
+// this was last asked
+func (f *PvPFlag) changed(now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	flagged := f.enabled || now.Before(f.until)
+	if flagged == f.announced {
+		return false
+	}
+	f.announced = flagged
+	return true
+}
+
+// duel is two players who agreed to fight each other until one of them
+// is beaten, without either of them dying
+type duel struct {
+	players [2]string
+	center  Position
+}
+
+// opponent returns the other fighter of the duel
+func (d *duel) opponent(playerID string) string {
+	if d.players[0] == playerID {
+		return d.players[1]
+	}
+	return d.players[0]
+}
+
+// duelChallenge is a duel one player offered another
+type duelChallenge struct {
+	challengerID string
+	expires      time.Time
+}
+
+// pvpRuleAt returns the rule that applies at a position and the region
+// it comes from: the strictest rule of the regions there, or the zone's
+// own rule outside of them. The caller holds the world lock
+func (w *World) pvpRuleAt(position Position) (PvPRule, string) {
+	rule, source := w.PvP, ""
+	if w.Map == nil {
+		return rule, source
+	}
+	found := false
+	for _, region := range w.Map.RegionsAt(position) {
+		regionRule, set := region.Properties["pvp"]
+		if !set {
+			continue
+		}
+		if !found || pvpStrictness[PvPRule(regionRule)] > pvpStrictness[rule] {
+			rule, source, found = PvPRule(regionRule), region.Name, true
+		}
+	}
+	return rule, source
+}
+
+// duelBetween returns the duel two players are fighting against each
+// other, if any; the caller holds the world lock
+func (w *World) duelBetween(playerID, otherID string) *duel {
+	if d := w.duels[playerID]; d != nil && d.opponent(playerID) == otherID {
+		return d
+	}
+	return nil
+}
+
+// canAttackPlayer checks the rules of where both players stand against
+// one attacking the other; the caller holds the world lock
+func (w *World) canAttackPlayer(attacker, target *Player, now time.Time) error {
+	if attacker == target || !target.Life.Alive() {
+		return ErrInvalidTarget
+	}
+	rule, _ := w.pvpRuleAt(attacker.GetPosition())
+	if targetRule, _ := w.pvpRuleAt(target.GetPosition()); pvpStrictness[targetRule] > pvpStrictness[rule] {
+		rule = targetRule
+	}
+
+	dueling := w.duelBetween(attacker.ID, target.ID) != nil
+	switch rule {
+	case PvPSanctuary:
+		return ErrSanctuary
+	case PvPDuel:
+		if !dueling {
+			return ErrDuelOnly
+		}
+	case PvPFlagged:
+		if !dueling && !target.PvP.Flagged(now) {
+			return ErrNotFlagged
+		}
+	}
+	return nil
+}
+
+// CanAttackPlayer checks whether one player may attack another where
+// they stand
+func (w *World) CanAttackPlayer(attackerID, targetID string) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	attacker, exists := w.Players[attackerID]
+	if !exists {
+		return errors.New("player not found")
+	}
+	target, exists := w.Players[targetID]
+	if !exists {
+		return ErrTargetNotFound
+	}
+	return w.canAttackPlayer(attacker, target, time.Now())
+}
+
+// flagAttacker restarts the PvP flag timer of a player who attacked
+// another outside of a duel between them; the caller holds the world lock
+func (w *World) flagAttacker(attacker, target *Player, now time.Time) {
+	if w.duelBetween(attacker.ID, target.ID) == nil {
+		attacker.PvP.engage(now)
+	}
+}
+
+// strikePlayer deals damage from one player to another. A blow that would
+// beat a duel opponent leaves them on their last point of health and
+// ends the duel instead; the caller holds the world lock
+func (w *World) strikePlayer(attacker, target *Player, damage int) []outboundMessage {
+	if d := w.duelBetween(attacker.ID, target.ID); d != nil {
+		if health, _ := target.Vitals.Health(); damage >= health {
+			messages := w.damagePlayer(target, health-1, attacker.ID)
+			return append(messages, w.endDuel(d, attacker.ID, DuelDefeated)...)
+		}
+	}
+	return w.damagePlayer(target, damage, attacker.ID)
+}
+
+// AttackPlayer makes a player hit another where the PvP rules allow it
+func (w *World) AttackPlayer(playerID, targetID string) error {
+	now := time.Now()
+
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	target, exists := w.Players[targetID]
+	if !exists {
+		w.mu.Unlock()
+		return ErrTargetNotFound
+	}
+	if !player.Life.Alive() {
+		w.mu.Unlock()
+		return ErrDead
+	}
+	if err := w.canAttackPlayer(player, target, now); err != nil {
+		w.mu.Unlock()
+		return err
+	}
+	if distance(player.GetPosition(), target.GetPosition()) > AttackRange {
+		w.mu.Unlock()
+		return ErrTargetTooFar
+	}
+	if player.Effects.Has(ControlStun) {
+		w.mu.Unlock()
+		return ErrStunned
+	}
+	if now.Sub(w.lastAttack[playerID]) < AttackCooldown {
+		w.mu.Unlock()
+		return ErrAttackCooldown
+	}
+	w.lastAttack[playerID] = now
+
+	damage := attackDamageMin + w.rng.Intn(attackDamageMax-attackDamageMin+1)
+	damage = scaleDamage(damage, player.Stats(), target.Stats())
+	w.flagAttacker(player, target, now)
+	messages := w.strikePlayer(player, target, damage)
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	return nil
+}
+
+// SetPvPFlag opts a player in to or out of PvP
+func (w *World) SetPvPFlag(playerID string, enabled bool) error {
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	player.PvP.SetEnabled(enabled)
+	messages := w.pvpFlagChanged(player, time.Now())
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	return nil
+}
+
+// pvpFlagChanged tells a player and those around them when their flag
+// came up or went down; the caller holds the world lock
+func (w *World) pvpFlagChanged(player *Player, now time.Time) []outboundMessage {
+	if !player.PvP.changed(now) {
+		return nil
+	}
+	position := player.GetPosition()
+	return []outboundMessage{
+		{near: &position, message: map[string]interface{}{
+			"type":    "player_pvp",
+			"id":      player.ID,
+			"flagged": player.PvP.Flagged(now),
+		}},
+		{playerID: player.ID, message: w.pvpStatus(player, now)},
+	}
+}
+
+// pvpStatus returns the pvp_status message describing the rule where a
+// player stands, their flag and their duel; the caller holds the world lock
+func (w *World) pvpStatus(player *Player, now time.Time) map[string]interface{} {
+	rule, region := w.pvpRuleAt(player.GetPosition())
+	message := map[string]interface{}{
+		"type":         "pvp_status",
+		"rule":         rule,
+		"region":       region,
+		"enabled":      player.PvP.Enabled(),
+		"flagged":      player.PvP.Flagged(now),
+		"flag_seconds": player.PvP.Remaining(now).Seconds(),
+	}
+	if d := w.duels[player.ID]; d != nil {
+		message["duel_opponent"] = d.opponent(player.ID)
+	}
+	return message
+}
+
+// canDuel checks that two players could start a duel where they stand;
+// the caller holds the world lock
+func (w *World) canDuel(challenger, target *Player) error {
+	if challenger == target || !challenger.Life.Alive() || !target.Life.Alive() {
+		return ErrInvalidTarget
+	}
+	if rule, _ := w.pvpRuleAt(challenger.GetPosition()); rule == PvPSanctuary {
+		return ErrSanctuary
+	}
+	if rule, _ := w.pvpRuleAt(target.GetPosition()); rule == PvPSanctuary {
+		return ErrSanctuary
+	}
+	if w.duels[challenger.ID] != nil || w.duels[target.ID] != nil {
+		return ErrAlreadyDueling
+	}
+	return nil
+}
+
+// CanChallenge checks whether one player could challenge another to a duel
+func (w *World) CanChallenge(challengerID, targetID string) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	challenger, exists := w.Players[challengerID]
+	if !exists {
+		return errors.New("player not found")
+	}
+	target, exists := w.Players[targetID]
+	if !exists {
+		return ErrTargetNotFound
+	}
+	return w.canDuel(challenger, target)
+}
+
+// ChallengeToDuel offers another player a duel, replacing any challenge
+// they had not answered yet
+func (w *World) ChallengeToDuel(challengerID, targetID string) error {
+	now := time.Now()
+
+	w.mu.Lock()
+	challenger, exists := w.Players[challengerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	target, exists := w.Players[targetID]
+	if !exists {
+		w.mu.Unlock()
+		return ErrTargetNotFound
+	}
+	if err := w.canDuel(challenger, target); err != nil {
+		w.mu.Unlock()
+		return err
+	}
+	w.duelChallenges[targetID] = &duelChallenge{challengerID: challengerID, expires: now.Add(duelChallengeTimeout)}
+	w.mu.Unlock()
+
+	w.deliver([]outboundMessage{{playerID: targetID, message: map[string]interface{}{
+		"type":            "duel_challenge",
+		"challenger_id":   challenger.ID,
+		"challenger_name": challenger.Name,
+		"seconds":         duelChallengeTimeout.Seconds(),
+	}}})
+	return nil
+}
+
+// AcceptDuel starts the duel a player was challenged to
+func (w *World) AcceptDuel(playerID string) error {
+	now := time.Now()
+
+	w.mu.Lock()
+	challenge := w.duelChallenges[playerID]
+	delete(w.duelChallenges, playerID)
+	if challenge == nil || now.After(challenge.expires) {
+		w.mu.Unlock()
+		return ErrNoDuelChallenge
+	}
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	challenger, exists := w.Players[challenge.challengerID]
+	if !exists {
+		w.mu.Unlock()
+		return ErrNoDuelChallenge
+	}
+	if err := w.canDuel(challenger, player); err != nil {
+		w.mu.Unlock()
+		return err
+	}
+
+	from, to := challenger.GetPosition(), player.GetPosition()
+	d := &duel{
+		players: [2]string{challenger.ID, player.ID},
+		center:  Position{X: (from.X + to.X) / 2, Y: (from.Y + to.Y) / 2},
+	}
+	w.duels[challenger.ID] = d
+	w.duels[player.ID] = d
+
+	center := d.center
+	messages := []outboundMessage{
+		{near: &center, message: map[string]interface{}{
+			"type":    "duel_started",
+			"players": d.players[:],
+			"x":       center.X,
+			"y":       center.Y,
+			"range":   duelRange,
+		}},
+		{playerID: challenger.ID, message: w.pvpStatus(challenger, now)},
+		{playerID: player.ID, message: w.pvpStatus(player, now)},
+	}
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	return nil
+}
+
+// DeclineDuel turns down the duel a player was challenged to
+func (w *World) DeclineDuel(playerID string) error {
+	w.mu.Lock()
+	challenge := w.duelChallenges[playerID]
+	delete(w.duelChallenges, playerID)
+	w.mu.Unlock()
+
+	if challenge == nil {
+		return ErrNoDuelChallenge
+	}
+	w.deliver([]outboundMessage{{playerID: challenge.challengerID, message: map[string]interface{}{
+		"type":      "duel_declined",
+		"target_id": playerID,
+	}}})
+	return nil
+}
+
+// endDuel ends a duel won by one of its fighters, taking away the
+// debuffs they put on each other; the caller holds the world lock
+func (w *World) endDuel(d *duel, winnerID, reason string) []outboundMessage {
+	now := time.Now()
+	loserID := d.opponent(winnerID)
+	delete(w.duels, d.players[0])
+	delete(w.duels, d.players[1])
+
+	center := d.center
+	messages := []outboundMessage{{near: &center, message: map[string]interface{}{
+		"type":      "duel_ended",
+		"winner_id": winnerID,
+		"loser_id":  loserID,
+		"reason":    reason,
+	}}}
+	if winner, exists := w.Players[winnerID]; exists {
+		w.AddStatistic(winner, StatisticDuelsWon, 1)
+	}
+	if loser, exists := w.Players[loserID]; exists {
+		w.AddStatistic(loser, StatisticDuelsLost, 1)
+	}
+	for _, playerID := range d.players {
+		player, exists := w.Players[playerID]
+		if !exists {
+			continue
+		}
+		opponentID := d.opponent(playerID)
+		removed := false
+		for _, status := range player.Effects.Snapshot() {
+			if status.Definition.Debuff && status.SourceID == opponentID && player.Effects.Remove(status.Definition.ID) {
+				messages = append(messages, statusRemoved(player.ID, status.Definition.ID, StatusDispelled, player.GetPosition()))
+				removed = true
+			}
+		}
+		if removed {
+			messages = append(messages, refreshStats(player)...)
+		}
+		messages = append(messages, outboundMessage{playerID: playerID, message: w.pvpStatus(player, now)})
+	}
+	return messages
+}
+
+// forfeitDuel ends the duel of a player who can no longer fight it, if
+// any, making their opponent the winner; the caller holds the world lock
+func (w *World) forfeitDuel(playerID, reason string) []outboundMessage {
+	d := w.duels[playerID]
+	if d == nil {
+		return nil
+	}
+	return w.endDuel(d, d.opponent(playerID), reason)
+}
+
+// updatePvP announces flags whose timer ran out, forgets unanswered
+// challenges and ends the duels of fighters who strayed too far; the
+// caller holds the world lock
+func (w *World) updatePvP(now time.Time) []outboundMessage {
+	var messages []outboundMessage
+
+	for targetID, challenge := range w.duelChallenges {
+		if now.After(challenge.expires) {
+			delete(w.duelChallenges, targetID)
+		}
+	}
+
+	for _, player := range w.Players {
+		messages = append(messages, w.pvpFlagChanged(player, now)...)
+		if d := w.duels[player.ID]; d != nil && distance(player.GetPosition(), d.center) > duelRange {
+			messages = append(messages, w.endDuel(d, d.opponent(player.ID), DuelFled)...)
+		}
+	}
+
+	return messages
+}
+
+// notableRegion reports whether players are told about entering and
+// leaving a region
+func notableRegion(region *Region) bool {
+	if region.Type == "portal" {
+		return false
+	}
+	_, hasRule := region.Properties["pvp"]
+	return region.Type == "region" || hasRule
+}
+
+// regionEvents tells a player which named regions a move took them into
+// and out of, along with the PvP rule where they now stand; the caller
+// holds the world lock
+func (w *World) regionEvents(player *Player, from, to Position) []outboundMessage {
+	if w.Map == nil {
+		return nil
+	}
+
+	var left, entered []*Region
+	for i := range w.Map.Regions {
+		region := &w.Map.Regions[i]
+		if !notableRegion(region) {
+			continue
+		}
+		was, is := region.Bounds.Contains(from), region.Bounds.Contains(to)
+		if was && !is {
+			left = append(left, region)
+		} else if is && !was {
+			entered = append(entered, region)
+		}
+	}
+	if len(left) == 0 && len(entered) == 0 {
+		return nil
+	}
+	sort.Slice(entered, func(i, j int) bool { return entered[i].Name < entered[j].Name })
+	sort.Slice(left, func(i, j int) bool { return left[i].Name < left[j].Name })
+
+	rule, _ := w.pvpRuleAt(to)
+	var messages []outboundMessage
+	for _, region := range left {
+		messages = append(messages, outboundMessage{playerID: player.ID, message: map[string]interface{}{
+			"type": "region_left",
+			"name": region.Name,
+			"rule": rule,
+		}})
+	}
+	for _, region := range entered {
+		messages = append(messages, outboundMessage{playerID: player.ID, message: map[string]interface{}{
+			"type": "region_entered",
+			"name": region.Name,
+			"pvp":  region.Properties["pvp"],
+			"rule": rule,
+		}})
+	}
+	return append(messages, outboundMessage{playerID: player.ID, message: w.pvpStatus(player, time.Now())})
+}
@@ -0,0 +1,421 @@
+package game
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxActiveQuests is how many quests a character's quest log can hold
+const MaxActiveQuests = 20
+
+var (
+	ErrUnknownQuest    = errors.New("unknown quest")
+	ErrQuestActive     = errors.New("quest is already in the quest log")
+	ErrQuestDone       = errors.New("quest was already completed")
+	ErrQuestLocked     = errors.New("quest requirements are not met")
+	ErrQuestLogFull    = errors.New("quest log is full")
+	ErrQuestNotActive  = errors.New("quest is not in the quest log")
+	ErrQuestIncomplete = errors.New("quest objectives are not complete")
+)
+
+// ObjectiveType is what a quest objective asks the player to do
+type ObjectiveType string
+
+const (
+	// ObjectiveKill counts kills of an NPC definition
+	ObjectiveKill ObjectiveType = "kill"
+	// ObjectiveCollect counts the items of a kind held in the inventory
+	ObjectiveCollect ObjectiveType = "collect"
+	// ObjectiveTalk is met by talking to an NPC definition
+	ObjectiveTalk ObjectiveType = "talk"
+	// ObjectiveReach is met by walking into a named map region
+	ObjectiveReach ObjectiveType = "reach"
+)
+
+// QuestObjective is one step of a quest as written in quests.json
+type QuestObjective struct {
+	Type ObjectiveType `json:"type"`
+	// Target is the NPC, item or region the objective is about
+	Target string `json:"target"`
+	// Zone limits reach objectives to the region of one zone or instance
+	Zone        string `json:"zone"`
+	Count       int    `json:"count"`
+	Description string `json:"description"`
+}
+
+// QuestItemReward is a stack of items handed out when a quest is turned in
+type QuestItemReward struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+// QuestRewards is what a character receives for turning in a quest
+type QuestRewards struct {
+	Experience int               `json:"xp"`
+	Currency   int               `json:"currency"`
+	Items      []QuestItemReward `json:"items"`
+}
+
+// QuestDefinition describes a quest as written in quests.json
+type QuestDefinition struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Giver and TurnIn name NPC definitions; a quest without a giver can
+	// be accepted anywhere and one without a turn-in NPC is handed back
+	// to the giver
+	Giver         string           `json:"giver"`
+	TurnIn        string           `json:"turn_in"`
+	MinLevel      int              `json:"min_level"`
+	Prerequisites []string         `json:"prerequisites"`
+	Objectives    []QuestObjective `json:"objectives"`
+	Rewards       QuestRewards     `json:"rewards"`
+	// Script names the script in content/scripts whose on_accept and
+	// on_complete run when the quest is accepted and handed in
+	Script string `json:"script"`
+}
+
+// applyDefaults fills optional fields left out of the content file
+func (d *QuestDefinition) applyDefaults() {
+	if d.Name == "" {
+		d.Name = d.ID
+	}
+	if d.TurnIn == "" {
+		d.TurnIn = d.Giver
+	}
+	if d.MinLevel <= 0 {
+		d.MinLevel = 1
+	}
+	for i := range d.Objectives {
+		if d.Objectives[i].Count <= 0 {
+			d.Objectives[i].Count = 1
+		}
+	}
+	if d.Rewards.Items == nil {
+		d.Rewards.Items = []QuestItemReward{}
+	}
+	for i := range d.Rewards.Items {
+		if d.Rewards.Items[i].Quantity <= 0 {
+			d.Rewards.Items[i].Quantity = 1
+		}
+	}
+}
+
+// QuestProgress is an accepted quest and how far each objective has come
+type QuestProgress struct {
+	QuestID  string
+	Counts   []int
+	Accepted time.Time
+}
+
+// Complete reports whether every objective of the quest is met
+func (p *QuestProgress) Complete(definition *QuestDefinition) bool {
+	for i, objective := range definition.Objectives {
+		if i >= len(p.Counts) || p.Counts[i] < objective.Count {
+			return false
+		}
+	}
+	return true
+}
+
+// questUpdate is an objective whose count changed
+type questUpdate struct {
+	questID   string
+	objective int
+	count     int
+}
+
+// QuestLog is a character's accepted quests and the quests they finished
+type QuestLog struct {
+	active    map[string]*QuestProgress
+	completed map[string]time.Time
+	mu        sync.Mutex
+}
+
+// NewQuestLog creates an empty quest log
+func NewQuestLog() *QuestLog {
+	return &QuestLog{
+		active:    make(map[string]*QuestProgress),
+		completed: make(map[string]time.Time),
+	}
+}
+
+// CanAccept checks whether a character of the given level may take a quest
+func (q *QuestLog) CanAccept(definition *QuestDefinition, level int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.canAccept(definition, level)
+}
+
+func (q *QuestLog) canAccept(definition *QuestDefinition, level int) error {
+	if _, active := q.active[definition.ID]; active {
+		return ErrQuestActive
+	}
+	if _, done := q.completed[definition.ID]; done {
+		return ErrQuestDone
+	}
+	if level < definition.MinLevel {
+		return ErrQuestLocked
+	}
+	for _, prerequisite := range definition.Prerequisites {
+		if _, done := q.completed[prerequisite]; !done {
+			return ErrQuestLocked
+		}
+	}
+	if len(q.active) >= MaxActiveQuests {
+		return ErrQuestLogFull
+	}
+	return nil
+}
+
+// Accept adds a quest to the log with no progress made
+func (q *QuestLog) Accept(definition *QuestDefinition, level int, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.canAccept(definition, level); err != nil {
+		return err
+	}
+	q.active[definition.ID] = &QuestProgress{
+		QuestID:  definition.ID,
+		Counts:   make([]int, len(definition.Objectives)),
+		Accepted: now,
+	}
+	return nil
+}
+
+// Abandon drops an accepted quest and its progress
+func (q *QuestLog) Abandon(questID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, active := q.active[questID]; !active {
+		return ErrQuestNotActive
+	}
+	delete(q.active, questID)
+	return nil
+}
+
+// Active returns a copy of an accepted quest's progress
+func (q *QuestLog) Active(questID string) (QuestProgress, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	progress, active := q.active[questID]
+	if !active {
+		return QuestProgress{}, false
+	}
+	copied := *progress
+	copied.Counts = append([]int(nil), progress.Counts...)
+	return copied, true
+}
+
+// Completed reports whether a quest was turned in
+func (q *QuestLog) Completed(questID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, done := q.completed[questID]
+	return done
+}
+
+// Finish moves a quest whose objectives are met to the completed quests
+func (q *QuestLog) Finish(definition *QuestDefinition, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	progress, active := q.active[definition.ID]
+	if !active {
+		return ErrQuestNotActive
+	}
+	if !progress.Complete(definition) {
+		return ErrQuestIncomplete
+	}
+	delete(q.active, definition.ID)
+	q.completed[definition.ID] = now
+	return nil
+}
+
+// Advance adds to the objectives of accepted quests matching an event,
+// never beyond what the objective asks for
+func (q *QuestLog) Advance(quests map[string]*QuestDefinition, objectiveType ObjectiveType, target, zone string, amount int) []questUpdate {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var updates []questUpdate
+	for questID, progress := range q.active {
+		definition, exists := quests[questID]
+		if !exists {
+			continue
+		}
+		for i, objective := range definition.Objectives {
+			if objective.Type != objectiveType || objective.Target != target {
+				continue
+			}
+			if objective.Zone != "" && objective.Zone != zone {
+				continue
+			}
+			if progress.Counts[i] >= objective.Count {
+				continue
+			}
+			progress.Counts[i] = minInt(progress.Counts[i]+amount, objective.Count)
+			updates = append(updates, questUpdate{questID: questID, objective: i, count: progress.Counts[i]})
+		}
+	}
+	return updates
+}
+
+// SyncCollected sets collect objectives to the number of items held,
+// so dropping or handing over items takes progress back
+func (q *QuestLog) SyncCollected(quests map[string]*QuestDefinition, inventory *Inventory) []questUpdate {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var updates []questUpdate
+	for questID, progress := range q.active {
+		definition, exists := quests[questID]
+		if !exists {
+			continue
+		}
+		for i, objective := range definition.Objectives {
+			if objective.Type != ObjectiveCollect {
+				continue
+			}
+			count := minInt(inventory.Count(objective.Target), objective.Count)
+			if count != progress.Counts[i] {
+				progress.Counts[i] = count
+				updates = append(updates, questUpdate{questID: questID, objective: i, count: count})
+			}
+		}
+	}
+	return updates
+}
+
+// Restore loads saved quests into the log, dropping quests whose
+// definition no longer exists and fitting progress to the current objectives
+func (q *QuestLog) Restore(quests map[string]*QuestDefinition, active []QuestProgress, completed map[string]time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, progress := range active {
+		definition, exists := quests[progress.QuestID]
+		if !exists {
+			continue
+		}
+		counts := make([]int, len(definition.Objectives))
+		for i := range counts {
+			if i < len(progress.Counts) {
+				counts[i] = minInt(progress.Counts[i], definition.Objectives[i].Count)
+			}
+		}
+		q.active[progress.QuestID] = &QuestProgress{QuestID: progress.QuestID, Counts: counts, Accepted: progress.Accepted}
+	}
+	for questID, at := range completed {
+		q.completed[questID] = at
+	}
+}
+
+// Refit fits the accepted quests to reloaded definitions the way Restore
+// does, dropping those whose definition is gone, and reports whether any
+// progress changed
+func (q *QuestLog) Refit(quests map[string]*QuestDefinition) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	changed := false
+	for questID, progress := range q.active {
+		definition, exists := quests[questID]
+		if !exists {
+			delete(q.active, questID)
+			changed = true
+			continue
+		}
+		counts := make([]int, len(definition.Objectives))
+		for i := range counts {
+			if i < len(progress.Counts) {
+				counts[i] = minInt(progress.Counts[i], definition.Objectives[i].Count)
+			}
+			if i >= len(progress.Counts) || counts[i] != progress.Counts[i] {
+				changed = true
+			}
+		}
+		if len(counts) != len(progress.Counts) {
+			changed = true
+		}
+		progress.Counts = counts
+	}
+	return changed
+}
+
+// Snapshot returns copies of the accepted quests, ordered by when they
+// were accepted, and of the completed quests
+func (q *QuestLog) Snapshot() ([]QuestProgress, map[string]time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	active := make([]QuestProgress, 0, len(q.active))
+	for _, progress := range q.active {
+		copied := *progress
+		copied.Counts = append([]int(nil), progress.Counts...)
+		active = append(active, copied)
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].Accepted.Equal(active[j].Accepted) {
+			return active[i].QuestID < active[j].QuestID
+		}
+		return active[i].Accepted.Before(active[j].Accepted)
+	})
+
+	completed := make(map[string]time.Time, len(q.completed))
+	for questID, at := range q.completed {
+		completed[questID] = at
+	}
+	return active, completed
+}
+
+// Message returns the quest_log message describing the accepted quests
+func (q *QuestLog) Message(quests map[string]*QuestDefinition) map[string]interface{} {
+	active, completed := q.Snapshot()
+
+	entries := make([]map[string]interface{}, 0, len(active))
+	for _, progress := range active {
+		if definition, exists := quests[progress.QuestID]; exists {
+			entries = append(entries, questEntry(definition, progress))
+		}
+	}
+
+	done := make([]string, 0, len(completed))
+	for questID := range completed {
+		done = append(done, questID)
+	}
+	sort.Strings(done)
+
+	return map[string]interface{}{
+		"type":      "quest_log",
+		"quests":    entries,
+		"completed": done,
+	}
+}
+
+// questEntry describes an accepted quest and its objectives for clients
+func questEntry(definition *QuestDefinition, progress QuestProgress) map[string]interface{} {
+	objectives := make([]map[string]interface{}, 0, len(definition.Objectives))
+	for i, objective := range definition.Objectives {
+		objectives = append(objectives, map[string]interface{}{
+			"type":        objective.Type,
+			"target":      objective.Target,
+			"description": objective.Description,
+			"count":       progress.Counts[i],
+			"required":    objective.Count,
+		})
+	}
+
+	return map[string]interface{}{
+		"id":          definition.ID,
+		"name":        definition.Name,
+		"description": definition.Description,
+		"objectives":  objectives,
+		"complete":    progress.Complete(definition),
+	}
+}
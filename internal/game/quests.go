@@ -0,0 +1,370 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultInteractionRange is how close a player must stand to an NPC to
+// talk to it, trade with it, take its quests or hand them in unless the
+// server is configured otherwise
+const DefaultInteractionRange = 96.0
+
+var (
+	ErrNPCTooFar     = errors.New("that npc is too far away")
+	ErrNoQuestGiver  = errors.New("the quest giver is not nearby")
+	ErrNoQuestTurnIn = errors.New("the quest must be handed in to someone else")
+)
+
+// Interact makes a player use an entity of the world: items are picked
+// up, NPCs talked to and resource nodes gathered
+func (w *World) Interact(playerID, targetID string) error {
+	w.mu.RLock()
+	player, exists := w.Players[playerID]
+	if exists && !player.Life.Alive() {
+		w.mu.RUnlock()
+		return ErrDead
+	}
+	_, isNPC := w.NPCs[targetID]
+	_, isResource := w.Resources[targetID]
+	w.mu.RUnlock()
+
+	if isNPC {
+		return w.TalkToNPC(playerID, targetID)
+	}
+	if isResource {
+		return w.StartGathering(playerID, targetID)
+	}
+	return w.PickupItem(playerID, targetID)
+}
+
+// TalkToNPC counts towards talk objectives and opens the NPC's dialogue;
+// NPCs without one tell the player which quests they offer or take back
+func (w *World) TalkToNPC(playerID, npcID string) error {
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	npc, exists := w.NPCs[npcID]
+	if !exists || npc.AI == nil {
+		w.mu.Unlock()
+		return ErrTargetNotFound
+	}
+	if distance(player.GetPosition(), npc.Position) > w.settings.InteractionRange {
+		w.mu.Unlock()
+		return ErrNPCTooFar
+	}
+	definitionID := npc.AI.Definition.ID
+	messages := w.questEvent(player, ObjectiveTalk, definitionID, 1)
+	if dialogue, ok := w.dialogueOf(npc); ok {
+		opened, err := w.startConversation(player, npc, dialogue)
+		w.mu.Unlock()
+		w.deliver(messages)
+		if err != nil {
+			return err
+		}
+		w.deliver(opened)
+		return nil
+	}
+	w.mu.Unlock()
+
+	available := make([]map[string]interface{}, 0)
+	completable := make([]map[string]interface{}, 0)
+	if w.Content() != nil {
+		level := player.Progress.GetLevel()
+		for _, quest := range w.Content().Quests {
+			if quest.Giver == definitionID && player.Quests.CanAccept(quest, level) == nil {
+				available = append(available, map[string]interface{}{
+					"id":          quest.ID,
+					"name":        quest.Name,
+					"description": quest.Description,
+				})
+			}
+			if progress, active := player.Quests.Active(quest.ID); active && quest.TurnIn == definitionID && progress.Complete(quest) {
+				completable = append(completable, map[string]interface{}{
+					"id":   quest.ID,
+					"name": quest.Name,
+				})
+			}
+		}
+	}
+
+	messages = append(messages, outboundMessage{playerID: playerID, message: map[string]interface{}{
+		"type":        "npc_quests",
+		"npc_id":      npcID,
+		"name":        npc.Name,
+		"available":   available,
+		"completable": completable,
+	}})
+	w.deliver(messages)
+	return nil
+}
+
+// AcceptQuest adds a quest to a player's quest log; quests with a giver
+// can only be taken while standing next to it
+func (w *World) AcceptQuest(playerID, questID string) error {
+	quest, err := w.quest(questID)
+	if err != nil {
+		return err
+	}
+	player, exists := w.GetPlayer(playerID)
+	if !exists {
+		return errors.New("player not found")
+	}
+	if !w.npcNearby(player, quest.Giver) {
+		return ErrNoQuestGiver
+	}
+	return w.acceptQuest(player, quest)
+}
+
+// acceptQuest adds a quest to the player's quest log wherever they stand
+func (w *World) acceptQuest(player *Player, quest *QuestDefinition) error {
+	if err := player.Quests.Accept(quest, player.Progress.GetLevel(), time.Now()); err != nil {
+		return err
+	}
+
+	progress, _ := player.Quests.Active(quest.ID)
+	entry := questEntry(quest, progress)
+	entry["type"] = "quest_accepted"
+	messages := []outboundMessage{{playerID: player.ID, message: entry}}
+	messages = append(messages, w.syncCollectObjectives(player)...)
+	w.deliver(messages)
+	if quest.Script != "" {
+		w.runScript(quest.Script, ScriptOnAccept, playerValue(player), quest.ID)
+	}
+	return nil
+}
+
+// AbandonQuest drops a quest and its progress from a player's quest log
+func (w *World) AbandonQuest(playerID, questID string) error {
+	player, exists := w.GetPlayer(playerID)
+	if !exists {
+		return errors.New("player not found")
+	}
+	if err := player.Quests.Abandon(questID); err != nil {
+		return err
+	}
+
+	w.SendToPlayer(playerID, map[string]interface{}{
+		"type":     "quest_abandoned",
+		"quest_id": questID,
+	})
+	return nil
+}
+
+// TurnInQuest hands a finished quest in to its NPC: collected items are
+// taken and reward items given in one inventory change, then experience
+// and currency are granted
+func (w *World) TurnInQuest(playerID, questID string) error {
+	quest, err := w.quest(questID)
+	if err != nil {
+		return err
+	}
+	player, exists := w.GetPlayer(playerID)
+	if !exists {
+		return errors.New("player not found")
+	}
+	if !w.npcNearby(player, quest.TurnIn) {
+		if _, active := player.Quests.Active(questID); !active {
+			return ErrQuestNotActive
+		}
+		return ErrNoQuestTurnIn
+	}
+	return w.turnInQuest(player, quest)
+}
+
+// turnInQuest hands a finished quest in wherever the player stands
+func (w *World) turnInQuest(player *Player, quest *QuestDefinition) error {
+	progress, active := player.Quests.Active(quest.ID)
+	if !active {
+		return ErrQuestNotActive
+	}
+	if !progress.Complete(quest) {
+		return ErrQuestIncomplete
+	}
+
+	var taken, given []ItemStack
+	for _, objective := range quest.Objectives {
+		if objective.Type == ObjectiveCollect {
+			taken = append(taken, ItemStack{ItemID: objective.Target, Quantity: objective.Count})
+		}
+	}
+	for _, reward := range quest.Rewards.Items {
+		given = append(given, ItemStack{ItemID: reward.Item, Quantity: reward.Quantity})
+	}
+	// Reward items that do not fit in the inventory are mailed instead
+	carried, mailed := given, []ItemStack(nil)
+	err := player.Inventory.Exchange(taken, carried, w.Content().Items)
+	if errors.Is(err, ErrInventoryFull) && w.post != nil && len(given) > 0 {
+		carried, mailed = nil, given
+		err = player.Inventory.Exchange(taken, carried, w.Content().Items)
+	}
+	if err != nil {
+		return err
+	}
+	if err := player.Quests.Finish(quest, time.Now()); err != nil {
+		// The objectives were complete a moment ago; hand the items back
+		if rollback := player.Inventory.Exchange(carried, taken, w.Content().Items); rollback != nil {
+			return fmt.Errorf("%w (items could not be returned: %v)", err, rollback)
+		}
+		return err
+	}
+	w.AddStatistic(player, StatisticQuestsCompleted, 1)
+	w.publish(QuestCompleted{Player: player, QuestID: quest.ID})
+	if len(mailed) > 0 {
+		reward := &Mail{
+			Recipient: player.Name,
+			Subject:   quest.Name,
+			Body:      "Your reward did not fit in your bags.",
+			Items:     mailed,
+		}
+		if err := w.post.Send(reward); err != nil {
+			log.Printf("Failed to mail rewards of quest %s to %s: %v", quest.ID, player.Name, err)
+		}
+	}
+
+	levels := player.Progress.AddExperience(quest.Rewards.Experience)
+	if quest.Rewards.Currency > 0 {
+		if err := w.currency.Credit(player, quest.Rewards.Currency, ReasonQuestReward, quest.ID); err != nil {
+			log.Printf("Failed to pay %s for quest %s: %v", player.Name, quest.ID, err)
+		}
+	}
+
+	messages := []outboundMessage{
+		{playerID: player.ID, message: map[string]interface{}{
+			"type":     "quest_completed",
+			"quest_id": quest.ID,
+			"name":     quest.Name,
+			"xp":       quest.Rewards.Experience,
+			"currency": quest.Rewards.Currency,
+			"items":    quest.Rewards.Items,
+		}},
+		{playerID: player.ID, message: player.Inventory.Message(w.Content().Items)},
+		{playerID: player.ID, message: player.Progress.Message()},
+		{playerID: player.ID, message: player.Wallet.Message()},
+	}
+	if levels > 0 {
+		position := player.GetPosition()
+		messages = append(messages, outboundMessage{near: &position, message: map[string]interface{}{
+			"type":  "level_up",
+			"id":    player.ID,
+			"name":  player.Name,
+			"level": player.Progress.GetLevel(),
+		}})
+		w.publish(LevelUp{Player: player, Level: player.Progress.GetLevel()})
+	}
+	messages = append(messages, w.syncCollectObjectives(player)...)
+	w.deliver(messages)
+	if quest.Script != "" {
+		w.runScript(quest.Script, ScriptOnComplete, playerValue(player), quest.ID)
+	}
+	return nil
+}
+
+// quest looks up a quest definition
+func (w *World) quest(questID string) (*QuestDefinition, error) {
+	if w.Content() == nil {
+		return nil, ErrUnknownQuest
+	}
+	quest, exists := w.Content().Quests[questID]
+	if !exists {
+		return nil, fmt.Errorf("%w %q", ErrUnknownQuest, questID)
+	}
+	return quest, nil
+}
+
+// npcNearby reports whether an NPC of the given definition stands within
+// talking range of the player; an empty definition is always nearby
+func (w *World) npcNearby(player *Player, definitionID string) bool {
+	if definitionID == "" {
+		return true
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	position := player.GetPosition()
+	for _, npc := range w.NPCs {
+		if npc.AI != nil && npc.AI.Definition.ID == definitionID && distance(position, npc.Position) <= w.settings.InteractionRange {
+			return true
+		}
+	}
+	return false
+}
+
+// questEvent advances the player's objectives matching something they
+// did in this zone. It only touches the player's own quest log, so it
+// may be called with or without the world lock held
+func (w *World) questEvent(player *Player, objectiveType ObjectiveType, target string, amount int) []outboundMessage {
+	if w.Content() == nil {
+		return nil
+	}
+	updates := player.Quests.Advance(w.Content().Quests, objectiveType, target, w.questZone(), amount)
+	return w.questProgressMessages(player, updates)
+}
+
+// syncCollectObjectives brings collect objectives in line with the
+// player's inventory; like questEvent it needs no world lock
+func (w *World) syncCollectObjectives(player *Player) []outboundMessage {
+	if w.Content() == nil {
+		return nil
+	}
+	updates := player.Quests.SyncCollected(w.Content().Quests, player.Inventory)
+	return w.questProgressMessages(player, updates)
+}
+
+func (w *World) questProgressMessages(player *Player, updates []questUpdate) []outboundMessage {
+	messages := make([]outboundMessage, 0, len(updates))
+	for _, update := range updates {
+		quest := w.Content().Quests[update.questID]
+		progress, _ := player.Quests.Active(update.questID)
+		messages = append(messages, outboundMessage{playerID: player.ID, message: map[string]interface{}{
+			"type":      "quest_progress",
+			"quest_id":  update.questID,
+			"objective": update.objective,
+			"count":     update.count,
+			"required":  quest.Objectives[update.objective].Count,
+			"complete":  progress.Complete(quest),
+		}})
+	}
+	return messages
+}
+
+// questZone is the zone reach objectives name for this world; every copy
+// of an instance counts as its template
+func (w *World) questZone() string {
+	if templateID, isInstance := instanceTemplateID(w.ID); isInstance {
+		return templateID
+	}
+	return w.ID
+}
+
+// regionsEntered returns the named regions, other than portals, that a
+// move stepped into
+func (w *World) regionsEntered(from, to Position) []*Region {
+	if w.Map == nil {
+		return nil
+	}
+
+	var entered []*Region
+	for _, region := range w.Map.RegionsAt(to) {
+		if region.Type != "portal" && !region.Bounds.Contains(from) {
+			entered = append(entered, region)
+		}
+	}
+	return entered
+}
+
+// reachEvents counts the regions a move stepped into towards the
+// player's reach objectives
+func (w *World) reachEvents(player *Player, from, to Position) []outboundMessage {
+	var messages []outboundMessage
+	for _, region := range w.regionsEntered(from, to) {
+		messages = append(messages, w.questEvent(player, ObjectiveReach, region.Name, 1)...)
+	}
+	return messages
+}
@@ -0,0 +1,447 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"golang-mmo-server/internal/loot"
+)
+
+// ErrZoneRemoved is returned when reloaded content leaves out a zone the
+// server is running; characters may be saved in it, so that takes a restart
+var ErrZoneRemoved = errors.New("zone removed from content")
+
+// contentKinds are the kinds of definitions a reload compares, in the
+// order they are reported
+var contentKinds = []string{
+	"items", "npcs", "zones", "maps", "instances", "loot_tables", "quests", "dialogues",
+	"shops", "resources", "recipes", "abilities", "status_effects", "achievements", "scripts",
+}
+
+// reloadReason is why casts and conversations cut short by a reload ended
+const reloadReason = "content reloaded"
+
+// DefinitionChanges lists the definitions of one kind a reload added,
+// changed and removed, by ID
+type DefinitionChanges struct {
+	Added   []string `json:"added,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// ContentDiff is what a content reload changed, by kind of definition;
+// kinds that did not change are left out
+type ContentDiff map[string]*DefinitionChanges
+
+// diffContent compares every kind of definition of two content sets
+func diffContent(before, after *Content) ContentDiff {
+	diff := make(ContentDiff)
+	diff.compare("items", before.Items, after.Items)
+	diff.compare("npcs", before.NPCs, after.NPCs)
+	diff.compare("zones", before.Zones, after.Zones)
+	diff.compare("maps", before.Maps, after.Maps)
+	diff.compare("instances", before.Instances, after.Instances)
+	diff.compare("loot_tables", lootTables(before.LootTables), lootTables(after.LootTables))
+	diff.compare("quests", before.Quests, after.Quests)
+	diff.compare("dialogues", before.Dialogues, after.Dialogues)
+	diff.compare("shops", before.Shops, after.Shops)
+	diff.compare("resources", before.Resources, after.Resources)
+	diff.compare("recipes", before.Recipes, after.Recipes)
+	diff.compare("abilities", before.Abilities, after.Abilities)
+	diff.compare("status_effects", before.Statuses, after.Statuses)
+	diff.compare("achievements", before.Achievements, after.Achievements)
+	diff.compare("scripts", before.Scripts.versions(), after.Scripts.versions())
+	return diff
+}
+
+// lootTables indexes a registry's tables by ID so they compare like the
+// other definitions
+func lootTables(registry *loot.Registry) map[string]*loot.Table {
+	tables := make(map[string]*loot.Table)
+	if registry == nil {
+		return tables
+	}
+	for _, id := range registry.IDs() {
+		tables[id], _ = registry.Table(id)
+	}
+	return tables
+}
+
+// compare records the differences between two maps of definitions keyed
+// by ID; definitions are equal when all their fields are
+func (d ContentDiff) compare(kind string, before, after interface{}) {
+	old, current := reflect.ValueOf(before), reflect.ValueOf(after)
+	changes := &DefinitionChanges{}
+	for _, key := range current.MapKeys() {
+		previous := old.MapIndex(key)
+		switch {
+		case !previous.IsValid():
+			changes.Added = append(changes.Added, key.String())
+		case !reflect.DeepEqual(previous.Interface(), current.MapIndex(key).Interface()):
+			changes.Changed = append(changes.Changed, key.String())
+		}
+	}
+	for _, key := range old.MapKeys() {
+		if !current.MapIndex(key).IsValid() {
+			changes.Removed = append(changes.Removed, key.String())
+		}
+	}
+	if len(changes.Added)+len(changes.Changed)+len(changes.Removed) == 0 {
+		return
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Changed)
+	sort.Strings(changes.Removed)
+	d[kind] = changes
+}
+
+// Empty reports whether the reload changed nothing
+func (d ContentDiff) Empty() bool {
+	return len(d) == 0
+}
+
+// String summarizes the diff as counts of added, changed and removed
+// definitions per kind, like "items +1 ~2, maps ~1"
+func (d ContentDiff) String() string {
+	if d.Empty() {
+		return "no changes"
+	}
+	var parts []string
+	for _, kind := range contentKinds {
+		changes, exists := d[kind]
+		if !exists {
+			continue
+		}
+		part := kind
+		if n := len(changes.Added); n > 0 {
+			part += fmt.Sprintf(" +%d", n)
+		}
+		if n := len(changes.Changed); n > 0 {
+			part += fmt.Sprintf(" ~%d", n)
+		}
+		if n := len(changes.Removed); n > 0 {
+			part += fmt.Sprintf(" -%d", n)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Lines reports the diff one kind per line, naming every definition
+func (d ContentDiff) Lines() []string {
+	var lines []string
+	for _, kind := range contentKinds {
+		changes, exists := d[kind]
+		if !exists {
+			continue
+		}
+		var parts []string
+		if len(changes.Added) > 0 {
+			parts = append(parts, "added "+strings.Join(changes.Added, ", "))
+		}
+		if len(changes.Changed) > 0 {
+			parts = append(parts, "changed "+strings.Join(changes.Changed, ", "))
+		}
+		if len(changes.Removed) > 0 {
+			parts = append(parts, "removed "+strings.Join(changes.Removed, ", "))
+		}
+		lines = append(lines, kind+": "+strings.Join(parts, "; "))
+	}
+	return lines
+}
+
+// has reports whether any definition of a kind changed
+func (d ContentDiff) has(kind string) bool {
+	_, exists := d[kind]
+	return exists
+}
+
+// touched reports whether a definition was changed or removed
+func (d ContentDiff) touched(kind, id string) bool {
+	changes, exists := d[kind]
+	if !exists {
+		return false
+	}
+	for _, list := range [][]string{changes.Changed, changes.Removed} {
+		for _, touched := range list {
+			if touched == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReloadContent loads the content directory again and, once the whole new
+// set has loaded and validated, switches the game over to it. Every zone
+// and instance swaps between two of its ticks, moving its live NPCs,
+// resource nodes, effects and quest progress onto the new definitions or
+// removing them along with theirs. Zones whose definition or map changed
+// are rebuilt and their players moved into the new copy; running instances
+// keep their map until they close. The current content stays in use when
+// the new set fails to load
+func (zm *ZoneManager) ReloadContent() (ContentDiff, error) {
+	zm.reloading.Lock()
+	defer zm.reloading.Unlock()
+
+	current := zm.Content()
+	next, err := LoadContent(current.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for id := range current.Zones {
+		if _, exists := next.Zones[id]; !exists {
+			return nil, fmt.Errorf("%w: %q", ErrZoneRemoved, id)
+		}
+	}
+
+	diff := diffContent(current, next)
+	if diff.Empty() {
+		return diff, nil
+	}
+
+	now := time.Now()
+	zm.mu.Lock()
+	zm.content.Store(next)
+	zm.defaultZone = next.DefaultZone
+	zm.Vendors.Reload(next.Shops, next.Items, now)
+
+	var migrated, started []*World
+	replaced := make(map[*World]*World)
+	for id, world := range zm.zones {
+		definition := next.Zones[id]
+		if !diff.touched("zones", id) && !diff.touched("maps", definition.Map) {
+			migrated = append(migrated, world)
+			continue
+		}
+		replacement := newZone(definition, next, zm.settings)
+		zm.wireWorld(replacement)
+		zm.zones[id] = replacement
+		replaced[world] = replacement
+		started = append(started, replacement)
+	}
+	for id, definition := range next.Zones {
+		if _, exists := zm.zones[id]; !exists {
+			world := newZone(definition, next, zm.settings)
+			zm.wireWorld(world)
+			zm.zones[id] = world
+			started = append(started, world)
+		}
+	}
+	for _, instance := range zm.instances {
+		migrated = append(migrated, instance.World)
+	}
+	// Players on their way into a rebuilt zone arrive in the new copy
+	for _, transfer := range zm.transfers {
+		if replacement, exists := replaced[transfer.target]; exists {
+			transfer.target = replacement
+		}
+	}
+
+	outbound := make(map[*World][]outboundMessage, len(migrated))
+	for _, world := range migrated {
+		world.mu.Lock()
+		outbound[world] = world.migrateContent(next, diff, now)
+		world.mu.Unlock()
+	}
+	running := zm.stop != nil
+	zm.mu.Unlock()
+
+	for world, messages := range outbound {
+		world.deliver(messages)
+	}
+	if running {
+		for _, world := range started {
+			world.StartGameLoop()
+		}
+	}
+	for old, replacement := range replaced {
+		zm.moveZonePlayers(old, replacement)
+		old.StopGameLoop()
+	}
+
+	return diff, nil
+}
+
+// moveZonePlayers transfers everyone in a zone that was rebuilt into its
+// replacement, where they stood unless the new map blocks that spot
+func (zm *ZoneManager) moveZonePlayers(old, replacement *World) {
+	for _, playerID := range old.PlayerIDs() {
+		player, exists := old.GetPlayer(playerID)
+		if !exists {
+			continue
+		}
+		position := player.GetPosition()
+		if replacement.Map == nil || replacement.Map.IsBlocked(position) {
+			position = replacement.SpawnPosition(Position{})
+		}
+		if err := zm.transferTo(playerID, replacement, position); err != nil {
+			log.Printf("Moving player %s into reloaded zone %s failed: %v", playerID, replacement.ID, err)
+		}
+	}
+}
+
+// migrateContent switches the zone to reloaded content, moving what lives
+// in it onto the new definitions; the caller holds the world lock
+func (w *World) migrateContent(next *Content, diff ContentDiff, now time.Time) []outboundMessage {
+	w.content.Store(next)
+	if next.LootTables != nil {
+		w.loot = loot.NewRoller(next.LootTables, w.rng.Int63())
+	}
+
+	var messages []outboundMessage
+	messages = append(messages, w.migrateNPCs(next, diff)...)
+	messages = append(messages, w.migrateItems(next)...)
+	for _, resource := range w.Resources {
+		// Instances keep their map, so a node may outlive its definition
+		if definition, exists := next.Resources[resource.Node.Definition.ID]; exists {
+			resource.Node.Definition = definition
+		}
+	}
+
+	for playerID, talk := range w.conversations {
+		if diff.touched("dialogues", talk.dialogue.ID) {
+			messages = append(messages, w.endConversation(playerID)...)
+		}
+	}
+	for playerID, cast := range w.casts {
+		if diff.touched("abilities", cast.ability.ID) {
+			messages = append(messages, w.interruptCast(playerID, reloadReason)...)
+		}
+	}
+	for _, player := range w.Players {
+		messages = append(messages, w.migratePlayer(player, next, diff, now)...)
+	}
+	return messages
+}
+
+// migrateNPCs moves NPCs, including those waiting to respawn or for their
+// part of the day, onto reloaded definitions and removes those whose
+// definition is gone; the caller holds the world lock
+func (w *World) migrateNPCs(next *Content, diff ContentDiff) []outboundMessage {
+	var messages []outboundMessage
+
+	for id, npc := range w.NPCs {
+		if npc.AI == nil {
+			continue
+		}
+		definition, exists := next.NPCs[npc.AI.Definition.ID]
+		position := npc.Position
+		if !exists {
+			delete(w.NPCs, id)
+			for playerID, talk := range w.conversations {
+				if talk.npcID == id {
+					messages = append(messages, w.endConversation(playerID)...)
+				}
+			}
+			messages = append(messages, outboundMessage{near: &position, message: map[string]interface{}{
+				"type": "npc_despawned",
+				"id":   id,
+			}})
+			continue
+		}
+		if !diff.touched("npcs", definition.ID) && !diff.has("status_effects") {
+			continue
+		}
+		for _, effectID := range migrateNPC(npc, definition, next) {
+			messages = append(messages, statusRemoved(id, effectID, reloadReason, position))
+		}
+		appearance := npcAppearance(npc)
+		appearance["type"] = "npc_spawned"
+		messages = append(messages, outboundMessage{near: &position, message: appearance})
+	}
+
+	for id, npc := range w.dormant {
+		if definition, exists := next.NPCs[npc.AI.Definition.ID]; exists {
+			migrateNPC(npc, definition, next)
+		} else {
+			delete(w.dormant, id)
+		}
+	}
+	waiting := w.respawns[:0]
+	for _, respawn := range w.respawns {
+		if definition, exists := next.NPCs[respawn.npc.AI.Definition.ID]; exists {
+			migrateNPC(respawn.npc, definition, next)
+			waiting = append(waiting, respawn)
+		}
+	}
+	w.respawns = waiting
+
+	return messages
+}
+
+// migrateNPC points an NPC at its reloaded definition, keeping the share
+// of health it had left, and returns the effects it lost
+func migrateNPC(npc *Entity, definition *NPCDefinition, next *Content) []string {
+	npc.AI.Definition = definition
+	npc.Name = definition.Name
+	if npc.MaxHealth != definition.Health {
+		if npc.MaxHealth > 0 {
+			npc.Health = maxInt(npc.Health*definition.Health/npc.MaxHealth, 1)
+		}
+		npc.MaxHealth = definition.Health
+		npc.Health = minInt(npc.Health, npc.MaxHealth)
+	}
+	if npc.Effects == nil {
+		return nil
+	}
+	return npc.Effects.Refit(next.Statuses)
+}
+
+// migrateItems removes ground items and item spawns whose item no longer
+// exists; the caller holds the world lock
+func (w *World) migrateItems(next *Content) []outboundMessage {
+	var messages []outboundMessage
+	for id, entity := range w.Items {
+		if _, exists := next.Items[entity.Drop.ItemID]; !exists {
+			messages = append(messages, w.removeItem(id)...)
+		}
+	}
+	spawns := w.itemSpawns[:0]
+	for _, spawn := range w.itemSpawns {
+		if _, exists := next.Items[spawn.itemID]; exists {
+			spawns = append(spawns, spawn)
+		}
+	}
+	w.itemSpawns = spawns
+	return messages
+}
+
+// migratePlayer fits a player's quests and effects to reloaded content
+// and resends what their client shows of the kinds that changed; the
+// caller holds the world lock
+func (w *World) migratePlayer(player *Player, next *Content, diff ContentDiff, now time.Time) []outboundMessage {
+	var messages []outboundMessage
+	send := func(message map[string]interface{}) {
+		messages = append(messages, outboundMessage{playerID: player.ID, message: message})
+	}
+
+	if removed := player.Effects.Refit(next.Statuses); len(removed) > 0 {
+		position := player.GetPosition()
+		for _, effectID := range removed {
+			messages = append(messages, statusRemoved(player.ID, effectID, reloadReason, position))
+		}
+		messages = append(messages, refreshStats(player)...)
+	}
+	if diff.has("status_effects") {
+		send(player.Effects.Message(player.ID, now))
+	}
+	if player.Quests.Refit(next.Quests) || diff.has("quests") {
+		send(player.Quests.Message(next.Quests))
+	}
+	if diff.has("items") {
+		send(player.Inventory.Message(next.Items))
+	}
+	if diff.has("abilities") {
+		send(next.AbilitiesMessage())
+	}
+	if diff.has("recipes") {
+		send(next.RecipesMessage())
+	}
+	return messages
+}
@@ -0,0 +1,670 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-mmo-server/internal/script"
+)
+
+const (
+	// scriptExtension marks the files below content/scripts that are scripts
+	scriptExtension = ".script"
+	// scriptReloadInterval is how often script files are checked for changes
+	scriptReloadInterval = 2 * time.Second
+	// npcThinkInterval is how often a scripted NPC's on_think runs
+	npcThinkInterval = time.Second
+	// MaxSummonedNPCs is how many NPCs scripts may have spawned in one zone
+	MaxSummonedNPCs = 20
+)
+
+// Functions scripts declare to hook into the game
+const (
+	ScriptOnThink    = "on_think"
+	ScriptOnDeath    = "on_death"
+	ScriptOnAccept   = "on_accept"
+	ScriptOnComplete = "on_complete"
+)
+
+var (
+	ErrUnknownScript = errors.New("unknown script")
+	ErrTooManyNPCs   = errors.New("too many summoned npcs")
+)
+
+// scriptFunctions are the game functions scripts can call
+var scriptFunctions = []string{
+	"message", "say", "give_item", "item_count",
+	"has_flag", "set_flag", "clear_flag",
+	"player", "npc", "nearby_players", "nearby_npcs",
+	"spawn", "despawn", "log",
+}
+
+// scriptCall is a script function waiting to run once the zone is unlocked
+type scriptCall struct {
+	script   string
+	function string
+	args     []script.Value
+}
+
+// Scripts are the compiled scripts below content/scripts, named by their
+// path without the extension, such as "npcs/guard". They are reloaded
+// when their files change
+type Scripts struct {
+	dir      string
+	programs map[string]*script.Program
+	modified map[string]time.Time
+	mu       sync.RWMutex
+}
+
+// LoadScripts compiles every script below a directory; a missing
+// directory means no scripts
+func LoadScripts(dir string) (*Scripts, error) {
+	scripts := &Scripts{
+		dir:      dir,
+		programs: make(map[string]*script.Program),
+		modified: make(map[string]time.Time),
+	}
+	files, err := scripts.files()
+	if err != nil {
+		return nil, err
+	}
+	for name, file := range files {
+		if err := scripts.compile(name, file); err != nil {
+			return nil, err
+		}
+	}
+	return scripts, nil
+}
+
+// scriptFile is a script file and when it was last changed
+type scriptFile struct {
+	path     string
+	modified time.Time
+}
+
+// files lists the script files by script name
+func (s *Scripts) files() (map[string]scriptFile, error) {
+	files := make(map[string]scriptFile)
+	err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path == s.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != scriptExtension {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(relative, scriptExtension))
+		files[name] = scriptFile{path: path, modified: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// compile reads and compiles one script file, replacing the script only
+// when it compiles
+func (s *Scripts) compile(name string, file scriptFile) error {
+	source, err := os.ReadFile(file.path)
+	if err != nil {
+		return err
+	}
+	program, err := script.Compile(name+scriptExtension, string(source), scriptFunctions)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.programs[name] = program
+	s.modified[name] = file.modified
+	return nil
+}
+
+// Get returns a script by name
+func (s *Scripts) Get(name string) (*script.Program, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	program, exists := s.programs[name]
+	return program, exists
+}
+
+// Has reports whether a script declares a function
+func (s *Scripts) Has(name, function string) bool {
+	program, exists := s.Get(name)
+	return exists && program.Has(function)
+}
+
+// versions returns when each script's file was last changed, which
+// tells reloaded content's scripts apart from the running ones
+func (s *Scripts) versions() map[string]time.Time {
+	versions := make(map[string]time.Time)
+	if s == nil {
+		return versions
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for name, modified := range s.modified {
+		versions[name] = modified
+	}
+	return versions
+}
+
+// Names returns the names of the loaded scripts
+func (s *Scripts) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.programs))
+	for name := range s.programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reload recompiles the scripts whose files changed and picks up new
+// ones. A script that no longer compiles keeps running its last good
+// version, and one whose file was removed stops being available
+func (s *Scripts) Reload() (reloaded []string, errs []error) {
+	if s == nil {
+		return nil, nil
+	}
+	files, err := s.files()
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	s.mu.RLock()
+	var changed []string
+	for name, file := range files {
+		if modified, known := s.modified[name]; !known || !modified.Equal(file.modified) {
+			changed = append(changed, name)
+		}
+	}
+	var removed []string
+	for name := range s.programs {
+		if _, exists := files[name]; !exists {
+			removed = append(removed, name)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(changed)
+	for _, name := range changed {
+		if err := s.compile(name, files[name]); err != nil {
+			// Remember the broken version so it is not reported every check
+			s.mu.Lock()
+			s.modified[name] = files[name].modified
+			s.mu.Unlock()
+			errs = append(errs, err)
+			continue
+		}
+		reloaded = append(reloaded, name)
+	}
+	if len(removed) > 0 {
+		s.mu.Lock()
+		for _, name := range removed {
+			delete(s.programs, name)
+			delete(s.modified, name)
+		}
+		s.mu.Unlock()
+	}
+	return reloaded, errs
+}
+
+// watchScripts reloads changed scripts of the content in use until
+// stopped
+func (zm *ZoneManager) watchScripts(stop chan struct{}) {
+	ticker := time.NewTicker(scriptReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, errs := zm.Content().Scripts.Reload()
+			for _, name := range reloaded {
+				log.Printf("Reloaded script %s", name)
+			}
+			for _, err := range errs {
+				log.Printf("Script not reloaded, keeping the previous version: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// checkScript checks that content refers to a script that exists
+func (c *Content) checkScript(name string) error {
+	if _, exists := c.Scripts.Get(name); !exists {
+		return fmt.Errorf("%w %q", ErrUnknownScript, name)
+	}
+	return nil
+}
+
+// runScript calls a script function, if the script declares it, with the
+// zone's script API. A failing script is logged and otherwise ignored, so
+// it cannot take the zone down with it. The zone must not be locked
+func (w *World) runScript(name, function string, args ...script.Value) {
+	program, exists := w.Content().Scripts.Get(name)
+	if !exists {
+		log.Printf("Script %s not found for %s", name, function)
+		return
+	}
+	if !program.Has(function) {
+		return
+	}
+	if _, err := program.Call(function, w.scriptAPI(name), w.settings.ScriptLimits, args...); err != nil {
+		log.Printf("Script failed in zone %s: %v", w.ID, err)
+	}
+}
+
+// queueScript has a script function run once the zone is unlocked at the
+// end of its tick; the caller holds the world lock
+func (w *World) queueScript(name, function string, args ...script.Value) {
+	if !w.Content().Scripts.Has(name, function) {
+		return
+	}
+	w.pendingScripts = append(w.pendingScripts, scriptCall{script: name, function: function, args: args})
+}
+
+// runQueuedScripts runs the script functions queued during a tick until
+// the zone's script budget for the tick is spent. The calls it does not
+// get to go back on the queue ahead of newer ones and run next tick. The
+// zone must not be locked
+func (w *World) runQueuedScripts(calls []scriptCall) {
+	if len(calls) == 0 {
+		return
+	}
+	start := time.Now()
+	ran := 0
+	for ran < len(calls) && time.Since(start) < w.settings.ScriptTickBudget {
+		call := calls[ran]
+		w.runScript(call.script, call.function, call.args...)
+		ran++
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.scriptBacklog = ran < len(calls)
+	if w.scriptBacklog {
+		w.pendingScripts = append(calls[ran:], w.pendingScripts...)
+	}
+}
+
+// queueNPCThinks queues on_think of the scripted NPCs due to think; the
+// caller holds the world lock. While calls from earlier ticks are still
+// waiting NPCs put off thinking, so busy scripts cannot grow the queue
+// without end
+func (w *World) queueNPCThinks(now time.Time) {
+	if w.scriptBacklog {
+		return
+	}
+	for _, npc := range w.NPCs {
+		brain := npc.AI
+		if brain == nil || brain.Definition.Script == "" || now.Before(brain.nextThink) {
+			continue
+		}
+		brain.nextThink = now.Add(npcThinkInterval)
+		w.queueScript(brain.Definition.Script, ScriptOnThink, npcValue(npc))
+	}
+}
+
+// playerValue describes a player to scripts
+func playerValue(player *Player) script.Value {
+	position := player.GetPosition()
+	health, maxHealth := player.Vitals.Health()
+	return map[string]script.Value{
+		"id":         player.ID,
+		"name":       player.Name,
+		"level":      float64(player.Progress.GetLevel()),
+		"x":          position.X,
+		"y":          position.Y,
+		"health":     float64(health),
+		"max_health": float64(maxHealth),
+	}
+}
+
+// npcValue describes an NPC to scripts; the caller holds the world lock
+func npcValue(npc *Entity) script.Value {
+	value := map[string]script.Value{
+		"id":         npc.ID,
+		"name":       npc.Name,
+		"x":          npc.Position.X,
+		"y":          npc.Position.Y,
+		"health":     float64(npc.Health),
+		"max_health": float64(npc.MaxHealth),
+		"summoned":   false,
+	}
+	if npc.AI != nil {
+		value["kind"] = npc.AI.Definition.ID
+		value["summoned"] = npc.AI.summoned
+	}
+	return value
+}
+
+// scriptAPI returns the game functions a script can call in this zone.
+// Scripts run with the zone unlocked, so each function locks what it uses
+func (w *World) scriptAPI(name string) map[string]script.Builtin {
+	return map[string]script.Builtin{
+		// message(player_id, text) shows a player a message
+		"message": func(args []script.Value) (script.Value, error) {
+			playerID, text, err := stringArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			w.SendToPlayer(playerID, map[string]interface{}{
+				"type": "script_message",
+				"text": text,
+			})
+			return nil, nil
+		},
+		// say(npc_id, text) has an NPC say something to those around it
+		"say": func(args []script.Value) (script.Value, error) {
+			npcID, text, err := stringArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			w.mu.RLock()
+			npc, exists := w.NPCs[npcID]
+			var position Position
+			if exists {
+				position = npc.Position
+			}
+			w.mu.RUnlock()
+			if !exists {
+				return false, nil
+			}
+			w.BroadcastNear(position, map[string]interface{}{
+				"type": "npc_say",
+				"id":   npcID,
+				"name": npc.Name,
+				"text": text,
+			})
+			return true, nil
+		},
+		// give_item(player_id, item_id, quantity) gives a player items,
+		// returning false when they do not fit
+		"give_item": func(args []script.Value) (script.Value, error) {
+			playerID, itemID, err := stringArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			quantity, err := script.OptionalNumberArg(args, 2, 1)
+			if err != nil {
+				return nil, err
+			}
+			definition, exists := w.Content().Items[itemID]
+			if !exists {
+				return nil, fmt.Errorf("unknown item %q", itemID)
+			}
+			if quantity < 1 || quantity > float64(maxInt(definition.MaxStack, 1)) {
+				return nil, fmt.Errorf("cannot give %v of %s", quantity, itemID)
+			}
+			player, exists := w.GetPlayer(playerID)
+			if !exists {
+				return false, nil
+			}
+			if err := player.Inventory.Add(definition, int(quantity)); err != nil {
+				return false, nil
+			}
+			messages := []outboundMessage{{playerID: playerID, message: player.Inventory.Message(w.Content().Items)}}
+			w.deliver(append(messages, w.syncCollectObjectives(player)...))
+			return true, nil
+		},
+		// item_count(player_id, item_id) counts the items a player carries
+		"item_count": func(args []script.Value) (script.Value, error) {
+			playerID, itemID, err := stringArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			player, exists := w.GetPlayer(playerID)
+			if !exists {
+				return float64(0), nil
+			}
+			return float64(player.Inventory.Count(itemID)), nil
+		},
+		// has_flag(player_id, flag) checks a character flag
+		"has_flag": func(args []script.Value) (script.Value, error) {
+			playerID, flag, err := stringArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			player, exists := w.GetPlayer(playerID)
+			return exists && player.Flags.Has(flag), nil
+		},
+		// set_flag(player_id, flag) sets a character flag
+		"set_flag": func(args []script.Value) (script.Value, error) {
+			playerID, flag, err := stringArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			if player, exists := w.GetPlayer(playerID); exists {
+				player.Flags.Set(flag)
+			}
+			return nil, nil
+		},
+		// clear_flag(player_id, flag) clears a character flag
+		"clear_flag": func(args []script.Value) (script.Value, error) {
+			playerID, flag, err := stringArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			if player, exists := w.GetPlayer(playerID); exists {
+				player.Flags.Clear(flag)
+			}
+			return nil, nil
+		},
+		// player(player_id) describes a player of the zone, or is nil
+		"player": func(args []script.Value) (script.Value, error) {
+			playerID, err := script.StringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			player, exists := w.GetPlayer(playerID)
+			if !exists {
+				return nil, nil
+			}
+			return playerValue(player), nil
+		},
+		// npc(npc_id) describes an NPC of the zone, or is nil
+		"npc": func(args []script.Value) (script.Value, error) {
+			npcID, err := script.StringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			w.mu.RLock()
+			defer w.mu.RUnlock()
+			npc, exists := w.NPCs[npcID]
+			if !exists {
+				return nil, nil
+			}
+			return npcValue(npc), nil
+		},
+		// nearby_players(x, y, radius) lists the players around a position
+		"nearby_players": func(args []script.Value) (script.Value, error) {
+			// Scripts look no farther around a position than players see
+			center, radius, err := areaArgs(args, w.settings.AOIRadius)
+			if err != nil {
+				return nil, err
+			}
+			w.mu.RLock()
+			var players []*Player
+			for _, player := range w.Players {
+				if distance(center, player.GetPosition()) <= radius {
+					players = append(players, player)
+				}
+			}
+			w.mu.RUnlock()
+			sort.Slice(players, func(i, j int) bool { return players[i].ID < players[j].ID })
+			list := make([]script.Value, len(players))
+			for i, player := range players {
+				list[i] = playerValue(player)
+			}
+			return list, nil
+		},
+		// nearby_npcs(x, y, radius) lists the NPCs around a position
+		"nearby_npcs": func(args []script.Value) (script.Value, error) {
+			center, radius, err := areaArgs(args, w.settings.AOIRadius)
+			if err != nil {
+				return nil, err
+			}
+			w.mu.RLock()
+			defer w.mu.RUnlock()
+			var ids []string
+			for id, npc := range w.NPCs {
+				if distance(center, npc.Position) <= radius {
+					ids = append(ids, id)
+				}
+			}
+			sort.Strings(ids)
+			list := make([]script.Value, len(ids))
+			for i, id := range ids {
+				list[i] = npcValue(w.NPCs[id])
+			}
+			return list, nil
+		},
+		// spawn(npc_kind, x, y) summons an NPC that does not respawn,
+		// returning its ID
+		"spawn": func(args []script.Value) (script.Value, error) {
+			kind, err := script.StringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			x, err := script.NumberArg(args, 1)
+			if err != nil {
+				return nil, err
+			}
+			y, err := script.NumberArg(args, 2)
+			if err != nil {
+				return nil, err
+			}
+			return w.SummonNPC(kind, Position{X: x, Y: y})
+		},
+		// despawn(npc_id) removes an NPC a script summoned
+		"despawn": func(args []script.Value) (script.Value, error) {
+			npcID, err := script.StringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return w.DismissNPC(npcID), nil
+		},
+		// log(values...) writes to the server log
+		"log": func(args []script.Value) (script.Value, error) {
+			parts := make([]string, len(args))
+			for i, arg := range args {
+				parts[i] = script.ToString(arg)
+			}
+			log.Printf("[script %s] %s", name, strings.Join(parts, " "))
+			return nil, nil
+		},
+	}
+}
+
+// stringArgs returns the first two arguments of a script call as strings
+func stringArgs(args []script.Value) (string, string, error) {
+	first, err := script.StringArg(args, 0)
+	if err != nil {
+		return "", "", err
+	}
+	second, err := script.StringArg(args, 1)
+	return first, second, err
+}
+
+// areaArgs returns the x, y and radius arguments of a script call, the
+// radius held to at most maxRadius
+func areaArgs(args []script.Value, maxRadius float64) (Position, float64, error) {
+	x, err := script.NumberArg(args, 0)
+	if err != nil {
+		return Position{}, 0, err
+	}
+	y, err := script.NumberArg(args, 1)
+	if err != nil {
+		return Position{}, 0, err
+	}
+	radius, err := script.NumberArg(args, 2)
+	if err != nil {
+		return Position{}, 0, err
+	}
+	return Position{X: x, Y: y}, math.Min(math.Max(radius, 0), maxRadius), nil
+}
+
+// SummonNPC places an NPC that stays until killed or dismissed, returning
+// its ID
+func (w *World) SummonNPC(kind string, position Position) (string, error) {
+	definition, exists := w.Content().NPCs[kind]
+	if !exists {
+		return "", fmt.Errorf("unknown npc %q", kind)
+	}
+	if w.Map != nil && w.Map.IsBlocked(position) {
+		return "", errors.New("that spot is blocked")
+	}
+
+	w.mu.Lock()
+	summoned := 0
+	for _, npc := range w.NPCs {
+		if npc.AI != nil && npc.AI.summoned {
+			summoned++
+		}
+	}
+	if summoned >= MaxSummonedNPCs {
+		w.mu.Unlock()
+		return "", ErrTooManyNPCs
+	}
+	w.summonSeq++
+	npc := NewEntity(npcEntityID(definition.ID+"_summoned", w.summonSeq), NPC, definition.Name, position)
+	npc.AI = &NPCBrain{Definition: definition, Home: position, summoned: true}
+	npc.Health = definition.Health
+	npc.MaxHealth = definition.Health
+	npc.Effects = NewStatusEffects()
+	w.NPCs[npc.ID] = npc
+	appearance := npcAppearance(npc)
+	w.mu.Unlock()
+
+	appearance["type"] = "npc_spawned"
+	w.BroadcastNear(position, appearance)
+	return npc.ID, nil
+}
+
+// DismissNPC removes a summoned NPC, reporting whether there was one
+func (w *World) DismissNPC(npcID string) bool {
+	w.mu.Lock()
+	npc, exists := w.NPCs[npcID]
+	if !exists || npc.AI == nil || !npc.AI.summoned {
+		w.mu.Unlock()
+		return false
+	}
+	delete(w.NPCs, npcID)
+	if npc.AI.request != nil {
+		npc.AI.request.Cancel()
+		npc.AI.request = nil
+	}
+	position := npc.Position
+	w.mu.Unlock()
+
+	w.BroadcastNear(position, map[string]interface{}{
+		"type": "npc_despawned",
+		"id":   npcID,
+	})
+	return true
+}
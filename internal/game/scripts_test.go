@@ -0,0 +1,99 @@
+package game
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang-mmo-server/internal/script"
+)
+
+// writeScript writes a script file, dating it so reloads notice the change
+// even within the file system's timestamp resolution
+func writeScript(t *testing.T, path, source string, modified time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadKeepsLastGoodScript(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "guard"+scriptExtension)
+	start := time.Now().Add(-time.Hour)
+	writeScript(t, path, `func on_think(npc) { say(npc.id, "halt") }`, start)
+
+	scripts, err := LoadScripts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, _ := scripts.Get("guard")
+
+	writeScript(t, path, `func on_think(npc) { say(npc.id, "halt" }`, start.Add(time.Minute))
+	reloaded, errs := scripts.Reload()
+	if len(reloaded) != 0 || len(errs) != 1 {
+		t.Fatalf("reloading a broken script: reloaded %v, errors %v", reloaded, errs)
+	}
+	if program, exists := scripts.Get("guard"); !exists || program != loaded {
+		t.Fatal("the broken script replaced the one that was running")
+	}
+	if reloaded, errs := scripts.Reload(); len(reloaded) != 0 || len(errs) != 0 {
+		t.Fatalf("an unchanged broken script was reported again: %v, %v", reloaded, errs)
+	}
+
+	writeScript(t, path, `func on_death(npc) { say(npc.id, "argh") }`, start.Add(2*time.Minute))
+	if reloaded, errs := scripts.Reload(); len(reloaded) != 1 || len(errs) != 0 {
+		t.Fatalf("reloading the fixed script: reloaded %v, errors %v", reloaded, errs)
+	}
+	if !scripts.Has("guard", ScriptOnDeath) || scripts.Has("guard", ScriptOnThink) {
+		t.Fatal("the fixed script was not loaded")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	scripts.Reload()
+	if _, exists := scripts.Get("guard"); exists {
+		t.Fatal("a removed script is still loaded")
+	}
+}
+
+func TestQueuedScriptsKeepToTheTickBudget(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, filepath.Join(dir, "busy"+scriptExtension), "func work(n) {\n\twhile true { }\n}", time.Now())
+	scripts, err := LoadScripts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every call runs out its 5ms, so a 12ms budget gets through 3 of them
+	settings := DefaultSettings()
+	settings.ScriptTickBudget = 12 * time.Millisecond
+	world := NewWorld("test", nil, &Content{Scripts: scripts}, settings)
+
+	var calls []scriptCall
+	for i := 0; i < 10; i++ {
+		calls = append(calls, scriptCall{script: "busy", function: "work", args: []script.Value{float64(i)}})
+	}
+	world.queueScript("busy", "work", "newer")
+	start := time.Now()
+	world.runQueuedScripts(calls)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("running the queue took %v", elapsed)
+	}
+
+	pending := world.pendingScripts
+	if !world.scriptBacklog || len(pending) < 2 || len(pending) > 9 {
+		t.Fatalf("%d calls left for the next tick, want some but not all", len(pending))
+	}
+	if first := pending[0].args[0]; first != float64(11-len(pending)) {
+		t.Fatalf("the next tick starts with call %v, want the first one not run", first)
+	}
+	if last := pending[len(pending)-1].args[0]; last != "newer" {
+		t.Fatalf("the call queued during the tick is not last: %v", last)
+	}
+}
@@ -0,0 +1,309 @@
+package game
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// BuybackSize is how many sold stacks a character can buy back
+	BuybackSize = 10
+	// BuybackDuration is how long a sold stack can be bought back
+	BuybackDuration = 30 * time.Minute
+)
+
+var (
+	ErrUnknownShop = errors.New("unknown shop")
+	ErrNotForSale  = errors.New("that item is not sold here")
+	ErrOutOfStock  = errors.New("the vendor does not have that many")
+	ErrNotSellable = errors.New("vendors do not buy that item")
+	ErrNoShopOpen  = errors.New("no shop is open")
+	ErrNoBuyback   = errors.New("that item can no longer be bought back")
+	ErrBadQuantity = errors.New("quantity must be positive")
+)
+
+// ShopItem is something a vendor sells as written in shops.json
+type ShopItem struct {
+	Item  string `json:"item"`
+	Price int    `json:"price"`
+	// Stock limits how many the vendor has on hand; 0 sells without limit
+	Stock int `json:"stock"`
+	// RestockSeconds is how long it takes one sold unit of limited stock
+	// to come back
+	RestockSeconds int `json:"restock_seconds"`
+}
+
+// ShopDefinition describes a vendor's shop as written in shops.json
+type ShopDefinition struct {
+	ID    string     `json:"id"`
+	Name  string     `json:"name"`
+	Items []ShopItem `json:"items"`
+}
+
+// applyDefaults fills optional fields left out of the content file
+func (d *ShopDefinition) applyDefaults() {
+	if d.Name == "" {
+		d.Name = d.ID
+	}
+}
+
+// shopStock is how much of its limited items a shop has left; restocked
+// is when each item last gained a unit back, or was last full
+type shopStock struct {
+	definition *ShopDefinition
+	stock      []int
+	restocked  []time.Time
+}
+
+// restock gives back the units of limited stock that came back since the
+// last look, up to each item's full stock
+func (s *shopStock) restock(now time.Time) {
+	for i, item := range s.definition.Items {
+		if item.Stock == 0 || item.RestockSeconds <= 0 {
+			continue
+		}
+		if s.stock[i] >= item.Stock {
+			s.restocked[i] = now
+			continue
+		}
+		period := time.Duration(item.RestockSeconds) * time.Second
+		units := int(now.Sub(s.restocked[i]) / period)
+		if units == 0 {
+			continue
+		}
+		s.stock[i] = minInt(s.stock[i]+units, item.Stock)
+		s.restocked[i] = s.restocked[i].Add(time.Duration(units) * period)
+	}
+}
+
+// BuybackEntry is a stack a character sold and can buy back for what
+// they were paid
+type BuybackEntry struct {
+	Shop  string
+	Stack ItemStack
+	Price int
+	Sold  time.Time
+}
+
+// Vendors keeps the stock of every shop and the stacks each character
+// sold recently; shops and buyback are shared by every zone
+type Vendors struct {
+	shops   map[string]*shopStock
+	buyback map[string][]BuybackEntry
+	mu      sync.Mutex
+}
+
+// NewVendors opens every shop fully stocked
+func NewVendors(shops map[string]*ShopDefinition) *Vendors {
+	vendors := &Vendors{
+		shops:   make(map[string]*shopStock),
+		buyback: make(map[string][]BuybackEntry),
+	}
+
+	now := time.Now()
+	for id, definition := range shops {
+		stock := &shopStock{
+			definition: definition,
+			stock:      make([]int, len(definition.Items)),
+			restocked:  make([]time.Time, len(definition.Items)),
+		}
+		for i, item := range definition.Items {
+			stock.stock[i] = item.Stock
+			stock.restocked[i] = now
+		}
+		vendors.shops[id] = stock
+	}
+	return vendors
+}
+
+// Reload switches the shops to reloaded definitions. Limited stock
+// carries over for items still sold with the same limit, other items
+// start fully stocked, and buyback of items that no longer exist is
+// dropped
+func (v *Vendors) Reload(shops map[string]*ShopDefinition, items map[string]*ItemDefinition, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	reloaded := make(map[string]*shopStock, len(shops))
+	for id, definition := range shops {
+		stock := &shopStock{
+			definition: definition,
+			stock:      make([]int, len(definition.Items)),
+			restocked:  make([]time.Time, len(definition.Items)),
+		}
+		previous := v.shops[id]
+		if previous != nil {
+			previous.restock(now)
+		}
+		for i, item := range definition.Items {
+			stock.stock[i] = item.Stock
+			stock.restocked[i] = now
+			if previous == nil {
+				continue
+			}
+			for j, old := range previous.definition.Items {
+				if old.Item == item.Item && old.Stock == item.Stock {
+					stock.stock[i] = previous.stock[j]
+					stock.restocked[i] = previous.restocked[j]
+					break
+				}
+			}
+		}
+		reloaded[id] = stock
+	}
+	v.shops = reloaded
+
+	for name, entries := range v.buyback {
+		kept := entries[:0]
+		for _, entry := range entries {
+			if _, exists := items[entry.Stack.ItemID]; exists {
+				kept = append(kept, entry)
+			}
+		}
+		if len(kept) == 0 {
+			delete(v.buyback, name)
+			continue
+		}
+		v.buyback[name] = kept
+	}
+}
+
+// Reserve takes units of an item off a shop's shelf and returns the
+// price of one; limited stock is only restored by Release or restocking
+func (v *Vendors) Reserve(shopID, itemID string, quantity int, now time.Time) (int, error) {
+	if quantity <= 0 {
+		return 0, ErrBadQuantity
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	shop, exists := v.shops[shopID]
+	if !exists {
+		return 0, ErrUnknownShop
+	}
+	shop.restock(now)
+
+	for i, item := range shop.definition.Items {
+		if item.Item != itemID {
+			continue
+		}
+		if item.Stock > 0 {
+			if shop.stock[i] < quantity {
+				return 0, ErrOutOfStock
+			}
+			shop.stock[i] -= quantity
+		}
+		return item.Price, nil
+	}
+	return 0, ErrNotForSale
+}
+
+// Release puts reserved units back on the shelf when a purchase fails
+func (v *Vendors) Release(shopID, itemID string, quantity int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	shop, exists := v.shops[shopID]
+	if !exists {
+		return
+	}
+	for i, item := range shop.definition.Items {
+		if item.Item == itemID && item.Stock > 0 {
+			shop.stock[i] = minInt(shop.stock[i]+quantity, item.Stock)
+			return
+		}
+	}
+}
+
+// AddBuyback remembers a stack a character sold, forgetting the oldest
+// once they have BuybackSize of them
+func (v *Vendors) AddBuyback(name string, entry BuybackEntry) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	entries := append(v.buyback[name], entry)
+	if len(entries) > BuybackSize {
+		entries = entries[len(entries)-BuybackSize:]
+	}
+	v.buyback[name] = entries
+}
+
+// TakeBuyback removes a stack from a character's buyback list
+func (v *Vendors) TakeBuyback(name string, index int, now time.Time) (BuybackEntry, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	entries := v.expireBuyback(name, now)
+	if index < 0 || index >= len(entries) {
+		return BuybackEntry{}, ErrNoBuyback
+	}
+	entry := entries[index]
+	v.buyback[name] = append(entries[:index:index], entries[index+1:]...)
+	return entry, nil
+}
+
+// expireBuyback drops the stacks sold too long ago; the caller holds the lock
+func (v *Vendors) expireBuyback(name string, now time.Time) []BuybackEntry {
+	entries := v.buyback[name]
+	kept := entries[:0]
+	for _, entry := range entries {
+		if now.Sub(entry.Sold) < BuybackDuration {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == 0 {
+		delete(v.buyback, name)
+		return nil
+	}
+	v.buyback[name] = kept
+	return kept
+}
+
+// Message returns the shop message listing a shop's wares and the
+// character's buyback, with -1 standing for unlimited stock
+func (v *Vendors) Message(shopID, npcID, name string, items map[string]*ItemDefinition, now time.Time) (map[string]interface{}, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	shop, exists := v.shops[shopID]
+	if !exists {
+		return nil, ErrUnknownShop
+	}
+	shop.restock(now)
+
+	wares := make([]map[string]interface{}, 0, len(shop.definition.Items))
+	for i, item := range shop.definition.Items {
+		stock := -1
+		if item.Stock > 0 {
+			stock = shop.stock[i]
+		}
+		wares = append(wares, map[string]interface{}{
+			"item_id": item.Item,
+			"name":    items[item.Item].Name,
+			"price":   item.Price,
+			"stock":   stock,
+		})
+	}
+
+	buyback := make([]map[string]interface{}, 0)
+	for i, entry := range v.expireBuyback(name, now) {
+		buyback = append(buyback, map[string]interface{}{
+			"index":    i,
+			"item_id":  entry.Stack.ItemID,
+			"name":     items[entry.Stack.ItemID].Name,
+			"quantity": entry.Stack.Quantity,
+			"price":    entry.Price,
+		})
+	}
+
+	return map[string]interface{}{
+		"type":    "shop",
+		"shop":    shopID,
+		"name":    shop.definition.Name,
+		"npc_id":  npcID,
+		"items":   wares,
+		"buyback": buyback,
+	}, nil
+}
@@ -0,0 +1,328 @@
+package game
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Statistics tracked for every character
+const (
+	StatisticKills           = "kills"
+	StatisticDeaths          = "deaths"
+	StatisticDuelsWon        = "duels_won"
+	StatisticDuelsLost       = "duels_lost"
+	StatisticDistanceWalked  = "distance_walked"
+	StatisticPlayTime        = "play_time"
+	StatisticQuestsCompleted = "quests_completed"
+)
+
+// KnownStatistics lists every tracked statistic in display order
+var KnownStatistics = []string{
+	StatisticKills,
+	StatisticDeaths,
+	StatisticDuelsWon,
+	StatisticDuelsLost,
+	StatisticDistanceWalked,
+	StatisticPlayTime,
+	StatisticQuestsCompleted,
+}
+
+const (
+	// statisticsFlushInterval is how often the statistics of online
+	// characters are written to the database
+	statisticsFlushInterval = 30 * time.Second
+	// LeaderboardPageSize is how many characters a leaderboard page lists
+	LeaderboardPageSize = 10
+	// SeasonAllTime names the leaderboard summed over every season
+	SeasonAllTime = "all"
+	// seasonLayout is how seasons are named: one season per calendar month
+	seasonLayout = "2006-01"
+)
+
+var (
+	ErrUnknownStatistic = errors.New("unknown statistic")
+	ErrUnknownSeason    = errors.New("unknown season")
+)
+
+// SeasonAt returns the season a moment falls in. Seasons follow the
+// calendar months in UTC, so the seasonal leaderboards start over on the
+// first of every month
+func SeasonAt(now time.Time) string {
+	return now.UTC().Format(seasonLayout)
+}
+
+// knownStatistic reports whether a statistic is tracked
+func knownStatistic(stat string) bool {
+	for _, known := range KnownStatistics {
+		if known == stat {
+			return true
+		}
+	}
+	return false
+}
+
+// Statistics are a character's running totals for the current season
+// and for all time. Changes are kept pending until they are flushed to
+// the database, which adds them to what it already holds
+type Statistics struct {
+	season   string
+	seasonal map[string]float64
+	lifetime map[string]float64
+	pending  map[string]float64
+	// counted is when play time was last added
+	counted time.Time
+	mu      sync.Mutex
+}
+
+// NewStatistics creates empty statistics starting in the current season
+func NewStatistics() *Statistics {
+	now := time.Now()
+	return &Statistics{
+		season:   SeasonAt(now),
+		seasonal: make(map[string]float64),
+		lifetime: make(map[string]float64),
+		pending:  make(map[string]float64),
+		counted:  now,
+	}
+}
+
+// Add adds to one of the character's statistics
+func (s *Statistics) Add(stat string, amount float64) {
+	if amount <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(stat, amount)
+}
+
+// add adds to a statistic; the caller holds the lock
+func (s *Statistics) add(stat string, amount float64) {
+	s.seasonal[stat] += amount
+	s.lifetime[stat] += amount
+	s.pending[stat] += amount
+}
+
+// Get returns the character's total of a statistic this season
+func (s *Statistics) Get(stat string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seasonal[stat]
+}
+
+// Lifetime returns the character's total of a statistic over all seasons
+func (s *Statistics) Lifetime(stat string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lifetime[stat]
+}
+
+// load replaces the totals with those saved per season, keeping changes
+// made since the character logged in
+func (s *Statistics) load(saved map[string]map[string]float64, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.season = SeasonAt(now)
+	s.seasonal = make(map[string]float64)
+	s.lifetime = make(map[string]float64)
+	for season, totals := range saved {
+		for stat, value := range totals {
+			s.lifetime[stat] += value
+			if season == s.season {
+				s.seasonal[stat] += value
+			}
+		}
+	}
+	for stat, value := range s.pending {
+		s.seasonal[stat] += value
+		s.lifetime[stat] += value
+	}
+	s.counted = now
+}
+
+// takePending adds the play time since it was last counted and hands
+// over the changes not yet saved along with the season they belong to.
+// Once a new season has begun the seasonal totals start over
+func (s *Statistics) takePending(now time.Time) (string, map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if played := now.Sub(s.counted).Seconds(); played > 0 {
+		s.add(StatisticPlayTime, played)
+	}
+	s.counted = now
+
+	season, pending := s.season, s.pending
+	s.pending = make(map[string]float64)
+	if current := SeasonAt(now); current != s.season {
+		s.season = current
+		s.seasonal = make(map[string]float64)
+	}
+	return season, pending
+}
+
+// restorePending puts back changes that could not be saved so the next
+// flush tries again
+func (s *Statistics) restorePending(pending map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for stat, value := range pending {
+		s.pending[stat] += value
+	}
+}
+
+// Message returns the statistics message describing the character's
+// totals this season and for all time, play time included up to now
+func (s *Statistics) Message() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seasonal := make(map[string]float64, len(KnownStatistics))
+	lifetime := make(map[string]float64, len(KnownStatistics))
+	for _, stat := range KnownStatistics {
+		seasonal[stat] = s.seasonal[stat]
+		lifetime[stat] = s.lifetime[stat]
+	}
+	played := time.Since(s.counted).Seconds()
+	seasonal[StatisticPlayTime] += played
+	lifetime[StatisticPlayTime] += played
+	return map[string]interface{}{
+		"type":     "statistics",
+		"season":   s.season,
+		"seasonal": seasonal,
+		"lifetime": lifetime,
+	}
+}
+
+// LeaderboardEntry is one character's place on a leaderboard
+type LeaderboardEntry struct {
+	Rank  int     `json:"rank"`
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// Leaderboard is one page of the characters with the highest total of a
+// statistic in a season, or over all seasons
+type Leaderboard struct {
+	Stat    string             `json:"stat"`
+	Season  string             `json:"season"`
+	Page    int                `json:"page"`
+	Pages   int                `json:"pages"`
+	Total   int                `json:"total"`
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+// Message returns the leaderboard message sent to clients
+func (l *Leaderboard) Message() map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "leaderboard",
+		"stat":    l.Stat,
+		"season":  l.Season,
+		"page":    l.Page,
+		"pages":   l.Pages,
+		"total":   l.Total,
+		"entries": l.Entries,
+	}
+}
+
+// Leaderboard returns a page of a statistic's leaderboard, counted from
+// zero. An empty season means the current one and SeasonAllTime sums
+// every season. Totals are read from the database, so the last few
+// seconds of play may not count yet
+func (zm *ZoneManager) Leaderboard(stat, season string, page int) (*Leaderboard, error) {
+	if zm.database == nil {
+		return nil, ErrNoDatabase
+	}
+	if !knownStatistic(stat) {
+		return nil, ErrUnknownStatistic
+	}
+	if season == "" {
+		season = SeasonAt(time.Now())
+	}
+	if season != SeasonAllTime {
+		if _, err := time.Parse(seasonLayout, season); err != nil {
+			return nil, ErrUnknownSeason
+		}
+	}
+
+	page = maxInt(page, 0)
+	entries, total, err := zm.database.Leaderboard(stat, season, LeaderboardPageSize, page*LeaderboardPageSize)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].Rank = page*LeaderboardPageSize + i + 1
+	}
+	return &Leaderboard{
+		Stat:    stat,
+		Season:  season,
+		Page:    page,
+		Pages:   (total + LeaderboardPageSize - 1) / LeaderboardPageSize,
+		Total:   total,
+		Entries: entries,
+	}, nil
+}
+
+// loadStatistics reads a logging-in character's statistics
+func (zm *ZoneManager) loadStatistics(player *Player) {
+	saved, err := zm.database.LoadStatistics(player.Name)
+	if err != nil {
+		log.Printf("Failed to load statistics of %s: %v", player.Name, err)
+		return
+	}
+	player.Statistics.load(saved, time.Now())
+}
+
+// flushStatistics adds a character's unsaved statistics to the database
+func (zm *ZoneManager) flushStatistics(player *Player) {
+	if !zm.persistent(player) {
+		return
+	}
+	season, pending := player.Statistics.takePending(time.Now())
+	zm.Events.Publish(StatisticChanged{Player: player, Statistic: StatisticPlayTime, Total: player.Statistics.Lifetime(StatisticPlayTime)})
+	if len(pending) == 0 {
+		return
+	}
+	if err := zm.database.AddStatistics(player.Name, season, pending); err != nil {
+		log.Printf("Failed to save statistics of %s: %v", player.Name, err)
+		player.Statistics.restorePending(pending)
+	}
+}
+
+// onlinePlayers returns every player in a zone or on their way to one
+func (zm *ZoneManager) onlinePlayers() []*Player {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+
+	players := make([]*Player, 0, len(zm.playerZones)+len(zm.transfers))
+	for id, world := range zm.playerZones {
+		if player, exists := world.GetPlayer(id); exists {
+			players = append(players, player)
+		}
+	}
+	for _, transfer := range zm.transfers {
+		players = append(players, transfer.player)
+	}
+	return players
+}
+
+// runStatisticsFlush periodically saves the statistics of online
+// characters until stopped
+func (zm *ZoneManager) runStatisticsFlush(stop chan struct{}) {
+	ticker := time.NewTicker(statisticsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, player := range zm.onlinePlayers() {
+				zm.flushStatistics(player)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package game
+
+import "math"
+
+// Stats status effects can modify
+const (
+	StatMaxHealth = "max_health"
+	StatMaxMana   = "max_mana"
+	// StatDamage raises or lowers the damage dealt, in percent
+	StatDamage = "damage_percent"
+	// StatDamageTaken raises or lowers the damage taken, in percent
+	StatDamageTaken = "damage_taken_percent"
+	// StatSpeed raises or lowers movement speed, in percent
+	StatSpeed = "speed_percent"
+)
+
+// knownStats are the stats content files may modify
+var knownStats = map[string]bool{
+	StatMaxHealth:   true,
+	StatMaxMana:     true,
+	StatDamage:      true,
+	StatDamageTaken: true,
+	StatSpeed:       true,
+}
+
+// minSpeedFactor keeps slowed movement from stopping altogether; only
+// roots and stuns do that
+const minSpeedFactor = 0.1
+
+// Stats are final stat values: base values with the modifiers of every
+// active status effect added on top
+type Stats map[string]float64
+
+// ComputeStats runs base stats through the modifiers of status effects
+func ComputeStats(base Stats, effects *StatusEffects) Stats {
+	stats := make(Stats, len(base))
+	for stat, value := range base {
+		stats[stat] = value
+	}
+	if effects != nil {
+		for stat, value := range effects.Modifiers() {
+			stats[stat] += value
+		}
+	}
+	return stats
+}
+
+// playerBaseStats are the stats every character starts from
+func playerBaseStats() Stats {
+	return Stats{
+		StatMaxHealth: DefaultMaxHealth,
+		StatMaxMana:   DefaultMaxMana,
+	}
+}
+
+// DamageDealtFactor is what damage dealt is multiplied by
+func (s Stats) DamageDealtFactor() float64 {
+	return math.Max(0, 1+s[StatDamage]/100)
+}
+
+// DamageTakenFactor is what damage taken is multiplied by
+func (s Stats) DamageTakenFactor() float64 {
+	return math.Max(0, 1+s[StatDamageTaken]/100)
+}
+
+// SpeedFactor is what movement speed is multiplied by
+func (s Stats) SpeedFactor() float64 {
+	return math.Max(minSpeedFactor, 1+s[StatSpeed]/100)
+}
+
+// Stats returns the player's stats after their status effects
+func (p *Player) Stats() Stats {
+	return ComputeStats(playerBaseStats(), p.Effects)
+}
+
+// MoveSpeedFactor returns what the player's movement speed is multiplied
+// by: 0 while dead, rooted or stunned
+func (p *Player) MoveSpeedFactor() float64 {
+	if p.Life.State() == Dead || p.Effects.Has(ControlRoot) || p.Effects.Has(ControlStun) {
+		return 0
+	}
+	return p.Stats().SpeedFactor()
+}
+
+// refreshStats applies a player's stats to their vitals and returns the
+// messages telling them about both
+func refreshStats(player *Player) []outboundMessage {
+	stats := player.Stats()
+	player.Vitals.SetMaximums(int(stats[StatMaxHealth]), int(stats[StatMaxMana]))
+
+	return []outboundMessage{
+		{playerID: player.ID, message: player.Vitals.Message()},
+		{playerID: player.ID, message: player.StatsMessage()},
+	}
+}
+
+// StatsMessage returns the stats_update message describing the player's
+// stats and whether they can move
+func (p *Player) StatsMessage() map[string]interface{} {
+	stats := p.Stats()
+	return map[string]interface{}{
+		"type":                 "stats_update",
+		"max_health":           stats[StatMaxHealth],
+		"max_mana":             stats[StatMaxMana],
+		"damage_percent":       stats[StatDamage],
+		"damage_taken_percent": stats[StatDamageTaken],
+		"speed_percent":        stats[StatSpeed],
+		"speed":                p.MoveSpeedFactor(),
+		"rooted":               p.Effects.Has(ControlRoot),
+		"stunned":              p.Effects.Has(ControlStun),
+	}
+}
+
+// npcSpeedFactor returns what an NPC's movement speed is multiplied by: 0
+// while rooted or stunned
+func npcSpeedFactor(npc *Entity) float64 {
+	if npc.Effects == nil {
+		return 1
+	}
+	if npc.Effects.Has(ControlRoot) || npc.Effects.Has(ControlStun) {
+		return 0
+	}
+	return ComputeStats(nil, npc.Effects).SpeedFactor()
+}
+
+// scaleDamage applies the attacker's and the target's stats to damage
+func scaleDamage(damage int, attacker, target Stats) int {
+	scaled := float64(damage) * attacker.DamageDealtFactor() * target.DamageTakenFactor()
+	return int(math.Round(scaled))
+}
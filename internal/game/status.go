@@ -0,0 +1,543 @@
+package game
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// persistentStatusSeconds is how long a status effect has to last for
+// it to be saved with the character when they log out
+const persistentStatusSeconds = 60
+
+// Crowd-control states a status effect can put its bearer in
+const (
+	// ControlStun keeps its bearer from moving, casting and attacking
+	ControlStun = "stun"
+	// ControlRoot keeps its bearer from moving
+	ControlRoot = "root"
+)
+
+// Reasons a status effect ends
+const (
+	StatusExpired   = "expired"
+	StatusDispelled = "dispelled"
+	StatusCancelled = "cancelled"
+	StatusFaded     = "faded"
+)
+
+var (
+	ErrStunned         = errors.New("you are stunned")
+	ErrUnknownStatus   = errors.New("unknown status effect")
+	ErrCannotCancelOut = errors.New("only your own buffs can be cancelled")
+)
+
+// StatusEffectDefinition describes a buff or debuff, as written in
+// status_effects.json
+type StatusEffectDefinition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Debuff effects are harmful; abilities put them on enemies
+	Debuff          bool    `json:"debuff"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	MaxStacks       int     `json:"max_stacks"`
+	// TickSeconds, TickDamage and TickHeal make damage or healing over
+	// time, dealt per stack every tick
+	TickSeconds float64 `json:"tick_seconds"`
+	TickDamage  int     `json:"tick_damage"`
+	TickHeal    int     `json:"tick_heal"`
+	// Modifiers add to stats per stack
+	Modifiers map[string]float64 `json:"modifiers"`
+	// Control lists crowd-control states, stun or root
+	Control []string `json:"control"`
+	// Dispel is the category dispels remove the effect by; effects
+	// without one cannot be dispelled
+	Dispel string `json:"dispel"`
+}
+
+// applyDefaults fills optional fields left out of the content file
+func (d *StatusEffectDefinition) applyDefaults() {
+	if d.Name == "" {
+		d.Name = d.ID
+	}
+	if d.MaxStacks <= 0 {
+		d.MaxStacks = 1
+	}
+	if d.Control == nil {
+		d.Control = []string{}
+	}
+}
+
+// persistent reports whether the effect lasts long enough to be saved
+func (d *StatusEffectDefinition) persistent() bool {
+	return d.DurationSeconds >= persistentStatusSeconds
+}
+
+// ActiveStatus is a status effect on a player or NPC
+type ActiveStatus struct {
+	Definition *StatusEffectDefinition
+	Stacks     int
+	// SourceID is the player who applied the effect
+	SourceID string
+	Expires  time.Time
+	nextTick time.Time
+}
+
+// statusTick is one tick of damage or healing over time due now
+type statusTick struct {
+	status *ActiveStatus
+	damage int
+	heal   int
+}
+
+// SavedStatus is a status effect as kept in the database between sessions
+type SavedStatus struct {
+	EffectID  string
+	Stacks    int
+	SourceID  string
+	Remaining time.Duration
+}
+
+// StatusEffects holds the status effects on one player or NPC
+type StatusEffects struct {
+	active map[string]*ActiveStatus
+	mu     sync.Mutex
+}
+
+// NewStatusEffects creates an empty set of status effects
+func NewStatusEffects() *StatusEffects {
+	return &StatusEffects{active: make(map[string]*ActiveStatus)}
+}
+
+// Apply puts a status effect on, or adds stacks to it and refreshes its
+// duration when it is already there. It returns the effect as it now is
+func (s *StatusEffects) Apply(definition *StatusEffectDefinition, stacks int, sourceID string, now time.Time) ActiveStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stacks <= 0 {
+		stacks = 1
+	}
+	expires := now.Add(time.Duration(definition.DurationSeconds * float64(time.Second)))
+	status, exists := s.active[definition.ID]
+	if !exists {
+		status = &ActiveStatus{Definition: definition, nextTick: now.Add(tickInterval(definition))}
+		s.active[definition.ID] = status
+	}
+	status.Stacks = minInt(status.Stacks+stacks, definition.MaxStacks)
+	status.SourceID = sourceID
+	status.Expires = expires
+	return *status
+}
+
+// Remove takes a status effect off, reporting whether it was there
+func (s *StatusEffects) Remove(effectID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.active[effectID]
+	delete(s.active, effectID)
+	return exists
+}
+
+// Dispel removes up to count effects of a dispel category, buffs or
+// debuffs, longest lasting first, and returns the IDs of those removed
+func (s *StatusEffects) Dispel(category string, debuffs bool, count int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matching []*ActiveStatus
+	for _, status := range s.active {
+		if status.Definition.Dispel == category && status.Definition.Debuff == debuffs {
+			matching = append(matching, status)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].Expires.After(matching[j].Expires)
+	})
+
+	var removed []string
+	for _, status := range matching {
+		if len(removed) == count {
+			break
+		}
+		delete(s.active, status.Definition.ID)
+		removed = append(removed, status.Definition.ID)
+	}
+	return removed
+}
+
+// Clear removes every status effect
+func (s *StatusEffects) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active = make(map[string]*ActiveStatus)
+}
+
+// Advance removes the effects that ran out and returns them together with
+// the ticks of damage and healing over time that came due
+func (s *StatusEffects) Advance(now time.Time) ([]ActiveStatus, []statusTick) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []ActiveStatus
+	var ticks []statusTick
+	for id, status := range s.active {
+		definition := status.Definition
+		if definition.TickSeconds > 0 {
+			for !status.nextTick.After(now) && !status.nextTick.After(status.Expires) {
+				ticks = append(ticks, statusTick{
+					status: status,
+					damage: definition.TickDamage * status.Stacks,
+					heal:   definition.TickHeal * status.Stacks,
+				})
+				status.nextTick = status.nextTick.Add(tickInterval(definition))
+			}
+		}
+		if !now.Before(status.Expires) {
+			delete(s.active, id)
+			expired = append(expired, *status)
+		}
+	}
+	return expired, ticks
+}
+
+// Has reports whether any effect puts its bearer in a crowd-control state
+func (s *StatusEffects) Has(control string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, status := range s.active {
+		for _, state := range status.Definition.Control {
+			if state == control {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Get returns one active effect
+func (s *StatusEffects) Get(effectID string) (ActiveStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, exists := s.active[effectID]
+	if !exists {
+		return ActiveStatus{}, false
+	}
+	return *status, true
+}
+
+// Modifiers returns the stat modifiers of every effect added up
+func (s *StatusEffects) Modifiers() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	modifiers := make(Stats)
+	for _, status := range s.active {
+		for stat, value := range status.Definition.Modifiers {
+			modifiers[stat] += value * float64(status.Stacks)
+		}
+	}
+	return modifiers
+}
+
+// Snapshot returns the active effects, soonest to run out first
+func (s *StatusEffects) Snapshot() []ActiveStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]ActiveStatus, 0, len(s.active))
+	for _, status := range s.active {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Expires.Before(statuses[j].Expires)
+	})
+	return statuses
+}
+
+// Persistent returns the long-lasting effects worth saving with the
+// character and how long each has left
+func (s *StatusEffects) Persistent(now time.Time) []SavedStatus {
+	var saved []SavedStatus
+	for _, status := range s.Snapshot() {
+		if status.Definition.persistent() && status.Expires.After(now) {
+			saved = append(saved, SavedStatus{
+				EffectID:  status.Definition.ID,
+				Stacks:    status.Stacks,
+				SourceID:  status.SourceID,
+				Remaining: status.Expires.Sub(now),
+			})
+		}
+	}
+	return saved
+}
+
+// Restore puts back the effects saved with a character, each with the
+// time it had left when they logged out
+func (s *StatusEffects) Restore(saved []SavedStatus, definitions map[string]*StatusEffectDefinition, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range saved {
+		definition, exists := definitions[entry.EffectID]
+		if !exists {
+			continue
+		}
+		s.active[definition.ID] = &ActiveStatus{
+			Definition: definition,
+			Stacks:     minInt(maxInt(entry.Stacks, 1), definition.MaxStacks),
+			SourceID:   entry.SourceID,
+			Expires:    now.Add(entry.Remaining),
+			nextTick:   now.Add(tickInterval(definition)),
+		}
+	}
+}
+
+// Refit moves the effects onto reloaded definitions, capping their
+// stacks, and returns the IDs of the effects whose definition is gone,
+// which are removed
+func (s *StatusEffects) Refit(definitions map[string]*StatusEffectDefinition) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed []string
+	for effectID, status := range s.active {
+		definition, exists := definitions[effectID]
+		if !exists {
+			delete(s.active, effectID)
+			removed = append(removed, effectID)
+			continue
+		}
+		status.Definition = definition
+		status.Stacks = minInt(status.Stacks, definition.MaxStacks)
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// Message returns the effects_update message listing a player's effects
+func (s *StatusEffects) Message(targetID string, now time.Time) map[string]interface{} {
+	statuses := s.Snapshot()
+	effects := make([]map[string]interface{}, 0, len(statuses))
+	for _, status := range statuses {
+		effects = append(effects, statusAppearance(targetID, status, now))
+	}
+
+	return map[string]interface{}{
+		"type":    "effects_update",
+		"effects": effects,
+	}
+}
+
+func tickInterval(definition *StatusEffectDefinition) time.Duration {
+	if definition.TickSeconds <= 0 {
+		return time.Duration(definition.DurationSeconds * float64(time.Second))
+	}
+	return time.Duration(definition.TickSeconds * float64(time.Second))
+}
+
+func statusAppearance(targetID string, status ActiveStatus, now time.Time) map[string]interface{} {
+	definition := status.Definition
+	return map[string]interface{}{
+		"target_id": targetID,
+		"effect_id": definition.ID,
+		"name":      definition.Name,
+		"debuff":    definition.Debuff,
+		"stacks":    status.Stacks,
+		"seconds":   status.Expires.Sub(now).Seconds(),
+		"source_id": status.SourceID,
+		"control":   definition.Control,
+		"dispel":    definition.Dispel,
+	}
+}
+
+// applyStatusToPlayer puts a status effect on a player, interrupting
+// their cast when it stuns them; the caller holds the world lock
+func (w *World) applyStatusToPlayer(player *Player, definition *StatusEffectDefinition, stacks int, sourceID string, now time.Time) []outboundMessage {
+	status := player.Effects.Apply(definition, stacks, sourceID, now)
+
+	position := player.GetPosition()
+	applied := statusAppearance(player.ID, status, now)
+	applied["type"] = "effect_applied"
+	messages := []outboundMessage{{near: &position, message: applied}}
+	messages = append(messages, refreshStats(player)...)
+	if player.Effects.Has(ControlStun) {
+		messages = append(messages, w.interruptCast(player.ID, "stunned")...)
+	}
+	return messages
+}
+
+// applyStatusToNPC puts a status effect on an NPC; the caller holds the
+// world lock
+func (w *World) applyStatusToNPC(npc *Entity, definition *StatusEffectDefinition, stacks int, sourceID string, now time.Time) []outboundMessage {
+	status := npc.Effects.Apply(definition, stacks, sourceID, now)
+
+	position := npc.Position
+	applied := statusAppearance(npc.ID, status, now)
+	applied["type"] = "effect_applied"
+	return []outboundMessage{{near: &position, message: applied}}
+}
+
+// statusRemoved builds the message telling nearby players an effect ended
+func statusRemoved(targetID, effectID, reason string, position Position) outboundMessage {
+	return outboundMessage{near: &position, message: map[string]interface{}{
+		"type":      "effect_removed",
+		"target_id": targetID,
+		"effect_id": effectID,
+		"reason":    reason,
+	}}
+}
+
+// dispelPlayer removes debuffs of a dispel category from a player; the
+// caller holds the world lock
+func (w *World) dispelPlayer(player *Player, category string, count int) []outboundMessage {
+	removed := player.Effects.Dispel(category, true, count)
+	if len(removed) == 0 {
+		return nil
+	}
+
+	position := player.GetPosition()
+	var messages []outboundMessage
+	for _, effectID := range removed {
+		messages = append(messages, statusRemoved(player.ID, effectID, StatusDispelled, position))
+	}
+	return append(messages, refreshStats(player)...)
+}
+
+// CancelStatus lets a player take one of their own buffs off
+func (w *World) CancelStatus(playerID, effectID string) error {
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return errors.New("player not found")
+	}
+	status, exists := player.Effects.Get(effectID)
+	if !exists {
+		w.mu.Unlock()
+		return ErrUnknownStatus
+	}
+	if status.Definition.Debuff {
+		w.mu.Unlock()
+		return ErrCannotCancelOut
+	}
+
+	player.Effects.Remove(effectID)
+	messages := []outboundMessage{statusRemoved(player.ID, effectID, StatusCancelled, player.GetPosition())}
+	messages = append(messages, refreshStats(player)...)
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	return nil
+}
+
+// updateStatusEffects ends the effects that ran out and deals the damage
+// and healing over time that came due, on players and NPCs alike; the
+// caller holds the world lock
+func (w *World) updateStatusEffects(now time.Time) []outboundMessage {
+	var messages []outboundMessage
+
+	for _, player := range w.Players {
+		expired, ticks := player.Effects.Advance(now)
+		for _, tick := range ticks {
+			if !player.Life.Alive() {
+				break
+			}
+			if tick.damage > 0 {
+				damage := scaleDamage(tick.damage, nil, player.Stats())
+				// Damage from another player cannot finish off a duel opponent
+				if source, exists := w.Players[tick.status.SourceID]; exists && source != player {
+					messages = append(messages, w.strikePlayer(source, player, damage)...)
+				} else {
+					messages = append(messages, w.damagePlayer(player, damage, tick.status.SourceID)...)
+				}
+			}
+			if tick.heal > 0 {
+				healed := player.Vitals.Heal(tick.heal)
+				health, maxHealth := player.Vitals.Health()
+				position := player.GetPosition()
+				messages = append(messages,
+					outboundMessage{near: &position, message: map[string]interface{}{
+						"type":       "player_healed",
+						"id":         player.ID,
+						"healer_id":  tick.status.SourceID,
+						"effect_id":  tick.status.Definition.ID,
+						"amount":     healed,
+						"health":     health,
+						"max_health": maxHealth,
+					}},
+					outboundMessage{playerID: player.ID, message: player.Vitals.Message()},
+				)
+			}
+		}
+		if len(expired) > 0 {
+			position := player.GetPosition()
+			for _, status := range expired {
+				messages = append(messages, statusRemoved(player.ID, status.Definition.ID, StatusExpired, position))
+			}
+			messages = append(messages, refreshStats(player)...)
+		}
+	}
+
+	for _, npc := range w.NPCs {
+		if npc.Effects == nil {
+			continue
+		}
+		expired, ticks := npc.Effects.Advance(now)
+		for _, tick := range ticks {
+			if npc.Health <= 0 {
+				break
+			}
+			if tick.damage > 0 {
+				messages = append(messages, w.statusDamageNPC(npc, tick, now)...)
+			}
+			if tick.heal > 0 {
+				npc.Health = minInt(npc.Health+tick.heal, npc.MaxHealth)
+			}
+		}
+		if npc.Health <= 0 {
+			continue
+		}
+		for _, status := range expired {
+			messages = append(messages, statusRemoved(npc.ID, status.Definition.ID, StatusExpired, npc.Position))
+		}
+	}
+
+	return messages
+}
+
+// statusDamageNPC deals a tick of damage over time to an NPC. Only the
+// player who applied the effect can finish the NPC off, so the effect
+// fades once they have left the zone; the caller holds the world lock
+func (w *World) statusDamageNPC(npc *Entity, tick statusTick, now time.Time) []outboundMessage {
+	definition := tick.status.Definition
+	source, exists := w.Players[tick.status.SourceID]
+	if !exists {
+		npc.Effects.Remove(definition.ID)
+		return []outboundMessage{statusRemoved(npc.ID, definition.ID, StatusFaded, npc.Position)}
+	}
+
+	damage := scaleDamage(tick.damage, source.Stats(), ComputeStats(nil, npc.Effects))
+	npc.Health = maxInt(npc.Health-damage, 0)
+	position := npc.Position
+	messages := []outboundMessage{{near: &position, message: map[string]interface{}{
+		"type":       "npc_damaged",
+		"id":         npc.ID,
+		"attacker":   source.ID,
+		"effect_id":  definition.ID,
+		"damage":     damage,
+		"health":     npc.Health,
+		"max_health": npc.MaxHealth,
+	}}}
+	if npc.Health == 0 {
+		messages = append(messages, w.killNPC(npc, source, now)...)
+	}
+	return messages
+}
@@ -0,0 +1,490 @@
+package game
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Tiled stores flip flags in the upper bits of every gid
+const tiledGIDMask = 0x0FFFFFFF
+
+type tiledProperty struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type tiledObject struct {
+	ID         int             `json:"id"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Class      string          `json:"class"`
+	X          float64         `json:"x"`
+	Y          float64         `json:"y"`
+	Width      float64         `json:"width"`
+	Height     float64         `json:"height"`
+	Point      bool            `json:"point"`
+	Properties []tiledProperty `json:"properties"`
+}
+
+type tiledLayer struct {
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Width      int             `json:"width"`
+	Height     int             `json:"height"`
+	Visible    bool            `json:"visible"`
+	Encoding   string          `json:"encoding"`
+	Compress   string          `json:"compression"`
+	Data       json.RawMessage `json:"data"`
+	Objects    []tiledObject   `json:"objects"`
+	Layers     []tiledLayer    `json:"layers"`
+	Properties []tiledProperty `json:"properties"`
+}
+
+type tiledTile struct {
+	ID    int    `json:"id"`
+	Type  string `json:"type"`
+	Class string `json:"class"`
+}
+
+type tiledTileset struct {
+	FirstGID int         `json:"firstgid"`
+	Name     string      `json:"name"`
+	Source   string      `json:"source"`
+	Tiles    []tiledTile `json:"tiles"`
+}
+
+type tiledMap struct {
+	Width       int             `json:"width"`
+	Height      int             `json:"height"`
+	TileWidth   int             `json:"tilewidth"`
+	TileHeight  int             `json:"tileheight"`
+	Orientation string          `json:"orientation"`
+	Infinite    bool            `json:"infinite"`
+	Layers      []tiledLayer    `json:"layers"`
+	Tilesets    []tiledTileset  `json:"tilesets"`
+	Properties  []tiledProperty `json:"properties"`
+}
+
+// TileLayer is a named grid of tile gids, 0 meaning empty
+type TileLayer struct {
+	Name string `json:"name"`
+	Data []int  `json:"data"`
+}
+
+// Rect is an axis-aligned rectangle in world coordinates
+type Rect struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Contains reports whether the position lies inside the rectangle
+func (r Rect) Contains(pos Position) bool {
+	return pos.X >= r.X && pos.X < r.X+r.Width && pos.Y >= r.Y && pos.Y < r.Y+r.Height
+}
+
+// Center returns the middle point of the rectangle
+func (r Rect) Center() Position {
+	return Position{X: r.X + r.Width/2, Y: r.Y + r.Height/2}
+}
+
+// SpawnPoint is a named location where players or entities appear
+type SpawnPoint struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Position   Position          `json:"position"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// Region is a named area of the map carrying designer properties
+type Region struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Bounds     Rect              `json:"bounds"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// TileMap is a collision-aware world map loaded from a Tiled JSON export
+type TileMap struct {
+	Name       string
+	Width      int
+	Height     int
+	TileWidth  int
+	TileHeight int
+	Layers     []TileLayer
+	TileTypes  map[int]string
+	Spawns     []SpawnPoint
+	Regions    []Region
+	Properties map[string]string
+	blocked    []bool
+}
+
+// LoadTileMap reads and parses a Tiled JSON map file
+func LoadTileMap(path string) (*TileMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tileMap, err := ParseTileMap(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return tileMap, nil
+}
+
+// ParseTileMap builds a TileMap from Tiled JSON data
+func ParseTileMap(data []byte) (*TileMap, error) {
+	var raw tiledMap
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	if raw.Infinite {
+		return nil, errors.New("infinite maps are not supported")
+	}
+	if raw.Orientation != "" && raw.Orientation != "orthogonal" {
+		return nil, fmt.Errorf("unsupported orientation %q", raw.Orientation)
+	}
+	if raw.Width <= 0 || raw.Height <= 0 || raw.TileWidth <= 0 || raw.TileHeight <= 0 {
+		return nil, errors.New("map dimensions must be positive")
+	}
+
+	tileMap := &TileMap{
+		Width:      raw.Width,
+		Height:     raw.Height,
+		TileWidth:  raw.TileWidth,
+		TileHeight: raw.TileHeight,
+		TileTypes:  make(map[int]string),
+		Properties: convertProperties(raw.Properties),
+		blocked:    make([]bool, raw.Width*raw.Height),
+	}
+	tileMap.Name = tileMap.Properties["name"]
+
+	for _, tileset := range raw.Tilesets {
+		if tileset.Source != "" {
+			return nil, fmt.Errorf("external tileset %q is not supported, embed it in the map", tileset.Source)
+		}
+		for _, tile := range tileset.Tiles {
+			tileType := tile.Class
+			if tileType == "" {
+				tileType = tile.Type
+			}
+			if tileType != "" {
+				tileMap.TileTypes[tileset.FirstGID+tile.ID] = tileType
+			}
+		}
+	}
+
+	if err := tileMap.addLayers(raw.Layers); err != nil {
+		return nil, err
+	}
+
+	return tileMap, nil
+}
+
+// addLayers walks Tiled layers, descending into groups
+func (m *TileMap) addLayers(layers []tiledLayer) error {
+	for _, layer := range layers {
+		switch layer.Type {
+		case "group":
+			if err := m.addLayers(layer.Layers); err != nil {
+				return err
+			}
+		case "tilelayer":
+			data, err := decodeTileData(layer)
+			if err != nil {
+				return fmt.Errorf("layer %q: %w", layer.Name, err)
+			}
+			if len(data) != m.Width*m.Height {
+				return fmt.Errorf("layer %q has %d tiles, expected %d", layer.Name, len(data), m.Width*m.Height)
+			}
+
+			properties := convertProperties(layer.Properties)
+			if strings.EqualFold(layer.Name, "collision") || properties["collision"] == "true" {
+				for i, gid := range data {
+					if gid != 0 {
+						m.blocked[i] = true
+					}
+				}
+				continue
+			}
+
+			m.Layers = append(m.Layers, TileLayer{Name: layer.Name, Data: data})
+		case "objectgroup":
+			m.addObjects(layer)
+		}
+	}
+	return nil
+}
+
+// addObjects converts Tiled objects into spawn points and regions
+func (m *TileMap) addObjects(layer tiledLayer) {
+	layerName := strings.ToLower(layer.Name)
+
+	for _, object := range layer.Objects {
+		objectType := strings.ToLower(object.Class)
+		if objectType == "" {
+			objectType = strings.ToLower(object.Type)
+		}
+		properties := convertProperties(object.Properties)
+
+		if object.Point || object.Width == 0 && object.Height == 0 {
+			if objectType == "" && layerName == "spawns" {
+				objectType = "spawn"
+			}
+			m.Spawns = append(m.Spawns, SpawnPoint{
+				Name:       object.Name,
+				Type:       objectType,
+				Position:   Position{X: object.X, Y: object.Y},
+				Properties: properties,
+			})
+			continue
+		}
+
+		if objectType == "" {
+			objectType = "region"
+		}
+		m.Regions = append(m.Regions, Region{
+			Name:       object.Name,
+			Type:       objectType,
+			Bounds:     Rect{X: object.X, Y: object.Y, Width: object.Width, Height: object.Height},
+			Properties: properties,
+		})
+	}
+}
+
+// decodeTileData reads CSV-style arrays or uncompressed base64 tile data
+func decodeTileData(layer tiledLayer) ([]int, error) {
+	if layer.Encoding == "" || layer.Encoding == "csv" {
+		var data []int64
+		if err := json.Unmarshal(layer.Data, &data); err != nil {
+			return nil, err
+		}
+		tiles := make([]int, len(data))
+		for i, gid := range data {
+			tiles[i] = int(gid & tiledGIDMask)
+		}
+		return tiles, nil
+	}
+
+	if layer.Encoding != "base64" {
+		return nil, fmt.Errorf("unsupported encoding %q", layer.Encoding)
+	}
+	if layer.Compress != "" {
+		return nil, fmt.Errorf("unsupported compression %q", layer.Compress)
+	}
+
+	var encoded string
+	if err := json.Unmarshal(layer.Data, &encoded); err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw)%4 != 0 {
+		return nil, errors.New("base64 tile data is not a multiple of 4 bytes")
+	}
+
+	tiles := make([]int, len(raw)/4)
+	for i := range tiles {
+		tiles[i] = int(binary.LittleEndian.Uint32(raw[i*4:]) & tiledGIDMask)
+	}
+	return tiles, nil
+}
+
+// convertProperties flattens Tiled custom properties to strings
+func convertProperties(properties []tiledProperty) map[string]string {
+	result := make(map[string]string, len(properties))
+	for _, property := range properties {
+		result[property.Name] = fmt.Sprint(property.Value)
+	}
+	return result
+}
+
+// PixelWidth returns the map width in world units
+func (m *TileMap) PixelWidth() float64 {
+	return float64(m.Width * m.TileWidth)
+}
+
+// PixelHeight returns the map height in world units
+func (m *TileMap) PixelHeight() float64 {
+	return float64(m.Height * m.TileHeight)
+}
+
+// TileAt converts a world position to tile coordinates
+func (m *TileMap) TileAt(pos Position) (int, int) {
+	return int(math.Floor(pos.X / float64(m.TileWidth))), int(math.Floor(pos.Y / float64(m.TileHeight)))
+}
+
+// TileCenter returns the world position at the middle of a tile
+func (m *TileMap) TileCenter(tileX, tileY int) Position {
+	return Position{
+		X: (float64(tileX) + 0.5) * float64(m.TileWidth),
+		Y: (float64(tileY) + 0.5) * float64(m.TileHeight),
+	}
+}
+
+// IsTileBlocked reports whether a tile is solid; tiles outside the map are solid
+func (m *TileMap) IsTileBlocked(tileX, tileY int) bool {
+	if tileX < 0 || tileY < 0 || tileX >= m.Width || tileY >= m.Height {
+		return true
+	}
+	return m.blocked[tileY*m.Width+tileX]
+}
+
+// IsBlocked reports whether a world position falls on a solid tile
+func (m *TileMap) IsBlocked(pos Position) bool {
+	tileX, tileY := m.TileAt(pos)
+	return m.IsTileBlocked(tileX, tileY)
+}
+
+// SweepMove moves from one position towards another in small steps,
+// sliding along blocked tiles instead of passing through them
+func (m *TileMap) SweepMove(from, to Position) Position {
+	dx := to.X - from.X
+	dy := to.Y - from.Y
+	stepSize := float64(minInt(m.TileWidth, m.TileHeight)) / 4
+	steps := int(math.Ceil(math.Max(math.Abs(dx), math.Abs(dy)) / stepSize))
+	if steps == 0 {
+		return from
+	}
+
+	current := from
+	stepX := dx / float64(steps)
+	stepY := dy / float64(steps)
+	slid := false
+
+	for i := 0; i < steps; i++ {
+		next := Position{X: current.X + stepX, Y: current.Y + stepY, Z: current.Z}
+		switch {
+		case !m.IsBlocked(next):
+			current = next
+		case stepX != 0 && !m.IsBlocked(Position{X: next.X, Y: current.Y, Z: current.Z}):
+			current.X = next.X
+			slid = true
+		case stepY != 0 && !m.IsBlocked(Position{X: current.X, Y: next.Y, Z: current.Z}):
+			current.Y = next.Y
+			slid = true
+		default:
+			return current
+		}
+	}
+
+	// Unobstructed moves land exactly on the target, free of step rounding
+	if !slid {
+		return to
+	}
+	return current
+}
+
+// Size returns the map dimensions in tiles
+func (m *TileMap) Size() (int, int) {
+	return m.Width, m.Height
+}
+
+// Walkable reports whether a tile can be entered, for pathfinding
+func (m *TileMap) Walkable(tileX, tileY int) bool {
+	return !m.IsTileBlocked(tileX, tileY)
+}
+
+// Spawn returns the spawn point with the given name
+func (m *TileMap) Spawn(name string) (SpawnPoint, bool) {
+	for _, spawn := range m.Spawns {
+		if spawn.Name == name {
+			return spawn, true
+		}
+	}
+	return SpawnPoint{}, false
+}
+
+// SpawnsOfType returns all spawn points of the given type
+func (m *TileMap) SpawnsOfType(spawnType string) []SpawnPoint {
+	var spawns []SpawnPoint
+	for _, spawn := range m.Spawns {
+		if spawn.Type == spawnType {
+			spawns = append(spawns, spawn)
+		}
+	}
+	return spawns
+}
+
+// PlayerSpawn returns where new players enter the map, preferring the
+// spawn named "default" and falling back to the first player spawn
+func (m *TileMap) PlayerSpawn() (Position, bool) {
+	if spawn, ok := m.Spawn("default"); ok {
+		return spawn.Position, true
+	}
+	if spawns := m.SpawnsOfType("spawn"); len(spawns) > 0 {
+		return spawns[0].Position, true
+	}
+	return Position{}, false
+}
+
+// Region returns the region with the given name
+func (m *TileMap) Region(name string) (*Region, bool) {
+	for i := range m.Regions {
+		if m.Regions[i].Name == name {
+			return &m.Regions[i], true
+		}
+	}
+	return nil, false
+}
+
+// RegionsAt returns every region containing the position
+func (m *TileMap) RegionsAt(pos Position) []*Region {
+	var regions []*Region
+	for i := range m.Regions {
+		if m.Regions[i].Bounds.Contains(pos) {
+			regions = append(regions, &m.Regions[i])
+		}
+	}
+	return regions
+}
+
+// Metadata returns the map description sent to clients on join
+func (m *TileMap) Metadata() map[string]interface{} {
+	collision := make([]int, len(m.blocked))
+	for i, blocked := range m.blocked {
+		if blocked {
+			collision[i] = 1
+		}
+	}
+
+	return map[string]interface{}{
+		"type":        "map_data",
+		"name":        m.Name,
+		"width":       m.Width,
+		"height":      m.Height,
+		"tile_width":  m.TileWidth,
+		"tile_height": m.TileHeight,
+		"layers":      m.Layers,
+		"tile_types":  m.TileTypes,
+		"collision":   collision,
+		"regions":     m.Regions,
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,170 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// shopVisit is a shop a player opened by talking to a vendor
+type shopVisit struct {
+	shopID string
+	npcID  string
+}
+
+// OpenShop shows a player a vendor's wares
+func (w *World) OpenShop(player *Player, npc *Entity, shopID string) error {
+	message, err := w.vendors.Message(shopID, npc.ID, player.Name, w.Content().Items, time.Now())
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.shopVisits[player.ID] = &shopVisit{shopID: shopID, npcID: npc.ID}
+	w.mu.Unlock()
+
+	w.SendToPlayer(player.ID, message)
+	return nil
+}
+
+// CloseShop forgets the shop a player had open
+func (w *World) CloseShop(playerID string) {
+	w.mu.Lock()
+	delete(w.shopVisits, playerID)
+	w.mu.Unlock()
+}
+
+// BuyItem buys items from the shop a player has open. Stock is taken,
+// the items added and the price paid in turn, each step undone when a
+// later one fails
+func (w *World) BuyItem(playerID, itemID string, quantity int) error {
+	player, visit, err := w.shopCustomer(playerID)
+	if err != nil {
+		return err
+	}
+	definition, exists := w.Content().Items[itemID]
+	if !exists {
+		return ErrNotForSale
+	}
+
+	price, err := w.vendors.Reserve(visit.shopID, itemID, quantity, time.Now())
+	if err != nil {
+		return err
+	}
+	stack := []ItemStack{{ItemID: itemID, Quantity: quantity}}
+	if err := player.Inventory.Exchange(nil, stack, w.Content().Items); err != nil {
+		w.vendors.Release(visit.shopID, itemID, quantity)
+		return err
+	}
+	reference := fmt.Sprintf("%s/%s x%d", visit.shopID, definition.ID, quantity)
+	if err := w.currency.Debit(player, price*quantity, ReasonShopBuy, reference); err != nil {
+		w.undoExchange(player, stack, nil)
+		w.vendors.Release(visit.shopID, itemID, quantity)
+		return err
+	}
+
+	w.sendTradeResult(player, visit)
+	return nil
+}
+
+// SellItem sells items from an inventory slot to the shop a player has
+// open for the items' value; the stack can be bought back for a while
+func (w *World) SellItem(playerID string, slot, quantity int) error {
+	player, visit, err := w.shopCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	slots := player.Inventory.Snapshot()
+	if slot < 0 || slot >= len(slots) || slots[slot] == nil {
+		return ErrEmptySlot
+	}
+	definition := w.Content().Items[slots[slot].ItemID]
+	if definition == nil || definition.Value <= 0 {
+		return ErrNotSellable
+	}
+
+	stack, err := player.Inventory.TakeFromSlot(slot, quantity)
+	if err != nil {
+		return err
+	}
+	price := definition.Value * stack.Quantity
+	reference := fmt.Sprintf("%s/%s x%d", visit.shopID, stack.ItemID, stack.Quantity)
+	if err := w.currency.Credit(player, price, ReasonShopSell, reference); err != nil {
+		w.undoExchange(player, nil, []ItemStack{stack})
+		return err
+	}
+
+	w.vendors.AddBuyback(player.Name, BuybackEntry{Shop: visit.shopID, Stack: stack, Price: price, Sold: time.Now()})
+	w.sendTradeResult(player, visit)
+	return nil
+}
+
+// BuybackItem buys a stack a player sold back for what they were paid
+func (w *World) BuybackItem(playerID string, index int) error {
+	player, visit, err := w.shopCustomer(playerID)
+	if err != nil {
+		return err
+	}
+
+	entry, err := w.vendors.TakeBuyback(player.Name, index, time.Now())
+	if err != nil {
+		return err
+	}
+	stack := []ItemStack{entry.Stack}
+	if err := player.Inventory.Exchange(nil, stack, w.Content().Items); err != nil {
+		w.vendors.AddBuyback(player.Name, entry)
+		return err
+	}
+	reference := fmt.Sprintf("%s/%s x%d", entry.Shop, entry.Stack.ItemID, entry.Stack.Quantity)
+	if err := w.currency.Debit(player, entry.Price, ReasonShopBuyback, reference); err != nil {
+		w.undoExchange(player, stack, nil)
+		w.vendors.AddBuyback(player.Name, entry)
+		return err
+	}
+
+	w.sendTradeResult(player, visit)
+	return nil
+}
+
+// shopCustomer returns a player with an open shop whose vendor is still
+// within talking range
+func (w *World) shopCustomer(playerID string) (*Player, *shopVisit, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	player, exists := w.Players[playerID]
+	if !exists {
+		return nil, nil, errors.New("player not found")
+	}
+	visit, exists := w.shopVisits[playerID]
+	if !exists {
+		return nil, nil, ErrNoShopOpen
+	}
+	npc, exists := w.NPCs[visit.npcID]
+	if !exists || distance(player.GetPosition(), npc.Position) > w.settings.InteractionRange {
+		delete(w.shopVisits, playerID)
+		return nil, nil, ErrNPCTooFar
+	}
+	return player, visit, nil
+}
+
+// undoExchange reverses an inventory change of a trade that failed
+// further on; the change was just made, so the reverse fits
+func (w *World) undoExchange(player *Player, added, removed []ItemStack) {
+	if err := player.Inventory.Exchange(added, removed, w.Content().Items); err != nil {
+		log.Printf("Could not undo trade of %s: %v", player.Name, err)
+	}
+}
+
+// sendTradeResult tells a player their inventory, wallet and the shop
+// after a trade
+func (w *World) sendTradeResult(player *Player, visit *shopVisit) {
+	w.SendToPlayer(player.ID, player.Inventory.Message(w.Content().Items))
+	w.SendToPlayer(player.ID, player.Wallet.Message())
+	if message, err := w.vendors.Message(visit.shopID, visit.npcID, player.Name, w.Content().Items, time.Now()); err == nil {
+		w.SendToPlayer(player.ID, message)
+	}
+	w.deliver(w.syncCollectObjectives(player))
+}
@@ -0,0 +1,129 @@
+package game
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	// DefaultMaxHealth is the health a character starts with
+	DefaultMaxHealth = 100
+	// DefaultMaxMana is the mana a character starts with
+	DefaultMaxMana = 50
+	// manaRegenPerSecond is how fast mana comes back
+	manaRegenPerSecond = 2.0
+)
+
+// Vitals holds a character's health and mana
+type Vitals struct {
+	health    int
+	maxHealth int
+	mana      float64
+	maxMana   int
+	mu        sync.Mutex
+}
+
+// NewVitals creates full vitals at the default maximums
+func NewVitals() *Vitals {
+	return &Vitals{
+		health:    DefaultMaxHealth,
+		maxHealth: DefaultMaxHealth,
+		mana:      DefaultMaxMana,
+		maxMana:   DefaultMaxMana,
+	}
+}
+
+// Health returns the current and maximum health
+func (v *Vitals) Health() (current, max int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.health, v.maxHealth
+}
+
+// Mana returns the current and maximum mana
+func (v *Vitals) Mana() (current, max int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return int(v.mana), v.maxMana
+}
+
+// SpendMana takes mana if there is enough of it
+func (v *Vitals) SpendMana(amount int) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if int(v.mana) < amount {
+		return false
+	}
+	v.mana -= float64(amount)
+	return true
+}
+
+// Heal restores health up to the maximum and returns how much was restored
+func (v *Vitals) Heal(amount int) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	healed := minInt(amount, v.maxHealth-v.health)
+	if healed < 0 {
+		healed = 0
+	}
+	v.health += healed
+	return healed
+}
+
+// Damage takes health down to no less than zero and returns how much was taken
+func (v *Vitals) Damage(amount int) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	taken := minInt(amount, v.health)
+	v.health -= taken
+	return taken
+}
+
+// SetMaximums changes the maximum health and mana, keeping the current
+// values within them
+func (v *Vitals) SetMaximums(maxHealth, maxMana int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.maxHealth = maxInt(maxHealth, 1)
+	v.maxMana = maxInt(maxMana, 0)
+	v.health = minInt(v.health, v.maxHealth)
+	v.mana = math.Min(v.mana, float64(v.maxMana))
+}
+
+// Revive sets health and mana to a share of their maximums
+func (v *Vitals) Revive(percent int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.health = maxInt(v.maxHealth*percent/100, 1)
+	v.mana = float64(v.maxMana * percent / 100)
+}
+
+// Regenerate brings mana back over some seconds, reporting whether the
+// whole points shown to the player changed
+func (v *Vitals) Regenerate(seconds float64) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	before := int(v.mana)
+	v.mana = math.Min(float64(v.maxMana), v.mana+manaRegenPerSecond*seconds)
+	return int(v.mana) != before
+}
+
+// Message returns the vitals_update message describing the vitals
+func (v *Vitals) Message() map[string]interface{} {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return map[string]interface{}{
+		"type":       "vitals_update",
+		"health":     v.health,
+		"max_health": v.maxHealth,
+		"mana":       int(v.mana),
+		"max_mana":   v.maxMana,
+	}
+}
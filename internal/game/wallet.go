@@ -0,0 +1,176 @@
+package game
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInsufficientFunds = errors.New("not enough currency")
+	ErrInvalidAmount     = errors.New("amount must be positive")
+	ErrNoDatabase        = errors.New("the game database is unavailable")
+	ErrGuest             = errors.New("log in to trade with other characters")
+)
+
+// Reasons a currency change is recorded in the ledger with
+const (
+	ReasonOpeningBalance = "opening_balance"
+	ReasonQuestReward    = "quest_reward"
+	ReasonShopBuy        = "shop_buy"
+	ReasonShopSell       = "shop_sell"
+	ReasonShopBuyback    = "shop_buyback"
+	ReasonAuctionDeposit = "auction_deposit"
+	ReasonAuctionBid     = "auction_bid"
+	ReasonAuctionBuyout  = "auction_buyout"
+	ReasonMail           = "mail"
+)
+
+// CurrencyEntry is one row of the currency ledger: a change of a
+// character's balance, the balance it left and why it happened
+type CurrencyEntry struct {
+	Name      string
+	Delta     int
+	Balance   int
+	Reason    string
+	Reference string
+	Time      time.Time
+}
+
+// Wallet is a character's currency balance. It is only changed through
+// the CurrencyService, which records every change in the ledger
+type Wallet struct {
+	balance int
+	mu      sync.Mutex
+}
+
+// NewWallet creates an empty wallet
+func NewWallet() *Wallet {
+	return &Wallet{}
+}
+
+// Balance returns how much currency the character holds
+func (w *Wallet) Balance() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.balance
+}
+
+// Message returns the wallet_update message describing the balance
+func (w *Wallet) Message() map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "wallet_update",
+		"balance": w.Balance(),
+	}
+}
+
+// CurrencyService is the one place character currency changes: every
+// credit and debit is written to the ledger together with the new
+// balance before the wallet changes, so the ledger always explains it
+type CurrencyService struct {
+	database *Database
+}
+
+// NewCurrencyService creates the currency service; without a database
+// wallets live in memory only, as guests' wallets always do
+func NewCurrencyService(database *Database) *CurrencyService {
+	return &CurrencyService{database: database}
+}
+
+// Open loads a character's saved balance into their wallet
+func (s *CurrencyService) Open(player *Player) error {
+	if s.database == nil || player.Guest {
+		return nil
+	}
+
+	balance, err := s.database.LoadWallet(player.Name, time.Now())
+	if err != nil {
+		return err
+	}
+
+	player.Wallet.mu.Lock()
+	player.Wallet.balance = balance
+	player.Wallet.mu.Unlock()
+	return nil
+}
+
+// Credit adds currency to a character's wallet
+func (s *CurrencyService) Credit(player *Player, amount int, reason, reference string) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	return s.apply(player, amount, reason, reference)
+}
+
+// Debit takes currency from a character's wallet, failing when they
+// cannot afford it
+func (s *CurrencyService) Debit(player *Player, amount int, reason, reference string) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	return s.apply(player, -amount, reason, reference)
+}
+
+func (s *CurrencyService) apply(player *Player, delta int, reason, reference string) error {
+	return s.Transact(player, delta, reason, reference, nil)
+}
+
+// Transact changes a character's wallet by delta together with the
+// database writes of fn, all in one transaction; the wallet only changes
+// once it commits. The saved balance is changed by delta rather than
+// overwritten, and the wallet takes whatever balance that leaves. A zero
+// delta writes nothing to the ledger. Guests cannot take part in
+// transactions with database writes
+func (s *CurrencyService) Transact(player *Player, delta int, reason, reference string, fn func(tx *sql.Tx) error) error {
+	wallet := player.Wallet
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	balance := wallet.balance + delta
+	if balance < 0 {
+		return ErrInsufficientFunds
+	}
+
+	if s.database == nil || player.Guest {
+		switch {
+		case fn != nil && player.Guest:
+			return ErrGuest
+		case fn != nil:
+			return ErrNoDatabase
+		}
+		wallet.balance = balance
+		return nil
+	}
+
+	err := s.database.Transact(func(tx *sql.Tx) error {
+		if delta != 0 {
+			entry := CurrencyEntry{
+				Name:      player.Name,
+				Delta:     delta,
+				Reason:    reason,
+				Reference: reference,
+				Time:      time.Now(),
+			}
+			saved, err := recordCurrency(tx, entry)
+			if errors.Is(err, ErrInsufficientFunds) {
+				return err
+			}
+			if err != nil {
+				return fmt.Errorf("recording %s of %d for %s: %w", reason, delta, player.Name, err)
+			}
+			balance = saved
+		}
+		if fn != nil {
+			return fn(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	wallet.balance = balance
+	return nil
+}
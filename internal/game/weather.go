@@ -0,0 +1,185 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+// Weather is the weather of a zone
+type Weather string
+
+const (
+	WeatherClear Weather = "clear"
+	WeatherRain  Weather = "rain"
+	WeatherStorm Weather = "storm"
+	WeatherFog   Weather = "fog"
+)
+
+// weatherVision is the share of the AOI radius players see in each
+// kind of weather
+var weatherVision = map[Weather]float64{
+	WeatherClear: 1,
+	WeatherRain:  0.8,
+	WeatherStorm: 0.6,
+	WeatherFog:   0.4,
+}
+
+// WeatherRules describe how the weather of a zone changes, as written in
+// zones.json. Zones without transitions keep clear skies
+type WeatherRules struct {
+	Initial Weather `json:"initial"`
+	// MinMinutes and MaxMinutes bound how long one kind of weather lasts
+	MinMinutes float64 `json:"min_minutes"`
+	MaxMinutes float64 `json:"max_minutes"`
+	// Transitions weighs the weather that may follow each kind of weather
+	Transitions map[Weather]map[Weather]int `json:"transitions"`
+}
+
+// applyDefaults fills optional fields left out of the content file
+func (r *WeatherRules) applyDefaults() {
+	if r.Initial == "" {
+		r.Initial = WeatherClear
+	}
+	if r.MinMinutes <= 0 {
+		r.MinMinutes = 5
+	}
+	if r.MaxMinutes < r.MinMinutes {
+		r.MaxMinutes = r.MinMinutes
+	}
+}
+
+// validate checks that the rules only name known kinds of weather
+func (r *WeatherRules) validate() error {
+	if _, known := weatherVision[r.Initial]; !known {
+		return fmt.Errorf("unknown initial weather %q", r.Initial)
+	}
+	for from, next := range r.Transitions {
+		if _, known := weatherVision[from]; !known {
+			return fmt.Errorf("transitions from unknown weather %q", from)
+		}
+		for to, weight := range next {
+			if _, known := weatherVision[to]; !known {
+				return fmt.Errorf("transition from %q to unknown weather %q", from, to)
+			}
+			if weight < 0 {
+				return fmt.Errorf("transition from %q to %q has a negative weight", from, to)
+			}
+		}
+	}
+	return nil
+}
+
+// Weather returns the weather of every zone by zone ID
+func (zm *ZoneManager) Weather() map[string]Weather {
+	weather := make(map[string]Weather)
+	for _, world := range zm.Zones() {
+		weather[world.ID] = world.CurrentWeather()
+	}
+	return weather
+}
+
+// weatherState is the current weather of a zone and when it next changes
+type weatherState struct {
+	current Weather
+	changes time.Time
+}
+
+// CurrentWeather returns the weather of the zone
+func (w *World) CurrentWeather() Weather {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.weather.current
+}
+
+// VisionRadius returns how far players see in the zone's weather
+func (w *World) VisionRadius() float64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.visionRadius()
+}
+
+// visionRadius returns how far players see in the zone's weather; the
+// caller holds the world lock
+func (w *World) visionRadius() float64 {
+	if factor, known := weatherVision[w.weather.current]; known {
+		return w.settings.AOIRadius * factor
+	}
+	return w.settings.AOIRadius
+}
+
+// weatherMessage returns the weather message describing the zone's
+// weather; the caller holds the world lock
+func (w *World) weatherMessage(previous Weather) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "weather",
+		"zone":     w.ID,
+		"weather":  w.weather.current,
+		"previous": previous,
+		"vision":   w.visionRadius(),
+	}
+}
+
+// updateWeather moves the zone's weather on once its time is up,
+// updating what every player sees when it changes; the caller holds the
+// world lock
+func (w *World) updateWeather(now time.Time) []outboundMessage {
+	rules := w.WeatherRules
+	if rules == nil || len(rules.Transitions) == 0 {
+		return nil
+	}
+	if w.weather.changes.IsZero() {
+		w.weather = weatherState{current: rules.Initial, changes: now.Add(w.weatherDuration(rules))}
+		return w.weatherChanged(WeatherClear)
+	}
+	if now.Before(w.weather.changes) {
+		return nil
+	}
+
+	previous := w.weather.current
+	w.weather.changes = now.Add(w.weatherDuration(rules))
+	w.weather.current = w.rollWeather(rules.Transitions[previous], previous)
+	if w.weather.current == previous {
+		return nil
+	}
+	return w.weatherChanged(previous)
+}
+
+// weatherChanged tells the zone about new weather and refreshes who sees
+// whom; the caller holds the world lock
+func (w *World) weatherChanged(previous Weather) []outboundMessage {
+	messages := []outboundMessage{{message: w.weatherMessage(previous)}}
+	for _, player := range w.Players {
+		messages = append(messages, w.refreshInterest(player, "player_appeared")...)
+	}
+	return messages
+}
+
+// weatherDuration rolls how long the next weather lasts; the caller
+// holds the world lock
+func (w *World) weatherDuration(rules *WeatherRules) time.Duration {
+	minutes := rules.MinMinutes + w.rng.Float64()*(rules.MaxMinutes-rules.MinMinutes)
+	return time.Duration(minutes * float64(time.Minute))
+}
+
+// rollWeather picks the weather that follows by weight, keeping the
+// current weather when nothing may follow it; the caller holds the
+// world lock
+func (w *World) rollWeather(next map[Weather]int, current Weather) Weather {
+	total := 0
+	for _, weight := range next {
+		total += weight
+	}
+	if total == 0 {
+		return current
+	}
+
+	// Walk the kinds in a fixed order so a seeded roll is reproducible
+	roll := w.rng.Intn(total)
+	for _, weather := range []Weather{WeatherClear, WeatherRain, WeatherStorm, WeatherFog} {
+		if roll < next[weather] {
+			return weather
+		}
+		roll -= next[weather]
+	}
+	return current
+}
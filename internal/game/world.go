@@ -1,24 +1,189 @@
 package game
 
 import (
+	"fmt"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang-mmo-server/internal/loot"
+	"golang-mmo-server/internal/pathfinding"
+	"golang-mmo-server/internal/script"
+)
+
+const (
+	// TickInterval is how often the world simulation advances by default
+	TickInterval = 100 * time.Millisecond
+	// DefaultScriptTickBudget is how long a zone spends running scripts
+	// per tick by default
+	DefaultScriptTickBudget = 20 * time.Millisecond
+	// pathfindingTickBudget caps the A* nodes expanded per tick
+	pathfindingTickBudget = 2000
+	// pathfindingCacheSize is how many recent paths are remembered
+	pathfindingCacheSize = 256
 )
 
+// Settings are the values of the simulation the server can configure.
+// Each zone keeps its own copy from when it was created
+type Settings struct {
+	// TickInterval is how often a zone advances
+	TickInterval time.Duration
+	// AOIRadius is how far away players see other players and NPCs
+	AOIRadius float64
+	// InteractionRange is how close a player must stand to an NPC to talk
+	// to it, trade with it, take its quests or hand them in
+	InteractionRange float64
+	// ScriptLimits bound every call into a script
+	ScriptLimits script.Limits
+	// ScriptTickBudget is how long a zone spends on the scripts queued in
+	// a tick; those it does not get to wait for the next one
+	ScriptTickBudget time.Duration
+}
+
+// DefaultSettings returns the settings zones run with unless configured
+func DefaultSettings() Settings {
+	return Settings{
+		TickInterval:     TickInterval,
+		AOIRadius:        DefaultAOIRadius,
+		InteractionRange: DefaultInteractionRange,
+		ScriptLimits:     script.Limits{Steps: 20000, Time: 5 * time.Millisecond, Depth: 32},
+		ScriptTickBudget: DefaultScriptTickBudget,
+	}
+}
+
+// Validate checks that the settings make a playable game
+func (s Settings) Validate() error {
+	switch {
+	case s.TickInterval <= 0:
+		return fmt.Errorf("tick interval %v must be positive", s.TickInterval)
+	case s.AOIRadius <= 0:
+		return fmt.Errorf("area of interest radius %g must be positive", s.AOIRadius)
+	case s.InteractionRange <= 0:
+		return fmt.Errorf("interaction range %g must be positive", s.InteractionRange)
+	case s.InteractionRange > s.AOIRadius:
+		return fmt.Errorf("interaction range %g is beyond the area of interest radius %g", s.InteractionRange, s.AOIRadius)
+	case s.ScriptLimits.Steps <= 0 || s.ScriptLimits.Time <= 0 || s.ScriptLimits.Depth <= 0:
+		return fmt.Errorf("script limits %+v must all be positive", s.ScriptLimits)
+	case s.ScriptTickBudget <= 0 || s.ScriptTickBudget >= s.TickInterval:
+		return fmt.Errorf("script tick budget %v must be positive and shorter than the tick interval %v", s.ScriptTickBudget, s.TickInterval)
+	}
+	return nil
+}
+
+// Broadcaster delivers world-originated messages to connected clients
+type Broadcaster interface {
+	SendToPlayer(playerID string, message map[string]interface{})
+}
+
+// outboundMessage is produced while the world is locked and sent once the
+// lock is released; it goes to one player, to the players around a
+// position, or to the whole zone when neither is set
+type outboundMessage struct {
+	playerID string
+	near     *Position
+	message  map[string]interface{}
+}
+
+// World is one zone of the game: a map with its own players, entities and tick
 type World struct {
+	ID               string
+	Name             string
 	Players          map[string]*Player
 	NPCs             map[string]*Entity
 	Items            map[string]*Entity
+	Resources        map[string]*Entity
 	PlayerInteracter *PlayerInteracter
+	Map              *TileMap
+	Navigator        *pathfinding.Service
+	Death            DeathRules
+	PvP              PvPRule
+	Clock            *WorldClock
+	WeatherRules     *WeatherRules
+	settings         Settings
+	content          atomic.Value
+	broadcaster      Broadcaster
+	playerPaths      map[string]*playerPath
+	visible          map[string]map[string]bool
+	visibleItems     map[string]map[string]bool
+	itemSpawns       []*itemSpawn
+	nextItemID       int
+	respawns         []*npcRespawn
+	lastAttack       map[string]time.Time
+	loot             *loot.Roller
+	lootRolls        map[string]*lootRoll
+	nextRollID       int
+	conversations    map[string]*conversation
+	shopVisits       map[string]*shopVisit
+	auctionVisits    map[string]string
+	gathers          map[string]*gathering
+	casts            map[string]*casting
+	duels            map[string]*duel
+	duelChallenges   map[string]*duelChallenge
+	dormant          map[string]*Entity
+	weather          weatherState
+	phase            DayPhase
+	lastClockSync    time.Time
+	vendors          *Vendors
+	currency         *CurrencyService
+	post             *PostOffice
+	auctions         *AuctionHouse
+	events           *EventBus
+	extensions       *Extensions
+	pendingScripts   []scriptCall
+	scriptBacklog    bool
+	summonSeq        int
+	onPortal         func(playerID string, portal *Region)
+	onTeleport       func(playerID, zoneID, spawn string)
+	parties          *PartyManager
+	rng              *rand.Rand
+	stop             chan struct{}
 	mu               sync.RWMutex
 }
 
-// NewWorld creates a new game world instance
-func NewWorld() *World {
+// NewWorld creates a new zone running with the given settings; a nil map
+// leaves the zone as an unbounded plane without collision or navigation
+func NewWorld(id string, tileMap *TileMap, content *Content, settings Settings) *World {
 	world := &World{
-		Players: make(map[string]*Player),
-		NPCs:    make(map[string]*Entity),
-		Items:   make(map[string]*Entity),
+		ID:             id,
+		Name:           id,
+		Players:        make(map[string]*Player),
+		NPCs:           make(map[string]*Entity),
+		Items:          make(map[string]*Entity),
+		Resources:      make(map[string]*Entity),
+		Map:            tileMap,
+		PvP:            PvPFlagged,
+		settings:       settings,
+		playerPaths:    make(map[string]*playerPath),
+		visible:        make(map[string]map[string]bool),
+		visibleItems:   make(map[string]map[string]bool),
+		lastAttack:     make(map[string]time.Time),
+		lootRolls:      make(map[string]*lootRoll),
+		conversations:  make(map[string]*conversation),
+		shopVisits:     make(map[string]*shopVisit),
+		auctionVisits:  make(map[string]string),
+		gathers:        make(map[string]*gathering),
+		casts:          make(map[string]*casting),
+		duels:          make(map[string]*duel),
+		duelChallenges: make(map[string]*duelChallenge),
+		dormant:        make(map[string]*Entity),
+		weather:        weatherState{current: WeatherClear},
+		currency:       NewCurrencyService(nil),
+		rng:            rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	world.content.Store(content)
+	if content != nil {
+		world.vendors = NewVendors(content.Shops)
+	}
+
+	if content != nil && content.LootTables != nil {
+		world.loot = loot.NewRoller(content.LootTables, world.rng.Int63())
+	}
+
+	if tileMap != nil {
+		world.Name = tileMap.Name
+		world.Navigator = pathfinding.NewService(tileMap, pathfinding.DefaultOptions(), pathfindingTickBudget, pathfindingCacheSize)
 	}
 
 	world.PlayerInteracter = NewPlayerInteracter(world)
@@ -29,63 +194,321 @@ func NewWorld() *World {
 
 // spawnInitialEntities initializes world with entities
 func (w *World) spawnInitialEntities() {
+	w.spawnNPCs()
+	w.spawnItems()
+	w.spawnResources()
 }
 
-// AddPlayer adds new player to the world
+// Content returns the definitions the zone runs on; a content reload
+// swaps them between two ticks
+func (w *World) Content() *Content {
+	content, _ := w.content.Load().(*Content)
+	return content
+}
+
+// SetBroadcaster sets where world-originated messages are delivered
+func (w *World) SetBroadcaster(broadcaster Broadcaster) {
+	w.broadcaster = broadcaster
+}
+
+// deliver sends messages produced under the world lock to clients
+func (w *World) deliver(messages []outboundMessage) {
+	if w.broadcaster == nil {
+		return
+	}
+
+	for _, outbound := range messages {
+		if outbound.playerID != "" {
+			w.broadcaster.SendToPlayer(outbound.playerID, outbound.message)
+			continue
+		}
+
+		w.mu.RLock()
+		var recipients []string
+		if outbound.near != nil {
+			recipients = w.observersOf(*outbound.near, "")
+		} else {
+			for playerID := range w.Players {
+				recipients = append(recipients, playerID)
+			}
+		}
+		w.mu.RUnlock()
+
+		for _, playerID := range recipients {
+			w.broadcaster.SendToPlayer(playerID, outbound.message)
+		}
+	}
+}
+
+// AddPlayer adds new player to the world and announces them to nearby players
 func (w *World) AddPlayer(player *Player) {
 	w.mu.Lock()
-	defer w.mu.Unlock()
 	w.Players[player.ID] = player
+	w.visible[player.ID] = make(map[string]bool)
+	w.visibleItems[player.ID] = make(map[string]bool)
+	messages := w.refreshInterest(player, "player_joined")
+	now := time.Now()
+	messages = append(messages,
+		outboundMessage{playerID: player.ID, message: w.pvpStatus(player, now)},
+		outboundMessage{playerID: player.ID, message: w.weatherMessage(w.weather.current)},
+	)
+	if w.Clock != nil {
+		messages = append(messages, outboundMessage{playerID: player.ID, message: w.Clock.Message(now)})
+	}
+	w.mu.Unlock()
+
+	w.deliver(messages)
 }
 
-// RemovePlayer removes player from the world
+// RemovePlayer removes player from the world and tells everyone who could see them
 func (w *World) RemovePlayer(playerID string) {
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	var messages []outboundMessage
+	for observerID := range w.visible[playerID] {
+		delete(w.visible[observerID], playerID)
+		messages = append(messages, outboundMessage{playerID: observerID, message: map[string]interface{}{
+			"type": "player_left",
+			"id":   playerID,
+		}})
+	}
+	messages = append(messages, w.forfeitDuel(playerID, DuelLeft)...)
+	delete(w.duelChallenges, playerID)
+	delete(w.visible, playerID)
+	delete(w.visibleItems, playerID)
+	delete(w.lastAttack, playerID)
+	delete(w.conversations, playerID)
+	delete(w.shopVisits, playerID)
+	delete(w.auctionVisits, playerID)
+	delete(w.gathers, playerID)
+	delete(w.casts, playerID)
 	delete(w.Players, playerID)
+	w.clearPlayerPath(playerID)
+	w.mu.Unlock()
+
+	w.deliver(messages)
 }
 
 // GetPlayer retrieves player by ID
 func (w *World) GetPlayer(playerID string) (*Player, bool) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 	player, exists := w.Players[playerID]
 	return player, exists
 }
 
+// PlayerCount returns how many players are in this zone
+func (w *World) PlayerCount() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.Players)
+}
+
+// PlayerIDs returns the IDs of the players in this zone
+func (w *World) PlayerIDs() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	ids := make([]string, 0, len(w.Players))
+	for playerID := range w.Players {
+		ids = append(ids, playerID)
+	}
+	return ids
+}
+
+// PlayerMoved announces a player's new position to nearby players,
+// counts the regions they walked into towards their quests, tells them
+// about the regions they entered or left and triggers any portal the
+// player stepped into
+func (w *World) PlayerMoved(playerID string, from Position, sprinting bool) {
+	w.mu.Lock()
+	player, exists := w.Players[playerID]
+	if !exists {
+		w.mu.Unlock()
+		return
+	}
+
+	position := player.GetPosition()
+	messages := w.refreshInterest(player, "player_appeared")
+	messages = append(messages, outboundMessage{near: &position, message: map[string]interface{}{
+		"type":      "player_moved",
+		"id":        player.ID,
+		"x":         position.X,
+		"y":         position.Y,
+		"sprinting": sprinting,
+	}})
+	messages = append(messages, w.reachEvents(player, from, position)...)
+	messages = append(messages, w.regionEvents(player, from, position)...)
+	var portal *Region
+	if player.Life.Alive() {
+		portal = w.portalEntered(from, position)
+	}
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	w.publish(PlayerMoved{Player: player, Zone: w.ID, From: from, To: position, Sprinting: sprinting})
+	w.triggerPortal(playerID, portal)
+}
+
+// SpawnPosition returns where a joining player should appear, falling
+// back to the requested position when the map has no spawn points
+func (w *World) SpawnPosition(requested Position) Position {
+	if w.Map == nil {
+		return requested
+	}
+	if spawn, ok := w.Map.PlayerSpawn(); ok {
+		return spawn
+	}
+	return requested
+}
+
+// ResolveMovement returns the position reached when moving between two
+// points, sliding along blocked tiles of the map
+func (w *World) ResolveMovement(from, to Position) Position {
+	if w.Map == nil {
+		return to
+	}
+	return w.Map.SweepMove(from, to)
+}
+
+// GetMapData returns the map metadata message for clients, if any
+func (w *World) GetMapData() (map[string]interface{}, bool) {
+	if w.Map == nil {
+		return nil, false
+	}
+	metadata := w.Map.Metadata()
+	metadata["zone"] = w.ID
+	metadata["zone_name"] = w.Name
+	return metadata, true
+}
+
 // GetWorldState returns current world state snapshot
 func (w *World) GetWorldState() map[string]interface{} {
+	return w.worldState("")
+}
+
+// GetWorldStateFor returns the world state as seen by one player,
+// limited to what lies within their area of interest
+func (w *World) GetWorldStateFor(playerID string) map[string]interface{} {
+	return w.worldState(playerID)
+}
+
+func (w *World) worldState(viewerID string) map[string]interface{} {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
+	var viewer *Player
+	if viewerID != "" {
+		viewer = w.Players[viewerID]
+	}
+
 	players := make([]map[string]interface{}, 0)
 	for _, player := range w.Players {
+		if viewer != nil && player != viewer && !w.visible[viewerID][player.ID] {
+			continue
+		}
+		position := player.GetPosition()
 		players = append(players, map[string]interface{}{
-			"id":   player.ID,
-			"name": player.Name,
-			"x":    player.Position.X,
-			"y":    player.Position.Y,
+			"id":      player.ID,
+			"name":    player.Name,
+			"x":       position.X,
+			"y":       position.Y,
+			"state":   player.Life.State(),
+			"flagged": player.PvP.Flagged(time.Now()),
 		})
 	}
 
+	npcs := make([]map[string]interface{}, 0)
+	for _, npc := range w.NPCs {
+		npcs = append(npcs, npcAppearance(npc))
+	}
+
+	items := make([]map[string]interface{}, 0)
+	for _, item := range w.Items {
+		if viewer != nil && !w.visibleItems[viewerID][item.ID] {
+			continue
+		}
+		appearance := itemAppearance(item)
+		delete(appearance, "type")
+		items = append(items, appearance)
+	}
+
+	resources := make([]map[string]interface{}, 0, len(w.Resources))
+	for _, resource := range w.Resources {
+		resources = append(resources, resourceAppearance(resource))
+	}
+
 	return map[string]interface{}{
-		"type":    "world_state",
-		"players": players,
-		"npcs":    []map[string]interface{}{},
-		"items":   []map[string]interface{}{},
+		"type":      "world_state",
+		"zone":      w.ID,
+		"players":   players,
+		"npcs":      npcs,
+		"items":     items,
+		"resources": resources,
 	}
 }
 
-// Update performs world state updates
-func (w *World) Update() {
+// Update performs world state updates, delta being the seconds since
+// the previous update
+func (w *World) Update(delta float64) {
+	if w.Navigator != nil {
+		w.Navigator.Tick()
+	}
+
+	now := time.Now()
+
+	w.mu.Lock()
+	messages := w.updateNPCs(delta, now)
+	pathMessages, portals := w.updatePlayerPaths(delta)
+	messages = append(messages, pathMessages...)
+	messages = append(messages, w.updateItems(now)...)
+	messages = append(messages, w.respawnNPCs(now)...)
+	messages = append(messages, w.updateLootRolls(now)...)
+	messages = append(messages, w.updateGathering(now)...)
+	messages = append(messages, w.updateCasting(now)...)
+	messages = append(messages, w.regenerateVitals(delta)...)
+	messages = append(messages, w.updateStatusEffects(now)...)
+	messages = append(messages, w.updatePvP(now)...)
+	messages = append(messages, w.updateClock(now)...)
+	messages = append(messages, w.updateWeather(now)...)
+	w.queueNPCThinks(now)
+	scripts := w.pendingScripts
+	w.pendingScripts = nil
+	w.mu.Unlock()
+
+	w.deliver(messages)
+	for playerID, portal := range portals {
+		w.triggerPortal(playerID, portal)
+	}
+	w.runQueuedScripts(scripts)
+	if w.extensions != nil {
+		w.extensions.tick(w, delta)
+	}
 }
 
-// StartGameLoop begins the main game update loop
+// StartGameLoop begins the zone's update loop
 func (w *World) StartGameLoop() {
-	ticker := time.NewTicker(time.Second)
+	ticker := time.NewTicker(w.settings.TickInterval)
+	stop := make(chan struct{})
+	w.stop = stop
 	go func() {
-		for range ticker.C {
-			w.Update()
+		defer ticker.Stop()
+		lastUpdate := time.Now()
+		for {
+			select {
+			case now := <-ticker.C:
+				w.Update(now.Sub(lastUpdate).Seconds())
+				lastUpdate = now
+			case <-stop:
+				return
+			}
 		}
 	}()
 }
+
+// StopGameLoop ends the zone's update loop
+func (w *World) StopGameLoop() {
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
@@ -0,0 +1,588 @@
+package game
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ZoneDefinition describes a zone as written in zones.json
+type ZoneDefinition struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	Map     string     `json:"map"`
+	Default bool       `json:"default"`
+	Death   DeathRules `json:"death"`
+	// PvP is the rule outside of regions with a rule of their own
+	PvP     PvPRule       `json:"pvp"`
+	Weather *WeatherRules `json:"weather"`
+}
+
+var (
+	ErrUnknownZone     = errors.New("unknown zone")
+	ErrTransferPending = errors.New("zone transfer already in progress")
+	ErrNoTransfer      = errors.New("no zone transfer in progress")
+	ErrAlreadyOnline   = errors.New("character is already in the game")
+)
+
+// zoneTransfer is a player on their way to another zone, waiting for
+// their client to finish loading it
+type zoneTransfer struct {
+	player   *Player
+	target   *World
+	position Position
+}
+
+// ZoneManager owns every zone and instance and knows which one each
+// player is in
+type ZoneManager struct {
+	Parties        *PartyManager
+	Currency       *CurrencyService
+	Vendors        *Vendors
+	Post           *PostOffice
+	Auctions       *AuctionHouse
+	Clock          *WorldClock
+	Events         *EventBus
+	Extensions     *Extensions
+	MaxInstances   int
+	zones          map[string]*World
+	defaultZone    string
+	instances      map[string]*Instance
+	ownerInstances map[string]*Instance
+	playerZones    map[string]*World
+	transfers      map[string]*zoneTransfer
+	// characters holds every character in the game by name, from joining
+	// until they have been saved on leaving
+	characters  map[string]*Player
+	content     atomic.Value
+	database    *Database
+	settings    Settings
+	broadcaster Broadcaster
+	stop        chan struct{}
+	// reloading keeps content reloads from overlapping
+	reloading sync.Mutex
+	mu        sync.RWMutex
+}
+
+// NewZoneManager builds a zone for every zone definition in the content;
+// every zone and instance runs with the given settings
+func NewZoneManager(content *Content, database *Database, settings Settings) (*ZoneManager, error) {
+	if len(content.Zones) == 0 {
+		return nil, errors.New("content defines no zones")
+	}
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	zm := &ZoneManager{
+		Parties:        NewPartyManager(),
+		Currency:       NewCurrencyService(database),
+		Vendors:        NewVendors(content.Shops),
+		Clock:          NewWorldClock(DefaultDayLength, time.Now()),
+		Events:         NewEventBus(),
+		Extensions:     NewExtensions(),
+		MaxInstances:   DefaultMaxInstances,
+		zones:          make(map[string]*World),
+		defaultZone:    content.DefaultZone,
+		instances:      make(map[string]*Instance),
+		ownerInstances: make(map[string]*Instance),
+		playerZones:    make(map[string]*World),
+		transfers:      make(map[string]*zoneTransfer),
+		characters:     make(map[string]*Player),
+		database:       database,
+		settings:       settings,
+	}
+	zm.content.Store(content)
+
+	if database != nil {
+		zm.Post = NewPostOffice(database, zm.Currency, zm.items)
+		zm.Post.SetNotifier(zm.notifyCharacter)
+		zm.Post.SetDirectory(zm.characterKnown)
+		auctions, err := NewAuctionHouse(database, zm.Currency, zm.Post, zm.items)
+		if err != nil {
+			return nil, fmt.Errorf("opening auction house: %w", err)
+		}
+		auctions.SetNotifier(zm.notifyCharacter)
+		zm.Auctions = auctions
+	}
+
+	// Achievements write to the database and notify players, so they
+	// follow the game on a goroutine of their own
+	zm.Events.SubscribeAsync(zm.trackAchievements, AsyncOptions{QueueSize: 4096}, achievementEvents...)
+
+	for _, definition := range content.Zones {
+		zm.addZone(newZone(definition, content, settings))
+	}
+
+	return zm, nil
+}
+
+// newZone builds the zone a zone definition describes
+func newZone(definition *ZoneDefinition, content *Content, settings Settings) *World {
+	world := NewWorld(definition.ID, content.Maps[definition.Map], content, settings)
+	world.Name = definition.Name
+	world.Death = definition.Death
+	world.PvP = definition.PvP
+	world.WeatherRules = definition.Weather
+	return world
+}
+
+// Content returns the definitions the game runs on, which ReloadContent
+// replaces
+func (zm *ZoneManager) Content() *Content {
+	return zm.content.Load().(*Content)
+}
+
+// items returns the item definitions in use, for the services that keep
+// running across content reloads
+func (zm *ZoneManager) items() map[string]*ItemDefinition {
+	return zm.Content().Items
+}
+
+// addZone registers a zone and wires it to the manager
+func (zm *ZoneManager) addZone(world *World) {
+	zm.wireWorld(world)
+
+	zm.mu.Lock()
+	zm.zones[world.ID] = world
+	zm.mu.Unlock()
+}
+
+// SetBroadcaster sets where every zone delivers its messages
+func (zm *ZoneManager) SetBroadcaster(broadcaster Broadcaster) {
+	zm.mu.Lock()
+	defer zm.mu.Unlock()
+
+	zm.broadcaster = broadcaster
+	for _, world := range zm.zones {
+		world.SetBroadcaster(broadcaster)
+	}
+	for _, instance := range zm.instances {
+		instance.World.SetBroadcaster(broadcaster)
+	}
+	zm.Parties.SetBroadcaster(broadcaster)
+}
+
+// StartGameLoops starts the tick of every zone, the upkeep of instances,
+// the expiry of old mail, the settling of ended auctions and the saving
+// of statistics
+func (zm *ZoneManager) StartGameLoops() {
+	for _, world := range zm.Zones() {
+		world.StartGameLoop()
+	}
+
+	zm.stop = make(chan struct{})
+	go zm.runInstanceMaintenance(zm.stop)
+	if zm.Post != nil {
+		go zm.runMailExpiry(zm.stop)
+	}
+	if zm.Auctions != nil {
+		go zm.runAuctionExpiry(zm.stop)
+	}
+	if zm.database != nil {
+		go zm.runStatisticsFlush(zm.stop)
+	}
+	go zm.watchScripts(zm.stop)
+}
+
+// Zone returns the zone or running instance with the given ID
+func (zm *ZoneManager) Zone(zoneID string) (*World, bool) {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+	if world, exists := zm.zones[zoneID]; exists {
+		return world, true
+	}
+	if instance, exists := zm.instances[zoneID]; exists && !instance.closing {
+		return instance.World, true
+	}
+	return nil, false
+}
+
+// DefaultZone returns the zone new characters start in
+func (zm *ZoneManager) DefaultZone() *World {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+	return zm.zones[zm.defaultZone]
+}
+
+// Zones returns every zone ordered by ID, leaving out instances
+func (zm *ZoneManager) Zones() []*World {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+
+	zones := make([]*World, 0, len(zm.zones))
+	for _, world := range zm.zones {
+		zones = append(zones, world)
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].ID < zones[j].ID })
+	return zones
+}
+
+// PlayerZone returns the zone a player is currently in; players in the
+// middle of a transfer are in no zone
+func (zm *ZoneManager) PlayerZone(playerID string) (*World, bool) {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+	world, exists := zm.playerZones[playerID]
+	return world, exists
+}
+
+// FindPlayer returns a player and the zone they are in
+func (zm *ZoneManager) FindPlayer(playerID string) (*Player, *World, bool) {
+	world, exists := zm.PlayerZone(playerID)
+	if !exists {
+		return nil, nil, false
+	}
+	player, exists := world.GetPlayer(playerID)
+	return player, world, exists
+}
+
+// PlayerCount returns the number of players in all zones, including
+// players being transferred
+func (zm *ZoneManager) PlayerCount() int {
+	zm.mu.RLock()
+	defer zm.mu.RUnlock()
+	return len(zm.playerZones) + len(zm.transfers)
+}
+
+// JoinPlayer places a logging-in player in the zone and position saved
+// with their character, or at the default zone's spawn for new characters.
+// Characters saved in an instance that has since closed are placed at its exit.
+// A character can only be in the game once, so joining with one that is
+// fails with ErrAlreadyOnline
+func (zm *ZoneManager) JoinPlayer(player *Player, requested Position) (*World, error) {
+	zm.mu.Lock()
+	if _, online := zm.characters[player.Name]; online {
+		zm.mu.Unlock()
+		return nil, ErrAlreadyOnline
+	}
+	zm.characters[player.Name] = player
+	zm.mu.Unlock()
+
+	world := zm.DefaultZone()
+	position := world.SpawnPosition(requested)
+
+	if zm.persistent(player) {
+		record, err := zm.database.GetCharacter(player.Name)
+		if err == nil {
+			if saved, exists := zm.savedZone(player, record.Zone); exists {
+				world = saved
+				position = saved.SpawnPosition(requested)
+				if saved.Map == nil || !saved.Map.IsBlocked(record.Position) {
+					position = record.Position
+				}
+			} else if templateID, isInstance := instanceTemplateID(record.Zone); isInstance {
+				if template, exists := zm.Content().Instances[templateID]; exists {
+					world, position = zm.instanceExit(template)
+				}
+			}
+		}
+
+		if err := zm.database.LoadInventory(player.Name, player.Inventory); err != nil {
+			log.Printf("Failed to load inventory of %s: %v", player.Name, err)
+		}
+		if err := zm.database.LoadProgress(player.Name, player.Progress); err != nil {
+			log.Printf("Failed to load progress of %s: %v", player.Name, err)
+		}
+		if err := zm.database.LoadQuestLog(player.Name, player.Quests, zm.Content().Quests); err != nil {
+			log.Printf("Failed to load quest log of %s: %v", player.Name, err)
+		}
+		if err := zm.database.LoadFlags(player.Name, player.Flags); err != nil {
+			log.Printf("Failed to load flags of %s: %v", player.Name, err)
+		}
+		if err := zm.database.LoadProfessions(player.Name, player.Professions); err != nil {
+			log.Printf("Failed to load professions of %s: %v", player.Name, err)
+		}
+		if err := zm.Currency.Open(player); err != nil {
+			log.Printf("Failed to load wallet of %s: %v", player.Name, err)
+		}
+		if bind, err := zm.database.GetBind(player.Name); err == nil {
+			player.Life.SetBind(*bind)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to load bind point of %s: %v", player.Name, err)
+		}
+		if saved, err := zm.database.LoadStatusEffects(player.Name); err != nil {
+			log.Printf("Failed to load status effects of %s: %v", player.Name, err)
+		} else {
+			player.Effects.Restore(saved, zm.Content().Statuses, time.Now())
+			refreshStats(player)
+		}
+		zm.loadStatistics(player)
+		if err := zm.database.LoadAchievements(player.Name, player.Achievements); err != nil {
+			log.Printf("Failed to load achievements of %s: %v", player.Name, err)
+		}
+	}
+
+	player.SetPosition(position)
+	zm.enterZone(player, world)
+	zm.Events.Publish(PlayerJoined{Player: player, Zone: world.ID})
+	return world, nil
+}
+
+// savedZone returns the zone or running instance a character was saved
+// in, as long as they may go back into it
+func (zm *ZoneManager) savedZone(player *Player, zoneID string) (*World, bool) {
+	world, exists := zm.Zone(zoneID)
+	if !exists {
+		return nil, false
+	}
+
+	zm.mu.RLock()
+	instance, isInstance := zm.instances[zoneID]
+	zm.mu.RUnlock()
+	if isInstance && !zm.rejoinInstance(player, instance) {
+		return nil, false
+	}
+	return world, true
+}
+
+// persistent reports whether a player's character is loaded from and
+// saved to the game database
+func (zm *ZoneManager) persistent(player *Player) bool {
+	return zm.database != nil && !player.Guest
+}
+
+// LeavePlayer removes a disconnecting player, saving where they were
+func (zm *ZoneManager) LeavePlayer(player *Player) {
+	zm.mu.Lock()
+	world, inZone := zm.playerZones[player.ID]
+	transfer, transferring := zm.transfers[player.ID]
+	delete(zm.playerZones, player.ID)
+	delete(zm.transfers, player.ID)
+	zm.mu.Unlock()
+
+	zm.Parties.Leave(player.ID)
+
+	switch {
+	case inZone:
+		zm.Events.Publish(PlayerLeft{Player: player, Zone: world.ID})
+	case transferring:
+		zm.Events.Publish(PlayerLeft{Player: player, Zone: transfer.target.ID})
+	}
+
+	switch {
+	case inZone && !player.Life.Alive():
+		// Logging out dead counts as releasing, so characters log back in
+		// alive at the graveyard rather than as a corpse
+		world.RemovePlayer(player.ID)
+		if player.Life.State() == Dead {
+			zm.applyDeathPenalty(player, world)
+		}
+		target, position := zm.respawnPoint(player, world)
+		zm.saveCharacter(player, target.ID, position)
+	case inZone:
+		world.RemovePlayer(player.ID)
+		zm.saveCharacter(player, world.ID, player.GetPosition())
+	case transferring:
+		zm.saveCharacter(player, transfer.target.ID, transfer.position)
+	}
+
+	// The name is only released once the character is saved, so logging
+	// straight back in loads what this session left behind
+	zm.mu.Lock()
+	if zm.characters[player.Name] == player {
+		delete(zm.characters, player.Name)
+	}
+	zm.mu.Unlock()
+}
+
+// BeginTransfer takes a player out of their zone and asks their client
+// to load the target zone; the player arrives once CompleteTransfer is called
+func (zm *ZoneManager) BeginTransfer(playerID, zoneID, spawnName string) error {
+	target, exists := zm.Zone(zoneID)
+	if !exists {
+		return fmt.Errorf("%w %q", ErrUnknownZone, zoneID)
+	}
+
+	position := target.SpawnPosition(Position{})
+	if spawnName != "" && target.Map != nil {
+		if spawn, ok := target.Map.Spawn(spawnName); ok {
+			position = spawn.Position
+		}
+	}
+
+	return zm.transferTo(playerID, target, position)
+}
+
+// transferTo moves a player out of their zone towards a position in
+// the target zone
+func (zm *ZoneManager) transferTo(playerID string, target *World, position Position) error {
+	zm.mu.Lock()
+	if _, pending := zm.transfers[playerID]; pending {
+		zm.mu.Unlock()
+		return ErrTransferPending
+	}
+	source, inZone := zm.playerZones[playerID]
+	if !inZone {
+		zm.mu.Unlock()
+		return errors.New("player is not in a zone")
+	}
+	player, exists := source.GetPlayer(playerID)
+	if !exists {
+		zm.mu.Unlock()
+		return errors.New("player not found")
+	}
+	delete(zm.playerZones, playerID)
+	zm.transfers[playerID] = &zoneTransfer{player: player, target: target, position: position}
+	broadcaster := zm.broadcaster
+	zm.mu.Unlock()
+
+	source.RemovePlayer(playerID)
+	player.SetPosition(position)
+	zm.saveCharacter(player, target.ID, position)
+
+	if broadcaster != nil {
+		broadcaster.SendToPlayer(playerID, map[string]interface{}{
+			"type":      "zone_transfer",
+			"zone":      target.ID,
+			"zone_name": target.Name,
+			"x":         position.X,
+			"y":         position.Y,
+		})
+		if mapData, ok := target.GetMapData(); ok {
+			broadcaster.SendToPlayer(playerID, mapData)
+		}
+	}
+
+	return nil
+}
+
+// CompleteTransfer places a transferring player in their target zone
+// once their client reports it has loaded
+func (zm *ZoneManager) CompleteTransfer(playerID string) (*World, error) {
+	zm.mu.Lock()
+	transfer, pending := zm.transfers[playerID]
+	if !pending {
+		zm.mu.Unlock()
+		return nil, ErrNoTransfer
+	}
+	delete(zm.transfers, playerID)
+	zm.mu.Unlock()
+
+	zm.enterZone(transfer.player, transfer.target)
+	return transfer.target, nil
+}
+
+// enterZone adds a player to a zone and records it as their current zone
+func (zm *ZoneManager) enterZone(player *Player, world *World) {
+	zm.mu.Lock()
+	zm.playerZones[player.ID] = world
+	zm.mu.Unlock()
+
+	world.AddPlayer(player)
+}
+
+// wireWorld hooks a zone or instance up to the manager's portals,
+// teleports, parties, shops, currency, mail, auctions, event bus,
+// plugin extensions and broadcaster
+func (zm *ZoneManager) wireWorld(world *World) {
+	world.onPortal = zm.handlePortal
+	world.onTeleport = zm.handleTeleport
+	world.parties = zm.Parties
+	world.vendors = zm.Vendors
+	world.currency = zm.Currency
+	world.post = zm.Post
+	world.auctions = zm.Auctions
+	world.events = zm.Events
+	world.extensions = zm.Extensions
+	world.Clock = zm.Clock
+	if zm.broadcaster != nil {
+		world.SetBroadcaster(zm.broadcaster)
+	}
+}
+
+// handleTeleport starts a transfer asked for by an NPC's dialogue
+func (zm *ZoneManager) handleTeleport(playerID, zoneID, spawn string) {
+	if err := zm.BeginTransfer(playerID, zoneID, spawn); err != nil {
+		log.Printf("Teleport to %s failed for player %s: %v", zoneID, playerID, err)
+	}
+}
+
+// handlePortal starts a transfer when a player steps into a portal
+// region, leading either to a zone or to the player's copy of an instance
+func (zm *ZoneManager) handlePortal(playerID string, portal *Region) {
+	if templateID := portal.Properties["target_instance"]; templateID != "" {
+		if err := zm.EnterInstance(playerID, templateID); err != nil {
+			zm.mu.RLock()
+			broadcaster := zm.broadcaster
+			zm.mu.RUnlock()
+			if broadcaster != nil {
+				broadcaster.SendToPlayer(playerID, map[string]interface{}{
+					"type":  "instance_denied",
+					"error": err.Error(),
+				})
+			}
+		}
+		return
+	}
+
+	zoneID := portal.Properties["target_zone"]
+	if err := zm.BeginTransfer(playerID, zoneID, portal.Properties["target_spawn"]); err != nil {
+		log.Printf("Portal %q failed for player %s: %v", portal.Name, playerID, err)
+	}
+}
+
+// saveCharacter stores where a character is, what they carry and how
+// far they got
+func (zm *ZoneManager) saveCharacter(player *Player, zoneID string, position Position) {
+	if !zm.persistent(player) {
+		return
+	}
+	if err := zm.database.SaveCharacterLocation(player.Name, zoneID, position); err != nil {
+		log.Printf("Failed to save location of %s: %v", player.Name, err)
+	}
+	if err := zm.database.SaveInventory(player.Name, player.Inventory); err != nil {
+		log.Printf("Failed to save inventory of %s: %v", player.Name, err)
+	}
+	if err := zm.database.SaveProgress(player.Name, player.Progress); err != nil {
+		log.Printf("Failed to save progress of %s: %v", player.Name, err)
+	}
+	if err := zm.database.SaveQuestLog(player.Name, player.Quests); err != nil {
+		log.Printf("Failed to save quest log of %s: %v", player.Name, err)
+	}
+	if err := zm.database.SaveFlags(player.Name, player.Flags); err != nil {
+		log.Printf("Failed to save flags of %s: %v", player.Name, err)
+	}
+	if err := zm.database.SaveProfessions(player.Name, player.Professions); err != nil {
+		log.Printf("Failed to save professions of %s: %v", player.Name, err)
+	}
+	if bind, ok := player.Life.Bind(); ok {
+		if err := zm.database.SaveBind(player.Name, bind); err != nil {
+			log.Printf("Failed to save bind point of %s: %v", player.Name, err)
+		}
+	}
+	// Only long-lasting effects survive logging out, paused until the next login
+	if err := zm.database.SaveStatusEffects(player.Name, player.Effects.Persistent(time.Now())); err != nil {
+		log.Printf("Failed to save status effects of %s: %v", player.Name, err)
+	}
+	zm.flushStatistics(player)
+	if err := zm.database.SaveAchievements(player.Name, player.Achievements); err != nil {
+		log.Printf("Failed to save achievements of %s: %v", player.Name, err)
+	}
+}
+
+// portalEntered returns the portal region a move stepped into, if any;
+// standing still inside a portal does not trigger it again
+func (w *World) portalEntered(from, to Position) *Region {
+	if w.Map == nil {
+		return nil
+	}
+	for _, region := range w.Map.RegionsAt(to) {
+		if region.Type == "portal" && !region.Bounds.Contains(from) {
+			return region
+		}
+	}
+	return nil
+}
+
+// triggerPortal hands a portal the player stepped into to the zone manager
+func (w *World) triggerPortal(playerID string, portal *Region) {
+	if portal != nil && w.onPortal != nil {
+		w.onPortal(playerID, portal)
+	}
+}
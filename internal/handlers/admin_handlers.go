@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"golang-mmo-server/internal/network"
+)
+
+// AdminHandlers serves the endpoints for operators, which need the
+// configured admin token in the X-Admin-Token header
+type AdminHandlers struct {
+	hub   *network.Hub
+	token string
+}
+
+func NewAdminHandlers(hub *network.Hub, token string) *AdminHandlers {
+	return &AdminHandlers{
+		hub:   hub,
+		token: token,
+	}
+}
+
+// authorized reports whether a request carries the admin token
+func (ah *AdminHandlers) authorized(r *http.Request) bool {
+	given := r.Header.Get("X-Admin-Token")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(ah.token)) == 1
+}
+
+// ReloadContent reloads the content directory and reports what changed;
+// content that fails to load is reported and the current content kept
+func (ah *AdminHandlers) ReloadContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !ah.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	diff, err := ah.hub.GetZones().ReloadContent()
+	if err != nil {
+		http.Error(w, "Content not reloaded: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reloaded": !diff.Empty(),
+		"summary":  diff.String(),
+		"changes":  diff,
+	})
+}
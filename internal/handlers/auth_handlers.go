@@ -3,18 +3,47 @@ package handlers
 import (
 	"encoding/json"
 	"golang-mmo-server/internal/auth"
+	"golang-mmo-server/internal/ratelimit"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type AuthHandlers struct {
 	authService *auth.AuthService
+	// limiter caps logins and registrations per client address; nil
+	// leaves them unlimited
+	limiter *ratelimit.Limiter
 }
 
-func NewAuthHandlers(authService *auth.AuthService) *AuthHandlers {
-	return &AuthHandlers{
+// NewAuthHandlers creates the account handlers, allowing each client
+// address requestsPerMinute logins and registrations, or any number at 0
+func NewAuthHandlers(authService *auth.AuthService, requestsPerMinute int) *AuthHandlers {
+	handlers := &AuthHandlers{
 		authService: authService,
 	}
+	if requestsPerMinute > 0 {
+		handlers.limiter = ratelimit.NewLimiter(float64(requestsPerMinute)/60, requestsPerMinute)
+	}
+	return handlers
+}
+
+// allow reports whether the client address of a request may make another
+// login or registration attempt, answering it when it may not
+func (ah *AuthHandlers) allow(w http.ResponseWriter, r *http.Request) bool {
+	if ah.limiter == nil {
+		return true
+	}
+	address, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		address = r.RemoteAddr
+	}
+	if ah.limiter.Allow(address, time.Now()) {
+		return true
+	}
+	writeErrorResponse(w, "Too many attempts, try again later", http.StatusTooManyRequests)
+	return false
 }
 
 func (ah *AuthHandlers) Register(w http.ResponseWriter, r *http.Request) {
@@ -22,6 +51,9 @@ func (ah *AuthHandlers) Register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !ah.allow(w, r) {
+		return
+	}
 
 	var req struct {
 		Username string `json:"username"`
@@ -62,6 +94,9 @@ func (ah *AuthHandlers) Login(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !ah.allow(w, r) {
+		return
+	}
 
 	var req struct {
 		Username string `json:"username"`
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
+	"golang-mmo-server/internal/game"
 	"golang-mmo-server/internal/network"
 )
 
@@ -38,9 +42,8 @@ func (gh *GameHandlers) HandlePlayerAction(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Create a simple world instance
-	world := gh.hub.GetWorld()
-	player, exists := world.GetPlayer(action.PlayerID)
+	// Find the player in whichever zone they are in
+	player, world, exists := gh.hub.GetZones().FindPlayer(action.PlayerID)
 	if !exists {
 		http.Error(w, "Player not found", http.StatusNotFound)
 		return
@@ -49,8 +52,9 @@ func (gh *GameHandlers) HandlePlayerAction(w http.ResponseWriter, r *http.Reques
 	// Process the action
 	switch action.Type {
 	case "move":
+		from := player.GetPosition()
 		player.Move(action.X, action.Y, action.Z)
-		gh.hub.BroadcastPlayerMoved(player)
+		world.PlayerMoved(player.ID, from, false)
 	default:
 		http.Error(w, "Unknown action type", http.StatusBadRequest)
 		return
@@ -59,13 +63,87 @@ func (gh *GameHandlers) HandlePlayerAction(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusOK)
 }
 
+// GetStatus reports player, zone, party and instance counts along with
+// the time of day and the weather of each zone
+func (gh *GameHandlers) GetStatus(w http.ResponseWriter, r *http.Request) {
+	zones := gh.hub.GetZones()
+	day, hour := zones.Clock.Now(time.Now())
+
+	status := map[string]interface{}{
+		"status":  "online",
+		"players": zones.PlayerCount(),
+		"zones":   len(zones.Zones()),
+		"parties": zones.Parties.Count(),
+		"instances": map[string]interface{}{
+			"active":      zones.InstanceCount(),
+			"max":         zones.MaxInstances,
+			"by_template": zones.InstanceCounts(),
+		},
+		"clock": map[string]interface{}{
+			"day":   day,
+			"hour":  hour,
+			"phase": zones.Clock.Phase(time.Now()),
+		},
+		"weather": zones.Weather(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// GetLeaderboard reports a page of a statistic's leaderboard, chosen with
+// the stat, season and page query parameters
+func (gh *GameHandlers) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	page := 0
+	if value := query.Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+		page = parsed
+	}
+
+	leaderboard, err := gh.hub.GetZones().Leaderboard(query.Get("stat"), query.Get("season"), page)
+	switch {
+	case errors.Is(err, game.ErrUnknownStatistic), errors.Is(err, game.ErrUnknownSeason):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, game.ErrNoDatabase):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, "Failed to read leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(leaderboard)
+}
+
 func (gh *GameHandlers) GetWorldState(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	worldState := gh.hub.GetWorld().GetWorldState()
+	world := gh.hub.GetZones().DefaultZone()
+	if zoneID := r.URL.Query().Get("zone"); zoneID != "" {
+		zone, exists := gh.hub.GetZones().Zone(zoneID)
+		if !exists {
+			http.Error(w, "Zone not found", http.StatusNotFound)
+			return
+		}
+		world = zone
+	}
+
+	worldState := world.GetWorldState()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(worldState)
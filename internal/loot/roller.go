@@ -0,0 +1,125 @@
+package loot
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// maxNestingDepth guards against runaway recursion through nested tables
+const maxNestingDepth = 16
+
+// Drop is an item produced by rolling a loot table
+type Drop struct {
+	Item     string
+	Quantity int
+	Rarity   Rarity
+}
+
+// Roller rolls loot tables with its own random source, so the same seed
+// always produces the same drops; it is not safe for concurrent use
+type Roller struct {
+	registry *Registry
+	rng      *rand.Rand
+}
+
+// NewRoller creates a roller over a registry seeded with the given value
+func NewRoller(registry *Registry, seed int64) *Roller {
+	return &Roller{
+		registry: registry,
+		rng:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Roll generates the drops of a table for a source of the given level.
+// Guaranteed entries always drop; the table's rolls then each pick one
+// weighted entry, or nothing
+func (r *Roller) Roll(tableID string, level int) ([]Drop, error) {
+	return r.roll(tableID, level, 0)
+}
+
+// RollPercent returns a number from 1 to 100, as used for need and greed rolls
+func (r *Roller) RollPercent() int {
+	return r.rng.Intn(100) + 1
+}
+
+func (r *Roller) roll(tableID string, level, depth int) ([]Drop, error) {
+	if depth > maxNestingDepth {
+		return nil, fmt.Errorf("%w: %q", ErrTableCycle, tableID)
+	}
+	table, exists := r.registry.Table(tableID)
+	if !exists {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTable, tableID)
+	}
+
+	var drops []Drop
+	var candidates []*Entry
+	totalWeight := table.NothingWeight
+
+	for i := range table.Entries {
+		entry := &table.Entries[i]
+		if !entry.allows(level) {
+			continue
+		}
+		if entry.Guaranteed {
+			resolved, err := r.resolve(entry, level, depth)
+			if err != nil {
+				return nil, err
+			}
+			drops = append(drops, resolved...)
+			continue
+		}
+		if entry.Weight > 0 {
+			candidates = append(candidates, entry)
+			totalWeight += entry.Weight
+		}
+	}
+
+	if len(candidates) == 0 || totalWeight <= 0 {
+		return drops, nil
+	}
+
+	for i := 0; i < table.Rolls; i++ {
+		pick := r.rng.Intn(totalWeight)
+		if pick < table.NothingWeight {
+			continue
+		}
+		pick -= table.NothingWeight
+
+		for _, entry := range candidates {
+			if pick < entry.Weight {
+				resolved, err := r.resolve(entry, level, depth)
+				if err != nil {
+					return nil, err
+				}
+				drops = append(drops, resolved...)
+				break
+			}
+			pick -= entry.Weight
+		}
+	}
+
+	return drops, nil
+}
+
+// resolve turns a picked entry into drops; a nested table is rolled as
+// many times as the entry's quantity
+func (r *Roller) resolve(entry *Entry, level, depth int) ([]Drop, error) {
+	quantity := entry.Min
+	if entry.Max > entry.Min {
+		quantity += r.rng.Intn(entry.Max - entry.Min + 1)
+	}
+
+	if entry.Table == "" {
+		return []Drop{{Item: entry.Item, Quantity: quantity, Rarity: entry.Rarity}}, nil
+	}
+
+	var drops []Drop
+	for i := 0; i < quantity; i++ {
+		nested, err := r.roll(entry.Table, level, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		drops = append(drops, nested...)
+	}
+	return drops, nil
+}
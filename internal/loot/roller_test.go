@@ -0,0 +1,194 @@
+package loot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testRegistry(t *testing.T) *Registry {
+	t.Helper()
+	registry, err := NewRegistry([]*Table{
+		{ID: "wolf", Rolls: 3, NothingWeight: 2, Entries: []Entry{
+			{Item: "pelt", Weight: 5, Min: 1, Max: 3},
+			{Item: "fang", Weight: 2},
+			{Table: "gems", Weight: 1},
+		}},
+		{ID: "gems", Entries: []Entry{
+			{Item: "ruby", Weight: 1, Rarity: Rare},
+			{Item: "sapphire", Weight: 1, Rarity: Epic},
+		}},
+		{ID: "chest", Entries: []Entry{
+			{Item: "gold", Guaranteed: true, Min: 10, Max: 10},
+			{Item: "key", Guaranteed: true, MinLevel: 5},
+		}},
+		{ID: "nothing", NothingWeight: 1, Entries: []Entry{{Item: "pelt", Weight: 0}}},
+		{ID: "bag", Entries: []Entry{{Table: "gems", Guaranteed: true, Min: 4, Max: 4}}},
+		{ID: "levelled", Entries: []Entry{
+			{Item: "low", Weight: 1, MaxLevel: 10},
+			{Item: "high", Weight: 1, MinLevel: 11},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func TestRollIsDeterministic(t *testing.T) {
+	registry := testRegistry(t)
+	for _, seed := range []int64{1, 42, 1234567} {
+		first, second := NewRoller(registry, seed), NewRoller(registry, seed)
+		for i := 0; i < 50; i++ {
+			a, err := first.Roll("wolf", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := second.Roll("wolf", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(a, b) {
+				t.Fatalf("seed %d roll %d: %v != %v", seed, i, a, b)
+			}
+		}
+	}
+}
+
+func TestRoll(t *testing.T) {
+	registry := testRegistry(t)
+	tests := []struct {
+		name  string
+		table string
+		level int
+		// check is called with the drops of every roll
+		check func(t *testing.T, drops []Drop)
+	}{
+		{
+			name:  "guaranteed entries always drop",
+			table: "chest",
+			level: 1,
+			check: func(t *testing.T, drops []Drop) {
+				if len(drops) != 1 || drops[0] != (Drop{Item: "gold", Quantity: 10, Rarity: Common}) {
+					t.Fatalf("drops = %v, want 10 gold", drops)
+				}
+			},
+		},
+		{
+			name:  "level limits guaranteed entries",
+			table: "chest",
+			level: 5,
+			check: func(t *testing.T, drops []Drop) {
+				if len(drops) != 2 {
+					t.Fatalf("drops = %v, want gold and key", drops)
+				}
+			},
+		},
+		{
+			name:  "zero weight entries never drop",
+			table: "nothing",
+			level: 1,
+			check: func(t *testing.T, drops []Drop) {
+				if len(drops) != 0 {
+					t.Fatalf("drops = %v, want none", drops)
+				}
+			},
+		},
+		{
+			name:  "nested tables roll once per quantity",
+			table: "bag",
+			level: 1,
+			check: func(t *testing.T, drops []Drop) {
+				if len(drops) != 4 {
+					t.Fatalf("drops = %v, want 4 gems", drops)
+				}
+				for _, drop := range drops {
+					if drop.Rarity != Rare && drop.Rarity != Epic {
+						t.Fatalf("drop %v did not come from the gems table", drop)
+					}
+				}
+			},
+		},
+		{
+			name:  "rolls and quantities stay in range",
+			table: "wolf",
+			level: 1,
+			check: func(t *testing.T, drops []Drop) {
+				if len(drops) > 3 {
+					t.Fatalf("drops = %v, want at most 3", drops)
+				}
+				for _, drop := range drops {
+					if drop.Item == "pelt" && (drop.Quantity < 1 || drop.Quantity > 3) {
+						t.Fatalf("pelt quantity %d out of range", drop.Quantity)
+					}
+				}
+			},
+		},
+		{
+			name:  "low level entries",
+			table: "levelled",
+			level: 10,
+			check: func(t *testing.T, drops []Drop) {
+				if len(drops) != 1 || drops[0].Item != "low" {
+					t.Fatalf("drops = %v, want low", drops)
+				}
+			},
+		},
+		{
+			name:  "high level entries",
+			table: "levelled",
+			level: 11,
+			check: func(t *testing.T, drops []Drop) {
+				if len(drops) != 1 || drops[0].Item != "high" {
+					t.Fatalf("drops = %v, want high", drops)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			roller := NewRoller(registry, 7)
+			for i := 0; i < 200; i++ {
+				drops, err := roller.Roll(test.table, test.level)
+				if err != nil {
+					t.Fatal(err)
+				}
+				test.check(t, drops)
+			}
+		})
+	}
+}
+
+func TestRollWeights(t *testing.T) {
+	registry := testRegistry(t)
+	roller := NewRoller(registry, 99)
+
+	counts := make(map[string]int)
+	const rolls = 20000
+	for i := 0; i < rolls; i++ {
+		drops, err := roller.Roll("wolf", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, drop := range drops {
+			counts[drop.Item]++
+		}
+	}
+
+	// Each of the 3 rolls picks pelt 5/10, fang 2/10 and a gem 1/10
+	for item, share := range map[string]float64{"pelt": 0.5, "fang": 0.2, "ruby": 0.05, "sapphire": 0.05} {
+		got := float64(counts[item]) / (rolls * 3)
+		if got < share*0.9 || got > share*1.1 {
+			t.Errorf("%s dropped on %.3f of rolls, want about %.3f", item, got, share)
+		}
+	}
+}
+
+func TestRollPercent(t *testing.T) {
+	roller := NewRoller(testRegistry(t), 3)
+	for i := 0; i < 1000; i++ {
+		if roll := roller.RollPercent(); roll < 1 || roll > 100 {
+			t.Fatalf("RollPercent = %d", roll)
+		}
+	}
+}
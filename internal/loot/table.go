@@ -0,0 +1,229 @@
+package loot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+var (
+	// ErrUnknownTable is returned when a table or nested table does not exist
+	ErrUnknownTable = errors.New("unknown loot table")
+	// ErrTableCycle is returned when nested tables refer back to themselves
+	ErrTableCycle = errors.New("loot table nests itself")
+)
+
+// Rarity is the quality tier of a drop
+type Rarity string
+
+const (
+	Common    Rarity = "common"
+	Uncommon  Rarity = "uncommon"
+	Rare      Rarity = "rare"
+	Epic      Rarity = "epic"
+	Legendary Rarity = "legendary"
+)
+
+var rarityRanks = map[Rarity]int{
+	Common:    0,
+	Uncommon:  1,
+	Rare:      2,
+	Epic:      3,
+	Legendary: 4,
+}
+
+// Rank orders rarities from common upwards; unknown rarities rank as common
+func (r Rarity) Rank() int {
+	return rarityRanks[r]
+}
+
+// AtLeast reports whether the rarity is as good as another
+func (r Rarity) AtLeast(other Rarity) bool {
+	return r.Rank() >= other.Rank()
+}
+
+// Entry is one possible result of a loot table: an item, or a nested
+// table rolled in its place
+type Entry struct {
+	// Item names the dropped item; Table names a nested table instead
+	Item  string `json:"item,omitempty"`
+	Table string `json:"table,omitempty"`
+	// Weight is the entry's share of a roll among the other entries
+	Weight int `json:"weight"`
+	// Guaranteed entries drop on every roll of the table
+	Guaranteed bool `json:"guaranteed,omitempty"`
+	// Min and Max bound the dropped quantity
+	Min int `json:"min"`
+	Max int `json:"max"`
+	// Rarity tiers the drop, common when left out
+	Rarity Rarity `json:"rarity,omitempty"`
+	// MinLevel and MaxLevel limit the entry to sources of those levels,
+	// 0 meaning no limit
+	MinLevel int `json:"min_level,omitempty"`
+	MaxLevel int `json:"max_level,omitempty"`
+}
+
+// allows reports whether the entry can drop from a source of the given level
+func (e *Entry) allows(level int) bool {
+	if e.MinLevel > 0 && level < e.MinLevel {
+		return false
+	}
+	if e.MaxLevel > 0 && level > e.MaxLevel {
+		return false
+	}
+	return true
+}
+
+// Table is a set of weighted entries rolled when loot is generated
+type Table struct {
+	ID string `json:"id"`
+	// Rolls is how many weighted picks are made, 1 when left out
+	Rolls int `json:"rolls"`
+	// NothingWeight is the share of each roll that drops nothing
+	NothingWeight int     `json:"nothing_weight"`
+	Entries       []Entry `json:"entries"`
+}
+
+// checkWeights makes sure a table with weighted entries has a positive
+// total weight to pick from
+func (t *Table) checkWeights() error {
+	total, weighted := t.NothingWeight, false
+	for _, entry := range t.Entries {
+		if !entry.Guaranteed {
+			total += entry.Weight
+			weighted = true
+		}
+	}
+	if weighted && total <= 0 {
+		return fmt.Errorf("loot table %q has a total weight of %d", t.ID, total)
+	}
+	return nil
+}
+
+// Registry holds every loot table by ID
+type Registry struct {
+	tables map[string]*Table
+}
+
+// NewRegistry creates a registry from tables, filling in defaults and
+// rejecting duplicates, unknown nested tables and cycles
+func NewRegistry(tables []*Table) (*Registry, error) {
+	registry := &Registry{tables: make(map[string]*Table)}
+
+	for _, table := range tables {
+		if _, exists := registry.tables[table.ID]; exists {
+			return nil, fmt.Errorf("duplicate loot table %q", table.ID)
+		}
+		if table.Rolls <= 0 {
+			table.Rolls = 1
+		}
+		if table.NothingWeight < 0 {
+			return nil, fmt.Errorf("loot table %q has a negative nothing_weight", table.ID)
+		}
+		for i := range table.Entries {
+			entry := &table.Entries[i]
+			if (entry.Item == "") == (entry.Table == "") {
+				return nil, fmt.Errorf("loot table %q entry %d must name either an item or a table", table.ID, i)
+			}
+			if entry.Weight < 0 {
+				return nil, fmt.Errorf("loot table %q entry %d has a negative weight", table.ID, i)
+			}
+			if entry.Min <= 0 {
+				entry.Min = 1
+			}
+			if entry.Max < entry.Min {
+				entry.Max = entry.Min
+			}
+			if entry.Rarity == "" {
+				entry.Rarity = Common
+			}
+			if _, known := rarityRanks[entry.Rarity]; !known {
+				return nil, fmt.Errorf("loot table %q entry %d has unknown rarity %q", table.ID, i, entry.Rarity)
+			}
+		}
+		if err := table.checkWeights(); err != nil {
+			return nil, err
+		}
+		registry.tables[table.ID] = table
+	}
+
+	for id := range registry.tables {
+		if err := registry.checkNesting(id, map[string]bool{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+// LoadRegistry reads loot tables from a JSON file
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []*Table
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewRegistry(tables)
+}
+
+// checkNesting walks the nested tables below a table looking for
+// unknown references and cycles
+func (r *Registry) checkNesting(id string, visiting map[string]bool) error {
+	table, exists := r.tables[id]
+	if !exists {
+		return fmt.Errorf("%w %q", ErrUnknownTable, id)
+	}
+	if visiting[id] {
+		return fmt.Errorf("%w: %q", ErrTableCycle, id)
+	}
+
+	visiting[id] = true
+	for _, entry := range table.Entries {
+		if entry.Table == "" {
+			continue
+		}
+		if err := r.checkNesting(entry.Table, visiting); err != nil {
+			return err
+		}
+	}
+	delete(visiting, id)
+
+	return nil
+}
+
+// Table returns the table with the given ID
+func (r *Registry) Table(id string) (*Table, bool) {
+	table, exists := r.tables[id]
+	return table, exists
+}
+
+// IDs returns the IDs of the tables, in order
+func (r *Registry) IDs() []string {
+	ids := make([]string, 0, len(r.tables))
+	for id := range r.tables {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Items returns the IDs of every item any table can drop
+func (r *Registry) Items() []string {
+	seen := make(map[string]bool)
+	var items []string
+	for _, table := range r.tables {
+		for _, entry := range table.Entries {
+			if entry.Item != "" && !seen[entry.Item] {
+				seen[entry.Item] = true
+				items = append(items, entry.Item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,118 @@
+package loot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewRegistryValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		tables []*Table
+		err    string
+	}{
+		{
+			name: "valid",
+			tables: []*Table{
+				{ID: "wolf", NothingWeight: 1, Entries: []Entry{{Item: "pelt", Weight: 3}, {Table: "gems", Weight: 1}}},
+				{ID: "gems", Entries: []Entry{{Item: "ruby", Weight: 1}}},
+			},
+		},
+		{
+			name:   "only guaranteed entries",
+			tables: []*Table{{ID: "chest", Entries: []Entry{{Item: "gold", Guaranteed: true}}}},
+		},
+		{
+			name:   "duplicate id",
+			tables: []*Table{{ID: "wolf", Entries: []Entry{{Item: "pelt", Weight: 1}}}, {ID: "wolf", Entries: []Entry{{Item: "pelt", Weight: 1}}}},
+			err:    `duplicate loot table "wolf"`,
+		},
+		{
+			name:   "entry with item and table",
+			tables: []*Table{{ID: "wolf", Entries: []Entry{{Item: "pelt", Table: "gems", Weight: 1}}}},
+			err:    "must name either an item or a table",
+		},
+		{
+			name:   "negative entry weight",
+			tables: []*Table{{ID: "wolf", Entries: []Entry{{Item: "pelt", Weight: -1}}}},
+			err:    "negative weight",
+		},
+		{
+			name:   "negative nothing weight",
+			tables: []*Table{{ID: "wolf", NothingWeight: -1000, Entries: []Entry{{Item: "pelt", Weight: 1}}}},
+			err:    "negative nothing_weight",
+		},
+		{
+			name:   "zero total weight",
+			tables: []*Table{{ID: "wolf", Entries: []Entry{{Item: "pelt"}}}},
+			err:    "total weight of 0",
+		},
+		{
+			name:   "unknown rarity",
+			tables: []*Table{{ID: "wolf", Entries: []Entry{{Item: "pelt", Weight: 1, Rarity: "mythic"}}}},
+			err:    "unknown rarity",
+		},
+		{
+			name:   "unknown nested table",
+			tables: []*Table{{ID: "wolf", Entries: []Entry{{Table: "gems", Weight: 1}}}},
+			err:    ErrUnknownTable.Error(),
+		},
+		{
+			name: "cycle",
+			tables: []*Table{
+				{ID: "a", Entries: []Entry{{Table: "b", Weight: 1}}},
+				{ID: "b", Entries: []Entry{{Table: "a", Weight: 1}}},
+			},
+			err: ErrTableCycle.Error(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewRegistry(test.tables)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.err != "" && err == nil:
+				t.Fatalf("expected an error containing %q", test.err)
+			case test.err != "" && !strings.Contains(err.Error(), test.err):
+				t.Fatalf("error %q does not contain %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestNewRegistryDefaults(t *testing.T) {
+	registry, err := NewRegistry([]*Table{{ID: "wolf", Entries: []Entry{{Item: "pelt", Weight: 1, Min: 3}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, _ := registry.Table("wolf")
+	entry := table.Entries[0]
+	if table.Rolls != 1 || entry.Max != 3 || entry.Rarity != Common {
+		t.Fatalf("defaults not applied: rolls %d, max %d, rarity %q", table.Rolls, entry.Max, entry.Rarity)
+	}
+}
+
+func TestRegistryLookups(t *testing.T) {
+	registry, err := NewRegistry([]*Table{
+		{ID: "wolf", Entries: []Entry{{Item: "pelt", Weight: 1}, {Table: "gems", Weight: 1}}},
+		{ID: "gems", Entries: []Entry{{Item: "ruby", Weight: 1}, {Item: "pelt", Weight: 1}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := strings.Join(registry.IDs(), ","); ids != "gems,wolf" {
+		t.Fatalf("IDs = %s", ids)
+	}
+	if items := registry.Items(); len(items) != 2 {
+		t.Fatalf("Items = %v, want pelt and ruby once each", items)
+	}
+	if _, exists := registry.Table("bear"); exists {
+		t.Fatal("unknown table found")
+	}
+	if _, err := NewRoller(registry, 1).Roll("bear", 1); !errors.Is(err, ErrUnknownTable) {
+		t.Fatalf("rolling an unknown table: %v", err)
+	}
+}
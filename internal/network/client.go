@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"golang-mmo-server/internal/game"
+	"golang-mmo-server/internal/ratelimit"
 	"log"
+	"math"
 	"net/http"
 	"sync"
 	"time"
@@ -17,6 +19,11 @@ type Client struct {
 	Conn   *websocket.Conn
 	Send   chan []byte
 	Player *game.Player
+
+	// limit drops messages sent faster than the hub allows; throttled is
+	// set while they are being dropped so the client is told only once
+	limit     *ratelimit.Bucket
+	throttled bool
 }
 
 var upgrader = websocket.Upgrader{
@@ -31,6 +38,8 @@ func NewClient(conn *websocket.Conn, hub *Hub) *Client {
 		Hub:  hub,
 		Conn: conn,
 		Send: make(chan []byte, 256),
+
+		limit: hub.messageLimit(),
 	}
 }
 
@@ -56,8 +65,7 @@ func (c *Client) writeMessages() {
 func (c *Client) readPump() {
 	defer func() {
 		if c.Player != nil {
-			c.Hub.world.RemovePlayer(c.Player.ID)
-			c.Hub.BroadcastPlayerLeft(c.Player.ID)
+			c.Hub.zones.LeavePlayer(c.Player)
 		}
 		c.Hub.unregister <- c
 		c.Conn.Close()
@@ -68,6 +76,17 @@ func (c *Client) readPump() {
 		if err != nil {
 			break
 		}
+		if c.limit != nil && !c.limit.Allow(time.Now()) {
+			if !c.throttled {
+				c.throttled = true
+				c.sendJSON(map[string]interface{}{
+					"type":  "rate_limited",
+					"error": "You are sending messages too quickly, some were ignored",
+				})
+			}
+			continue
+		}
+		c.throttled = false
 		c.handleGameMessage(message)
 	}
 }
@@ -90,62 +109,221 @@ func (c *Client) handleGameMessage(message []byte) {
 		c.handleJoin(gameMessage)
 	case "move":
 		c.handleMove(gameMessage)
+	case "move_to":
+		c.handleMoveTo(gameMessage)
+	case "zone_ready":
+		c.handleZoneReady(gameMessage)
+	case "party_accept":
+		c.handlePartyAccept(gameMessage)
+	case "party_decline":
+		c.handlePartyDecline(gameMessage)
+	case "party_leave":
+		c.handlePartyLeave(gameMessage)
 	case "chat":
 		c.handleChat(gameMessage)
 	case "interact":
 		c.handleInteract(gameMessage)
+	case "drop_item":
+		c.handleDropItem(gameMessage)
+	case "quest_accept":
+		c.handleQuestAccept(gameMessage)
+	case "quest_abandon":
+		c.handleQuestAbandon(gameMessage)
+	case "quest_turn_in":
+		c.handleQuestTurnIn(gameMessage)
+	case "dialogue_choose":
+		c.handleDialogueChoose(gameMessage)
+	case "dialogue_close":
+		c.handleDialogueClose(gameMessage)
+	case "shop_buy":
+		c.handleShopBuy(gameMessage)
+	case "shop_sell":
+		c.handleShopSell(gameMessage)
+	case "shop_buyback":
+		c.handleShopBuyback(gameMessage)
+	case "shop_close":
+		c.handleShopClose(gameMessage)
+	case "craft":
+		c.handleCraft(gameMessage)
+	case "auction_search":
+		c.handleAuctionSearch(gameMessage)
+	case "auction_list":
+		c.handleAuctionList(gameMessage)
+	case "auction_bid":
+		c.handleAuctionBid(gameMessage)
+	case "auction_buyout":
+		c.handleAuctionBuyout(gameMessage)
+	case "auction_cancel":
+		c.handleAuctionCancel(gameMessage)
+	case "auction_close":
+		c.handleAuctionClose(gameMessage)
+	case "mail_list":
+		c.handleMailList(gameMessage)
+	case "mail_take":
+		c.handleMailTake(gameMessage)
+	case "mail_send":
+		c.handleMailSend(gameMessage)
+	case "mail_return":
+		c.handleMailReturn(gameMessage)
+	case "mail_delete":
+		c.handleMailDelete(gameMessage)
+	case "attack":
+		c.handleAttack(gameMessage)
+	case "cast":
+		c.handleCast(gameMessage)
+	case "effect_cancel":
+		c.handleEffectCancel(gameMessage)
+	case "release_spirit":
+		c.handleReleaseSpirit()
+	case "revive_at_corpse":
+		c.handleReviveAtCorpse()
+	case "resurrect_accept":
+		c.handleResurrectAccept()
+	case "bind":
+		c.handleBind()
+	case "pvp_flag":
+		c.handlePvPFlag(gameMessage)
+	case "duel_accept":
+		c.handleDuelAccept()
+	case "duel_decline":
+		c.handleDuelDecline()
+	case "statistics":
+		c.handleStatistics()
+	case "leaderboard":
+		c.handleLeaderboard(gameMessage)
+	case "achievements":
+		c.handleAchievements()
+	case "set_title":
+		c.handleSetTitle(gameMessage)
+	case "loot_roll_choice":
+		c.handleLootRollChoice(gameMessage)
+	case "party_loot_mode":
+		c.handlePartyLootMode(gameMessage)
 	case "player_interact":
 		c.handlePlayerInteract(gameMessage)
 	case "get_nearby_players":
 		c.handleGetNearbyPlayers(gameMessage)
+	default:
+		c.handlePluginMessage(msgType, gameMessage)
+	}
+}
+
+// handlePluginMessage passes a message type the server does not handle
+// itself to the plugin that added it
+func (c *Client) handlePluginMessage(msgType string, data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	handled, err := c.Hub.zones.Extensions.HandleMessage(msgType, c.Player, world, data)
+	if !handled {
+		log.Printf("Unknown message type %q from %s", msgType, c.Player.Name)
+		return
+	}
+	if err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":  msgType + "_failed",
+			"error": err.Error(),
+		})
 	}
 }
 
-// handleJoin processes player join requests
+// handleJoin processes player join requests. Logged-in players play the
+// character of their account, whatever name they send; players without a
+// token join as a guest whose character is not saved
 func (c *Client) handleJoin(data map[string]interface{}) {
-	name, _ := data["name"].(string)
+	if c.Player != nil {
+		return
+	}
+
 	token, _ := data["token"].(string)
 	x, _ := data["x"].(float64)
 	y, _ := data["y"].(float64)
 
-	// Verify the token if provided
-	if token != "" {
-		// You'll need to pass the auth service to verify the token
-		// For now, we'll trust the client's username
-	}
-
-	if name == "" {
-		name = "Guest"
+	guest := token == ""
+	var name string
+	if guest {
+		name = c.Hub.guestName()
+	} else {
+		session, err := c.Hub.auth.ValidateSession(token)
+		if err != nil {
+			c.sendJSON(map[string]interface{}{"type": "join_failed", "error": "Your login has expired, please log in again"})
+			return
+		}
+		name = session.Username
 	}
 
-	playerID := c.generatePlayerID()
-	c.Player = game.NewPlayer(playerID, name)
-	c.Player.Position.X = x
-	c.Player.Position.Y = y
+	c.Player = game.NewPlayer(c.generatePlayerID(), name)
+	c.Player.Guest = guest
 	c.Player.Conn = c
+	c.Hub.addPlayer(c)
 
-	c.Hub.world.AddPlayer(c.Player)
+	world, err := c.Hub.zones.JoinPlayer(c.Player, game.Position{X: x, Y: y})
+	if err != nil {
+		c.Hub.removePlayer(c.Player.ID)
+		c.Player = nil
+		c.sendJSON(map[string]interface{}{"type": "join_failed", "error": "This character is already playing in another window"})
+		return
+	}
+	position := c.Player.GetPosition()
 
 	// Send player their own info
 	response := map[string]interface{}{
 		"type": "your_player",
 		"id":   c.Player.ID,
 		"name": c.Player.Name,
-		"x":    c.Player.Position.X,
-		"y":    c.Player.Position.Y,
+		"x":    position.X,
+		"y":    position.Y,
+		"zone": world.ID,
 	}
 	c.sendJSON(response)
+	c.sendJSON(c.Player.Inventory.Message(world.Content().Items))
+	c.sendJSON(c.Player.Progress.Message())
+	c.sendJSON(c.Player.Wallet.Message())
+	c.sendJSON(c.Player.Professions.Message())
+	c.sendJSON(world.Content().RecipesMessage())
+	c.sendJSON(c.Player.Vitals.Message())
+	c.sendJSON(world.Content().AbilitiesMessage())
+	c.sendJSON(c.Player.StatsMessage())
+	c.sendJSON(c.Player.Effects.Message(c.Player.ID, time.Now()))
+	c.sendJSON(c.Player.Quests.Message(world.Content().Quests))
+	if post := c.Hub.zones.Post; post != nil {
+		if summary, err := post.SummaryMessage(c.Player.Name); err == nil {
+			c.sendJSON(summary)
+		} else {
+			log.Printf("Failed to count mail of %s: %v", c.Player.Name, err)
+		}
+	}
+
+	c.sendZoneState(world)
+}
+
+// sendZoneState sends the map and visible world state of a zone
+func (c *Client) sendZoneState(world *game.World) {
+	// Send map so the client can draw the same tiles the server collides with
+	if mapData, ok := world.GetMapData(); ok {
+		c.sendJSON(mapData)
+	}
 
 	// Send world state
-	c.sendJSON(c.Hub.world.GetWorldState())
+	c.sendJSON(world.GetWorldStateFor(c.Player.ID))
+}
 
-	// Broadcast new player to others
-	c.Hub.BroadcastPlayerJoined(c.Player)
+// world returns the zone the client's player is in, or nil while the
+// player is not in the game or is being transferred between zones
+func (c *Client) world() *game.World {
+	if c.Player == nil {
+		return nil
+	}
+	world, _ := c.Hub.zones.PlayerZone(c.Player.ID)
+	return world
 }
 
 // handleMove validates and processes player movement
 func (c *Client) handleMove(data map[string]interface{}) {
-	if c.Player == nil {
+	world := c.world()
+	if world == nil {
 		return
 	}
 
@@ -154,11 +332,23 @@ func (c *Client) handleMove(data map[string]interface{}) {
 	sprinting, _ := data["sprinting"].(bool)
 
 	// Smooth position validation
-	oldX, oldY := c.Player.Position.X, c.Player.Position.Y
+	oldPosition := c.Player.GetPosition()
 	maxMoveDistance := 50.0 // Prevent teleporting/cheating
 
-	deltaX := x - oldX
-	deltaY := y - oldY
+	// Rooted and stunned players stay put; slowed ones cover less ground
+	speed := c.Player.MoveSpeedFactor()
+	if speed == 0 {
+		c.sendJSON(map[string]interface{}{
+			"type": "position_correction",
+			"x":    oldPosition.X,
+			"y":    oldPosition.Y,
+		})
+		return
+	}
+	maxMoveDistance *= math.Min(speed, 1)
+
+	deltaX := x - oldPosition.X
+	deltaY := y - oldPosition.Y
 	distance := deltaX*deltaX + deltaY*deltaY
 
 	if distance > maxMoveDistance*maxMoveDistance {
@@ -166,53 +356,738 @@ func (c *Client) handleMove(data map[string]interface{}) {
 		return
 	}
 
-	c.Player.Position.X = x
-	c.Player.Position.Y = y
+	// Manual movement takes over from click-to-move
+	world.CancelClickMove(c.Player.ID)
+
+	requested := game.Position{X: x, Y: y, Z: oldPosition.Z}
+	resolved := world.ResolveMovement(oldPosition, requested)
+
+	c.Player.SetPosition(resolved)
+	world.AddStatistic(c.Player, game.StatisticDistanceWalked, math.Hypot(resolved.X-oldPosition.X, resolved.Y-oldPosition.Y))
+
+	// Correct the client when the map blocked part of the move
+	if resolved != requested {
+		c.sendJSON(map[string]interface{}{
+			"type": "position_correction",
+			"x":    resolved.X,
+			"y":    resolved.Y,
+		})
+	}
 
 	// Update sprint status and stamina
 	c.Player.UpdateSprint(sprinting)
 
-	// Broadcast movement to all players with sprint status
-	movementData := map[string]interface{}{
-		"type":      "player_moved",
-		"id":        c.Player.ID,
-		"x":         c.Player.Position.X,
-		"y":         c.Player.Position.Y,
-		"sprinting": sprinting,
+	// Broadcast movement to nearby players with sprint status
+	world.PlayerMoved(c.Player.ID, oldPosition, sprinting)
+}
+
+// handleMoveTo starts server-side pathing towards a clicked destination
+func (c *Client) handleMoveTo(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
 	}
 
-	c.Hub.BroadcastToAll(movementData)
+	x, _ := data["x"].(float64)
+	y, _ := data["y"].(float64)
+
+	if err := world.StartClickMove(c.Player.ID, game.Position{X: x, Y: y}); err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":  "move_to_failed",
+			"error": err.Error(),
+		})
+	}
 }
 
-// handleChat processes and broadcasts chat messages
-func (c *Client) handleChat(data map[string]interface{}) {
+// handleZoneReady completes a zone transfer once the client has loaded the new zone
+func (c *Client) handleZoneReady(data map[string]interface{}) {
+	if c.Player == nil {
+		return
+	}
+
+	world, err := c.Hub.zones.CompleteTransfer(c.Player.ID)
+	if err != nil {
+		return
+	}
+
+	position := c.Player.GetPosition()
+	c.sendJSON(map[string]interface{}{
+		"type":      "zone_entered",
+		"zone":      world.ID,
+		"zone_name": world.Name,
+		"x":         position.X,
+		"y":         position.Y,
+	})
+	c.sendJSON(world.GetWorldStateFor(c.Player.ID))
+}
+
+// handlePartyAccept joins the party the player was invited to
+func (c *Client) handlePartyAccept(data map[string]interface{}) {
+	if c.Player == nil {
+		return
+	}
+
+	if _, err := c.Hub.zones.Parties.Accept(c.Player.ID); err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":  "party_error",
+			"error": err.Error(),
+		})
+	}
+}
+
+// handlePartyDecline turns down a pending party invite
+func (c *Client) handlePartyDecline(data map[string]interface{}) {
+	if c.Player == nil {
+		return
+	}
+	c.Hub.zones.Parties.Decline(c.Player.ID)
+}
+
+// handlePartyLeave removes the player from their party
+func (c *Client) handlePartyLeave(data map[string]interface{}) {
+	if c.Player == nil {
+		return
+	}
+	c.Hub.zones.Parties.Leave(c.Player.ID)
+}
+
+// handlePartyLootMode changes how the player's party shares loot
+func (c *Client) handlePartyLootMode(data map[string]interface{}) {
+	if c.Player == nil {
+		return
+	}
+
+	mode, _ := data["mode"].(string)
+	if err := c.Hub.zones.Parties.SetLootMode(c.Player.ID, game.LootMode(mode)); err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":  "party_error",
+			"error": err.Error(),
+		})
+	}
+}
+
+// handleAttack makes the player hit an NPC
+func (c *Client) handleAttack(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	targetID, _ := data["target_id"].(string)
+	attack := world.AttackNPC
+	if _, isPlayer := world.GetPlayer(targetID); isPlayer {
+		attack = world.AttackPlayer
+	}
+	if err := attack(c.Player.ID, targetID); err != nil && err != game.ErrAttackCooldown {
+		c.sendJSON(map[string]interface{}{
+			"type":      "attack_failed",
+			"target_id": targetID,
+			"error":     err.Error(),
+		})
+	}
+}
+
+// handleCast casts an ability at a target or a point on the ground
+func (c *Client) handleCast(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	abilityID, _ := data["ability_id"].(string)
+	targetID, _ := data["target_id"].(string)
+	x, _ := data["x"].(float64)
+	y, _ := data["y"].(float64)
+	if err := world.CastAbility(c.Player.ID, abilityID, targetID, game.Position{X: x, Y: y}); err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":       "ability_failed",
+			"ability_id": abilityID,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// handleEffectCancel takes one of the player's buffs off at their request
+func (c *Client) handleEffectCancel(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	effectID, _ := data["effect_id"].(string)
+	if err := world.CancelStatus(c.Player.ID, effectID); err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":      "effect_cancel_failed",
+			"effect_id": effectID,
+			"error":     err.Error(),
+		})
+	}
+}
+
+// handleReleaseSpirit sends a dead player to the nearest graveyard
+func (c *Client) handleReleaseSpirit() {
+	if c.Player == nil {
+		return
+	}
+	if err := c.Hub.zones.ReleaseSpirit(c.Player.ID); err != nil {
+		c.sendDeathFailure(err)
+	}
+}
+
+// handleReviveAtCorpse brings a ghost back to life at their corpse
+func (c *Client) handleReviveAtCorpse() {
+	world := c.world()
+	if world == nil {
+		return
+	}
+	if err := world.ReviveAtCorpse(c.Player.ID); err != nil {
+		c.sendDeathFailure(err)
+	}
+}
+
+// handleResurrectAccept takes up the resurrection a player was offered
+func (c *Client) handleResurrectAccept() {
+	world := c.world()
+	if world == nil {
+		return
+	}
+	if err := world.AcceptResurrection(c.Player.ID); err != nil {
+		c.sendDeathFailure(err)
+	}
+}
+
+// handleBind binds the player to the bind point they stand at
+func (c *Client) handleBind() {
+	world := c.world()
+	if world == nil {
+		return
+	}
+	if err := world.BindAt(c.Player.ID); err != nil {
+		c.sendDeathFailure(err)
+	}
+}
+
+// handlePvPFlag opts the player in to or out of PvP
+func (c *Client) handlePvPFlag(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+	enabled, _ := data["enabled"].(bool)
+	if err := world.SetPvPFlag(c.Player.ID, enabled); err != nil {
+		c.sendPvPFailure(err)
+	}
+}
+
+// handleDuelAccept starts the duel the player was challenged to
+func (c *Client) handleDuelAccept() {
+	world := c.world()
+	if world == nil {
+		return
+	}
+	if err := world.AcceptDuel(c.Player.ID); err != nil {
+		c.sendPvPFailure(err)
+	}
+}
+
+// handleDuelDecline turns down the duel the player was challenged to
+func (c *Client) handleDuelDecline() {
+	world := c.world()
+	if world == nil {
+		return
+	}
+	if err := world.DeclineDuel(c.Player.ID); err != nil {
+		c.sendPvPFailure(err)
+	}
+}
+
+func (c *Client) sendPvPFailure(err error) {
+	c.sendJSON(map[string]interface{}{
+		"type":  "pvp_failed",
+		"error": err.Error(),
+	})
+}
+
+// handleAchievements sends the player their achievements and progress
+func (c *Client) handleAchievements() {
+	if c.Player == nil {
+		return
+	}
+	c.sendJSON(c.Hub.zones.AchievementsMessage(c.Player))
+}
+
+// handleSetTitle changes the achievement title the player shows
+func (c *Client) handleSetTitle(data map[string]interface{}) {
 	if c.Player == nil {
 		return
 	}
+	title, _ := data["title"].(string)
+	if err := c.Hub.zones.SetTitle(c.Player.ID, title); err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":  "title_failed",
+			"error": err.Error(),
+		})
+	}
+}
+
+// handleStatistics sends the player their character statistics
+func (c *Client) handleStatistics() {
+	if c.Player == nil {
+		return
+	}
+	c.sendJSON(c.Player.Statistics.Message())
+}
+
+// handleLeaderboard sends the player a page of a statistic's leaderboard
+func (c *Client) handleLeaderboard(data map[string]interface{}) {
+	stat, _ := data["stat"].(string)
+	season, _ := data["season"].(string)
+	page, _ := data["page"].(float64)
+
+	leaderboard, err := c.Hub.zones.Leaderboard(stat, season, int(page))
+	if err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":  "leaderboard_failed",
+			"error": err.Error(),
+		})
+		return
+	}
+	c.sendJSON(leaderboard.Message())
+}
+
+func (c *Client) sendDeathFailure(err error) {
+	c.sendJSON(map[string]interface{}{
+		"type":  "death_failed",
+		"error": err.Error(),
+	})
+}
+
+// handleLootRollChoice records the player's need, greed or pass on a drop
+func (c *Client) handleLootRollChoice(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	rollID, _ := data["roll_id"].(string)
+	choice, _ := data["choice"].(string)
+	if err := world.LootRollChoice(c.Player.ID, rollID, choice); err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":  "loot_roll_failed",
+			"error": err.Error(),
+		})
+	}
+}
+
+// handleChat processes and broadcasts chat messages to the player's zone
+func (c *Client) handleChat(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
 
 	message, _ := data["message"].(string)
 	if message == "" {
 		return
 	}
 
-	chatMessage := map[string]interface{}{
-		"type":    "chat_message",
-		"name":    c.Player.Name,
-		"message": message,
+	world.Chat(c.Player, message)
+}
+
+// handleInteract processes interaction with an entity of the world,
+// such as picking up an item lying on the ground or talking to an NPC
+func (c *Client) handleInteract(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
 	}
 
-	c.Hub.BroadcastToAll(chatMessage)
+	targetID, _ := data["target_id"].(string)
+	if err := world.Interact(c.Player.ID, targetID); err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":      "interact_failed",
+			"target_id": targetID,
+			"error":     err.Error(),
+		})
+	}
 }
 
-// handleInteract processes general interaction requests
-func (c *Client) handleInteract(data map[string]interface{}) {
-	// Handle item interaction, NPC interaction, etc.
-	log.Printf("Player %s interacted at position", c.Player.Name)
+// handleDropItem drops items from an inventory slot onto the ground
+func (c *Client) handleDropItem(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	slot, _ := data["slot"].(float64)
+	quantity, _ := data["quantity"].(float64)
+
+	if err := world.DropFromInventory(c.Player.ID, int(slot), int(quantity)); err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":  "drop_failed",
+			"error": err.Error(),
+		})
+	}
+}
+
+// handleQuestAccept takes a quest offered by a nearby NPC
+func (c *Client) handleQuestAccept(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	questID, _ := data["quest_id"].(string)
+	if err := world.AcceptQuest(c.Player.ID, questID); err != nil {
+		c.sendQuestFailed(questID, err)
+	}
+}
+
+// handleQuestAbandon drops a quest from the quest log
+func (c *Client) handleQuestAbandon(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	questID, _ := data["quest_id"].(string)
+	if err := world.AbandonQuest(c.Player.ID, questID); err != nil {
+		c.sendQuestFailed(questID, err)
+	}
+}
+
+// handleQuestTurnIn hands a finished quest in for its rewards
+func (c *Client) handleQuestTurnIn(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	questID, _ := data["quest_id"].(string)
+	if err := world.TurnInQuest(c.Player.ID, questID); err != nil {
+		c.sendQuestFailed(questID, err)
+	}
+}
+
+func (c *Client) sendQuestFailed(questID string, err error) {
+	c.sendJSON(map[string]interface{}{
+		"type":     "quest_failed",
+		"quest_id": questID,
+		"error":    err.Error(),
+	})
+}
+
+// handleDialogueChoose answers the NPC the player is talking to
+func (c *Client) handleDialogueChoose(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	option, ok := data["option"].(float64)
+	if !ok {
+		option = -1
+	}
+	if err := world.ChooseDialogueOption(c.Player.ID, int(option)); err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":  "dialogue_failed",
+			"error": err.Error(),
+		})
+	}
+}
+
+// handleDialogueClose walks away from the NPC the player is talking to
+func (c *Client) handleDialogueClose(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	world.EndConversation(c.Player.ID)
+}
+
+// handleShopBuy buys items from the shop the player has open
+func (c *Client) handleShopBuy(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	itemID, _ := data["item_id"].(string)
+	quantity, ok := data["quantity"].(float64)
+	if !ok {
+		quantity = 1
+	}
+	if err := world.BuyItem(c.Player.ID, itemID, int(quantity)); err != nil {
+		c.sendShopFailed(err)
+	}
+}
+
+// handleShopSell sells items from an inventory slot to the open shop
+func (c *Client) handleShopSell(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	slot, ok := data["slot"].(float64)
+	if !ok {
+		slot = -1
+	}
+	quantity, _ := data["quantity"].(float64)
+	if err := world.SellItem(c.Player.ID, int(slot), int(quantity)); err != nil {
+		c.sendShopFailed(err)
+	}
+}
+
+// handleShopBuyback buys a recently sold stack back
+func (c *Client) handleShopBuyback(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	index, ok := data["index"].(float64)
+	if !ok {
+		index = -1
+	}
+	if err := world.BuybackItem(c.Player.ID, int(index)); err != nil {
+		c.sendShopFailed(err)
+	}
+}
+
+// handleShopClose closes the shop the player has open
+func (c *Client) handleShopClose(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	world.CloseShop(c.Player.ID)
+}
+
+// handleCraft makes a recipe from the player's inventory
+func (c *Client) handleCraft(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	recipeID, _ := data["recipe_id"].(string)
+	if err := world.Craft(c.Player.ID, recipeID); err != nil {
+		c.sendJSON(map[string]interface{}{
+			"type":      "craft_failed",
+			"recipe_id": recipeID,
+			"error":     err.Error(),
+		})
+	}
+}
+
+// handleAuctionSearch sends a page of auction listings
+func (c *Client) handleAuctionSearch(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	text, _ := data["text"].(string)
+	maxPrice, _ := data["max_price"].(float64)
+	page, _ := data["page"].(float64)
+	query := game.AuctionQuery{Text: text, MaxPrice: int(maxPrice), Page: int(page)}
+	if mine, _ := data["mine"].(bool); mine {
+		query.Seller = c.Player.Name
+	}
+	if err := world.SearchAuctions(c.Player.ID, query); err != nil {
+		c.sendAuctionFailed(err)
+	}
+}
+
+// handleAuctionList puts items from an inventory slot up for auction
+func (c *Client) handleAuctionList(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	slot, ok := data["slot"].(float64)
+	if !ok {
+		slot = -1
+	}
+	quantity, ok := data["quantity"].(float64)
+	if !ok {
+		quantity = 1
+	}
+	minBid, _ := data["min_bid"].(float64)
+	buyout, _ := data["buyout"].(float64)
+	hours, ok := data["hours"].(float64)
+	if !ok {
+		hours = float64(game.AuctionDurations[0])
+	}
+	if err := world.ListAuction(c.Player.ID, int(slot), int(quantity), int(minBid), int(buyout), int(hours)); err != nil {
+		c.sendAuctionFailed(err)
+	}
+}
+
+// handleAuctionBid bids on an auction listing
+func (c *Client) handleAuctionBid(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	id, _ := data["id"].(float64)
+	amount, _ := data["amount"].(float64)
+	if err := world.BidAuction(c.Player.ID, int64(id), int(amount)); err != nil {
+		c.sendAuctionFailed(err)
+	}
+}
+
+// handleAuctionBuyout buys an auction listing outright
+func (c *Client) handleAuctionBuyout(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	id, _ := data["id"].(float64)
+	if err := world.BuyoutAuction(c.Player.ID, int64(id)); err != nil {
+		c.sendAuctionFailed(err)
+	}
+}
+
+// handleAuctionCancel takes one of the player's listings off the market
+func (c *Client) handleAuctionCancel(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	id, _ := data["id"].(float64)
+	if err := world.CancelAuction(c.Player.ID, int64(id)); err != nil {
+		c.sendAuctionFailed(err)
+	}
+}
+
+// handleAuctionClose closes the auction house the player has open
+func (c *Client) handleAuctionClose(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	world.CloseAuction(c.Player.ID)
+}
+
+func (c *Client) sendAuctionFailed(err error) {
+	c.sendJSON(map[string]interface{}{
+		"type":  "auction_failed",
+		"error": err.Error(),
+	})
+}
+
+// handleMailList sends the player their mailbox
+func (c *Client) handleMailList(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	if err := world.ListMail(c.Player.ID); err != nil {
+		c.sendMailFailed(err)
+	}
+}
+
+// handleMailTake takes the attachments of a letter
+func (c *Client) handleMailTake(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	id, _ := data["id"].(float64)
+	if err := world.TakeMail(c.Player.ID, int64(id)); err != nil {
+		c.sendMailFailed(err)
+	}
+}
+
+// handleMailSend posts a letter to another character, with optional
+// attachments given as inventory slots and a COD price
+func (c *Client) handleMailSend(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	recipient, _ := data["to"].(string)
+	subject, _ := data["subject"].(string)
+	body, _ := data["body"].(string)
+	currency, _ := data["currency"].(float64)
+	cod, _ := data["cod"].(float64)
+
+	var attachments []game.MailAttachment
+	items, _ := data["items"].([]interface{})
+	for _, raw := range items {
+		item, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		slot, hasSlot := item["slot"].(float64)
+		if !hasSlot {
+			continue
+		}
+		quantity, _ := item["quantity"].(float64)
+		attachments = append(attachments, game.MailAttachment{Slot: int(slot), Quantity: int(quantity)})
+	}
+
+	if err := world.SendMail(c.Player.ID, recipient, subject, body, attachments, int(currency), int(cod)); err != nil {
+		c.sendMailFailed(err)
+	}
+}
+
+// handleMailReturn sends a letter back to its sender
+func (c *Client) handleMailReturn(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	id, _ := data["id"].(float64)
+	if err := world.ReturnMail(c.Player.ID, int64(id)); err != nil {
+		c.sendMailFailed(err)
+	}
+}
+
+// handleMailDelete throws away an empty letter
+func (c *Client) handleMailDelete(data map[string]interface{}) {
+	world := c.world()
+	if world == nil {
+		return
+	}
+
+	id, _ := data["id"].(float64)
+	if err := world.DeleteMail(c.Player.ID, int64(id)); err != nil {
+		c.sendMailFailed(err)
+	}
+}
+
+func (c *Client) sendMailFailed(err error) {
+	c.sendJSON(map[string]interface{}{
+		"type":  "mail_failed",
+		"error": err.Error(),
+	})
+}
+
+func (c *Client) sendShopFailed(err error) {
+	c.sendJSON(map[string]interface{}{
+		"type":  "shop_failed",
+		"error": err.Error(),
+	})
 }
 
 // handlePlayerInteract processes player-to-player interactions
 func (c *Client) handlePlayerInteract(data map[string]interface{}) {
-	if c.Player == nil {
+	world := c.world()
+	if world == nil {
 		return
 	}
 
@@ -232,7 +1107,7 @@ func (c *Client) handlePlayerInteract(data map[string]interface{}) {
 		Data:         data["data"],
 	}
 
-	result := c.Hub.world.PlayerInteracter.ProcessInteraction(request)
+	result := world.PlayerInteracter.ProcessInteraction(request)
 
 	log.Printf("Interaction result: %+v", result)
 
@@ -246,17 +1121,18 @@ func (c *Client) handlePlayerInteract(data map[string]interface{}) {
 
 // handleGetNearbyPlayers returns nearby players with interaction options
 func (c *Client) handleGetNearbyPlayers(data map[string]interface{}) {
-	if c.Player == nil {
+	world := c.world()
+	if world == nil {
 		return
 	}
 
-	nearbyPlayers := c.Hub.world.PlayerInteracter.GetNearbyPlayers(c.Player.ID)
+	nearbyPlayers := world.PlayerInteracter.GetNearbyPlayers(c.Player.ID)
 
 	log.Printf("Player %s checking nearby players, found %d", c.Player.Name, len(nearbyPlayers))
 
 	playersData := make([]map[string]interface{}, 0)
 	for _, player := range nearbyPlayers {
-		interactions := c.Hub.world.PlayerInteracter.GetAvailableInteractions(c.Player.ID, player.ID)
+		interactions := world.PlayerInteracter.GetAvailableInteractions(c.Player.ID, player.ID)
 
 		log.Printf("Player %s is nearby %s with %d interactions", c.Player.Name, player.Name, len(interactions))
 
@@ -2,28 +2,61 @@ package network
 
 import (
 	"encoding/json"
+	"fmt"
+	"golang-mmo-server/internal/auth"
 	"golang-mmo-server/internal/game"
+	"golang-mmo-server/internal/ratelimit"
 	"sync"
+	"sync/atomic"
 )
 
+// Hub keeps track of the connected clients. A client's Send channel is
+// only closed once it has been unregistered; messages for a client whose
+// buffer is full are dropped, as its own replies are
 type Hub struct {
 	clients    map[*Client]bool
+	players    map[string]*Client
 	broadcast  chan []byte
 	register   chan *Client
 	unregister chan *Client
-	world      *game.World
+	zones      *game.ZoneManager
+	auth       *auth.AuthService
+	guests     int64
 	mu         sync.Mutex
+	// MessagesPerSecond and MessageBurst limit what each connection may
+	// send; messages over the limit are dropped. A rate of 0 sends freely
+	MessagesPerSecond float64
+	MessageBurst      int
 }
 
-// NewHub creates a new network hub with initialized world
-func NewHub() *Hub {
-	return &Hub{
+// NewHub creates a new network hub serving the given zones to players
+// logged in with the given auth service
+func NewHub(zones *game.ZoneManager, authService *auth.AuthService) *Hub {
+	hub := &Hub{
 		clients:    make(map[*Client]bool),
+		players:    make(map[string]*Client),
 		broadcast:  make(chan []byte),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
-		world:      game.NewWorld(),
+		zones:      zones,
+		auth:       authService,
 	}
+	zones.SetBroadcaster(hub)
+	return hub
+}
+
+// messageLimit returns the bucket limiting a new connection, or nil when
+// connections are not limited
+func (h *Hub) messageLimit() *ratelimit.Bucket {
+	if h.MessagesPerSecond <= 0 {
+		return nil
+	}
+	return ratelimit.NewBucket(h.MessagesPerSecond, h.MessageBurst)
+}
+
+// guestName returns a name no other guest has been given since the start
+func (h *Hub) guestName() string {
+	return fmt.Sprintf("Guest%d", atomic.AddInt64(&h.guests, 1))
 }
 
 // RegisterClient adds client to registration queue
@@ -31,9 +64,24 @@ func (h *Hub) RegisterClient(client *Client) {
 	h.register <- client
 }
 
-// GetWorld returns the game world instance
-func (h *Hub) GetWorld() *game.World {
-	return h.world
+// addPlayer indexes a client by the player it has just been given, so
+// messages for the player reach it
+func (h *Hub) addPlayer(client *Client) {
+	h.mu.Lock()
+	h.players[client.Player.ID] = client
+	h.mu.Unlock()
+}
+
+// removePlayer forgets which client controls a player
+func (h *Hub) removePlayer(playerID string) {
+	h.mu.Lock()
+	delete(h.players, playerID)
+	h.mu.Unlock()
+}
+
+// GetZones returns the zone manager
+func (h *Hub) GetZones() *game.ZoneManager {
+	return h.zones
 }
 
 // Run starts the hub event loop
@@ -49,6 +97,9 @@ func (h *Hub) Run() {
 			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
+				if client.Player != nil && h.players[client.Player.ID] == client {
+					delete(h.players, client.Player.ID)
+				}
 				close(client.Send)
 			}
 			h.mu.Unlock()
@@ -59,8 +110,6 @@ func (h *Hub) Run() {
 				select {
 				case client.Send <- message:
 				default:
-					close(client.Send)
-					delete(h.clients, client)
 				}
 			}
 			h.mu.Unlock()
@@ -82,43 +131,26 @@ func (h *Hub) BroadcastToAll(message map[string]interface{}) {
 		select {
 		case client.Send <- data:
 		default:
-			close(client.Send)
-			delete(h.clients, client)
 		}
 	}
 }
 
-// BroadcastPlayerJoined announces new player to all clients
-func (h *Hub) BroadcastPlayerJoined(player *game.Player) {
-	message := map[string]interface{}{
-		"type": "player_joined",
-		"id":   player.ID,
-		"name": player.Name,
-		"x":    player.Position.X,
-		"y":    player.Position.Y,
+// SendToPlayer sends message to the client controlling the given player
+func (h *Hub) SendToPlayer(playerID string, message map[string]interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
 	}
-	h.BroadcastToAll(message)
-}
 
-// BroadcastPlayerLeft announces player departure to all clients
-func (h *Hub) BroadcastPlayerLeft(playerID string) {
-	message := map[string]interface{}{
-		"type": "player_left",
-		"id":   playerID,
-	}
-	h.BroadcastToAll(message)
-}
-
-// BroadcastPlayerMoved announces player movement to all clients with sprint status
-func (h *Hub) BroadcastPlayerMoved(player *game.Player) {
-	current, _, _ := player.GetStaminaInfo()
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	message := map[string]interface{}{
-		"type":      "player_moved",
-		"id":        player.ID,
-		"x":         player.Position.X,
-		"y":         player.Position.Y,
-		"sprinting": current > 0 && player.Stamina.IsRunning,
+	client, exists := h.players[playerID]
+	if !exists {
+		return
+	}
+	select {
+	case client.Send <- data:
+	default:
 	}
-	h.BroadcastToAll(message)
 }
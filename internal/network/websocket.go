@@ -17,6 +17,8 @@ func HandleWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		Hub:  hub,
 		Conn: conn,
 		Send: make(chan []byte, 256),
+
+		limit: hub.messageLimit(),
 	}
 
 	hub.RegisterClient(client)
@@ -0,0 +1,242 @@
+package pathfinding
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+)
+
+var (
+	// ErrNoPath is returned when the goal cannot be reached
+	ErrNoPath = errors.New("no path to goal")
+	// ErrBudgetExceeded is returned when a search expands more nodes than allowed
+	ErrBudgetExceeded = errors.New("search budget exceeded")
+	// ErrBlocked is returned when the start or goal cell is not walkable
+	ErrBlocked = errors.New("start or goal is blocked")
+)
+
+// Grid exposes the walkability of a rectangular cell grid
+type Grid interface {
+	Size() (width, height int)
+	Walkable(x, y int) bool
+}
+
+// Point is a cell coordinate on the grid
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Options tune how paths are searched
+type Options struct {
+	// AllowDiagonal enables eight-way movement
+	AllowDiagonal bool
+	// CutCorners lets diagonal steps pass a blocked orthogonal neighbour
+	CutCorners bool
+	// MaxNodes caps the nodes a single search may expand, 0 meaning no cap
+	MaxNodes int
+	// Smooth removes intermediate points that have direct line of sight
+	Smooth bool
+}
+
+// DefaultOptions returns eight-way movement without corner cutting
+func DefaultOptions() Options {
+	return Options{
+		AllowDiagonal: true,
+		CutCorners:    false,
+		MaxNodes:      4000,
+		Smooth:        true,
+	}
+}
+
+var (
+	orthogonalDirections = []Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	diagonalDirections   = []Point{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
+
+type node struct {
+	point  Point
+	g      float64
+	f      float64
+	parent *node
+	index  int
+	closed bool
+}
+
+type openSet []*node
+
+func (o openSet) Len() int { return len(o) }
+
+func (o openSet) Less(i, j int) bool { return o[i].f < o[j].f }
+
+func (o openSet) Swap(i, j int) {
+	o[i], o[j] = o[j], o[i]
+	o[i].index = i
+	o[j].index = j
+}
+
+func (o *openSet) Push(x interface{}) {
+	n := x.(*node)
+	n.index = len(*o)
+	*o = append(*o, n)
+}
+
+func (o *openSet) Pop() interface{} {
+	old := *o
+	n := old[len(old)-1]
+	*o = old[:len(old)-1]
+	n.index = -1
+	return n
+}
+
+// search is an A* search that can be advanced a few nodes at a time
+type search struct {
+	grid     Grid
+	options  Options
+	start    Point
+	goal     Point
+	open     openSet
+	nodes    map[Point]*node
+	expanded int
+	path     []Point
+	err      error
+	done     bool
+}
+
+func newSearch(grid Grid, start, goal Point, options Options) *search {
+	s := &search{
+		grid:    grid,
+		options: options,
+		start:   start,
+		goal:    goal,
+		nodes:   make(map[Point]*node),
+	}
+
+	if !grid.Walkable(start.X, start.Y) || !grid.Walkable(goal.X, goal.Y) {
+		s.finish(nil, ErrBlocked)
+		return s
+	}
+	if start == goal {
+		s.finish([]Point{start}, nil)
+		return s
+	}
+
+	first := &node{point: start, f: s.heuristic(start)}
+	s.nodes[start] = first
+	heap.Push(&s.open, first)
+	return s
+}
+
+// step expands up to limit nodes and returns how many were used
+func (s *search) step(limit int) int {
+	used := 0
+	for !s.done && used < limit {
+		if s.open.Len() == 0 {
+			s.finish(nil, ErrNoPath)
+			break
+		}
+		if s.options.MaxNodes > 0 && s.expanded >= s.options.MaxNodes {
+			s.finish(nil, ErrBudgetExceeded)
+			break
+		}
+
+		current := heap.Pop(&s.open).(*node)
+		current.closed = true
+		s.expanded++
+		used++
+
+		if current.point == s.goal {
+			s.finish(s.reconstruct(current), nil)
+			break
+		}
+
+		s.expand(current)
+	}
+	return used
+}
+
+func (s *search) expand(current *node) {
+	for _, direction := range orthogonalDirections {
+		s.visit(current, direction, 1)
+	}
+	if !s.options.AllowDiagonal {
+		return
+	}
+	for _, direction := range diagonalDirections {
+		if !s.options.CutCorners {
+			if !s.grid.Walkable(current.point.X+direction.X, current.point.Y) ||
+				!s.grid.Walkable(current.point.X, current.point.Y+direction.Y) {
+				continue
+			}
+		}
+		s.visit(current, direction, math.Sqrt2)
+	}
+}
+
+func (s *search) visit(current *node, direction Point, cost float64) {
+	next := Point{X: current.point.X + direction.X, Y: current.point.Y + direction.Y}
+	if !s.grid.Walkable(next.X, next.Y) {
+		return
+	}
+
+	g := current.g + cost
+	neighbour, seen := s.nodes[next]
+	if seen && (neighbour.closed || g >= neighbour.g) {
+		return
+	}
+
+	if !seen {
+		neighbour = &node{point: next}
+		s.nodes[next] = neighbour
+	}
+	neighbour.g = g
+	neighbour.f = g + s.heuristic(next)
+	neighbour.parent = current
+
+	if seen {
+		heap.Fix(&s.open, neighbour.index)
+	} else {
+		heap.Push(&s.open, neighbour)
+	}
+}
+
+// heuristic is octile distance for eight-way grids and Manhattan otherwise
+func (s *search) heuristic(p Point) float64 {
+	dx := math.Abs(float64(p.X - s.goal.X))
+	dy := math.Abs(float64(p.Y - s.goal.Y))
+	if !s.options.AllowDiagonal {
+		return dx + dy
+	}
+	return dx + dy + (math.Sqrt2-2)*math.Min(dx, dy)
+}
+
+func (s *search) reconstruct(end *node) []Point {
+	var path []Point
+	for n := end; n != nil; n = n.parent {
+		path = append(path, n.point)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	if s.options.Smooth {
+		path = Smooth(s.grid, path, s.options.CutCorners)
+	}
+	return path
+}
+
+func (s *search) finish(path []Point, err error) {
+	s.path = path
+	s.err = err
+	s.done = true
+	s.open = nil
+	s.nodes = nil
+}
+
+// FindPath runs a complete A* search between two cells
+func FindPath(grid Grid, start, goal Point, options Options) ([]Point, error) {
+	s := newSearch(grid, start, goal, options)
+	for !s.done {
+		s.step(math.MaxInt32)
+	}
+	return s.path, s.err
+}
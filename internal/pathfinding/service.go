@@ -0,0 +1,181 @@
+package pathfinding
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Request is a queued path search that is answered during Tick
+type Request struct {
+	Start    Point
+	Goal     Point
+	callback func([]Point, error)
+	search   *search
+	// cancelled is set atomically, as requests are cancelled from
+	// outside the service's lock
+	cancelled int32
+}
+
+// Cancel drops the request; its callback will not be called
+func (r *Request) Cancel() {
+	atomic.StoreInt32(&r.cancelled, 1)
+}
+
+// isCancelled reports whether Cancel has been called
+func (r *Request) isCancelled() bool {
+	return atomic.LoadInt32(&r.cancelled) == 1
+}
+
+type cacheKey struct {
+	start Point
+	goal  Point
+}
+
+type completion struct {
+	request *Request
+	path    []Point
+	err     error
+}
+
+// Service answers path requests over one grid, spreading the search
+// work across ticks and caching recent results
+type Service struct {
+	grid       Grid
+	options    Options
+	tickBudget int
+	cacheSize  int
+	cache      map[cacheKey][]Point
+	cacheOrder []cacheKey
+	queue      []*Request
+	mu         sync.Mutex
+}
+
+// NewService creates a pathfinding service expanding at most tickBudget
+// nodes per tick and remembering up to cacheSize paths
+func NewService(grid Grid, options Options, tickBudget, cacheSize int) *Service {
+	return &Service{
+		grid:       grid,
+		options:    options,
+		tickBudget: tickBudget,
+		cacheSize:  cacheSize,
+		cache:      make(map[cacheKey][]Point),
+	}
+}
+
+// Request queues a search; callback runs during a later Tick
+func (s *Service) Request(start, goal Point, callback func([]Point, error)) *Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request := &Request{Start: start, Goal: goal, callback: callback}
+	s.queue = append(s.queue, request)
+	return request
+}
+
+// Tick advances queued searches until this tick's node budget is spent
+func (s *Service) Tick() {
+	var completed []completion
+
+	s.mu.Lock()
+	remaining := s.tickBudget
+	for len(s.queue) > 0 && remaining > 0 {
+		request := s.queue[0]
+		if request.isCancelled() {
+			s.queue = s.queue[1:]
+			continue
+		}
+
+		key := cacheKey{start: request.Start, goal: request.Goal}
+		if path, ok := s.cache[key]; ok {
+			completed = append(completed, completion{request: request, path: copyPath(path)})
+			s.queue = s.queue[1:]
+			continue
+		}
+
+		if request.search == nil {
+			request.search = newSearch(s.grid, request.Start, request.Goal, s.options)
+		}
+		remaining -= request.search.step(remaining)
+		if !request.search.done {
+			break
+		}
+
+		if request.search.err == nil {
+			s.store(key, request.search.path)
+		}
+		completed = append(completed, completion{
+			request: request,
+			path:    copyPath(request.search.path),
+			err:     request.search.err,
+		})
+		s.queue = s.queue[1:]
+	}
+	s.mu.Unlock()
+
+	// Callbacks run outside the lock so they may queue follow-up requests;
+	// requests cancelled by an earlier callback are skipped
+	for _, c := range completed {
+		if c.request.callback != nil && !c.request.isCancelled() {
+			c.request.callback(c.path, c.err)
+		}
+	}
+}
+
+// Find searches immediately, bypassing the tick budget but using the cache
+func (s *Service) Find(start, goal Point) ([]Point, error) {
+	key := cacheKey{start: start, goal: goal}
+
+	s.mu.Lock()
+	if path, ok := s.cache[key]; ok {
+		s.mu.Unlock()
+		return copyPath(path), nil
+	}
+	s.mu.Unlock()
+
+	path, err := FindPath(s.grid, start, goal, s.options)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.store(key, path)
+	s.mu.Unlock()
+	return copyPath(path), nil
+}
+
+// Pending returns the number of queued requests
+func (s *Service) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Invalidate clears cached paths, e.g. after the grid changed
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache = make(map[cacheKey][]Point)
+	s.cacheOrder = nil
+}
+
+// store caches a path, evicting the oldest entry when full
+func (s *Service) store(key cacheKey, path []Point) {
+	if s.cacheSize <= 0 {
+		return
+	}
+	if _, exists := s.cache[key]; !exists {
+		if len(s.cacheOrder) >= s.cacheSize {
+			delete(s.cache, s.cacheOrder[0])
+			s.cacheOrder = s.cacheOrder[1:]
+		}
+		s.cacheOrder = append(s.cacheOrder, key)
+	}
+	s.cache[key] = path
+}
+
+func copyPath(path []Point) []Point {
+	if path == nil {
+		return nil
+	}
+	return append([]Point(nil), path...)
+}
@@ -0,0 +1,81 @@
+package pathfinding
+
+// Smooth removes waypoints that can be skipped by walking in a straight
+// line, keeping only the corners a path actually has to turn at
+func Smooth(grid Grid, path []Point, cutCorners bool) []Point {
+	if len(path) <= 2 {
+		return path
+	}
+
+	smoothed := []Point{path[0]}
+	anchor := 0
+	for anchor < len(path)-1 {
+		next := anchor + 1
+		for candidate := len(path) - 1; candidate > anchor+1; candidate-- {
+			if lineOfSight(grid, path[anchor], path[candidate], cutCorners) {
+				next = candidate
+				break
+			}
+		}
+		smoothed = append(smoothed, path[next])
+		anchor = next
+	}
+
+	return smoothed
+}
+
+// LineOfSight reports whether every cell crossed by the straight line
+// between two cell centers is walkable
+func LineOfSight(grid Grid, a, b Point) bool {
+	return lineOfSight(grid, a, b, false)
+}
+
+func lineOfSight(grid Grid, a, b Point, cutCorners bool) bool {
+	dx, dy := abs(b.X-a.X), abs(b.Y-a.Y)
+	sx, sy := sign(b.X-a.X), sign(b.Y-a.Y)
+	x, y := a.X, a.Y
+
+	for ix, iy := 0, 0; ix < dx || iy < dy; {
+		decision := (1+2*ix)*dy - (1+2*iy)*dx
+		switch {
+		case decision == 0:
+			// The line passes exactly through a cell corner
+			if !cutCorners && (!grid.Walkable(x+sx, y) || !grid.Walkable(x, y+sy)) {
+				return false
+			}
+			x += sx
+			y += sy
+			ix++
+			iy++
+		case decision < 0:
+			x += sx
+			ix++
+		default:
+			y += sy
+			iy++
+		}
+
+		if !grid.Walkable(x, y) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func sign(v int) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+// Package ratelimit limits how often something may happen with token
+// buckets, either for one caller or per key such as a client address
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket allows Rate events per second on average and up to Burst at once
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// NewBucket creates a full bucket
+func NewBucket(perSecond float64, burst int) *Bucket {
+	return &Bucket{rate: perSecond, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Allow takes a token if one is left and reports whether it could
+func (b *Bucket) Allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full reports whether the bucket has refilled completely by now
+func (b *Bucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// refill adds the tokens earned since the last call; the caller holds
+// the bucket lock
+func (b *Bucket) refill(now time.Time) {
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+}
+
+// Limiter keeps a bucket per key; buckets that have refilled are dropped
+// now and then so keys seen once do not pile up
+type Limiter struct {
+	rate    float64
+	burst   int
+	buckets map[string]*Bucket
+	pruned  time.Time
+	mu      sync.Mutex
+}
+
+// pruneInterval is how often a limiter drops buckets that have refilled
+const pruneInterval = time.Minute
+
+// NewLimiter creates a limiter allowing each key perSecond events per
+// second and burst at once
+func NewLimiter(perSecond float64, burst int) *Limiter {
+	return &Limiter{rate: perSecond, burst: burst, buckets: make(map[string]*Bucket)}
+}
+
+// Allow takes a token from a key's bucket and reports whether it could
+func (l *Limiter) Allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	if now.Sub(l.pruned) >= pruneInterval {
+		for bucketKey, bucket := range l.buckets {
+			if bucket.full(now) {
+				delete(l.buckets, bucketKey)
+			}
+		}
+		l.pruned = now
+	}
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = NewBucket(l.rate, l.burst)
+		l.buckets[key] = bucket
+	}
+	l.mu.Unlock()
+
+	return bucket.Allow(now)
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"golang-mmo-server/internal/auth"
+	"golang-mmo-server/internal/config"
 	"golang-mmo-server/internal/handlers"
 	"golang-mmo-server/internal/network"
 	"net/http"
@@ -12,13 +13,15 @@ type Router struct {
 	authService *auth.AuthService
 	hub         *network.Hub
 	authHandler *handlers.AuthHandlers
+	adminToken  string
 }
 
-func NewRouter(authService *auth.AuthService, hub *network.Hub) *Router {
+func NewRouter(authService *auth.AuthService, hub *network.Hub, cfg *config.Config) *Router {
 	return &Router{
 		authService: authService,
 		hub:         hub,
-		authHandler: handlers.NewAuthHandlers(authService),
+		authHandler: handlers.NewAuthHandlers(authService, cfg.AuthRequestsPerMinute),
+		adminToken:  cfg.AdminToken,
 	}
 }
 
@@ -32,6 +35,12 @@ func (router *Router) SetupRoutes() {
 	// Game routes
 	router.setupGameRoutes()
 
+	// Plugin routes
+	router.setupPluginRoutes()
+
+	// Admin routes
+	router.setupAdminRoutes()
+
 	// WebSocket route
 	router.setupWebSocketRoute()
 
@@ -69,11 +78,28 @@ func (router *Router) setupAuthRoutes() {
 }
 
 func (router *Router) setupGameRoutes() {
+	gameHandlers := handlers.NewGameHandlers(router.hub)
+
 	// Game API routes can be added here
-	http.HandleFunc("/api/game/status", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"status": "online", "players": 0}`))
-	})
+	http.HandleFunc("/api/game/status", gameHandlers.GetStatus)
+	http.HandleFunc("/api/game/leaderboards", gameHandlers.GetLeaderboard)
+}
+
+func (router *Router) setupPluginRoutes() {
+	// Routes added by enabled plugins, all below /api/plugins/<name>/
+	for _, route := range router.hub.GetZones().Extensions.Routes() {
+		http.HandleFunc(route.Pattern, route.Handler)
+	}
+}
+
+func (router *Router) setupAdminRoutes() {
+	// Admin routes only exist when an admin token is configured
+	if router.adminToken == "" {
+		return
+	}
+	adminHandlers := handlers.NewAdminHandlers(router.hub, router.adminToken)
+
+	http.HandleFunc("/api/admin/content/reload", adminHandlers.ReloadContent)
 }
 
 func (router *Router) setupWebSocketRoute() {
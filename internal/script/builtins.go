@@ -0,0 +1,236 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// coreFunctions are built into the language and available to every script
+var coreFunctions map[string]Builtin
+
+func init() {
+	coreFunctions = map[string]Builtin{
+		"len":      builtinLen,
+		"str":      builtinStr,
+		"num":      builtinNum,
+		"floor":    builtinFloor,
+		"abs":      builtinAbs,
+		"min":      builtinMin,
+		"max":      builtinMax,
+		"random":   builtinRandom,
+		"keys":     builtinKeys,
+		"append":   builtinAppend,
+		"contains": builtinContains,
+		"range":    builtinRange,
+		"lower":    builtinLower,
+		"upper":    builtinUpper,
+	}
+}
+
+// CoreFunctions returns the names of the functions built into the language
+func CoreFunctions() []string {
+	names := make([]string, 0, len(coreFunctions))
+	for name := range coreFunctions {
+		names = append(names, name)
+	}
+	return names
+}
+
+// builtinLen counts a string's bytes, a list's items or a map's entries
+func builtinLen(args []Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("takes 1 argument")
+	}
+	switch v := args[0].(type) {
+	case string:
+		return float64(len(v)), nil
+	case []Value:
+		return float64(len(v)), nil
+	case map[string]Value:
+		return float64(len(v)), nil
+	}
+	return nil, fmt.Errorf("cannot take the length of %s", TypeName(args[0]))
+}
+
+// builtinStr formats a value as a string
+func builtinStr(args []Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("takes 1 argument")
+	}
+	text := ToString(args[0])
+	if len(text) > MaxStringLength {
+		return nil, fmt.Errorf("string longer than %d bytes", MaxStringLength)
+	}
+	return text, nil
+}
+
+// builtinNum parses a number, returning nil when the string is not one
+func builtinNum(args []Value) (Value, error) {
+	if len(args) == 1 {
+		if number, ok := args[0].(float64); ok {
+			return number, nil
+		}
+	}
+	text, err := StringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return nil, nil
+	}
+	return number, nil
+}
+
+func builtinFloor(args []Value) (Value, error) {
+	number, err := NumberArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return math.Floor(number), nil
+}
+
+func builtinAbs(args []Value) (Value, error) {
+	number, err := NumberArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return math.Abs(number), nil
+}
+
+func builtinMin(args []Value) (Value, error) {
+	return extreme(args, func(a, b float64) bool { return a < b })
+}
+
+func builtinMax(args []Value) (Value, error) {
+	return extreme(args, func(a, b float64) bool { return a > b })
+}
+
+// extreme returns the number that beats all others at better
+func extreme(args []Value, better func(a, b float64) bool) (Value, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("takes at least 1 argument")
+	}
+	var best float64
+	for i := range args {
+		number, err := NumberArg(args, i)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 || better(number, best) {
+			best = number
+		}
+	}
+	return best, nil
+}
+
+// builtinRandom rolls a whole number from 1 to n
+func builtinRandom(args []Value) (Value, error) {
+	n, err := NumberArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > math.MaxInt32 {
+		return nil, fmt.Errorf("needs a number from 1 to %d", math.MaxInt32)
+	}
+	return float64(rand.Intn(int(n)) + 1), nil
+}
+
+// builtinKeys lists a map's keys in order
+func builtinKeys(args []Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("takes 1 argument")
+	}
+	m, ok := args[0].(map[string]Value)
+	if !ok {
+		return nil, fmt.Errorf("argument 1 must be a map, not %s", TypeName(args[0]))
+	}
+	keys := sortedKeys(m)
+	list := make([]Value, len(keys))
+	for i, key := range keys {
+		list[i] = key
+	}
+	return list, nil
+}
+
+// builtinAppend returns a new list with values added at the end; the
+// list passed in is left as it was
+func builtinAppend(args []Value) (Value, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("takes a list and the values to add")
+	}
+	list, ok := args[0].([]Value)
+	if !ok {
+		return nil, fmt.Errorf("argument 1 must be a list, not %s", TypeName(args[0]))
+	}
+	if len(list)+len(args)-1 > MaxCollectionSize {
+		return nil, fmt.Errorf("list holds more than %d items", MaxCollectionSize)
+	}
+	return append(append([]Value(nil), list...), args[1:]...), nil
+}
+
+// builtinContains reports whether a list holds a value, a map has a key
+// or a string has a substring
+func builtinContains(args []Value) (Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("takes 2 arguments")
+	}
+	switch v := args[0].(type) {
+	case []Value:
+		for _, item := range v {
+			if equal(item, args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]Value:
+		key, ok := args[1].(string)
+		if !ok {
+			return false, nil
+		}
+		_, exists := v[key]
+		return exists, nil
+	case string:
+		sub, err := StringArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Contains(v, sub), nil
+	}
+	return nil, fmt.Errorf("cannot look inside %s", TypeName(args[0]))
+}
+
+// builtinRange lists the whole numbers from 0 up to n, for counted loops
+func builtinRange(args []Value) (Value, error) {
+	n, err := NumberArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > MaxCollectionSize {
+		return nil, fmt.Errorf("needs a number from 0 to %d", MaxCollectionSize)
+	}
+	list := make([]Value, int(n))
+	for i := range list {
+		list[i] = float64(i)
+	}
+	return list, nil
+}
+
+func builtinLower(args []Value) (Value, error) {
+	text, err := StringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToLower(text), nil
+}
+
+func builtinUpper(args []Value) (Value, error) {
+	text, err := StringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToUpper(text), nil
+}
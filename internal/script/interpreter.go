@@ -0,0 +1,604 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxStringLength is the longest string a script can build
+	MaxStringLength = 64 * 1024
+	// MaxCollectionSize is the most items a script's list or map can hold
+	MaxCollectionSize = 10000
+	// deadlineCheckSteps is how many steps run between clock checks
+	deadlineCheckSteps = 128
+)
+
+// ErrBudgetExceeded is returned when a call runs out of steps or time
+var ErrBudgetExceeded = errors.New("script exceeded its budget")
+
+// Limits bound what one call into a script may use. A step is roughly
+// one statement or expression
+type Limits struct {
+	Steps int
+	Time  time.Duration
+	Depth int
+}
+
+// DefaultLimits are the limits for callers that do not set their own
+var DefaultLimits = Limits{Steps: 10000, Time: 10 * time.Millisecond, Depth: 32}
+
+// Error is a script failing to compile or run, with where it happened
+type Error struct {
+	Script  string
+	Line    int
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Script, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.Script, e.Line, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Program is a compiled script: a set of functions the host can call
+type Program struct {
+	Name      string
+	functions map[string]*function
+}
+
+// Compile parses a script. Calls to functions that are neither declared
+// by the script, built into the language nor among the host's functions
+// are reported here rather than when they run
+func Compile(name, source string, host []string) (*Program, error) {
+	tokens, err := lex(name, source)
+	if err != nil {
+		return nil, err
+	}
+	functions, calls, err := parse(name, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(host))
+	for _, hostFunction := range host {
+		known[hostFunction] = true
+	}
+	for _, call := range calls {
+		fn, declared := functions[call.name]
+		if declared && len(call.args) != len(fn.params) {
+			return nil, &Error{Script: name, Line: call.line, Message: fmt.Sprintf("%s takes %d arguments, not %d", call.name, len(fn.params), len(call.args))}
+		}
+		if _, core := coreFunctions[call.name]; !declared && !core && !known[call.name] {
+			return nil, &Error{Script: name, Line: call.line, Message: fmt.Sprintf("unknown function %s", call.name)}
+		}
+	}
+	return &Program{Name: name, functions: functions}, nil
+}
+
+// Has reports whether the script declares a function
+func (p *Program) Has(name string) bool {
+	_, exists := p.functions[name]
+	return exists
+}
+
+// Functions returns the names of the script's functions
+func (p *Program) Functions() []string {
+	names := make([]string, 0, len(p.functions))
+	for name := range p.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Call runs one of the script's functions with the host's functions
+// available to it. Arguments the function does not take are ignored and
+// those it takes but is not given are nil. Whatever the script does, and
+// even if a host function panics, Call returns an error rather than
+// letting it through
+func (p *Program) Call(name string, host map[string]Builtin, limits Limits, args ...Value) (result Value, err error) {
+	fn, exists := p.functions[name]
+	if !exists {
+		return nil, &Error{Script: p.Name, Message: fmt.Sprintf("no function %s", name)}
+	}
+
+	in := &interpreter{
+		program:  p,
+		host:     host,
+		limits:   limits,
+		deadline: time.Now().Add(limits.Time),
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, &Error{Script: p.Name, Line: in.line, Message: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+
+	params := make([]Value, len(fn.params))
+	copy(params, args)
+	return in.call(fn, params)
+}
+
+// flow is how a statement left its block
+type flow int
+
+const (
+	flowNormal flow = iota
+	flowBreak
+	flowContinue
+	flowReturn
+)
+
+// scope holds the variables of a block
+type scope struct {
+	vars   map[string]Value
+	parent *scope
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{vars: make(map[string]Value), parent: parent}
+}
+
+func (s *scope) lookup(name string) (*scope, bool) {
+	for current := s; current != nil; current = current.parent {
+		if _, exists := current.vars[name]; exists {
+			return current, true
+		}
+	}
+	return nil, false
+}
+
+// interpreter runs one call into a program
+type interpreter struct {
+	program  *Program
+	host     map[string]Builtin
+	limits   Limits
+	steps    int
+	deadline time.Time
+	depth    int
+	line     int
+}
+
+func (in *interpreter) fail(line int, format string, args ...interface{}) error {
+	return &Error{Script: in.program.Name, Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+// step spends one step of the budget
+func (in *interpreter) step(line int) error {
+	in.line = line
+	in.steps++
+	if in.limits.Steps > 0 && in.steps > in.limits.Steps {
+		return &Error{Script: in.program.Name, Line: line, Message: fmt.Sprintf("ran out of steps (%d)", in.limits.Steps), Err: ErrBudgetExceeded}
+	}
+	if in.limits.Time > 0 && in.steps%deadlineCheckSteps == 0 && time.Now().After(in.deadline) {
+		return &Error{Script: in.program.Name, Line: line, Message: fmt.Sprintf("ran out of time (%v)", in.limits.Time), Err: ErrBudgetExceeded}
+	}
+	return nil
+}
+
+// call runs a script function with its arguments
+func (in *interpreter) call(fn *function, args []Value) (Value, error) {
+	if in.limits.Depth > 0 && in.depth >= in.limits.Depth {
+		return nil, in.fail(fn.line, "calls nested deeper than %d", in.limits.Depth)
+	}
+	in.depth++
+	defer func() { in.depth-- }()
+
+	locals := newScope(nil)
+	for i, param := range fn.params {
+		locals.vars[param] = args[i]
+	}
+	_, result, err := in.block(fn.body, locals)
+	return result, err
+}
+
+// block runs statements in a scope of their own
+func (in *interpreter) block(body []stmt, parent *scope) (flow, Value, error) {
+	locals := newScope(parent)
+	for _, statement := range body {
+		flow, result, err := in.exec(statement, locals)
+		if err != nil || flow != flowNormal {
+			return flow, result, err
+		}
+	}
+	return flowNormal, nil, nil
+}
+
+func (in *interpreter) exec(statement stmt, locals *scope) (flow, Value, error) {
+	if err := in.step(statement.stmtLine()); err != nil {
+		return flowNormal, nil, err
+	}
+
+	switch s := statement.(type) {
+	case *letStmt:
+		if _, exists := locals.vars[s.name]; exists {
+			return flowNormal, nil, in.fail(s.line, "%s already declared", s.name)
+		}
+		value, err := in.eval(s.value, locals)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		locals.vars[s.name] = value
+	case *assignStmt:
+		value, err := in.eval(s.value, locals)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		if err := in.assign(s.target, value, locals); err != nil {
+			return flowNormal, nil, err
+		}
+	case *callStmt:
+		if _, err := in.eval(s.call, locals); err != nil {
+			return flowNormal, nil, err
+		}
+	case *ifStmt:
+		condition, err := in.eval(s.condition, locals)
+		if err != nil {
+			return flowNormal, nil, err
+		}
+		if Truthy(condition) {
+			return in.block(s.then, locals)
+		}
+		if s.otherwise != nil {
+			return in.block(s.otherwise, locals)
+		}
+	case *whileStmt:
+		for {
+			condition, err := in.eval(s.condition, locals)
+			if err != nil {
+				return flowNormal, nil, err
+			}
+			if !Truthy(condition) {
+				break
+			}
+			flow, result, err := in.block(s.body, locals)
+			if err != nil || flow == flowReturn {
+				return flow, result, err
+			}
+			if flow == flowBreak {
+				break
+			}
+		}
+	case *forStmt:
+		return in.forLoop(s, locals)
+	case *returnStmt:
+		var result Value
+		if s.value != nil {
+			var err error
+			if result, err = in.eval(s.value, locals); err != nil {
+				return flowNormal, nil, err
+			}
+		}
+		return flowReturn, result, nil
+	case *breakStmt:
+		return flowBreak, nil, nil
+	case *continueStmt:
+		return flowContinue, nil, nil
+	}
+	return flowNormal, nil, nil
+}
+
+// forLoop runs a loop over a list's items or a map's keys in order
+func (in *interpreter) forLoop(s *forStmt, locals *scope) (flow, Value, error) {
+	iterable, err := in.eval(s.iterable, locals)
+	if err != nil {
+		return flowNormal, nil, err
+	}
+
+	var items []Value
+	switch v := iterable.(type) {
+	case []Value:
+		items = append(items, v...)
+	case map[string]Value:
+		for _, key := range sortedKeys(v) {
+			items = append(items, key)
+		}
+	default:
+		return flowNormal, nil, in.fail(s.line, "cannot loop over %s", TypeName(iterable))
+	}
+
+	for _, item := range items {
+		iteration := newScope(locals)
+		iteration.vars[s.name] = item
+		flow, result, err := in.block(s.body, iteration)
+		if err != nil || flow == flowReturn {
+			return flow, result, err
+		}
+		if flow == flowBreak {
+			break
+		}
+	}
+	return flowNormal, nil, nil
+}
+
+// assign stores a value in a variable, list item or map entry
+func (in *interpreter) assign(target expr, value Value, locals *scope) error {
+	switch t := target.(type) {
+	case *identExpr:
+		owner, exists := locals.lookup(t.name)
+		if !exists {
+			return in.fail(t.line, "assignment to undeclared %s (use let)", t.name)
+		}
+		owner.vars[t.name] = value
+	case *indexExpr:
+		container, err := in.eval(t.target, locals)
+		if err != nil {
+			return err
+		}
+		index, err := in.eval(t.index, locals)
+		if err != nil {
+			return err
+		}
+		switch c := container.(type) {
+		case []Value:
+			i, ok := integer(index)
+			if !ok || i < 0 || i >= len(c) {
+				return in.fail(t.line, "list index %s out of range", ToString(index))
+			}
+			c[i] = value
+		case map[string]Value:
+			key, ok := index.(string)
+			if !ok {
+				return in.fail(t.line, "map keys are strings, not %s", TypeName(index))
+			}
+			if _, exists := c[key]; !exists && len(c) >= MaxCollectionSize {
+				return in.fail(t.line, "map holds more than %d entries", MaxCollectionSize)
+			}
+			c[key] = value
+		default:
+			return in.fail(t.line, "cannot index %s", TypeName(container))
+		}
+	}
+	return nil
+}
+
+func (in *interpreter) eval(expression expr, locals *scope) (Value, error) {
+	if err := in.step(expression.exprLine()); err != nil {
+		return nil, err
+	}
+
+	switch e := expression.(type) {
+	case *literalExpr:
+		return e.value, nil
+	case *identExpr:
+		if owner, exists := locals.lookup(e.name); exists {
+			return owner.vars[e.name], nil
+		}
+		return nil, in.fail(e.line, "undefined %s", e.name)
+	case *listExpr:
+		list := make([]Value, len(e.items))
+		for i, item := range e.items {
+			value, err := in.eval(item, locals)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case *mapExpr:
+		m := make(map[string]Value, len(e.keys))
+		for i, key := range e.keys {
+			value, err := in.eval(e.values[i], locals)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case *unaryExpr:
+		operand, err := in.eval(e.operand, locals)
+		if err != nil {
+			return nil, err
+		}
+		if e.op == "!" {
+			return !Truthy(operand), nil
+		}
+		number, ok := operand.(float64)
+		if !ok {
+			return nil, in.fail(e.line, "cannot negate %s", TypeName(operand))
+		}
+		return -number, nil
+	case *binaryExpr:
+		return in.binary(e, locals)
+	case *indexExpr:
+		return in.index(e, locals)
+	case *callExpr:
+		return in.callExpr(e, locals)
+	}
+	return nil, in.fail(expression.exprLine(), "unknown expression")
+}
+
+func (in *interpreter) binary(e *binaryExpr, locals *scope) (Value, error) {
+	left, err := in.eval(e.left, locals)
+	if err != nil {
+		return nil, err
+	}
+	// && and || only look at the right side when they have to
+	switch e.op {
+	case "&&":
+		if !Truthy(left) {
+			return false, nil
+		}
+		right, err := in.eval(e.right, locals)
+		return Truthy(right), err
+	case "||":
+		if Truthy(left) {
+			return true, nil
+		}
+		right, err := in.eval(e.right, locals)
+		return Truthy(right), err
+	}
+
+	right, err := in.eval(e.right, locals)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "+":
+		return in.add(e.line, left, right)
+	case "<", "<=", ">", ">=":
+		return in.compare(e, left, right)
+	}
+
+	a, aok := left.(float64)
+	b, bok := right.(float64)
+	if !aok || !bok {
+		return nil, in.fail(e.line, "cannot use %s on %s and %s", e.op, TypeName(left), TypeName(right))
+	}
+	switch e.op {
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, in.fail(e.line, "division by zero")
+		}
+		return a / b, nil
+	case "%":
+		if b == 0 {
+			return nil, in.fail(e.line, "division by zero")
+		}
+		return math.Mod(a, b), nil
+	}
+	return nil, in.fail(e.line, "unknown operator %s", e.op)
+}
+
+// add adds numbers, joins lists and, when either side is a string,
+// joins the two as text
+func (in *interpreter) add(line int, left, right Value) (Value, error) {
+	switch a := left.(type) {
+	case float64:
+		if b, ok := right.(float64); ok {
+			return a + b, nil
+		}
+	case []Value:
+		if b, ok := right.([]Value); ok {
+			if len(a)+len(b) > MaxCollectionSize {
+				return nil, in.fail(line, "list holds more than %d items", MaxCollectionSize)
+			}
+			return append(append([]Value(nil), a...), b...), nil
+		}
+	}
+	_, leftString := left.(string)
+	_, rightString := right.(string)
+	if !leftString && !rightString {
+		return nil, in.fail(line, "cannot add %s and %s", TypeName(left), TypeName(right))
+	}
+	text := ToString(left) + ToString(right)
+	if len(text) > MaxStringLength {
+		return nil, in.fail(line, "string longer than %d bytes", MaxStringLength)
+	}
+	return text, nil
+}
+
+// compare orders two numbers or two strings
+func (in *interpreter) compare(e *binaryExpr, left, right Value) (Value, error) {
+	var order int
+	switch a := left.(type) {
+	case float64:
+		b, ok := right.(float64)
+		if !ok {
+			return nil, in.fail(e.line, "cannot compare number and %s", TypeName(right))
+		}
+		if a < b {
+			order = -1
+		} else if a > b {
+			order = 1
+		}
+	case string:
+		b, ok := right.(string)
+		if !ok {
+			return nil, in.fail(e.line, "cannot compare string and %s", TypeName(right))
+		}
+		order = strings.Compare(a, b)
+	default:
+		return nil, in.fail(e.line, "cannot compare %s", TypeName(left))
+	}
+	switch e.op {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	}
+	return order >= 0, nil
+}
+
+// index reads a list item or a map entry; missing map entries are nil
+func (in *interpreter) index(e *indexExpr, locals *scope) (Value, error) {
+	container, err := in.eval(e.target, locals)
+	if err != nil {
+		return nil, err
+	}
+	index, err := in.eval(e.index, locals)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := container.(type) {
+	case []Value:
+		i, ok := integer(index)
+		if !ok || i < 0 || i >= len(c) {
+			return nil, in.fail(e.line, "list index %s out of range", ToString(index))
+		}
+		return c[i], nil
+	case map[string]Value:
+		key, ok := index.(string)
+		if !ok {
+			return nil, in.fail(e.line, "map keys are strings, not %s", TypeName(index))
+		}
+		return c[key], nil
+	}
+	return nil, in.fail(e.line, "cannot index %s", TypeName(container))
+}
+
+// callExpr calls a function of the script, of the language or of the
+// host, in that order
+func (in *interpreter) callExpr(e *callExpr, locals *scope) (Value, error) {
+	args := make([]Value, len(e.args))
+	for i, arg := range e.args {
+		value, err := in.eval(arg, locals)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	if fn, exists := in.program.functions[e.name]; exists {
+		return in.call(fn, args)
+	}
+	builtin, exists := coreFunctions[e.name]
+	if !exists {
+		builtin, exists = in.host[e.name]
+	}
+	if !exists {
+		return nil, in.fail(e.line, "unknown function %s", e.name)
+	}
+	in.line = e.line
+	result, err := builtin(args)
+	if err != nil {
+		var scriptErr *Error
+		if errors.As(err, &scriptErr) {
+			return nil, err
+		}
+		return nil, &Error{Script: in.program.Name, Line: e.line, Message: fmt.Sprintf("%s: %v", e.name, err), Err: err}
+	}
+	return result, nil
+}
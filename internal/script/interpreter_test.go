@@ -0,0 +1,314 @@
+package script
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// run compiles a script and calls its main function with default limits
+func run(t *testing.T, source string, host map[string]Builtin, args ...Value) (Value, error) {
+	t.Helper()
+	names := make([]string, 0, len(host))
+	for name := range host {
+		names = append(names, name)
+	}
+	program, err := Compile("test", source, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program.Call("main", host, DefaultLimits, args...)
+}
+
+func TestEvaluation(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   Value
+	}{
+		{"arithmetic precedence", "return 1 + 2 * 3 - 8 / 4", 5.0},
+		{"parentheses and unary minus", "return -(1 + 2) * 2", -6.0},
+		{"modulo", "return 7 % 3", 1.0},
+		{"string joining", `return "hp " + 10 + " " + true`, "hp 10 true"},
+		{"list joining", "return [1] + [2, 3]", []Value{1.0, 2.0, 3.0}},
+		{"comparison", `return 1 < 2 && "a" < "b" && 2 >= 2`, true},
+		{"equality of mixed types", `return 1 == "1"`, false},
+		{"lists are never equal", "return [] == []", false},
+		{"short circuit and", "return false && missing()", false},
+		{"short circuit or", "return true || missing()", true},
+		{"truthiness", `return !0 || !"" || ![] || !nil`, true},
+		{"nil from a missing map entry", "let m = {a: 1}\nreturn m.b", nil},
+		{"map literal with string keys", `let m = {"a b": 1, c: 2,}` + "\nreturn m[\"a b\"] + m.c", 3.0},
+		{"assignment through an index", "let l = [1, 2]\nl[1] = 5\nlet m = {}\nm.k = l\nreturn m.k[1]", 5.0},
+		{"inner scopes see outer variables", "let x = 1\nif true { x = 2 }\nreturn x", 2.0},
+		{"inner declarations do not leak", "let x = 1\nif true { let x = 2 }\nreturn x", 1.0},
+		{"else if chains", "let x = 5\nif x < 3 { return \"low\" } else if x < 7 { return \"mid\" } else { return \"high\" }", "mid"},
+		{"while with break and continue", "let i = 0\nlet sum = 0\nwhile true {\n i = i + 1\n if i > 5 { break }\n if i % 2 == 0 { continue }\n sum = sum + i\n}\nreturn sum", 9.0},
+		{"for over a list", "let sum = 0\nfor n in [1, 2, 3] { sum = sum + n }\nreturn sum", 6.0},
+		{"for over map keys in order", `let out = ""` + "\nfor k in {b: 1, a: 2, c: 3} { out = out + k }\nreturn out", "abc"},
+		{"return from inside a loop", "for n in range(10) { if n == 3 { return n } }", 3.0},
+		{"recursion", "return fib(10)", 55.0},
+		{"bare return", "return\n", nil},
+		{"no return", "let x = 1", nil},
+		{"core functions", `return len("abc") + len([1]) + floor(2.7) + abs(-1) + min(3, 1, 2) + max(1, 4) + num("2")`, 14.0},
+		{"string core functions", `return upper("a") + lower("B") + str(1.5)`, "Ab1.5"},
+		{"keys and contains", `return contains(keys({x: 1, y: 2}), "y") && contains("team", "ea")`, true},
+		{"append copies", "let a = [1]\nlet b = append(a, 2)\nreturn len(a) * 10 + len(b)", 12.0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := "func main() {\n" + test.source + "\n}\nfunc fib(n) {\n if n < 2 { return n }\n return fib(n - 1) + fib(n - 2)\n}\nfunc missing() { return nil }"
+			got, err := run(t, source, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCallArguments(t *testing.T) {
+	source := "func main(a, b) { return [a, b] }"
+	tests := []struct {
+		name string
+		args []Value
+		want Value
+	}{
+		{"all given", []Value{1.0, "x"}, []Value{1.0, "x"}},
+		{"missing are nil", []Value{1.0}, []Value{1.0, nil}},
+		{"extra are ignored", []Value{1.0, 2.0, 3.0}, []Value{1.0, 2.0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := run(t, source, nil, test.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		line   int
+		err    string
+	}{
+		{"undefined variable", "\nreturn x", 3, "undefined x"},
+		{"assignment without let", "x = 1", 2, "assignment to undeclared x"},
+		{"declared twice", "let x = 1\nlet x = 2", 3, "x already declared"},
+		{"division by zero", "let x = 0\nreturn 1 / x", 3, "division by zero"},
+		{"modulo by zero", "return 1 % 0", 2, "division by zero"},
+		{"bad operands", `return "a" - 1`, 2, "cannot use - on string and number"},
+		{"bad addition", "return nil + 1", 2, "cannot add nil and number"},
+		{"bad comparison", `return 1 < "a"`, 2, "cannot compare number and string"},
+		{"negating a string", `return -"a"`, 2, "cannot negate string"},
+		{"index out of range", "let l = [1]\nreturn l[1]", 3, "list index 1 out of range"},
+		{"fractional index", "let l = [1]\nreturn l[0.5]", 3, "list index 0.5 out of range"},
+		{"non-string map key", "let m = {}\nm[1] = 2", 3, "map keys are strings, not number"},
+		{"indexing a number", "let n = 1\nreturn n[0]", 3, "cannot index number"},
+		{"looping over a number", "for x in 3 { }", 2, "cannot loop over number"},
+		{"core function error", `return len(1)`, 2, "len:"},
+		{"long strings", "let s = \"xxxxxxxxxxxxxxxx\"\nwhile true { s = s + s }", 3, "string longer than"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := run(t, "func main() {\n"+test.source+"\n}", nil)
+			var scriptErr *Error
+			if !errors.As(err, &scriptErr) {
+				t.Fatalf("got %v, want a script error", err)
+			}
+			if scriptErr.Line != test.line || !strings.Contains(scriptErr.Message, test.err) {
+				t.Fatalf("error %q, want %q on line %d", err, test.err, test.line)
+			}
+		})
+	}
+}
+
+func TestCallUnknownFunction(t *testing.T) {
+	program, err := Compile("test", "func main() {}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := program.Call("other", nil, DefaultLimits); err == nil || !strings.Contains(err.Error(), "no function other") {
+		t.Fatalf("calling an undeclared function: %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	source := `
+func spin() {
+	while true { }
+}
+
+func recurse(n) {
+	return recurse(n + 1)
+}
+
+func count(n) {
+	let i = 0
+	while i < n { i = i + 1 }
+	return i
+}
+`
+	program, err := Compile("test", source, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		function string
+		args     []Value
+		limits   Limits
+		budget   bool
+		err      string
+	}{
+		{"steps", "spin", nil, Limits{Steps: 1000}, true, "ran out of steps (1000)"},
+		{"time", "spin", nil, Limits{Time: 20 * time.Millisecond}, true, "ran out of time"},
+		{"depth", "recurse", []Value{0.0}, Limits{Steps: 100000, Depth: 10}, false, "calls nested deeper than 10"},
+		{"within limits", "count", []Value{100.0}, Limits{Steps: 1000, Time: time.Second, Depth: 2}, false, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			_, err := program.Call(test.function, nil, test.limits, test.args...)
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("call ran for %v", elapsed)
+			}
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error %v, want %q", err, test.err)
+			}
+			if errors.Is(err, ErrBudgetExceeded) != test.budget {
+				t.Fatalf("errors.Is(%v, ErrBudgetExceeded) = %v", err, !test.budget)
+			}
+		})
+	}
+}
+
+func TestCollectionLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{"lists", "let l = range(10000)\nreturn l + [1]", "list holds more than"},
+		{"maps", "let m = {}\nfor i in range(10000) { m[str(i)] = i }\nm.extra = 1", "map holds more than"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			program, err := Compile("test", "func main() {\n"+test.source+"\n}", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = program.Call("main", nil, Limits{Steps: 200000})
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestHostFunctions(t *testing.T) {
+	var said []string
+	host := map[string]Builtin{
+		"say": func(args []Value) (Value, error) {
+			text, err := StringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			said = append(said, text)
+			return nil, nil
+		},
+		"fail": func(args []Value) (Value, error) {
+			return nil, errors.New("not allowed")
+		},
+		"explode": func(args []Value) (Value, error) {
+			var m map[string]int
+			m["boom"]++
+			return nil, nil
+		},
+	}
+
+	tests := []struct {
+		name string
+		body string
+		line int
+		err  string
+	}{
+		{"calls through", `say("hi")`, 0, ""},
+		{"bad arguments", "\nsay(1)", 3, "say: argument 1 must be a string, not number"},
+		{"errors", "\n\nfail()", 4, "fail: not allowed"},
+		{"panics are recovered", "say(\"before\")\n\nexplode()\nsay(\"after\")", 4, "panic:"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			said = nil
+			_, err := run(t, "func main() {\n"+test.body+"\n}", host)
+			if test.err == "" {
+				if err != nil || len(said) != 1 || said[0] != "hi" {
+					t.Fatalf("said %v, error %v", said, err)
+				}
+				return
+			}
+			var scriptErr *Error
+			if !errors.As(err, &scriptErr) {
+				t.Fatalf("got %v, want a script error", err)
+			}
+			if scriptErr.Line != test.line || !strings.Contains(scriptErr.Message, test.err) {
+				t.Fatalf("error %q, want %q on line %d", err, test.err, test.line)
+			}
+			for _, text := range said {
+				if text == "after" {
+					t.Fatal("the script kept running after a host function panicked")
+				}
+			}
+		})
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	want := []string{"abs", "append", "contains", "floor", "keys", "len", "lower", "max", "min", "num", "random", "range", "str", "upper"}
+	core := CoreFunctions()
+	sort.Strings(core)
+	if !reflect.DeepEqual(core, want) {
+		t.Fatalf("core functions = %v, want %v", core, want)
+	}
+
+	// Nothing beyond the core and the host's functions can be named
+	for _, name := range []string{"print", "exec", "open", "import", "eval", "os", "panic"} {
+		if _, err := Compile("test", "func main() { "+name+"() }", []string{"say"}); err == nil {
+			t.Errorf("a script compiled with a call to %s", name)
+		}
+	}
+
+	// A host function promised at compile time but not handed to Call
+	// fails when called rather than reaching anything else
+	program, err := Compile("test", "func main() { say(\"hi\") }", []string{"say"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := program.Call("main", map[string]Builtin{}, DefaultLimits); err == nil || !strings.Contains(err.Error(), "unknown function say") {
+		t.Fatalf("calling without the host function: %v", err)
+	}
+
+}
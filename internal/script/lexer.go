@@ -0,0 +1,159 @@
+package script
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenKeyword
+	tokenSymbol
+)
+
+// keywords are the words a script cannot use as names
+var keywords = map[string]bool{
+	"func":     true,
+	"let":      true,
+	"if":       true,
+	"else":     true,
+	"while":    true,
+	"for":      true,
+	"in":       true,
+	"return":   true,
+	"break":    true,
+	"continue": true,
+	"true":     true,
+	"false":    true,
+	"nil":      true,
+}
+
+// symbols are the operators and punctuation, longest first so "==" is
+// not read as two "="
+var symbols = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"+", "-", "*", "/", "%", "<", ">", "!", "=",
+	"(", ")", "{", "}", "[", "]", ",", ":", ".", ";",
+}
+
+type token struct {
+	kind   tokenKind
+	text   string
+	number float64
+	line   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of file"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lex splits a script's source into tokens
+func lex(name, source string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '/' && i+1 < len(source) && source[i+1] == '/':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			text, length, err := lexString(source[i:])
+			if err != nil {
+				return nil, &Error{Script: name, Line: line, Message: err.Error()}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, line: line})
+			i += length
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && (source[i] >= '0' && source[i] <= '9' || source[i] == '.') {
+				i++
+			}
+			number, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, &Error{Script: name, Line: line, Message: fmt.Sprintf("bad number %q", source[start:i])}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], number: number, line: line})
+		case isLetter(c):
+			start := i
+			for i < len(source) && (isLetter(source[i]) || source[i] >= '0' && source[i] <= '9') {
+				i++
+			}
+			word := source[start:i]
+			kind := tokenIdent
+			if keywords[word] {
+				kind = tokenKeyword
+			}
+			tokens = append(tokens, token{kind: kind, text: word, line: line})
+		default:
+			symbol := ""
+			for _, candidate := range symbols {
+				if strings.HasPrefix(source[i:], candidate) {
+					symbol = candidate
+					break
+				}
+			}
+			if symbol == "" {
+				return nil, &Error{Script: name, Line: line, Message: fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: symbol, line: line})
+			i += len(symbol)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, line: line}), nil
+}
+
+// isLetter reports whether a byte can start a name; names are ASCII
+func isLetter(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// lexString reads a double-quoted string with \n, \t, \" and \\ escapes,
+// returning its text and how many bytes of source it took up
+func lexString(source string) (string, int, error) {
+	var text strings.Builder
+	for i := 1; i < len(source); i++ {
+		switch source[i] {
+		case '"':
+			return text.String(), i + 1, nil
+		case '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case '\\':
+			i++
+			if i == len(source) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			switch source[i] {
+			case 'n':
+				text.WriteByte('\n')
+			case 't':
+				text.WriteByte('\t')
+			case '"', '\\':
+				text.WriteByte(source[i])
+			default:
+				return "", 0, fmt.Errorf("unknown escape \\%c", source[i])
+			}
+		default:
+			text.WriteByte(source[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
@@ -0,0 +1,74 @@
+package script
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tokens, err := lex("test", "let x = 1.5 // note\nif x >= 2 { say(\"a\\n\\\"b\\\"\") }")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		kind tokenKind
+		text string
+		line int
+	}{
+		{tokenKeyword, "let", 1},
+		{tokenIdent, "x", 1},
+		{tokenSymbol, "=", 1},
+		{tokenNumber, "1.5", 1},
+		{tokenKeyword, "if", 2},
+		{tokenIdent, "x", 2},
+		{tokenSymbol, ">=", 2},
+		{tokenNumber, "2", 2},
+		{tokenSymbol, "{", 2},
+		{tokenIdent, "say", 2},
+		{tokenSymbol, "(", 2},
+		{tokenString, "a\n\"b\"", 2},
+		{tokenSymbol, ")", 2},
+		{tokenSymbol, "}", 2},
+		{tokenEOF, "", 2},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d: %v", len(tokens), len(want), tokens)
+	}
+	for i, token := range tokens {
+		if token.kind != want[i].kind || token.text != want[i].text || token.line != want[i].line {
+			t.Errorf("token %d = %v on line %d, want %q on line %d", i, token, token.line, want[i].text, want[i].line)
+		}
+	}
+	if tokens[3].number != 1.5 {
+		t.Errorf("number token read as %v", tokens[3].number)
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		line   int
+		err    string
+	}{
+		{"unexpected character", "let x = 1\nlet y = @", 2, `unexpected character '@'`},
+		{"unterminated string", "\n\nlet s = \"open\nlet t = 1", 3, "unterminated string"},
+		{"string at end of file", `let s = "open\`, 1, "unterminated string"},
+		{"unknown escape", `let s = "\q"`, 1, `unknown escape \q`},
+		{"bad number", "\nlet n = 1.2.3", 2, `bad number "1.2.3"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := lex("test", test.source)
+			scriptErr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("lex returned %v, want a script error", err)
+			}
+			if scriptErr.Line != test.line || !strings.Contains(scriptErr.Message, test.err) {
+				t.Fatalf("error %q, want %q on line %d", err, test.err, test.line)
+			}
+		})
+	}
+}
@@ -0,0 +1,614 @@
+package script
+
+import "fmt"
+
+// Expressions
+
+type literalExpr struct {
+	value Value
+	line  int
+}
+
+type identExpr struct {
+	name string
+	line int
+}
+
+type listExpr struct {
+	items []expr
+	line  int
+}
+
+type mapExpr struct {
+	keys   []string
+	values []expr
+	line   int
+}
+
+type unaryExpr struct {
+	op      string
+	operand expr
+	line    int
+}
+
+type binaryExpr struct {
+	op    string
+	left  expr
+	right expr
+	line  int
+}
+
+// indexExpr is list[i], map[key] or map.key
+type indexExpr struct {
+	target expr
+	index  expr
+	line   int
+}
+
+type callExpr struct {
+	name string
+	args []expr
+	line int
+}
+
+type expr interface {
+	exprLine() int
+}
+
+func (e *literalExpr) exprLine() int { return e.line }
+func (e *identExpr) exprLine() int   { return e.line }
+func (e *listExpr) exprLine() int    { return e.line }
+func (e *mapExpr) exprLine() int     { return e.line }
+func (e *unaryExpr) exprLine() int   { return e.line }
+func (e *binaryExpr) exprLine() int  { return e.line }
+func (e *indexExpr) exprLine() int   { return e.line }
+func (e *callExpr) exprLine() int    { return e.line }
+
+// Statements
+
+type letStmt struct {
+	name  string
+	value expr
+	line  int
+}
+
+type assignStmt struct {
+	target expr
+	value  expr
+	line   int
+}
+
+type callStmt struct {
+	call *callExpr
+}
+
+type ifStmt struct {
+	condition expr
+	then      []stmt
+	otherwise []stmt
+	line      int
+}
+
+type whileStmt struct {
+	condition expr
+	body      []stmt
+	line      int
+}
+
+type forStmt struct {
+	name     string
+	iterable expr
+	body     []stmt
+	line     int
+}
+
+type returnStmt struct {
+	value expr
+	line  int
+}
+
+type breakStmt struct {
+	line int
+}
+
+type continueStmt struct {
+	line int
+}
+
+type stmt interface {
+	stmtLine() int
+}
+
+func (s *letStmt) stmtLine() int      { return s.line }
+func (s *assignStmt) stmtLine() int   { return s.line }
+func (s *callStmt) stmtLine() int     { return s.call.line }
+func (s *ifStmt) stmtLine() int       { return s.line }
+func (s *whileStmt) stmtLine() int    { return s.line }
+func (s *forStmt) stmtLine() int      { return s.line }
+func (s *returnStmt) stmtLine() int   { return s.line }
+func (s *breakStmt) stmtLine() int    { return s.line }
+func (s *continueStmt) stmtLine() int { return s.line }
+
+// function is a function declared by a script
+type function struct {
+	name   string
+	params []string
+	body   []stmt
+	line   int
+}
+
+// parser turns tokens into the functions of a script
+type parser struct {
+	name   string
+	tokens []token
+	pos    int
+	loops  int
+	nested int
+	calls  []*callExpr
+}
+
+// maxNesting is how deeply expressions may nest
+const maxNesting = 100
+
+// parse reads a script made of function declarations, returning them
+// along with every call they make
+func parse(name string, tokens []token) (map[string]*function, []*callExpr, error) {
+	p := &parser{name: name, tokens: tokens}
+	functions := make(map[string]*function)
+	for p.peek().kind != tokenEOF {
+		fn, err := p.function()
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, exists := functions[fn.name]; exists {
+			return nil, nil, p.errorAt(fn.line, "function %s declared twice", fn.name)
+		}
+		functions[fn.name] = fn
+	}
+	return functions, p.calls, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// previousLine is the line of the last token read
+func (p *parser) previousLine() int {
+	if p.pos == 0 {
+		return 1
+	}
+	return p.tokens[p.pos-1].line
+}
+
+// is reports whether the next token is a symbol or keyword
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokenSymbol || t.kind == tokenKeyword) && t.text == text
+}
+
+// sameLine reports whether the next token is on the line of the last
+// one. Operators, calls and indexing only continue an expression on the
+// same line, so statements need no separators
+func (p *parser) sameLine() bool {
+	return p.peek().line == p.previousLine()
+}
+
+func (p *parser) expect(text string) (token, error) {
+	if !p.is(text) {
+		return token{}, p.errorAt(p.peek().line, "expected %q, found %s", text, p.peek())
+	}
+	return p.next(), nil
+}
+
+func (p *parser) ident() (token, error) {
+	t := p.peek()
+	if t.kind != tokenIdent {
+		return token{}, p.errorAt(t.line, "expected a name, found %s", t)
+	}
+	return p.next(), nil
+}
+
+func (p *parser) errorAt(line int, format string, args ...interface{}) error {
+	return &Error{Script: p.name, Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+// function reads: func name(params) { body }
+func (p *parser) function() (*function, error) {
+	start, err := p.expect("func")
+	if err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	fn := &function{name: name.text, line: start.line}
+	seen := make(map[string]bool)
+	for !p.is(")") {
+		if len(fn.params) > 0 {
+			if _, err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		param, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if seen[param.text] {
+			return nil, p.errorAt(param.line, "parameter %s repeated", param.text)
+		}
+		seen[param.text] = true
+		fn.params = append(fn.params, param.text)
+	}
+	p.next()
+
+	if fn.body, err = p.block(); err != nil {
+		return nil, err
+	}
+	return fn, nil
+}
+
+// block reads statements between braces
+func (p *parser) block() ([]stmt, error) {
+	if _, err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var body []stmt
+	for !p.is("}") {
+		if p.peek().kind == tokenEOF {
+			return nil, p.errorAt(p.peek().line, "missing \"}\"")
+		}
+		statement, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		if statement != nil {
+			body = append(body, statement)
+		}
+	}
+	p.next()
+	return body, nil
+}
+
+// loopBody reads the block of a loop, where break and continue are allowed
+func (p *parser) loopBody() ([]stmt, error) {
+	p.loops++
+	defer func() { p.loops-- }()
+	return p.block()
+}
+
+func (p *parser) statement() (stmt, error) {
+	t := p.peek()
+	switch {
+	case p.is(";"):
+		p.next()
+		return nil, nil
+	case p.is("let"):
+		p.next()
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect("="); err != nil {
+			return nil, err
+		}
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return &letStmt{name: name.text, value: value, line: t.line}, nil
+	case p.is("if"):
+		return p.ifStatement()
+	case p.is("while"):
+		p.next()
+		condition, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		body, err := p.loopBody()
+		if err != nil {
+			return nil, err
+		}
+		return &whileStmt{condition: condition, body: body, line: t.line}, nil
+	case p.is("for"):
+		p.next()
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		iterable, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		body, err := p.loopBody()
+		if err != nil {
+			return nil, err
+		}
+		return &forStmt{name: name.text, iterable: iterable, body: body, line: t.line}, nil
+	case p.is("return"):
+		p.next()
+		statement := &returnStmt{line: t.line}
+		if p.sameLine() && !p.is("}") && !p.is(";") && p.peek().kind != tokenEOF {
+			value, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			statement.value = value
+		}
+		return statement, nil
+	case p.is("break"), p.is("continue"):
+		p.next()
+		if p.loops == 0 {
+			return nil, p.errorAt(t.line, "%s outside a loop", t.text)
+		}
+		if t.text == "break" {
+			return &breakStmt{line: t.line}, nil
+		}
+		return &continueStmt{line: t.line}, nil
+	}
+
+	target, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.is("=") {
+		p.next()
+		switch target.(type) {
+		case *identExpr, *indexExpr:
+		default:
+			return nil, p.errorAt(t.line, "cannot assign to that")
+		}
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return &assignStmt{target: target, value: value, line: t.line}, nil
+	}
+	call, ok := target.(*callExpr)
+	if !ok {
+		return nil, p.errorAt(t.line, "expression is not used")
+	}
+	return &callStmt{call: call}, nil
+}
+
+// ifStatement reads if, else if and else branches
+func (p *parser) ifStatement() (stmt, error) {
+	start := p.next()
+	condition, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	then, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	statement := &ifStmt{condition: condition, then: then, line: start.line}
+	if p.is("else") {
+		p.next()
+		if p.is("if") {
+			nested, err := p.ifStatement()
+			if err != nil {
+				return nil, err
+			}
+			statement.otherwise = []stmt{nested}
+		} else if statement.otherwise, err = p.block(); err != nil {
+			return nil, err
+		}
+	}
+	return statement, nil
+}
+
+// binaryLevels are the binary operators from loosest to tightest binding
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) expression() (expr, error) {
+	if p.nested == maxNesting {
+		return nil, p.errorAt(p.peek().line, "expression nested too deeply")
+	}
+	p.nested++
+	defer func() { p.nested-- }()
+	return p.binary(0)
+}
+
+func (p *parser) binary(level int) (expr, error) {
+	if level == len(binaryLevels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.sameLine() {
+		op := ""
+		for _, candidate := range binaryLevels[level] {
+			if p.is(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			break
+		}
+		line := p.next().line
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right, line: line}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (expr, error) {
+	if p.is("-") || p.is("!") {
+		t := p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: t.text, operand: operand, line: t.line}, nil
+	}
+	return p.postfix()
+}
+
+// postfix reads a primary expression followed by calls, indexing and
+// field access
+func (p *parser) postfix() (expr, error) {
+	target, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for p.sameLine() {
+		switch {
+		case p.is("("):
+			ident, ok := target.(*identExpr)
+			if !ok {
+				return nil, p.errorAt(p.peek().line, "only named functions can be called")
+			}
+			p.next()
+			call := &callExpr{name: ident.name, line: ident.line}
+			if call.args, err = p.expressions(")"); err != nil {
+				return nil, err
+			}
+			p.calls = append(p.calls, call)
+			target = call
+		case p.is("["):
+			line := p.next().line
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			target = &indexExpr{target: target, index: index, line: line}
+		case p.is("."):
+			line := p.next().line
+			field, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			target = &indexExpr{target: target, index: &literalExpr{value: field.text, line: line}, line: line}
+		default:
+			return target, nil
+		}
+	}
+	return target, nil
+}
+
+// expressions reads comma-separated expressions up to a closing symbol
+func (p *parser) expressions(closing string) ([]expr, error) {
+	var list []expr
+	for !p.is(closing) {
+		if len(list) > 0 {
+			if _, err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if p.is(closing) {
+				break
+			}
+		}
+		item, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	p.next()
+	return list, nil
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return &literalExpr{value: t.number, line: t.line}, nil
+	case tokenString:
+		return &literalExpr{value: t.text, line: t.line}, nil
+	case tokenIdent:
+		return &identExpr{name: t.text, line: t.line}, nil
+	case tokenKeyword:
+		switch t.text {
+		case "true":
+			return &literalExpr{value: true, line: t.line}, nil
+		case "false":
+			return &literalExpr{value: false, line: t.line}, nil
+		case "nil":
+			return &literalExpr{value: nil, line: t.line}, nil
+		}
+	case tokenSymbol:
+		switch t.text {
+		case "(":
+			inner, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "[":
+			items, err := p.expressions("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listExpr{items: items, line: t.line}, nil
+		case "{":
+			return p.mapLiteral(t.line)
+		}
+	}
+	return nil, p.errorAt(t.line, "unexpected %s", t)
+}
+
+// mapLiteral reads {key: value, ...} after its opening brace; keys are
+// names or strings
+func (p *parser) mapLiteral(line int) (expr, error) {
+	literal := &mapExpr{line: line}
+	for !p.is("}") {
+		if len(literal.keys) > 0 {
+			if _, err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if p.is("}") {
+				break
+			}
+		}
+		key := p.next()
+		if key.kind != tokenIdent && key.kind != tokenString {
+			return nil, p.errorAt(key.line, "expected a map key, found %s", key)
+		}
+		if _, err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		literal.keys = append(literal.keys, key.text)
+		literal.values = append(literal.values, value)
+	}
+	p.next()
+	return literal, nil
+}
@@ -0,0 +1,77 @@
+package script
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	program, err := Compile("test", `
+func greet(name) {
+	say("hello " + name)
+}
+
+func add(a, b) { return a + b }
+`, []string{"say"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if functions := strings.Join(program.Functions(), ","); functions != "add,greet" {
+		t.Fatalf("Functions = %s", functions)
+	}
+	if !program.Has("greet") || program.Has("say") {
+		t.Fatal("Has does not match the declared functions")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		line   int
+		err    string
+	}{
+		{"statement outside a function", "let x = 1", 1, `expected "func", found "let"`},
+		{"missing brace", "func f() {\n\tlet x = 1\n", 3, `missing "}"`},
+		{"function declared twice", "func f() {}\n\nfunc f() {}", 3, "function f declared twice"},
+		{"repeated parameter", "func f(a,\n a) {}", 2, "parameter a repeated"},
+		{"break outside a loop", "func f() {\n\tbreak\n}", 2, "break outside a loop"},
+		{"continue outside a loop", "func f() {\n\tif true { continue }\n}", 2, "continue outside a loop"},
+		{"assignment to a call", "func f() {\n\tlen(1) = 2\n}", 2, "cannot assign to that"},
+		{"unused expression", "func f() {\n\t1 + 2\n}", 2, "expression is not used"},
+		{"call of a non-name", "func f() {\n\tlet x = [1](2)\n}", 2, "only named functions can be called"},
+		{"bad map key", "func f() {\n\tlet m = {1: 2}\n}", 2, "expected a map key"},
+		{"unexpected token", "func f() {\n\tlet x = )\n}", 2, `unexpected ")"`},
+		{"keyword as a name", "func f() {\n\tlet if = 1\n}", 2, `expected a name, found "if"`},
+		{"nested too deeply", "func f() {\n\tlet x = " + strings.Repeat("(", 200) + "1" + strings.Repeat(")", 200) + "\n}", 2, "expression nested too deeply"},
+		{"unknown function", "func f() {\n\n\tspawn()\n}", 3, "unknown function spawn"},
+		{"wrong argument count", "func f() { g(1, 2) }\nfunc g(a) {}", 1, "g takes 1 arguments, not 2"},
+		{"lexer error", "func f() {\n\tlet x = #\n}", 2, "unexpected character"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Compile("test", test.source, nil)
+			var scriptErr *Error
+			if !errors.As(err, &scriptErr) {
+				t.Fatalf("Compile returned %v, want a script error", err)
+			}
+			if scriptErr.Script != "test" || scriptErr.Line != test.line || !strings.Contains(scriptErr.Message, test.err) {
+				t.Fatalf("error %q, want %q on line %d", err, test.err, test.line)
+			}
+		})
+	}
+}
+
+func TestStatementsNeedNoSeparators(t *testing.T) {
+	// A "-" on the next line starts a new statement rather than
+	// continuing the expression above it
+	program, err := Compile("test", "func f() {\n\tlet x = 1\n\t-x\n}", nil)
+	if err == nil {
+		t.Fatalf("compiled %v, want the unused -x reported", program.Functions())
+	}
+	if scriptErr := err.(*Error); scriptErr.Line != 3 {
+		t.Fatalf("error on line %d, want 3", scriptErr.Line)
+	}
+}
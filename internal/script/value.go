@@ -0,0 +1,174 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Value is a script value: nil, bool, float64, string, []Value or
+// map[string]Value. Numbers are always float64
+type Value interface{}
+
+// Builtin is a Go function scripts can call
+type Builtin func(args []Value) (Value, error)
+
+// TypeName names a value's type the way error messages do
+func TypeName(value Value) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []Value:
+		return "list"
+	case map[string]Value:
+		return "map"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// Truthy reports whether a value counts as true: everything but nil and
+// false does
+func Truthy(value Value) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	return true
+}
+
+// maxFormatted is how many list items and map entries a value is
+// formatted with before the rest is elided; a list can hold itself, so
+// formatting has to stop somewhere
+const maxFormatted = 256
+
+// ToString formats a value the way str() and string concatenation do
+func ToString(value Value) string {
+	budget := maxFormatted
+	return format(value, &budget)
+}
+
+// format formats a value, spending the budget on the items it shows
+func format(value Value, budget *int) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case []Value:
+		var parts []string
+		for _, item := range v {
+			if *budget == 0 {
+				parts = append(parts, "...")
+				break
+			}
+			*budget--
+			parts = append(parts, quoted(item, budget))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case map[string]Value:
+		var parts []string
+		for _, key := range sortedKeys(v) {
+			if *budget == 0 {
+				parts = append(parts, "...")
+				break
+			}
+			*budget--
+			parts = append(parts, strconv.Quote(key)+": "+quoted(v[key], budget))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	}
+	return fmt.Sprint(value)
+}
+
+// quoted formats a value inside a list or map, strings quoted
+func quoted(value Value, budget *int) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return format(value, budget)
+}
+
+// equal compares two values; lists and maps are never equal to anything
+func equal(a, b Value) bool {
+	switch av := a.(type) {
+	case nil:
+		return b == nil
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	case float64:
+		bv, ok := b.(float64)
+		return ok && av == bv
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	}
+	return false
+}
+
+// sortedKeys returns a map's keys in order, which is the order for loops
+// visit them in
+func sortedKeys(m map[string]Value) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// integer returns a number as an int when it is a whole number
+func integer(value Value) (int, bool) {
+	number, ok := value.(float64)
+	if !ok || number != math.Trunc(number) || math.Abs(number) > math.MaxInt32 {
+		return 0, false
+	}
+	return int(number), true
+}
+
+// StringArg returns argument i of a builtin as a string
+func StringArg(args []Value, i int) (string, error) {
+	if i >= len(args) {
+		return "", fmt.Errorf("missing argument %d", i+1)
+	}
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %d must be a string, not %s", i+1, TypeName(args[i]))
+	}
+	return s, nil
+}
+
+// NumberArg returns argument i of a builtin as a number
+func NumberArg(args []Value, i int) (float64, error) {
+	if i >= len(args) {
+		return 0, fmt.Errorf("missing argument %d", i+1)
+	}
+	number, ok := args[i].(float64)
+	if !ok {
+		return 0, fmt.Errorf("argument %d must be a number, not %s", i+1, TypeName(args[i]))
+	}
+	return number, nil
+}
+
+// OptionalNumberArg returns argument i of a builtin as a number, or a
+// default when it was left out or is nil
+func OptionalNumberArg(args []Value, i int, def float64) (float64, error) {
+	if i >= len(args) || args[i] == nil {
+		return def, nil
+	}
+	return NumberArg(args, i)
+}
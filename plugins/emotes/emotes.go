@@ -0,0 +1,210 @@
+// Package emotes is an example plugin: players play emotes for those
+// around them, wave at each other from the interaction menu and roll
+// dice in chat. It only uses the plugin API, so it shows how gameplay
+// can live outside the game package
+package emotes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang-mmo-server/internal/game"
+)
+
+const (
+	// cooldown is how long a player waits between two emotes
+	cooldown = 2 * time.Second
+	// defaultRoll is the highest number /roll rolls when not told otherwise
+	defaultRoll = 100
+	// maxRoll is the highest number /roll accepts
+	maxRoll = 1000000
+)
+
+// Wave is the interaction the plugin adds to the interaction menu
+const Wave game.InteractionType = "wave"
+
+// verbs are the emotes players can play, by name
+var verbs = map[string]string{
+	"wave":  "waves",
+	"dance": "dances",
+	"bow":   "bows",
+	"cheer": "cheers",
+	"laugh": "laughs",
+}
+
+var (
+	errUnknownEmote = errors.New("unknown emote")
+	errCooldown     = errors.New("you need to catch your breath first")
+)
+
+func init() {
+	game.RegisterPlugin(newPlugin())
+}
+
+// plugin keeps the emote cooldowns and how often each emote was played
+type plugin struct {
+	lastUsed  map[string]time.Time
+	counts    map[string]int
+	rolls     int
+	lastPrune time.Time
+	rng       *rand.Rand
+	mu        sync.Mutex
+}
+
+func newPlugin() *plugin {
+	return &plugin{
+		lastUsed: make(map[string]time.Time),
+		counts:   make(map[string]int),
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Name is what the config calls the plugin
+func (p *plugin) Name() string {
+	return "emotes"
+}
+
+// Setup adds the emote message, the wave interaction, the /roll command,
+// the cooldown cleanup and the stats route
+func (p *plugin) Setup(api *game.PluginAPI) error {
+	if err := api.HandleMessage("emote", p.handleEmote); err != nil {
+		return err
+	}
+	err := api.AddInteraction(game.PluginInteraction{
+		Type:   Wave,
+		Label:  "Wave",
+		Icon:   "👋",
+		Handle: p.handleWave,
+	})
+	if err != nil {
+		return err
+	}
+	if err := api.AddChatCommand("roll", p.handleRoll); err != nil {
+		return err
+	}
+	api.AddTickSystem(p.forgetCooldowns)
+	return api.HandleHTTP("stats", p.serveStats)
+}
+
+// handleEmote plays an emote for the players around the sender
+func (p *plugin) handleEmote(player *game.Player, world *game.World, data map[string]interface{}) error {
+	emote, _ := data["emote"].(string)
+	verb, exists := verbs[emote]
+	if !exists {
+		return errUnknownEmote
+	}
+	if err := p.use(player.ID, emote); err != nil {
+		return err
+	}
+
+	world.BroadcastNear(player.GetPosition(), emoteMessage(player, emote, fmt.Sprintf("%s %s", player.Name, verb)))
+	return nil
+}
+
+// handleWave waves at another player from the interaction menu
+func (p *plugin) handleWave(world *game.World, from, to *game.Player, data interface{}) *game.InteractionResult {
+	if err := p.use(from.ID, string(Wave)); err != nil {
+		return &game.InteractionResult{Success: false, Message: err.Error(), Error: err.Error()}
+	}
+
+	world.BroadcastNear(from.GetPosition(), emoteMessage(from, string(Wave), fmt.Sprintf("%s waves at %s", from.Name, to.Name)))
+	return &game.InteractionResult{
+		Success: true,
+		Message: fmt.Sprintf("You wave at %s", to.Name),
+	}
+}
+
+// handleRoll rolls a number from 1 to the one given, 100 by default, for
+// the whole zone to see
+func (p *plugin) handleRoll(player *game.Player, world *game.World, args []string) error {
+	highest := defaultRoll
+	if len(args) > 0 {
+		parsed, err := strconv.Atoi(args[0])
+		if err != nil || parsed < 2 || parsed > maxRoll {
+			return fmt.Errorf("roll takes a number from 2 to %d", maxRoll)
+		}
+		highest = parsed
+	}
+
+	p.mu.Lock()
+	rolled := p.rng.Intn(highest) + 1
+	p.rolls++
+	p.mu.Unlock()
+
+	world.BroadcastZone(emoteMessage(player, "roll", fmt.Sprintf("%s rolls %d (1-%d)", player.Name, rolled, highest)))
+	return nil
+}
+
+// use starts a player's emote cooldown and counts the emote, failing
+// while the cooldown runs
+func (p *plugin) use(playerID, emote string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.lastUsed[playerID]) < cooldown {
+		return errCooldown
+	}
+	p.lastUsed[playerID] = now
+	p.counts[emote]++
+	return nil
+}
+
+// forgetCooldowns drops the cooldowns that ran out, so players who left
+// are not remembered forever. Every zone ticks it, so it only looks once
+// per cooldown
+func (p *plugin) forgetCooldowns(world *game.World, delta float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.lastPrune) < cooldown {
+		return
+	}
+	p.lastPrune = now
+	for playerID, used := range p.lastUsed {
+		if now.Sub(used) >= cooldown {
+			delete(p.lastUsed, playerID)
+		}
+	}
+}
+
+// serveStats reports how often each emote was played and dice were
+// rolled since the server started
+func (p *plugin) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p.mu.Lock()
+	counts := make(map[string]int, len(p.counts))
+	for emote, count := range p.counts {
+		counts[emote] = count
+	}
+	stats := map[string]interface{}{
+		"emotes": counts,
+		"rolls":  p.rolls,
+	}
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// emoteMessage returns the emote message shown to players
+func emoteMessage(player *game.Player, emote, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "emote",
+		"id":    player.ID,
+		"name":  player.Name,
+		"emote": emote,
+		"text":  text,
+	}
+}
@@ -7,6 +7,7 @@ import { UIManager } from '../ui/UIManager.js';
 import { PlayerManager } from '../player/PlayerManager.js';
 import { StaminaSystem } from '../player/StaminaSystem.js';
 import { InteractionManager } from '../interaction/InteractionManager.js';
+import { EntityManager } from '../entities/EntityManager.js';
 
 export class GameClient {
     constructor() {
@@ -21,12 +22,14 @@ export class GameClient {
         this.renderManager = new RenderManager(this.canvas, this.ctx, this);
         this.uiManager = new UIManager(this);
         this.playerManager = new PlayerManager();
+        this.entityManager = new EntityManager();
         this.staminaSystem = new StaminaSystem();
         this.interactionManager = new InteractionManager(this);
         
         // Game state
         this.myPlayer = null;
         this.currentUser = null;
+        this.moveTarget = null;
         this.isLoading = true;
         
         this.init();
@@ -67,6 +70,7 @@ export class GameClient {
             this.inputManager.handleInput();
             this.staminaSystem.update();
             this.playerManager.update();
+            this.entityManager.update();
             this.interactionManager.update();
             this.renderManager.render();
             
@@ -84,4 +88,7 @@ export class GameClient {
     getContext() { return this.ctx; }
     getNetworkManager() { return this.networkManager; }
     getPlayerManager() { return this.playerManager; }
+    getEntityManager() { return this.entityManager; }
+    getMoveTarget() { return this.moveTarget; }
+    setMoveTarget(target) { this.moveTarget = target; }
 }
@@ -0,0 +1,157 @@
+export class EntityManager {
+    constructor() {
+        this.npcs = new Map();
+        this.items = new Map();
+        this.resources = new Map();
+        this.interpolationFactor = 0.2;
+    }
+    
+    addNPC(npcData) {
+        const npc = {
+            id: npcData.id,
+            name: npcData.name,
+            x: npcData.x,
+            y: npcData.y,
+            targetX: npcData.x,
+            targetY: npcData.y,
+            health: npcData.health,
+            maxHealth: npcData.max_health
+        };
+        
+        this.npcs.set(npcData.id, npc);
+        return npc;
+    }
+    
+    removeNPC(npcId) {
+        this.npcs.delete(npcId);
+    }
+    
+    addItem(itemData) {
+        this.items.set(itemData.id, {
+            id: itemData.id,
+            itemId: itemData.item_id,
+            name: itemData.name,
+            quantity: itemData.quantity,
+            x: itemData.x,
+            y: itemData.y
+        });
+    }
+    
+    removeItem(itemId) {
+        this.items.delete(itemId);
+    }
+    
+    addResource(resourceData) {
+        this.resources.set(resourceData.id, {
+            id: resourceData.id,
+            resourceId: resourceData.resource_id,
+            name: resourceData.name,
+            profession: resourceData.profession,
+            skill: resourceData.skill,
+            x: resourceData.x,
+            y: resourceData.y,
+            depleted: resourceData.depleted
+        });
+    }
+    
+    setResourceDepleted(resourceId, depleted) {
+        const resource = this.resources.get(resourceId);
+        if (resource) {
+            resource.depleted = depleted;
+        }
+    }
+    
+    getResourceAt(x, y, radius = 16) {
+        for (const resource of this.resources.values()) {
+            if (Math.abs(resource.x - x) <= radius && Math.abs(resource.y - y) <= radius) {
+                return resource;
+            }
+        }
+        return null;
+    }
+    
+    getItemAt(x, y, radius = 14) {
+        for (const item of this.items.values()) {
+            if (Math.abs(item.x - x) <= radius && Math.abs(item.y - y) <= radius) {
+                return item;
+            }
+        }
+        return null;
+    }
+    
+    clear() {
+        this.npcs.clear();
+        this.items.clear();
+        this.resources.clear();
+    }
+    
+    updateNPCPosition(data) {
+        const npc = this.npcs.get(data.id);
+        if (npc) {
+            npc.targetX = data.x;
+            npc.targetY = data.y;
+        }
+    }
+    
+    updateNPCHealth(data) {
+        const npc = this.npcs.get(data.id);
+        if (npc) {
+            npc.health = data.health;
+            npc.maxHealth = data.max_health;
+        }
+    }
+    
+    getNPCAt(x, y, radius = 16) {
+        for (const npc of this.npcs.values()) {
+            if (Math.abs(npc.x - x) <= radius && Math.abs(npc.y - y) <= radius) {
+                return npc;
+            }
+        }
+        return null;
+    }
+    
+    updateWorldState(data) {
+        if (data.items) {
+            this.items.clear();
+            data.items.forEach(itemData => this.addItem(itemData));
+        }
+        
+        if (data.resources) {
+            this.resources.clear();
+            data.resources.forEach(resourceData => this.addResource(resourceData));
+        }
+        
+        if (!data.npcs) return;
+        
+        data.npcs.forEach(npcData => {
+            if (!this.npcs.has(npcData.id)) {
+                this.addNPC(npcData);
+            } else {
+                this.updateNPCPosition(npcData);
+            }
+        });
+    }
+    
+    update() {
+        this.npcs.forEach(npc => {
+            npc.x += (npc.targetX - npc.x) * this.interpolationFactor;
+            npc.y += (npc.targetY - npc.y) * this.interpolationFactor;
+        });
+    }
+    
+    getAllItems() {
+        return this.items;
+    }
+    
+    getAllResources() {
+        return this.resources;
+    }
+    
+    getAllNPCs() {
+        return this.npcs;
+    }
+    
+    getNPC(id) {
+        return this.npcs.get(id);
+    }
+}
@@ -4,6 +4,8 @@ export class InputManager {
         this.keys = {};
         this.lastMoveTime = 0;
         this.moveInterval = 50;
+        this.targetId = null;
+        this.mouse = { x: 0, y: 0 };
     }
     
     setupInputHandlers() {
@@ -15,6 +17,10 @@ export class InputManager {
         const canvas = this.gameClient.getCanvas();
         if (canvas) {
             canvas.addEventListener('click', (e) => this.handleClick(e));
+            canvas.addEventListener('mousemove', (e) => {
+                const rect = canvas.getBoundingClientRect();
+                this.mouse = { x: e.clientX - rect.left, y: e.clientY - rect.top };
+            });
         }
         
         // Chat input
@@ -39,6 +45,12 @@ export class InputManager {
             e.preventDefault();
         }
         
+        // Number keys cast the abilities on the ability bar
+        const typing = document.activeElement && ['INPUT', 'TEXTAREA'].includes(document.activeElement.tagName);
+        if (!typing && key >= '1' && key <= '9') {
+            this.gameClient.uiManager.castAbility(parseInt(key, 10) - 1);
+        }
+        
         if (key === 'enter') {
             e.preventDefault();
             const chatInput = document.getElementById('chatInput');
@@ -65,7 +77,47 @@ export class InputManager {
         const x = e.clientX - rect.left;
         const y = e.clientY - rect.top;
         
-        this.gameClient.interactionManager.handleClick(x, y);
+        // Clicking an item on the ground picks it up
+        const item = this.gameClient.getEntityManager().getItemAt(x, y);
+        if (item) {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'interact',
+                target_id: item.id
+            });
+            return;
+        }
+        
+        // Clicking a tree or ore vein starts gathering from it
+        const resource = this.gameClient.getEntityManager().getResourceAt(x, y);
+        if (resource) {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'interact',
+                target_id: resource.id
+            });
+            return;
+        }
+        
+        // Clicking a creature attacks it, clicking anyone else talks to them
+        const npc = this.gameClient.getEntityManager().getNPCAt(x, y);
+        if (npc) {
+            if (npc.maxHealth > 0) {
+                this.targetId = npc.id;
+            }
+            this.gameClient.getNetworkManager().sendMessage({
+                type: npc.maxHealth > 0 ? 'attack' : 'interact',
+                target_id: npc.id
+            });
+            return;
+        }
+        
+        // Clicks that don't hit a player walk there along a server-side path
+        if (!this.gameClient.interactionManager.handleClick(x, y)) {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'move_to',
+                x: x,
+                y: y
+            });
+        }
     }
     
     handleInput() {
@@ -82,7 +134,10 @@ export class InputManager {
         const baseSpeed = 8;
         const sprintMultiplier = 1.5;
         const isSprintActive = this.gameClient.staminaSystem.isSprintActive();
-        const speed = isSprintActive ? baseSpeed * sprintMultiplier : baseSpeed;
+        // Slows shrink each step and roots and stuns stop movement altogether
+        const moveSpeed = this.gameClient.uiManager.moveSpeed;
+        if (moveSpeed <= 0) return;
+        const speed = (isSprintActive ? baseSpeed * sprintMultiplier : baseSpeed) * Math.min(moveSpeed, 1);
         
         if (this.keys['w'] || this.keys['arrowup']) {
             newY -= speed;
@@ -102,6 +157,7 @@ export class InputManager {
         }
         
         if (moved) {
+            this.gameClient.setMoveTarget(null);
             this.gameClient.playerManager.movePlayer(newX, newY, isSprintActive, this.gameClient);
             this.lastMoveTime = now;
         }
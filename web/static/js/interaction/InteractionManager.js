@@ -35,9 +35,13 @@ export class InteractionManager {
         
         if (clickedPlayer) {
             this.showPlayerInteractionMenu(clickedPlayer, x, y);
-        } else {
-            this.hideInteractionMenu();
+            return true;
         }
+        
+        // A click away from an open menu only closes it
+        const menuWasVisible = this.interactionMenuVisible;
+        this.hideInteractionMenu();
+        return menuWasVisible;
     }
     
     checkNearbyPlayers() {
@@ -1,6 +1,7 @@
 export class MessageHandler {
     constructor(gameClient) {
         this.gameClient = gameClient;
+        this.zoneTransferPending = false;
     }
     
     handleMessage(data) {
@@ -13,6 +14,27 @@ export class MessageHandler {
                 this.handleWorldState(data);
                 break;
                 
+            case 'map_data':
+                this.handleMapData(data);
+                break;
+                
+            case 'position_correction':
+                this.handlePositionCorrection(data);
+                break;
+                
+            case 'npc_moved':
+                this.handleNPCMoved(data);
+                break;
+                
+            case 'move_path':
+                this.handleMovePath(data);
+                break;
+                
+            case 'move_to_complete':
+            case 'move_to_failed':
+                this.handleMoveToFinished(data);
+                break;
+                
             case 'player_joined':
                 this.handlePlayerJoined(data);
                 break;
@@ -21,6 +43,22 @@ export class MessageHandler {
                 this.handlePlayerLeft(data);
                 break;
                 
+            case 'player_appeared':
+                this.handlePlayerAppeared(data);
+                break;
+                
+            case 'player_disappeared':
+                this.handlePlayerLeft(data);
+                break;
+                
+            case 'zone_transfer':
+                this.handleZoneTransfer(data);
+                break;
+                
+            case 'zone_entered':
+                this.handleZoneEntered(data);
+                break;
+                
             case 'player_moved':
                 this.handlePlayerMoved(data);
                 break;
@@ -37,11 +75,465 @@ export class MessageHandler {
                 this.handleInteractionResult(data);
                 break;
                 
+            case 'item_appeared':
+                this.gameClient.entityManager.addItem(data);
+                break;
+                
+            case 'item_disappeared':
+                this.gameClient.entityManager.removeItem(data.id);
+                break;
+                
+            case 'inventory_update':
+                this.gameClient.uiManager.updateInventory(data);
+                break;
+                
+            case 'interact_failed':
+            case 'drop_failed':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'progress_update':
+                this.gameClient.uiManager.updateProgress(data);
+                break;
+                
+            case 'level_up':
+                this.gameClient.uiManager.addSystemMessage(`${data.name} reached level ${data.level}!`);
+                break;
+                
+            case 'quest_log':
+                this.gameClient.uiManager.setQuests(data.quests);
+                break;
+                
+            case 'quest_accepted':
+                this.gameClient.uiManager.addQuest(data);
+                this.gameClient.uiManager.addSystemMessage(`Quest accepted: ${data.name}`);
+                break;
+                
+            case 'quest_progress':
+                this.gameClient.uiManager.updateQuestProgress(data);
+                break;
+                
+            case 'quest_completed':
+                this.gameClient.uiManager.removeQuest(data.quest_id);
+                this.gameClient.uiManager.addSystemMessage(`Quest completed: ${data.name} (+${data.xp} XP, +${data.currency} coins)`);
+                break;
+                
+            case 'quest_abandoned':
+                this.gameClient.uiManager.removeQuest(data.quest_id);
+                break;
+                
+            case 'quest_failed':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'npc_quests':
+                this.handleNPCQuests(data);
+                break;
+                
+            case 'dialogue':
+                this.gameClient.uiManager.showDialogue(data);
+                break;
+                
+            case 'dialogue_closed':
+                this.gameClient.uiManager.hideDialogue();
+                break;
+                
+            case 'dialogue_failed':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'shop':
+                this.gameClient.uiManager.showShop(data);
+                break;
+                
+            case 'shop_failed':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'wallet_update':
+                this.gameClient.uiManager.updateWallet(data);
+                break;
+                
+            case 'auction_opened':
+                this.gameClient.uiManager.showAuction();
+                break;
+                
+            case 'auction_results':
+                this.gameClient.uiManager.showAuctionResults(data);
+                break;
+                
+            case 'auction_update':
+                this.gameClient.uiManager.addSystemMessage(this.describeAuctionUpdate(data));
+                this.gameClient.uiManager.refreshAuction();
+                break;
+                
+            case 'auction_outbid':
+                this.gameClient.uiManager.addSystemMessage(`You were outbid on ${data.name}`);
+                this.gameClient.uiManager.refreshAuction();
+                break;
+                
+            case 'auction_sold':
+                this.gameClient.uiManager.addSystemMessage(`Your auction of ${data.name} sold for ${data.bid}`);
+                break;
+                
+            case 'auction_expired':
+                this.gameClient.uiManager.addSystemMessage(`Your auction of ${data.name} expired`);
+                break;
+                
+            case 'mail_received':
+                this.gameClient.uiManager.addSystemMessage(`New mail from ${data.sender}: ${data.subject} (${data.unread} unread, type /mail)`);
+                break;
+                
+            case 'mail_summary':
+                if (data.unread > 0) {
+                    this.gameClient.uiManager.addSystemMessage(`You have ${data.unread} unread letters (type /mail)`);
+                }
+                break;
+                
+            case 'mail_sent':
+                this.gameClient.uiManager.addSystemMessage(`Your letter "${data.subject}" is on its way to ${data.recipient}`);
+                break;
+                
+            case 'mail_list':
+                this.gameClient.uiManager.showMail(data);
+                break;
+                
+            case 'auction_failed':
+            case 'mail_failed':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'professions_update':
+                this.gameClient.uiManager.updateProfessions(data);
+                break;
+                
+            case 'profession_level_up':
+                this.gameClient.uiManager.addSystemMessage(`Your ${data.profession} is now level ${data.level}`);
+                break;
+                
+            case 'recipes':
+                this.gameClient.uiManager.setRecipes(data.recipes);
+                break;
+                
+            case 'gather_started':
+                this.gameClient.uiManager.addSystemMessage(`Gathering from ${data.name}...`);
+                break;
+                
+            case 'gather_interrupted':
+                this.gameClient.uiManager.addSystemMessage('Gathering interrupted');
+                break;
+                
+            case 'gather_complete':
+                this.gameClient.uiManager.addSystemMessage(data.items.length === 0
+                    ? `The ${data.name} yielded nothing`
+                    : `Gathered ${data.items.map(item => `${item.quantity} ${item.name}`).join(', ')}`);
+                break;
+                
+            case 'craft_complete':
+                this.gameClient.uiManager.addSystemMessage(`Crafted ${data.name}`);
+                break;
+                
+            case 'gather_failed':
+            case 'craft_failed':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'resource_depleted':
+                this.gameClient.entityManager.setResourceDepleted(data.id, true);
+                break;
+                
+            case 'resource_respawned':
+                this.gameClient.entityManager.setResourceDepleted(data.id, false);
+                break;
+                
+            case 'abilities':
+                this.gameClient.uiManager.setAbilities(data.abilities);
+                break;
+                
+            case 'vitals_update':
+                this.gameClient.uiManager.updateVitals(data);
+                break;
+                
+            case 'stats_update':
+                this.gameClient.uiManager.updateStats(data);
+                break;
+                
+            case 'effects_update':
+                this.gameClient.uiManager.setEffects(data.effects);
+                break;
+                
+            case 'effect_applied':
+                if (this.isMe(data.target_id)) {
+                    this.gameClient.uiManager.addEffect(data);
+                }
+                break;
+                
+            case 'effect_removed':
+                if (this.isMe(data.target_id)) {
+                    this.gameClient.uiManager.removeEffect(data.effect_id);
+                }
+                break;
+                
+            case 'effect_cancel_failed':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'stamina_update':
+                this.gameClient.staminaSystem.sync(data.stamina);
+                break;
+                
+            case 'cast_started':
+                if (this.isMe(data.caster_id)) {
+                    this.gameClient.uiManager.showCastBar(data.name, data.seconds);
+                }
+                break;
+                
+            case 'cast_finished':
+                if (this.isMe(data.caster_id)) {
+                    this.gameClient.uiManager.hideCastBar();
+                }
+                break;
+                
+            case 'cast_interrupted':
+                if (this.isMe(data.caster_id)) {
+                    this.gameClient.uiManager.hideCastBar();
+                    this.gameClient.uiManager.addSystemMessage(`Cast interrupted: ${data.reason}`);
+                }
+                break;
+                
+            case 'ability_cooldown':
+                this.gameClient.uiManager.startAbilityCooldown(data.ability_id, data.seconds);
+                break;
+                
+            case 'ability_failed':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'player_healed':
+                if (this.isMe(data.id) && data.amount > 0) {
+                    this.gameClient.uiManager.addSystemMessage(`Healed for ${data.amount}`);
+                }
+                break;
+                
+            case 'death_state': {
+                const myPlayer = this.gameClient.getMyPlayer();
+                if (myPlayer) {
+                    this.gameClient.playerManager.setPlayerState(myPlayer.id, data.state);
+                }
+                this.gameClient.uiManager.showDeathState(data);
+                break;
+            }
+                
+            case 'player_died':
+                this.gameClient.playerManager.setPlayerState(data.id, 'dead');
+                if (this.isMe(data.id)) {
+                    this.gameClient.uiManager.hideCastBar();
+                }
+                break;
+                
+            case 'player_revived':
+            case 'player_released':
+                this.gameClient.playerManager.setPlayerState(data.id, data.state);
+                this.gameClient.playerManager.updatePlayerPosition(data);
+                break;
+                
+            case 'resurrect_offer':
+                this.gameClient.uiManager.showResurrectOffer(data);
+                break;
+                
+            case 'death_penalty':
+                this.gameClient.uiManager.addSystemMessage(`You lost ${data.experience} experience`);
+                break;
+                
+            case 'bind_set':
+                this.gameClient.uiManager.addSystemMessage(`You are now bound to ${data.name}`);
+                break;
+                
+            case 'death_failed':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'pvp_status':
+                this.gameClient.uiManager.showPvPStatus(data);
+                break;
+                
+            case 'region_entered':
+                this.gameClient.uiManager.addSystemMessage(`Entering ${data.name}`);
+                break;
+                
+            case 'region_left':
+                this.gameClient.uiManager.addSystemMessage(`Leaving ${data.name}`);
+                break;
+                
+            case 'duel_challenge':
+                this.gameClient.uiManager.addSystemMessage(`${data.challenger_name} challenges you to a duel. Type /duel accept or /duel decline`);
+                break;
+                
+            case 'duel_declined':
+                this.gameClient.uiManager.addSystemMessage('Your duel challenge was declined');
+                break;
+                
+            case 'duel_started':
+                if (data.players.some(id => this.isMe(id))) {
+                    this.gameClient.uiManager.addSystemMessage('The duel begins!');
+                }
+                break;
+                
+            case 'duel_ended':
+                if (this.isMe(data.winner_id)) {
+                    this.gameClient.uiManager.addSystemMessage('You won the duel');
+                } else if (this.isMe(data.loser_id)) {
+                    this.gameClient.uiManager.addSystemMessage(`You lost the duel (${data.reason})`);
+                }
+                break;
+                
+            case 'pvp_failed':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'statistics':
+                this.gameClient.uiManager.showStatistics(data);
+                break;
+                
+            case 'leaderboard':
+                this.gameClient.uiManager.showLeaderboard(data);
+                break;
+                
+            case 'join_failed':
+            case 'leaderboard_failed':
+            case 'title_failed':
+            case 'emote_failed':
+            case 'chat_command_failed':
+            case 'rate_limited':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'emote':
+                this.gameClient.uiManager.addSystemMessage(data.text);
+                break;
+                
+            case 'script_message':
+                this.gameClient.uiManager.addSystemMessage(data.text);
+                break;
+                
+            case 'npc_say':
+                this.gameClient.uiManager.addSystemMessage(`${data.name}: ${data.text}`);
+                break;
+                
+            case 'achievements':
+                this.gameClient.uiManager.showAchievements(data);
+                break;
+                
+            case 'achievement_unlocked':
+                if (this.isMe(data.player_id)) {
+                    this.gameClient.uiManager.addSystemMessage(`Achievement earned: ${data.name}!`);
+                    if (data.title) {
+                        this.gameClient.uiManager.addSystemMessage(`You can now use the title "${data.title}"`);
+                    }
+                } else {
+                    this.gameClient.uiManager.addSystemMessage(`${data.player_name} earned the achievement ${data.name}`);
+                }
+                break;
+                
+            case 'achievement_progress':
+            case 'player_title':
+                break;
+                
+            case 'player_damaged':
+                if (this.isMe(data.id)) {
+                    this.gameClient.uiManager.addSystemMessage(`You take ${data.damage} damage`);
+                }
+                break;
+                
+            case 'npc_damaged':
+                this.gameClient.entityManager.updateNPCHealth(data);
+                break;
+                
+            case 'npc_died':
+            case 'npc_despawned':
+                this.gameClient.entityManager.removeNPC(data.id);
+                break;
+                
+            case 'world_time':
+                this.gameClient.uiManager.showWorldTime(data);
+                this.gameClient.renderManager.setEnvironment(data.phase, null);
+                break;
+                
+            case 'weather':
+                this.gameClient.uiManager.showWeather(data);
+                this.gameClient.renderManager.setEnvironment(null, data.weather);
+                break;
+                
+            case 'npc_spawned':
+                this.gameClient.entityManager.addNPC(data);
+                break;
+                
+            case 'attack_failed':
+            case 'loot_roll_failed':
+                this.gameClient.uiManager.addSystemMessage(data.error);
+                break;
+                
+            case 'loot_roll':
+                this.handleLootRoll(data);
+                break;
+                
+            case 'loot_roll_result':
+                this.handleLootRollResult(data);
+                break;
+                
+            case 'party_invite':
+                this.handlePartyInvite(data);
+                break;
+                
+            case 'party_update':
+                this.handlePartyUpdate(data);
+                break;
+                
+            case 'party_left':
+                this.gameClient.uiManager.addSystemMessage('You are no longer in a party');
+                break;
+                
+            case 'party_declined':
+                this.gameClient.uiManager.addSystemMessage(`${data.name} declined your party invite`);
+                break;
+                
+            case 'party_error':
+                this.gameClient.uiManager.addSystemMessage(`Party: ${data.error}`);
+                break;
+                
+            case 'instance_denied':
+                this.gameClient.uiManager.addSystemMessage(`Cannot enter: ${data.error}`);
+                break;
+                
+            case 'instance_closed':
+                this.gameClient.uiManager.addSystemMessage(`${data.zone_name} has closed`);
+                break;
+                
             default:
                 console.log('Unknown message type:', data.type);
         }
     }
     
+    isMe(playerId) {
+        const myPlayer = this.gameClient.getMyPlayer();
+        return myPlayer !== null && myPlayer.id === playerId;
+    }
+    
+    describeAuctionUpdate(data) {
+        switch (data.action) {
+            case 'listed':
+                return `Posted ${data.name} at the auction house`;
+            case 'bid':
+                return `You bid ${data.price} on ${data.name}`;
+            case 'bought':
+                return `You bought ${data.name} for ${data.price}; it is on its way by mail`;
+            case 'cancelled':
+                return `Cancelled your auction of ${data.name}; it is on its way by mail`;
+            default:
+                return `Auction ${data.action}: ${data.name}`;
+        }
+    }
+    
     handleYourPlayer(data) {
         const player = {
             id: data.id,
@@ -61,6 +553,78 @@ export class MessageHandler {
     
     handleWorldState(data) {
         this.gameClient.playerManager.updateWorldState(data);
+        this.gameClient.entityManager.updateWorldState(data);
+    }
+    
+    handleMapData(data) {
+        this.gameClient.renderManager.setMap(data);
+        
+        // The new zone's map is in place, tell the server we're ready to enter
+        if (this.zoneTransferPending) {
+            this.zoneTransferPending = false;
+            this.gameClient.getNetworkManager().sendMessage({ type: 'zone_ready' });
+        }
+    }
+    
+    handleZoneTransfer(data) {
+        this.zoneTransferPending = true;
+        this.gameClient.loadingScreen.show();
+        this.gameClient.setMoveTarget(null);
+        this.gameClient.uiManager.hideDialogue();
+        this.gameClient.uiManager.hideShop();
+        this.gameClient.uiManager.hideAuction();
+        
+        // Forget everything from the zone we are leaving
+        const myPlayer = this.gameClient.getMyPlayer();
+        const playerManager = this.gameClient.playerManager;
+        Array.from(playerManager.getAllPlayers().keys()).forEach(id => {
+            if (!myPlayer || id !== myPlayer.id) {
+                playerManager.removePlayer(id);
+            }
+        });
+        this.gameClient.entityManager.clear();
+        
+        if (myPlayer) {
+            myPlayer.x = myPlayer.targetX = data.x;
+            myPlayer.y = myPlayer.targetY = data.y;
+        }
+    }
+    
+    handleZoneEntered(data) {
+        this.gameClient.loadingScreen.hide();
+        this.gameClient.uiManager.addSystemMessage(`Entered ${data.zone_name}`);
+    }
+    
+    handlePlayerAppeared(data) {
+        this.gameClient.playerManager.addPlayer(data);
+    }
+    
+    handlePositionCorrection(data) {
+        const myPlayer = this.gameClient.getMyPlayer();
+        if (!myPlayer) return;
+        
+        myPlayer.x = data.x;
+        myPlayer.y = data.y;
+        myPlayer.targetX = data.x;
+        myPlayer.targetY = data.y;
+    }
+    
+    handleNPCMoved(data) {
+        this.gameClient.entityManager.updateNPCPosition(data);
+    }
+    
+    handleMovePath(data) {
+        const waypoints = data.waypoints || [];
+        if (waypoints.length > 0) {
+            this.gameClient.setMoveTarget(waypoints[waypoints.length - 1]);
+        }
+    }
+    
+    handleMoveToFinished(data) {
+        this.gameClient.setMoveTarget(null);
+        if (data.error) {
+            this.gameClient.uiManager.addSystemMessage(`Cannot move there: ${data.error}`);
+        }
     }
     
     handlePlayerJoined(data) {
@@ -84,6 +648,56 @@ export class MessageHandler {
         this.gameClient.interactionManager.updateNearbyPlayers(data.nearby_players);
     }
     
+    handlePartyInvite(data) {
+        const accepted = window.confirm(`${data.from_name} invites you to join their party. Accept?`);
+        this.gameClient.getNetworkManager().sendMessage({
+            type: accepted ? 'party_accept' : 'party_decline'
+        });
+    }
+    
+    handlePartyUpdate(data) {
+        const names = data.members.map(member => member.id === data.leader ? `${member.name} (leader)` : member.name);
+        this.gameClient.uiManager.addSystemMessage(`Party: ${names.join(', ')} - loot: ${data.loot_mode.replace(/_/g, ' ')}`);
+    }
+    
+    handleNPCQuests(data) {
+        const network = this.gameClient.getNetworkManager();
+        
+        data.completable.forEach(quest => {
+            if (confirm(`${data.name}: Have you finished "${quest.name}"?`)) {
+                network.sendMessage({ type: 'quest_turn_in', quest_id: quest.id });
+            }
+        });
+        
+        data.available.forEach(quest => {
+            if (confirm(`${data.name} offers "${quest.name}":\n\n${quest.description}\n\nAccept?`)) {
+                network.sendMessage({ type: 'quest_accept', quest_id: quest.id });
+            }
+        });
+        
+        if (data.completable.length === 0 && data.available.length === 0) {
+            this.gameClient.uiManager.addSystemMessage(`${data.name} has nothing for you right now.`);
+        }
+    }
+    
+    handleLootRoll(data) {
+        const answer = window.prompt(`Roll on ${data.name} (${data.rarity}): need, greed or pass?`, 'greed');
+        const choice = ['need', 'greed', 'pass'].includes(answer) ? answer : 'pass';
+        this.gameClient.getNetworkManager().sendMessage({
+            type: 'loot_roll_choice',
+            roll_id: data.roll_id,
+            choice: choice
+        });
+    }
+    
+    handleLootRollResult(data) {
+        data.results.forEach(result => {
+            this.gameClient.uiManager.addSystemMessage(`${result.name} rolled ${result.roll} (${result.choice})`);
+        });
+        const outcome = data.winner ? `${data.winner} won the roll` : 'Everyone passed';
+        this.gameClient.uiManager.addSystemMessage(outcome);
+    }
+    
     handleInteractionResult(data) {
         this.gameClient.interactionManager.handleInteractionResult(data.result);
     }
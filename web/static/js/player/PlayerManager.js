@@ -16,7 +16,8 @@ export class PlayerManager {
             moving: false,
             showInteractionHint: false,
             sprinting: false,
-            lastSprintTime: 0
+            lastSprintTime: 0,
+            state: playerData.state || 'alive'
         };
         
         this.players.set(playerData.id, player);
@@ -27,6 +28,13 @@ export class PlayerManager {
         this.players.delete(playerId);
     }
     
+    setPlayerState(playerId, state) {
+        const player = this.players.get(playerId);
+        if (player) {
+            player.state = state;
+        }
+    }
+    
     updatePlayerPosition(data) {
         const player = this.players.get(data.id);
         if (player) {
@@ -53,6 +61,7 @@ export class PlayerManager {
                     const player = this.players.get(playerData.id);
                     player.targetX = playerData.x;
                     player.targetY = playerData.y;
+                    player.state = playerData.state || 'alive';
                 }
             });
         }
@@ -76,6 +85,18 @@ export class PlayerManager {
             newY = Math.max(margin, Math.min(canvas.height - margin, newY));
         }
         
+        // Predict map collision, sliding along blocked tiles like the server
+        const renderManager = gameClient.renderManager;
+        if (renderManager.isBlocked(newX, newY)) {
+            if (!renderManager.isBlocked(newX, myPlayer.y)) {
+                newY = myPlayer.y;
+            } else if (!renderManager.isBlocked(myPlayer.x, newY)) {
+                newX = myPlayer.x;
+            } else {
+                return;
+            }
+        }
+        
         if (newX !== myPlayer.x || newY !== myPlayer.y) {
             myPlayer.x = newX;
             myPlayer.y = newY;
@@ -22,6 +22,12 @@ export class StaminaSystem {
         console.log('Sprint stopped');
     }
     
+    // sync takes the server's stamina after it was spent on an ability
+    sync(stamina) {
+        this.stamina = Math.min(this.maxStamina, stamina);
+        this.updateStaminaDisplay();
+    }
+    
     isSprintActive() {
         return this.isRunning && this.canSprint && this.stamina > 0;
     }
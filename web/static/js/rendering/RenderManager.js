@@ -5,6 +5,37 @@ export class RenderManager {
         this.gameClient = gameClient;
         this.windParticles = [];
         this.interpolationFactor = 0.15;
+        this.map = null;
+        this.phase = 'day';
+        this.weather = 'clear';
+        this.tileColors = {
+            grass: '#2d5a27',
+            path: '#8b7355',
+            water: '#1f4e79',
+            wall: '#4a4a4a',
+            tree: '#1b3d17',
+            floor: '#6b5344',
+            sand: '#c2b280'
+        };
+    }
+    
+    setMap(mapData) {
+        this.map = mapData;
+    }
+    
+    getMap() {
+        return this.map;
+    }
+    
+    isBlocked(x, y) {
+        if (!this.map) return false;
+        
+        const tileX = Math.floor(x / this.map.tile_width);
+        const tileY = Math.floor(y / this.map.tile_height);
+        if (tileX < 0 || tileY < 0 || tileX >= this.map.width || tileY >= this.map.height) {
+            return true;
+        }
+        return this.map.collision[tileY * this.map.width + tileX] === 1;
     }
     
     setupCanvas() {
@@ -31,8 +62,22 @@ export class RenderManager {
         this.ctx.fillStyle = '#1a1a2e';
         this.ctx.fillRect(0, 0, this.canvas.width, this.canvas.height);
         
-        // Draw grid
-        this.drawGrid();
+        // Draw map tiles, falling back to the grid on an unbounded world
+        if (this.map) {
+            this.drawMap();
+        } else {
+            this.drawGrid();
+        }
+        
+        // Draw click-to-move destination
+        this.drawMoveTarget();
+        
+        // Draw resource nodes and items on the ground beneath everything else
+        this.gameClient.getEntityManager().getAllResources().forEach(resource => this.drawResource(resource));
+        this.gameClient.getEntityManager().getAllItems().forEach(item => this.drawItem(item));
+        
+        // Draw NPCs beneath players
+        this.gameClient.getEntityManager().getAllNPCs().forEach(npc => this.drawNPC(npc));
         
         // Update and draw wind particles
         this.updateWindParticles();
@@ -48,6 +93,34 @@ export class RenderManager {
                 this.createSprintParticles(player.x, player.y);
             }
         });
+        
+        // Darken the night and dim the light in bad weather
+        this.drawEnvironment();
+    }
+    
+    setEnvironment(phase, weather) {
+        if (phase) this.phase = phase;
+        if (weather) this.weather = weather;
+    }
+    
+    drawEnvironment() {
+        const darkness = { dawn: 0.15, day: 0, dusk: 0.2, night: 0.45 }[this.phase] || 0;
+        const overlays = {
+            rain: 'rgba(60, 70, 90, 0.2)',
+            storm: 'rgba(30, 35, 50, 0.35)',
+            fog: 'rgba(200, 200, 210, 0.35)'
+        };
+        
+        this.ctx.save();
+        if (darkness > 0) {
+            this.ctx.fillStyle = `rgba(10, 10, 40, ${darkness})`;
+            this.ctx.fillRect(0, 0, this.canvas.width, this.canvas.height);
+        }
+        if (overlays[this.weather]) {
+            this.ctx.fillStyle = overlays[this.weather];
+            this.ctx.fillRect(0, 0, this.canvas.width, this.canvas.height);
+        }
+        this.ctx.restore();
     }
     
     drawGrid() {
@@ -73,12 +146,159 @@ export class RenderManager {
         }
     }
     
+    drawMap() {
+        if (!this.ctx || !this.map) return;
+        
+        const map = this.map;
+        const tileWidth = map.tile_width;
+        const tileHeight = map.tile_height;
+        const endX = Math.min(map.width, Math.ceil(this.canvas.width / tileWidth));
+        const endY = Math.min(map.height, Math.ceil(this.canvas.height / tileHeight));
+        
+        (map.layers || []).forEach(layer => {
+            for (let y = 0; y < endY; y++) {
+                for (let x = 0; x < endX; x++) {
+                    const gid = layer.data[y * map.width + x];
+                    if (!gid) continue;
+                    
+                    const tileType = map.tile_types ? map.tile_types[gid] : null;
+                    this.ctx.fillStyle = this.tileColors[tileType] || '#2d5a27';
+                    this.ctx.fillRect(x * tileWidth, y * tileHeight, tileWidth, tileHeight);
+                }
+            }
+        });
+        
+        // Subtle tile grid on top of the terrain
+        this.ctx.strokeStyle = 'rgba(0, 0, 0, 0.08)';
+        this.ctx.lineWidth = 1;
+        for (let y = 0; y < endY; y++) {
+            for (let x = 0; x < endX; x++) {
+                this.ctx.strokeRect(x * tileWidth, y * tileHeight, tileWidth, tileHeight);
+            }
+        }
+        
+        // Region labels
+        this.ctx.save();
+        this.ctx.font = 'italic 12px Arial';
+        this.ctx.fillStyle = 'rgba(255, 255, 255, 0.5)';
+        (map.regions || []).forEach(region => {
+            if (region.type !== 'region' || !region.name) return;
+            this.ctx.fillText(region.name, region.bounds.x + 6, region.bounds.y + 16);
+        });
+        this.ctx.restore();
+    }
+    
+    drawMoveTarget() {
+        const target = this.gameClient.getMoveTarget();
+        if (!this.ctx || !target) return;
+        
+        const pulse = 6 + 3 * Math.sin(Date.now() * 0.008);
+        this.ctx.save();
+        this.ctx.strokeStyle = '#ffff00';
+        this.ctx.lineWidth = 2;
+        this.ctx.globalAlpha = 0.8;
+        this.ctx.beginPath();
+        this.ctx.arc(target.x, target.y, pulse, 0, Math.PI * 2);
+        this.ctx.stroke();
+        this.ctx.restore();
+    }
+    
+    drawItem(item) {
+        if (!this.ctx) return;
+        
+        this.ctx.save();
+        this.ctx.fillStyle = '#f1c40f';
+        this.ctx.strokeStyle = '#7d5a00';
+        this.ctx.lineWidth = 2;
+        this.ctx.beginPath();
+        this.ctx.moveTo(item.x, item.y - 8);
+        this.ctx.lineTo(item.x + 8, item.y);
+        this.ctx.lineTo(item.x, item.y + 8);
+        this.ctx.lineTo(item.x - 8, item.y);
+        this.ctx.closePath();
+        this.ctx.fill();
+        this.ctx.stroke();
+        
+        const label = item.quantity > 1 ? `${item.name} x${item.quantity}` : item.name;
+        this.ctx.font = '10px Arial';
+        this.ctx.textAlign = 'center';
+        this.ctx.fillStyle = '#ffffff';
+        this.ctx.fillText(label, item.x, item.y - 12);
+        this.ctx.restore();
+    }
+    
+    drawResource(resource) {
+        if (!this.ctx) return;
+        
+        this.ctx.save();
+        this.ctx.globalAlpha = resource.depleted ? 0.35 : 1;
+        this.ctx.fillStyle = resource.profession === 'mining' ? '#8e8e8e' : '#2e7d32';
+        this.ctx.strokeStyle = '#1b1b1b';
+        this.ctx.lineWidth = 2;
+        this.ctx.beginPath();
+        if (resource.profession === 'mining') {
+            this.ctx.moveTo(resource.x - 12, resource.y + 10);
+            this.ctx.lineTo(resource.x - 6, resource.y - 10);
+            this.ctx.lineTo(resource.x + 8, resource.y - 8);
+            this.ctx.lineTo(resource.x + 12, resource.y + 10);
+        } else {
+            this.ctx.moveTo(resource.x, resource.y - 14);
+            this.ctx.lineTo(resource.x + 12, resource.y + 10);
+            this.ctx.lineTo(resource.x - 12, resource.y + 10);
+        }
+        this.ctx.closePath();
+        this.ctx.fill();
+        this.ctx.stroke();
+        
+        this.ctx.font = '10px Arial';
+        this.ctx.textAlign = 'center';
+        this.ctx.fillStyle = '#ffffff';
+        this.ctx.fillText(resource.name, resource.x, resource.y - 18);
+        this.ctx.restore();
+    }
+    
+    drawNPC(npc) {
+        if (!this.ctx) return;
+        
+        const size = 28;
+        
+        this.ctx.save();
+        this.ctx.fillStyle = '#c0392b';
+        this.ctx.strokeStyle = '#ffffff';
+        this.ctx.lineWidth = 2;
+        this.ctx.fillRect(npc.x - size / 2, npc.y - size / 2, size, size);
+        this.ctx.strokeRect(npc.x - size / 2, npc.y - size / 2, size, size);
+        
+        this.ctx.font = 'bold 12px Arial';
+        this.ctx.textAlign = 'center';
+        this.ctx.fillStyle = '#ffd700';
+        this.ctx.fillText(npc.name, npc.x, npc.y - size / 2 - 6);
+        
+        // Health bar for NPCs that can be fought
+        if (npc.maxHealth > 0) {
+            const ratio = Math.max(0, npc.health / npc.maxHealth);
+            this.ctx.fillStyle = '#330000';
+            this.ctx.fillRect(npc.x - size / 2, npc.y + size / 2 + 4, size, 4);
+            this.ctx.fillStyle = '#e74c3c';
+            this.ctx.fillRect(npc.x - size / 2, npc.y + size / 2 + 4, size * ratio, 4);
+        }
+        this.ctx.restore();
+    }
+    
     drawPlayer(player) {
         if (!this.ctx) return;
         
         const radius = 20;
         const myPlayer = this.gameClient.getMyPlayer();
         
+        // Corpses and ghosts are drawn faded
+        this.ctx.save();
+        if (player.state === 'dead') {
+            this.ctx.globalAlpha = 0.5;
+        } else if (player.state === 'ghost') {
+            this.ctx.globalAlpha = 0.35;
+        }
+        
         // Draw shadow
         this.ctx.save();
         this.ctx.globalAlpha = 0.3;
@@ -182,6 +402,8 @@ export class RenderManager {
             this.ctx.fillText('Click to interact', player.x, player.y + radius + 33);
             this.ctx.restore();
         }
+        
+        this.ctx.restore();
     }
     
     createSprintParticles(x, y) {
@@ -4,11 +4,22 @@ export class UIManager {
         this.chatInput = document.getElementById('chatInput');
         this.chatMessages = document.getElementById('chatMessages');
         this.sendButton = document.getElementById('sendButton');
+        this.quests = new Map();
+        this.shop = null;
+        this.recipes = [];
+        this.auction = null;
+        this.abilities = [];
+        this.cooldowns = new Map();
+        this.level = 1;
+        this.castTimer = null;
+        this.effects = new Map();
+        this.moveSpeed = 1;
     }
     
     setupUI() {
         this.setupUIHandlers();
         this.populateUI();
+        setInterval(() => this.renderEffects(), 1000);
     }
     
     populateUI() {
@@ -101,6 +112,17 @@ export class UIManager {
             });
         }
         
+        // Shop close handler
+        const shopClose = document.getElementById('shopClose');
+        if (shopClose) {
+            shopClose.addEventListener('click', () => {
+                this.hideShop();
+            });
+        }
+        
+        this.setupAuctionHandlers();
+        this.setupDeathHandlers();
+        
         // Chat tab handlers
         document.querySelectorAll('.chat-tab').forEach(tab => {
             tab.addEventListener('click', () => {
@@ -114,7 +136,94 @@ export class UIManager {
         if (!this.chatInput) return;
         
         const message = this.chatInput.value.trim();
-        if (message) {
+        if (message === '/leave') {
+            this.gameClient.getNetworkManager().sendMessage({ type: 'party_leave' });
+            this.chatInput.value = '';
+        } else if (message === '/mail') {
+            this.gameClient.getNetworkManager().sendMessage({ type: 'mail_list' });
+            this.chatInput.value = '';
+        } else if (message.startsWith('/mail take ')) {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'mail_take',
+                id: parseInt(message.slice('/mail take '.length), 10)
+            });
+            this.chatInput.value = '';
+        } else if (message.startsWith('/mail return ')) {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'mail_return',
+                id: parseInt(message.slice('/mail return '.length), 10)
+            });
+            this.chatInput.value = '';
+        } else if (message.startsWith('/mail delete ')) {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'mail_delete',
+                id: parseInt(message.slice('/mail delete '.length), 10)
+            });
+            this.chatInput.value = '';
+        } else if (message.startsWith('/mail send ')) {
+            this.sendMail(message.slice('/mail send '.length));
+            this.chatInput.value = '';
+        } else if (message === '/recipes') {
+            this.listRecipes();
+            this.chatInput.value = '';
+        } else if (message.startsWith('/craft ')) {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'craft',
+                recipe_id: message.slice('/craft '.length).trim()
+            });
+            this.chatInput.value = '';
+        } else if (message === '/bind') {
+            this.gameClient.getNetworkManager().sendMessage({ type: 'bind' });
+            this.chatInput.value = '';
+        } else if (message === '/pvp on' || message === '/pvp off') {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'pvp_flag',
+                enabled: message === '/pvp on'
+            });
+            this.chatInput.value = '';
+        } else if (message === '/duel accept' || message === '/duel decline') {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: message === '/duel accept' ? 'duel_accept' : 'duel_decline'
+            });
+            this.chatInput.value = '';
+        } else if (message === '/achievements') {
+            this.gameClient.getNetworkManager().sendMessage({ type: 'achievements' });
+            this.chatInput.value = '';
+        } else if (message === '/title' || message.startsWith('/title ')) {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'set_title',
+                title: message.slice('/title'.length).trim()
+            });
+            this.chatInput.value = '';
+        } else if (message === '/stats') {
+            this.gameClient.getNetworkManager().sendMessage({ type: 'statistics' });
+            this.chatInput.value = '';
+        } else if (message.startsWith('/leaderboard')) {
+            // /leaderboard <stat> [season|all] [page]
+            const [stat, season, page] = message.slice('/leaderboard'.length).trim().split(/\s+/);
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'leaderboard',
+                stat: stat || 'kills',
+                season: season || '',
+                page: page ? parseInt(page, 10) - 1 : 0
+            });
+            this.chatInput.value = '';
+        } else if (message.startsWith('/emote ')) {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'emote',
+                emote: message.slice('/emote '.length).trim()
+            });
+            this.chatInput.value = '';
+        } else if (message.startsWith('/cancel ')) {
+            this.cancelEffect(message.slice('/cancel '.length).trim());
+            this.chatInput.value = '';
+        } else if (message.startsWith('/loot ')) {
+            this.gameClient.getNetworkManager().sendMessage({
+                type: 'party_loot_mode',
+                mode: message.slice('/loot '.length).trim()
+            });
+            this.chatInput.value = '';
+        } else if (message) {
             this.gameClient.getNetworkManager().sendMessage({
                 type: 'chat',
                 message: message
@@ -141,6 +250,669 @@ export class UIManager {
         }
     }
     
+    updateInventory(data) {
+        const container = document.getElementById('inventorySlots');
+        if (!container) return;
+        
+        container.innerHTML = '';
+        const slots = new Map(data.slots.map(slot => [slot.slot, slot]));
+        
+        for (let i = 0; i < data.size; i++) {
+            const slotDiv = document.createElement('div');
+            slotDiv.className = 'inventory-slot';
+            
+            const stack = slots.get(i);
+            if (stack) {
+                slotDiv.title = stack.value > 0
+                    ? `${stack.name} (right-click to drop, click to sell for ${stack.value} each while trading)`
+                    : `${stack.name} (right-click to drop)`;
+                slotDiv.innerHTML = `${stack.name}<span class="quantity">${stack.quantity}</span>`;
+                slotDiv.addEventListener('contextmenu', (e) => {
+                    e.preventDefault();
+                    this.gameClient.getNetworkManager().sendMessage({
+                        type: 'drop_item',
+                        slot: i,
+                        quantity: stack.quantity
+                    });
+                });
+                slotDiv.addEventListener('click', () => {
+                    if (this.auction) {
+                        this.selectAuctionItem(i, stack);
+                        return;
+                    }
+                    if (!this.shop || stack.value <= 0) return;
+                    this.gameClient.getNetworkManager().sendMessage({
+                        type: 'shop_sell',
+                        slot: i,
+                        quantity: stack.quantity
+                    });
+                });
+            }
+            
+            container.appendChild(slotDiv);
+        }
+    }
+    
+    updateProgress(data) {
+        this.level = data.level;
+        this.renderAbilities();
+        const level = document.getElementById('level');
+        if (level) {
+            level.textContent = `Lv ${data.level} (${data.experience}/${data.experience_to_level})`;
+        }
+    }
+    
+    updateWallet(data) {
+        const currency = document.getElementById('currency');
+        if (currency) {
+            currency.textContent = data.balance;
+        }
+    }
+    
+    updateProfessions(data) {
+        const professions = document.getElementById('professions');
+        if (professions) {
+            professions.textContent = data.professions.length === 0
+                ? 'No professions'
+                : data.professions.map(skill => `${skill.profession} ${skill.level}`).join(', ');
+        }
+    }
+    
+    updateVitals(data) {
+        const health = document.getElementById('health');
+        if (health) {
+            health.textContent = `${data.health}/${data.max_health}`;
+        }
+        const mana = document.getElementById('mana');
+        if (mana) {
+            mana.textContent = `${data.mana}/${data.max_mana}`;
+        }
+    }
+    
+    setAbilities(abilities) {
+        this.abilities = abilities;
+        this.renderAbilities();
+    }
+    
+    renderAbilities() {
+        const bar = document.getElementById('abilityBar');
+        if (!bar) return;
+        
+        bar.innerHTML = '';
+        this.abilities.slice(0, 9).forEach((ability, index) => {
+            const slot = document.createElement('div');
+            slot.className = 'ability-slot';
+            if (ability.level > this.level) {
+                slot.classList.add('locked');
+            }
+            if ((this.cooldowns.get(ability.id) || 0) > Date.now()) {
+                slot.classList.add('cooling');
+            }
+            const costs = [];
+            if (ability.mana > 0) costs.push(`${ability.mana} mana`);
+            if (ability.stamina > 0) costs.push(`${ability.stamina} stamina`);
+            slot.title = `${ability.name} (level ${ability.level}) ${costs.join(', ')}`;
+            slot.innerHTML = `<span class="ability-key">${index + 1}</span><span class="ability-name">${ability.name}</span>`;
+            slot.addEventListener('click', () => this.castAbility(index));
+            bar.appendChild(slot);
+        });
+    }
+    
+    // castAbility casts the ability in a hotbar slot: harmful abilities at
+    // the last creature attacked, ground abilities at the mouse pointer
+    castAbility(index) {
+        const ability = this.abilities[index];
+        if (!ability) return;
+        
+        const input = this.gameClient.inputManager;
+        const message = { type: 'cast', ability_id: ability.id };
+        if (ability.targeting === 'target' && ability.hostile) {
+            message.target_id = input.targetId || '';
+        } else if (ability.targeting === 'ground') {
+            message.x = input.mouse.x;
+            message.y = input.mouse.y;
+        }
+        this.gameClient.getNetworkManager().sendMessage(message);
+    }
+    
+    startAbilityCooldown(abilityId, seconds) {
+        this.cooldowns.set(abilityId, Date.now() + seconds * 1000);
+        this.renderAbilities();
+        setTimeout(() => this.renderAbilities(), seconds * 1000);
+    }
+    
+    updateStats(data) {
+        this.moveSpeed = data.speed;
+    }
+    
+    setEffects(effects) {
+        this.effects.clear();
+        effects.forEach(effect => this.addEffect(effect));
+    }
+    
+    addEffect(effect) {
+        this.effects.set(effect.effect_id, {
+            ...effect,
+            expires: Date.now() + effect.seconds * 1000
+        });
+        this.renderEffects();
+    }
+    
+    removeEffect(effectId) {
+        this.effects.delete(effectId);
+        this.renderEffects();
+    }
+    
+    renderEffects() {
+        const list = document.getElementById('effects');
+        if (!list) return;
+        
+        const now = Date.now();
+        const shown = [...this.effects.values()].map(effect => {
+            const seconds = Math.max(0, Math.ceil((effect.expires - now) / 1000));
+            const stacks = effect.stacks > 1 ? ` x${effect.stacks}` : '';
+            const remaining = seconds >= 60 ? `${Math.ceil(seconds / 60)}m` : `${seconds}s`;
+            const color = effect.debuff ? '#e74c3c' : '#2ecc71';
+            return `<span style="color: ${color};" title="${effect.effect_id}">${effect.name}${stacks} (${remaining})</span>`;
+        });
+        list.innerHTML = shown.length > 0 ? shown.join(', ') : 'None';
+    }
+    
+    cancelEffect(name) {
+        const wanted = name.toLowerCase();
+        const effect = [...this.effects.values()].find(effect =>
+            effect.effect_id === wanted || effect.name.toLowerCase() === wanted);
+        if (!effect) {
+            this.addSystemMessage(`You have no effect called ${name}`);
+            return;
+        }
+        this.gameClient.getNetworkManager().sendMessage({
+            type: 'effect_cancel',
+            effect_id: effect.effect_id
+        });
+    }
+    
+    setupDeathHandlers() {
+        const buttons = {
+            releaseSpirit: 'release_spirit',
+            reviveAtCorpse: 'revive_at_corpse',
+            acceptResurrect: 'resurrect_accept'
+        };
+        Object.entries(buttons).forEach(([id, type]) => {
+            const button = document.getElementById(id);
+            if (button) {
+                button.addEventListener('click', () => {
+                    this.gameClient.getNetworkManager().sendMessage({ type });
+                });
+            }
+        });
+    }
+    
+    showDeathState(data) {
+        const panel = document.getElementById('deathPanel');
+        const message = document.getElementById('deathMessage');
+        if (!panel || !message) return;
+        
+        if (data.state === 'alive') {
+            panel.style.display = 'none';
+            return;
+        }
+        
+        panel.style.display = 'block';
+        message.textContent = data.state === 'dead'
+            ? 'You have died.'
+            : 'You are a ghost. Return to your corpse to come back to life.';
+        document.getElementById('releaseSpirit').style.display = data.state === 'dead' ? 'block' : 'none';
+        document.getElementById('reviveAtCorpse').style.display = data.state === 'ghost' ? 'block' : 'none';
+        document.getElementById('acceptResurrect').style.display = 'none';
+    }
+    
+    showResurrectOffer(data) {
+        const button = document.getElementById('acceptResurrect');
+        if (!button) return;
+        
+        this.addSystemMessage(`${data.caster_name} offers to resurrect you with ${data.percent}% health`);
+        button.style.display = 'block';
+        setTimeout(() => {
+            button.style.display = 'none';
+        }, data.seconds * 1000);
+    }
+    
+    showWorldTime(data) {
+        // Keep the clock running between the server's periodic syncs
+        clearInterval(this.clockTimer);
+        const synced = Date.now();
+        const hoursPerMs = 24 / (data.day_length_seconds * 1000);
+        const update = () => {
+            const hour = (data.hour + (Date.now() - synced) * hoursPerMs) % 24;
+            const hh = String(Math.floor(hour)).padStart(2, '0');
+            const mm = String(Math.floor((hour % 1) * 60)).padStart(2, '0');
+            const clock = document.getElementById('worldTime');
+            if (clock) clock.textContent = `Day ${data.day} ${hh}:${mm}`;
+        };
+        update();
+        this.clockTimer = setInterval(update, 1000);
+    }
+    
+    showWeather(data) {
+        const weather = document.getElementById('weather');
+        if (weather) {
+            const icons = { clear: '☀️', rain: '🌧️', storm: '⛈️', fog: '🌫️' };
+            weather.textContent = `${icons[data.weather] || ''} ${data.weather}`;
+        }
+        if (data.previous && data.previous !== data.weather) {
+            this.addSystemMessage(`The weather turns to ${data.weather}`);
+        }
+    }
+    
+    showPvPStatus(data) {
+        const status = document.getElementById('pvpStatus');
+        if (!status) return;
+        
+        const rules = {
+            sanctuary: 'Sanctuary',
+            duel: 'Duels only',
+            flagged: 'Flagged PvP',
+            ffa: 'Free-for-all'
+        };
+        let text = rules[data.rule] || data.rule;
+        if (data.flagged) {
+            text += data.enabled ? ' (flagged)' : ` (flagged ${Math.ceil(data.flag_seconds)}s)`;
+        }
+        if (data.duel_opponent) {
+            text += ' (dueling)';
+        }
+        status.textContent = text;
+    }
+    
+    showStatistics(data) {
+        const format = (stat, value) => {
+            if (stat === 'play_time') return `${Math.floor(value / 3600)}h ${Math.floor(value / 60) % 60}m`;
+            if (stat === 'distance_walked') return `${Math.round(value / 32)} tiles`;
+            return Math.round(value);
+        };
+        this.addSystemMessage(`Statistics for season ${data.season} (all time):`);
+        Object.keys(data.seasonal).forEach(stat => {
+            this.addSystemMessage(`${stat.replace(/_/g, ' ')}: ${format(stat, data.seasonal[stat])} (${format(stat, data.lifetime[stat])})`);
+        });
+    }
+    
+    showAchievements(data) {
+        const earned = data.achievements.filter(achievement => achievement.unlocked).length;
+        this.addSystemMessage(`Achievements (${earned}/${data.achievements.length}):`);
+        data.achievements.forEach(achievement => {
+            const progress = achievement.goals
+                .map((goal, i) => `${Math.min(Math.floor(achievement.progress[i]), goal)}/${goal}`)
+                .join(', ');
+            const state = achievement.unlocked ? '✔' : progress;
+            this.addSystemMessage(`${achievement.name} - ${achievement.description} [${state}]`);
+        });
+        if (data.titles.length > 0) {
+            this.addSystemMessage(`Titles: ${data.titles.join(', ')}. Type /title <title> to show one`);
+        }
+    }
+    
+    showLeaderboard(data) {
+        const season = data.season === 'all' ? 'all time' : `season ${data.season}`;
+        this.addSystemMessage(`${data.stat.replace(/_/g, ' ')} leaderboard, ${season} (page ${data.page + 1}/${Math.max(data.pages, 1)}):`);
+        if (data.entries.length === 0) {
+            this.addSystemMessage('Nobody is on this page yet');
+        }
+        data.entries.forEach(entry => {
+            this.addSystemMessage(`${entry.rank}. ${entry.name} - ${Math.round(entry.value)}`);
+        });
+    }
+    
+    showCastBar(name, seconds) {
+        const bar = document.getElementById('castBar');
+        const fill = document.getElementById('castBarFill');
+        const label = document.getElementById('castBarName');
+        if (!bar || !fill || !label) return;
+        
+        clearInterval(this.castTimer);
+        const started = Date.now();
+        label.textContent = name;
+        bar.style.display = 'block';
+        this.castTimer = setInterval(() => {
+            const progress = Math.min(1, (Date.now() - started) / (seconds * 1000));
+            fill.style.width = `${progress * 100}%`;
+        }, 50);
+    }
+    
+    hideCastBar() {
+        clearInterval(this.castTimer);
+        const bar = document.getElementById('castBar');
+        if (bar) {
+            bar.style.display = 'none';
+        }
+    }
+    
+    setRecipes(recipes) {
+        this.recipes = recipes.slice().sort((a, b) => a.id.localeCompare(b.id));
+    }
+    
+    listRecipes() {
+        if (this.recipes.length === 0) {
+            this.addSystemMessage('You know no recipes');
+            return;
+        }
+        this.recipes.forEach(recipe => {
+            const inputs = recipe.inputs.map(input => `${input.quantity} ${input.item}`).join(', ');
+            const station = recipe.station ? ` at a ${recipe.station}` : '';
+            this.addSystemMessage(`/craft ${recipe.id}: ${inputs} (${recipe.profession} ${recipe.skill}${station})`);
+        });
+    }
+    
+    setQuests(quests) {
+        this.quests = new Map(quests.map(quest => [quest.id, quest]));
+        this.renderQuests();
+    }
+    
+    addQuest(quest) {
+        this.quests.set(quest.id, quest);
+        this.renderQuests();
+    }
+    
+    removeQuest(questID) {
+        this.quests.delete(questID);
+        this.renderQuests();
+    }
+    
+    updateQuestProgress(data) {
+        const quest = this.quests.get(data.quest_id);
+        if (!quest) return;
+        
+        quest.objectives[data.objective].count = data.count;
+        quest.complete = data.complete;
+        this.renderQuests();
+    }
+    
+    renderQuests() {
+        const container = document.getElementById('questList');
+        if (!container) return;
+        
+        container.innerHTML = '';
+        for (const quest of this.quests.values()) {
+            const entry = document.createElement('div');
+            entry.className = quest.complete ? 'quest-entry complete' : 'quest-entry';
+            entry.title = quest.description;
+            
+            const abandon = document.createElement('button');
+            abandon.className = 'quest-abandon';
+            abandon.textContent = '×';
+            abandon.title = 'Abandon quest';
+            abandon.addEventListener('click', () => {
+                if (confirm(`Abandon ${quest.name}?`)) {
+                    this.gameClient.getNetworkManager().sendMessage({
+                        type: 'quest_abandon',
+                        quest_id: quest.id
+                    });
+                }
+            });
+            entry.appendChild(abandon);
+            
+            const name = document.createElement('div');
+            name.className = 'quest-name';
+            name.textContent = quest.name;
+            entry.appendChild(name);
+            
+            quest.objectives.forEach(objective => {
+                const line = document.createElement('div');
+                line.className = 'quest-objective';
+                line.textContent = `${objective.description || objective.target}: ${objective.count}/${objective.required}`;
+                entry.appendChild(line);
+            });
+            
+            container.appendChild(entry);
+        }
+    }
+    
+    showDialogue(data) {
+        const panel = document.getElementById('dialoguePanel');
+        if (!panel) return;
+        
+        document.getElementById('dialogueName').textContent = data.name;
+        document.getElementById('dialogueText').textContent = data.text;
+        
+        const network = this.gameClient.getNetworkManager();
+        const container = document.getElementById('dialogueOptions');
+        container.innerHTML = '';
+        data.options.forEach(option => {
+            const button = document.createElement('button');
+            button.className = 'dialogue-option';
+            button.textContent = `${option.index + 1}. ${option.text}`;
+            button.addEventListener('click', () => {
+                network.sendMessage({ type: 'dialogue_choose', option: option.index });
+            });
+            container.appendChild(button);
+        });
+        
+        if (data.options.length === 0) {
+            const button = document.createElement('button');
+            button.className = 'dialogue-option';
+            button.textContent = 'Goodbye.';
+            button.addEventListener('click', () => {
+                network.sendMessage({ type: 'dialogue_close' });
+            });
+            container.appendChild(button);
+        }
+        
+        panel.style.display = 'block';
+    }
+    
+    showShop(data) {
+        const panel = document.getElementById('shopPanel');
+        if (!panel) return;
+        
+        this.shop = data.shop;
+        document.getElementById('shopName').textContent = data.name;
+        
+        const network = this.gameClient.getNetworkManager();
+        const wares = document.getElementById('shopItems');
+        wares.innerHTML = '';
+        data.items.forEach(item => {
+            const button = document.createElement('button');
+            button.className = 'shop-item';
+            const stock = item.stock < 0 ? '' : ` (${item.stock} left)`;
+            button.textContent = `${item.name} - ${item.price} coins${stock}`;
+            button.title = 'Click to buy one, shift-click to buy five';
+            button.disabled = item.stock === 0;
+            button.addEventListener('click', (e) => {
+                network.sendMessage({ type: 'shop_buy', item_id: item.item_id, quantity: e.shiftKey ? 5 : 1 });
+            });
+            wares.appendChild(button);
+        });
+        
+        const buyback = document.getElementById('shopBuyback');
+        buyback.innerHTML = '';
+        data.buyback.forEach(entry => {
+            const button = document.createElement('button');
+            button.className = 'shop-item';
+            button.textContent = `${entry.name} x${entry.quantity} - ${entry.price} coins`;
+            button.addEventListener('click', () => {
+                network.sendMessage({ type: 'shop_buyback', index: entry.index });
+            });
+            buyback.appendChild(button);
+        });
+        document.getElementById('shopBuybackTitle').style.display = data.buyback.length > 0 ? 'block' : 'none';
+        
+        panel.style.display = 'block';
+    }
+    
+    hideShop() {
+        const panel = document.getElementById('shopPanel');
+        if (panel && this.shop) {
+            panel.style.display = 'none';
+            this.shop = null;
+            this.gameClient.getNetworkManager().sendMessage({ type: 'shop_close' });
+        }
+    }
+    
+    setupAuctionHandlers() {
+        const network = this.gameClient.getNetworkManager();
+        const bind = (id, handler) => {
+            const element = document.getElementById(id);
+            if (element) element.addEventListener('click', handler);
+        };
+        
+        bind('auctionClose', () => this.hideAuction());
+        bind('auctionSearchButton', () => this.searchAuctions({ text: document.getElementById('auctionText').value, page: 0 }));
+        bind('auctionMine', () => this.searchAuctions({ mine: true, page: 0 }));
+        bind('auctionPrev', () => this.searchAuctions({ ...this.auction.query, page: Math.max(this.auction.page - 1, 0) }));
+        bind('auctionNext', () => this.searchAuctions({ ...this.auction.query, page: Math.min(this.auction.page + 1, this.auction.pages - 1) }));
+        bind('auctionPost', () => {
+            if (!this.auction || !this.auction.sell) {
+                this.addSystemMessage('Click an inventory item to sell first');
+                return;
+            }
+            network.sendMessage({
+                type: 'auction_list',
+                slot: this.auction.sell.slot,
+                quantity: this.auction.sell.quantity,
+                buyout: parseInt(document.getElementById('auctionBuyout').value, 10) || 0,
+                min_bid: parseInt(document.getElementById('auctionBid').value, 10) || 0,
+                hours: parseInt(document.getElementById('auctionHours').value, 10)
+            });
+            this.auction.sell = null;
+            document.getElementById('auctionSellItem').textContent = '(click an inventory item)';
+        });
+    }
+    
+    showAuction() {
+        const panel = document.getElementById('auctionPanel');
+        if (!panel) return;
+        
+        this.auction = { query: { page: 0 }, page: 0, pages: 1, sell: null };
+        panel.style.display = 'block';
+        this.searchAuctions(this.auction.query);
+    }
+    
+    searchAuctions(query) {
+        if (!this.auction) return;
+        this.auction.query = query;
+        this.gameClient.getNetworkManager().sendMessage({ type: 'auction_search', ...query });
+    }
+    
+    refreshAuction() {
+        if (this.auction) {
+            this.searchAuctions(this.auction.query);
+        }
+    }
+    
+    selectAuctionItem(slot, stack) {
+        this.auction.sell = { slot: slot, quantity: stack.quantity };
+        document.getElementById('auctionSellItem').textContent = `${stack.name} x${stack.quantity}`;
+    }
+    
+    showAuctionResults(data) {
+        if (!this.auction) return;
+        
+        this.auction.page = data.page;
+        this.auction.pages = Math.max(data.pages, 1);
+        document.getElementById('auctionPage').textContent = `${data.page + 1}/${this.auction.pages}`;
+        
+        const network = this.gameClient.getNetworkManager();
+        const myName = this.gameClient.getMyPlayer() ? this.gameClient.getMyPlayer().name : '';
+        const results = document.getElementById('auctionResults');
+        results.innerHTML = '';
+        if (data.listings.length === 0) {
+            results.textContent = 'No auctions found';
+            return;
+        }
+        
+        data.listings.forEach(listing => {
+            const row = document.createElement('div');
+            row.className = listing.your_bid ? 'auction-listing your-bid' : 'auction-listing';
+            
+            const hours = Math.max(Math.ceil(listing.expires_in / 3600), 1);
+            const label = document.createElement('span');
+            const bid = listing.biddable ? ` bid ${listing.bid || '-'}` : '';
+            label.textContent = `${listing.name} x${listing.quantity} -${bid} buyout ${listing.buyout} (${hours}h, ${listing.seller})`;
+            row.appendChild(label);
+            
+            const addButton = (text, message) => {
+                const button = document.createElement('button');
+                button.textContent = text;
+                button.addEventListener('click', () => network.sendMessage(message));
+                row.appendChild(button);
+            };
+            if (listing.seller === myName) {
+                addButton('Cancel', { type: 'auction_cancel', id: listing.id });
+            } else {
+                if (listing.biddable && !listing.your_bid) {
+                    addButton(`Bid ${listing.next_bid}`, { type: 'auction_bid', id: listing.id, amount: listing.next_bid });
+                }
+                addButton('Buy', { type: 'auction_buyout', id: listing.id });
+            }
+            results.appendChild(row);
+        });
+    }
+    
+    hideAuction() {
+        const panel = document.getElementById('auctionPanel');
+        if (panel && this.auction) {
+            panel.style.display = 'none';
+            this.auction = null;
+            this.gameClient.getNetworkManager().sendMessage({ type: 'auction_close' });
+        }
+    }
+    
+    // sendMail parses "/mail send <name> [item:<slot>[x<qty>]] [coins:<n>] [cod:<n>] <subject> | <body>";
+    // slots count from 1 along the inventory
+    sendMail(text) {
+        const [head, ...rest] = text.split('|');
+        const words = head.trim().split(/\s+/);
+        const mail = { type: 'mail_send', to: words.shift() || '', items: [], currency: 0, cod: 0, body: rest.join('|').trim() };
+        const subject = [];
+        words.forEach(word => {
+            const item = word.match(/^item:(\d+)(?:x(\d+))?$/);
+            const coins = word.match(/^coins:(\d+)$/);
+            const cod = word.match(/^cod:(\d+)$/);
+            if (item) {
+                mail.items.push({ slot: parseInt(item[1], 10) - 1, quantity: item[2] ? parseInt(item[2], 10) : 0 });
+            } else if (coins) {
+                mail.currency = parseInt(coins[1], 10);
+            } else if (cod) {
+                mail.cod = parseInt(cod[1], 10);
+            } else {
+                subject.push(word);
+            }
+        });
+        mail.subject = subject.join(' ');
+        this.gameClient.getNetworkManager().sendMessage(mail);
+    }
+    
+    showMail(data) {
+        if (data.mail.length === 0) {
+            this.addSystemMessage('Your mailbox is empty');
+            return;
+        }
+        data.mail.forEach(mail => {
+            const attachments = mail.items.map(item => `${item.quantity} ${item.name}`);
+            if (mail.currency > 0) {
+                attachments.push(`${mail.currency} coins`);
+            }
+            let attached = '';
+            if (attachments.length > 0) {
+                const price = mail.cod > 0 ? ` for ${mail.cod} coins COD` : '';
+                attached = ` [${attachments.join(', ')}${price}] /mail take ${mail.id}`;
+            } else {
+                attached = ` /mail delete ${mail.id}`;
+            }
+            const unread = mail.read ? '' : ' (new)';
+            const returned = mail.returned ? ' (returned)' : '';
+            const days = Math.max(0, Math.ceil((mail.expires * 1000 - Date.now()) / 86400000));
+            this.addSystemMessage(`#${mail.id}${unread}${returned} from ${mail.sender}: ${mail.subject} - ${mail.body}${attached} (${days}d left)`);
+        });
+    }
+    
+    hideDialogue() {
+        const panel = document.getElementById('dialoguePanel');
+        if (panel) {
+            panel.style.display = 'none';
+        }
+    }
+    
     addSystemMessage(message) {
         if (!this.chatMessages) return;
         